@@ -12,6 +12,7 @@ import (
 	"github.com/duvrdx/whoami/internal/models"
 	"github.com/duvrdx/whoami/internal/routing"
 	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/services"
 	"github.com/duvrdx/whoami/internal/utils"
 )
 
@@ -19,15 +20,30 @@ func main() {
 	config.Init()
 	config.Connect()
 
-	config.MigrateDB(models.User{}, models.Client{}, models.Group{}, models.Token{},
-		models.RBACRole{}, models.RBACPermission{}, models.RBACResourceType{},
-		models.RBACResourceIdentifier{}, models.Config{})
+	config.MigrateDB(models.User{}, models.Client{}, models.Group{}, models.GroupClosure{}, models.Token{}, models.Session{},
+		models.PersonalAccessToken{}, models.MFAFactor{}, models.Invitation{}, models.LoginChallenge{}, models.ExternalIdentity{},
+		models.FederationState{}, models.LoginRequest{},
+		models.SAMLServiceProvider{}, models.SAMLBrowserSession{}, models.SAMLSession{},
+		models.SAMLIdentityProvider{}, models.SAMLAuthnRequest{}, models.SAMLConsumedAssertion{},
+		models.SCIMToken{}, models.AuditLog{},
+		models.RBACRole{}, models.RBACRoleAssignment{}, models.RBACRoleClosure{}, models.RBACPermission{}, models.RBACResourceType{},
+		models.RBACResourceIdentifier{}, models.RBACApprovalPolicy{}, models.RBACAccessRequest{}, models.RBACAccessRequestEvent{},
+		models.ReBACNamespace{}, models.ReBACTuple{}, models.ReBACChange{},
+		models.Config{})
 
 	e := routing.Routing.GetRoutes(routing.Routing{})
 
 	e.HideBanner = true
 	e.HidePort = true
 
+	// Sem a lista de senhas vazadas toda senha passaria pela verificação
+	if config.Config.Password.Breach.Policy != "off" {
+		if _, err := services.NewBreachChecker(); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+	}
+
 	if detectFirstRun() {
 		if err := firstRun(); err != nil {
 			fmt.Println("Error creating superuser:", err)
@@ -36,11 +52,32 @@ func main() {
 		fmt.Println("Superuser created successfully.")
 	}
 
+	startJobs()
+
 	banner()
 
 	e.Logger.Fatal(e.Start(":7777"))
 }
 
+// startJobs schedules the background jobs enabled in the configuration
+func startJobs() {
+	if config.Config.LDAP.Enabled && config.Config.LDAP.SyncInterval > 0 {
+		ldapService := services.NewLDAPService()
+		utils.RunPeriodically("LDAP sync", time.Duration(config.Config.LDAP.SyncInterval)*time.Second, func() error {
+			_, err := ldapService.Sync()
+			return err
+		})
+	}
+
+	if config.Config.Authz.AssignmentCleanupInterval > 0 {
+		authzRBACService := services.NewAuthzRBACService()
+		utils.RunPeriodically("Role assignment cleanup", time.Duration(config.Config.Authz.AssignmentCleanupInterval)*time.Second, func() error {
+			_, err := authzRBACService.ExpireAssignments()
+			return err
+		})
+	}
+}
+
 func banner() {
 
 	banner := fmt.Sprintf(""+"| Version: %-10s \n"+"| Started: %-30s", "1.0.0", time.Now().Format(time.RFC1123))
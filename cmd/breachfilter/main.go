@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/duvrdx/whoami/internal/utils"
+)
+
+// breachfilter builds the bloom filter used by password.breach.filter_path from a
+// downloaded list of breached password SHA-1 hashes. The input can be a single
+// "HASH:COUNT" file or a directory of 5 character prefix range files.
+func main() {
+	input := flag.String("input", "", "breached password list (file or directory of prefix files)")
+	output := flag.String("output", "breached.bloom", "where to write the filter")
+	falsePositiveRate := flag.Float64("fp", 0.001, "target false positive rate")
+	minCount := flag.Int("min-count", 1, "ignore hashes seen fewer times than this")
+	flag.Parse()
+
+	if *input == "" {
+		fmt.Println("Usage: breachfilter -input <file|dir> [-output breached.bloom] [-fp 0.001] [-min-count 1]")
+		os.Exit(2)
+	}
+
+	sources, err := listSources(*input)
+	if err != nil {
+		fmt.Println("Error reading input:", err)
+		os.Exit(1)
+	}
+
+	// Primeira passada conta as entradas para dimensionar o filtro
+	var total uint64
+	err = eachHash(sources, *minCount, func(digest [20]byte) {
+		total++
+	})
+	if err != nil {
+		fmt.Println("Error reading input:", err)
+		os.Exit(1)
+	}
+
+	filter := utils.NewBloomFilter(total, *falsePositiveRate)
+
+	err = eachHash(sources, *minCount, func(digest [20]byte) {
+		filter.Add(digest)
+	})
+	if err != nil {
+		fmt.Println("Error reading input:", err)
+		os.Exit(1)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		fmt.Println("Error creating output:", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	if _, err := filter.WriteTo(file); err != nil {
+		fmt.Println("Error writing filter:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Filter with %d hashes written to %s\n", total, *output)
+}
+
+type source struct {
+	path   string
+	prefix string
+}
+
+func listSources(input string) ([]source, error) {
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []source{{path: input}}, nil
+	}
+
+	entries, err := os.ReadDir(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []source
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		prefix := strings.TrimSuffix(entry.Name(), ".txt")
+		if len(prefix) != 5 {
+			continue
+		}
+
+		sources = append(sources, source{path: filepath.Join(input, entry.Name()), prefix: prefix})
+	}
+
+	return sources, nil
+}
+
+func eachHash(sources []source, minCount int, fn func([20]byte)) error {
+	for _, src := range sources {
+		file, err := os.Open(src.path)
+		if err != nil {
+			return err
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			digest, count, ok := utils.ParseSHA1CountLine(scanner.Text(), src.prefix)
+			if ok && count >= minCount {
+				fn(digest)
+			}
+		}
+
+		file.Close()
+
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
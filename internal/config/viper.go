@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -20,9 +21,171 @@ type DatabaseConfig struct {
 	Password string
 }
 
+type Argon2Config struct {
+	Memory     uint32
+	Time       uint32
+	Threads    uint8
+	KeyLength  uint32
+	SaltLength uint32
+}
+
+type BcryptConfig struct {
+	Cost int
+}
+
+type ScryptConfig struct {
+	LogN       uint8
+	R          int
+	P          int
+	KeyLength  int
+	SaltLength int
+}
+
+type BreachConfig struct {
+	Policy     string
+	FilterPath string
+	CorpusPath string
+	MinCount   int
+}
+
+type PasswordConfig struct {
+	Algorithm string
+	Breach    BreachConfig
+	Argon2    Argon2Config
+	Bcrypt    BcryptConfig
+	Scrypt    ScryptConfig
+}
+
+type PasswordlessConfig struct {
+	LinkURL     string
+	Expiration  int
+	MaxAttempts int
+	RateLimit   int
+	RateWindow  int
+}
+
+type NotifierConfig struct {
+	Kind       string
+	WebhookURL string
+}
+
+type OIDCProviderConfig struct {
+	Name             string            `mapstructure:"name"`
+	Type             string            `mapstructure:"type"` // oidc (padrão) ou oauth2, para provedores sem id_token como o GitHub
+	Issuer           string            `mapstructure:"issuer"`
+	ClientID         string            `mapstructure:"client_id"`
+	ClientSecret     string            `mapstructure:"client_secret"`
+	RedirectURL      string            `mapstructure:"redirect_url"`
+	Scopes           []string          `mapstructure:"scopes"`
+	AuthorizationURL string            `mapstructure:"authorization_url"`
+	TokenURL         string            `mapstructure:"token_url"`
+	UserInfoURL      string            `mapstructure:"userinfo_url"`
+	SubjectClaim     string            `mapstructure:"subject_claim"`
+	IdentifierClaim  string            `mapstructure:"identifier_claim"`
+	MetadataClaims   map[string]string `mapstructure:"metadata_claims"`
+	Provision        bool              `mapstructure:"provision"`
+	LinkExisting     bool              `mapstructure:"link_existing"`
+}
+
+type FederationConfig struct {
+	StateExpiration int
+	Providers       []OIDCProviderConfig
+}
+
+type LDAPConfig struct {
+	Enabled             bool
+	URL                 string
+	BindDN              string
+	BindPassword        string
+	InsecureSkipVerify  bool
+	Timeout             int
+	PageSize            int
+	UserBase            string
+	UserFilter          string // Filtro de login, %s é substituído pelo identificador
+	UserSyncFilter      string
+	IdentifierAttribute string
+	MetadataAttributes  map[string]string
+	GroupBase           string
+	GroupFilter         string
+	GroupIdentifier     string
+	GroupDescription    string
+	GroupMember         string
+	SyncInterval        int
+}
+
+type SAMLConfig struct {
+	BaseURL           string // URL pública do whoami, usada para montar os endpoints SAML
+	EntityID          string
+	SPEntityID        string // Entity ID do whoami como SP de IdPs parceiros
+	AssertionLifetime int
+	SessionLifetime   int
+}
+
+type SCIMConfig struct {
+	BaseURL           string // URL pública da API SCIM, usada em meta.location
+	MaxResults        int
+	BulkMaxOperations int
+	BulkMaxPayload    int
+}
+
+type AccountConfig struct {
+	EditableMetadata []string // Chaves de metadata que o próprio usuário pode alterar em /me
+}
+
+type MFAConfig struct {
+	Issuer              string // Nome exibido nos aplicativos autenticadores
+	Skew                int    // Intervalos de 30s de tolerância ao relógio do dispositivo
+	ChallengeExpiration int    // Validade em segundos do token de login à espera do segundo fator
+	MaxAttempts         int    // Códigos aceitos por token antes de o login precisar recomeçar
+}
+
+type SessionConfig struct {
+	TouchInterval int // Segundos mínimos entre duas atualizações de last_seen da mesma sessão
+}
+
+type ImpersonationConfig struct {
+	Expiration int // Validade em segundos dos tokens emitidos para a equipe de suporte
+}
+
+type InvitationConfig struct {
+	AcceptURL  string // Página de cadastro que recebe o convite em ?token=
+	Expiration int    // Validade do convite em segundos
+}
+
+type AccessRequestConfig struct {
+	Expiration  int // Segundos para decidir um pedido de acesso antes que ele expire
+	MaxDuration int // Duração máxima, em segundos, do acesso pedido quando a política não define a sua
+}
+
+type AuthzConfig struct {
+	CombiningAlgorithm string // deny-overrides, allow-overrides ou first-applicable
+	BatchMaxChecks     int    // Máximo de verificações por chamada de autorização em lote
+	// Segundos entre as remoções de atribuições de papel expiradas; 0 desativa a limpeza
+	AssignmentCleanupInterval int
+}
+
+type ReBACConfig struct {
+	MaxDepth int // Profundidade máxima de reescritas e usersets aninhados avaliados por consulta
+}
+
 type AppConfig struct {
-	Token    TokenConfig
-	Database DatabaseConfig
+	Token         TokenConfig
+	Database      DatabaseConfig
+	Password      PasswordConfig
+	Passwordless  PasswordlessConfig
+	Notifier      NotifierConfig
+	Federation    FederationConfig
+	LDAP          LDAPConfig
+	SAML          SAMLConfig
+	SCIM          SCIMConfig
+	Account       AccountConfig
+	MFA           MFAConfig
+	Session       SessionConfig
+	Impersonation ImpersonationConfig
+	Invitation    InvitationConfig
+	AccessRequest AccessRequestConfig
+	Authz         AuthzConfig
+	ReBAC         ReBACConfig
 }
 
 var Config AppConfig
@@ -34,6 +197,56 @@ func Init() {
 	viper.SetDefault("database.host", "localhost")
 	viper.SetDefault("database.port", "5432")
 	viper.SetDefault("database.dialect", "sqlite")
+	viper.SetDefault("password.algorithm", "argon2id")
+	viper.SetDefault("password.argon2.memory", 64*1024)
+	viper.SetDefault("password.argon2.time", 3)
+	viper.SetDefault("password.argon2.threads", 4)
+	viper.SetDefault("password.argon2.key_length", 32)
+	viper.SetDefault("password.argon2.salt_length", 16)
+	viper.SetDefault("password.bcrypt.cost", 10)
+	viper.SetDefault("password.scrypt.log_n", 15)
+	viper.SetDefault("password.scrypt.r", 8)
+	viper.SetDefault("password.scrypt.p", 1)
+	viper.SetDefault("password.scrypt.key_length", 32)
+	viper.SetDefault("password.scrypt.salt_length", 16)
+	viper.SetDefault("password.breach.policy", "reject")
+	viper.SetDefault("password.breach.min_count", 1)
+	viper.SetDefault("passwordless.expiration", 600)
+	viper.SetDefault("passwordless.max_attempts", 5)
+	viper.SetDefault("passwordless.rate_limit", 5)
+	viper.SetDefault("passwordless.rate_window", 900)
+	viper.SetDefault("notifier.kind", "log")
+	viper.SetDefault("federation.state_expiration", 600)
+	viper.SetDefault("ldap.timeout", 10)
+	viper.SetDefault("ldap.page_size", 500)
+	viper.SetDefault("ldap.user_filter", "(&(objectClass=person)(uid=%s))")
+	viper.SetDefault("ldap.user_sync_filter", "(objectClass=person)")
+	viper.SetDefault("ldap.identifier_attribute", "uid")
+	viper.SetDefault("ldap.group_filter", "(objectClass=groupOfNames)")
+	viper.SetDefault("ldap.group_identifier", "cn")
+	viper.SetDefault("ldap.group_description", "description")
+	viper.SetDefault("ldap.group_member", "member")
+	viper.SetDefault("saml.base_url", "http://localhost:7777")
+	viper.SetDefault("saml.assertion_lifetime", 300)
+	viper.SetDefault("saml.session_lifetime", 28800)
+	viper.SetDefault("scim.base_url", "http://localhost:7777/scim/v2")
+	viper.SetDefault("scim.max_results", 200)
+	viper.SetDefault("scim.bulk_max_operations", 1000)
+	viper.SetDefault("scim.bulk_max_payload", 1048576)
+	viper.SetDefault("account.editable_metadata", []string{"name", "given_name", "family_name", "nickname", "picture", "locale", "zoneinfo"})
+	viper.SetDefault("mfa.issuer", "whoami")
+	viper.SetDefault("mfa.skew", 1)
+	viper.SetDefault("mfa.challenge_expiration", 300)
+	viper.SetDefault("mfa.max_attempts", 5)
+	viper.SetDefault("session.touch_interval", 60)
+	viper.SetDefault("impersonation.expiration", 900)
+	viper.SetDefault("invitation.expiration", 604800)
+	viper.SetDefault("access_request.expiration", 259200)
+	viper.SetDefault("access_request.max_duration", 28800)
+	viper.SetDefault("authz.combining_algorithm", "deny-overrides")
+	viper.SetDefault("authz.batch_max_checks", 1000)
+	viper.SetDefault("authz.assignment_cleanup_interval", 300)
+	viper.SetDefault("rebac.max_depth", 25)
 
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -43,6 +256,11 @@ func Init() {
 		log.Printf("Failed to read config file: %v", err)
 	}
 
+	var providers []OIDCProviderConfig
+	if err := viper.UnmarshalKey("federation.providers", &providers); err != nil {
+		log.Printf("Failed to read federation providers: %v", err)
+	}
+
 	// Carrega todas as configurações na struct
 	Config = AppConfig{
 		Token: TokenConfig{
@@ -57,6 +275,111 @@ func Init() {
 			Name:     viper.GetString("database.name"),
 			Password: viper.GetString("database.password"),
 		},
+		Password: PasswordConfig{
+			Algorithm: viper.GetString("password.algorithm"),
+			Breach: BreachConfig{
+				Policy:     viper.GetString("password.breach.policy"),
+				FilterPath: viper.GetString("password.breach.filter_path"),
+				CorpusPath: viper.GetString("password.breach.corpus_path"),
+				MinCount:   viper.GetInt("password.breach.min_count"),
+			},
+			Argon2: Argon2Config{
+				Memory:     viper.GetUint32("password.argon2.memory"),
+				Time:       viper.GetUint32("password.argon2.time"),
+				Threads:    uint8(viper.GetUint("password.argon2.threads")),
+				KeyLength:  viper.GetUint32("password.argon2.key_length"),
+				SaltLength: viper.GetUint32("password.argon2.salt_length"),
+			},
+			Bcrypt: BcryptConfig{
+				Cost: viper.GetInt("password.bcrypt.cost"),
+			},
+			Scrypt: ScryptConfig{
+				LogN:       uint8(viper.GetUint("password.scrypt.log_n")),
+				R:          viper.GetInt("password.scrypt.r"),
+				P:          viper.GetInt("password.scrypt.p"),
+				KeyLength:  viper.GetInt("password.scrypt.key_length"),
+				SaltLength: viper.GetInt("password.scrypt.salt_length"),
+			},
+		},
+		Passwordless: PasswordlessConfig{
+			LinkURL:     viper.GetString("passwordless.link_url"),
+			Expiration:  viper.GetInt("passwordless.expiration"),
+			MaxAttempts: viper.GetInt("passwordless.max_attempts"),
+			RateLimit:   viper.GetInt("passwordless.rate_limit"),
+			RateWindow:  viper.GetInt("passwordless.rate_window"),
+		},
+		Notifier: NotifierConfig{
+			Kind:       viper.GetString("notifier.kind"),
+			WebhookURL: viper.GetString("notifier.webhook_url"),
+		},
+		Federation: FederationConfig{
+			StateExpiration: viper.GetInt("federation.state_expiration"),
+			Providers:       providers,
+		},
+		LDAP: LDAPConfig{
+			Enabled:             viper.GetBool("ldap.enabled"),
+			URL:                 viper.GetString("ldap.url"),
+			BindDN:              viper.GetString("ldap.bind_dn"),
+			BindPassword:        viper.GetString("ldap.bind_password"),
+			InsecureSkipVerify:  viper.GetBool("ldap.insecure_skip_verify"),
+			Timeout:             viper.GetInt("ldap.timeout"),
+			PageSize:            viper.GetInt("ldap.page_size"),
+			UserBase:            viper.GetString("ldap.user_base"),
+			UserFilter:          viper.GetString("ldap.user_filter"),
+			UserSyncFilter:      viper.GetString("ldap.user_sync_filter"),
+			IdentifierAttribute: viper.GetString("ldap.identifier_attribute"),
+			MetadataAttributes:  viper.GetStringMapString("ldap.metadata_attributes"),
+			GroupBase:           viper.GetString("ldap.group_base"),
+			GroupFilter:         viper.GetString("ldap.group_filter"),
+			GroupIdentifier:     viper.GetString("ldap.group_identifier"),
+			GroupDescription:    viper.GetString("ldap.group_description"),
+			GroupMember:         viper.GetString("ldap.group_member"),
+			SyncInterval:        viper.GetInt("ldap.sync_interval"),
+		},
+		SAML: SAMLConfig{
+			BaseURL:           strings.TrimSuffix(viper.GetString("saml.base_url"), "/"),
+			EntityID:          viper.GetString("saml.entity_id"),
+			SPEntityID:        viper.GetString("saml.sp_entity_id"),
+			AssertionLifetime: viper.GetInt("saml.assertion_lifetime"),
+			SessionLifetime:   viper.GetInt("saml.session_lifetime"),
+		},
+		SCIM: SCIMConfig{
+			BaseURL:           strings.TrimSuffix(viper.GetString("scim.base_url"), "/"),
+			MaxResults:        viper.GetInt("scim.max_results"),
+			BulkMaxOperations: viper.GetInt("scim.bulk_max_operations"),
+			BulkMaxPayload:    viper.GetInt("scim.bulk_max_payload"),
+		},
+		Account: AccountConfig{
+			EditableMetadata: viper.GetStringSlice("account.editable_metadata"),
+		},
+		MFA: MFAConfig{
+			Issuer:              viper.GetString("mfa.issuer"),
+			Skew:                viper.GetInt("mfa.skew"),
+			ChallengeExpiration: viper.GetInt("mfa.challenge_expiration"),
+			MaxAttempts:         viper.GetInt("mfa.max_attempts"),
+		},
+		Session: SessionConfig{
+			TouchInterval: viper.GetInt("session.touch_interval"),
+		},
+		Impersonation: ImpersonationConfig{
+			Expiration: viper.GetInt("impersonation.expiration"),
+		},
+		Invitation: InvitationConfig{
+			AcceptURL:  viper.GetString("invitation.accept_url"),
+			Expiration: viper.GetInt("invitation.expiration"),
+		},
+		AccessRequest: AccessRequestConfig{
+			Expiration:  viper.GetInt("access_request.expiration"),
+			MaxDuration: viper.GetInt("access_request.max_duration"),
+		},
+		Authz: AuthzConfig{
+			CombiningAlgorithm:        viper.GetString("authz.combining_algorithm"),
+			BatchMaxChecks:            viper.GetInt("authz.batch_max_checks"),
+			AssignmentCleanupInterval: viper.GetInt("authz.assignment_cleanup_interval"),
+		},
+		ReBAC: ReBACConfig{
+			MaxDepth: viper.GetInt("rebac.max_depth"),
+		},
 	}
 }
 
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type AccessRequestController struct {
+	accessRequestService services.AccessRequestService
+}
+
+func NewAccessRequestController(accessRequestService services.AccessRequestService) AccessRequestController {
+	return AccessRequestController{accessRequestService: accessRequestService}
+}
+
+// accessRequestErrorResponse maps access request errors to HTTP responses
+func accessRequestErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrAccessRequestNotFound):
+		return c.JSON(404, err.Error())
+	case errors.Is(err, services.ErrNotApprover), errors.Is(err, services.ErrSelfApproval), errors.Is(err, services.ErrNotRequester):
+		return c.JSON(403, err.Error())
+	case errors.Is(err, services.ErrAccessRequestClosed), errors.Is(err, services.ErrAccessRequestDuplicated),
+		errors.Is(err, services.ErrAlreadyApproved), errors.Is(err, services.ErrRoleAlreadyHeld),
+		errors.Is(err, services.ErrRoleScheduled):
+		return c.JSON(409, err.Error())
+	}
+	return c.JSON(400, err.Error())
+}
+
+func accessRequestID(c echo.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	return uint(id), err == nil
+}
+
+// Approval policies
+func (controller AccessRequestController) SetApprovalPolicy(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can manage approval policies")
+	}
+
+	var policy schemas.RBACApprovalPolicyUpdate
+
+	if err := c.Bind(&policy); err != nil {
+		return c.JSON(400, err)
+	}
+
+	returnPolicy, err := controller.accessRequestService.SetApprovalPolicy(c.Param("identifier"), &policy)
+	if err != nil {
+		return accessRequestErrorResponse(c, err)
+	}
+
+	return c.JSON(200, returnPolicy)
+}
+
+func (controller AccessRequestController) GetApprovalPolicy(c echo.Context) error {
+	policy, err := controller.accessRequestService.GetApprovalPolicy(c.Param("identifier"))
+	if err != nil {
+		return c.JSON(404, err.Error())
+	}
+
+	return c.JSON(200, policy)
+}
+
+func (controller AccessRequestController) GetApprovalPolicies(c echo.Context) error {
+	policies, err := controller.accessRequestService.GetApprovalPolicies()
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, policies)
+}
+
+func (controller AccessRequestController) DeleteApprovalPolicy(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can manage approval policies")
+	}
+
+	if err := controller.accessRequestService.DeleteApprovalPolicy(c.Param("identifier")); err != nil {
+		return c.JSON(404, err.Error())
+	}
+
+	return c.JSON(200, "Approval policy deleted")
+}
+
+// Access requests
+func (controller AccessRequestController) CreateRequest(c echo.Context) error {
+	var request schemas.RBACAccessRequestCreate
+
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, err)
+	}
+
+	createdRequest, err := controller.accessRequestService.CreateRequest(currentUser(c), &request)
+	if err != nil {
+		return accessRequestErrorResponse(c, err)
+	}
+
+	return c.JSON(201, createdRequest)
+}
+
+// GetRequest and GetRequests show administrators every request; other users see the
+// requests they made and the ones they can decide
+func (controller AccessRequestController) GetRequest(c echo.Context) error {
+	id, ok := accessRequestID(c)
+	if !ok {
+		return c.JSON(400, "Invalid access request id")
+	}
+
+	_, admin := currentAdmin(c)
+
+	request, err := controller.accessRequestService.GetRequest(id, currentUser(c), admin)
+	if err != nil {
+		return accessRequestErrorResponse(c, err)
+	}
+
+	return c.JSON(200, request)
+}
+
+func (controller AccessRequestController) GetRequests(c echo.Context) error {
+	var filter schemas.RBACAccessRequestFilter
+
+	if err := c.Bind(&filter); err != nil {
+		return c.JSON(400, err)
+	}
+
+	_, admin := currentAdmin(c)
+
+	requests, err := controller.accessRequestService.GetRequests(&filter, currentUser(c), admin)
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, requests)
+}
+
+func (controller AccessRequestController) Approve(c echo.Context) error {
+	return controller.decide(c, controller.accessRequestService.Approve)
+}
+
+func (controller AccessRequestController) Deny(c echo.Context) error {
+	return controller.decide(c, controller.accessRequestService.Deny)
+}
+
+func (controller AccessRequestController) decide(c echo.Context, decide func(uint, string, *schemas.RBACAccessRequestDecision) (*schemas.RBACAccessRequestResponse, error)) error {
+	id, ok := accessRequestID(c)
+	if !ok {
+		return c.JSON(400, "Invalid access request id")
+	}
+
+	var decision schemas.RBACAccessRequestDecision
+
+	if err := c.Bind(&decision); err != nil {
+		return c.JSON(400, err)
+	}
+
+	request, err := decide(id, currentUser(c), &decision)
+	if err != nil {
+		return accessRequestErrorResponse(c, err)
+	}
+
+	return c.JSON(200, request)
+}
+
+func (controller AccessRequestController) Cancel(c echo.Context) error {
+	id, ok := accessRequestID(c)
+	if !ok {
+		return c.JSON(400, "Invalid access request id")
+	}
+
+	request, err := controller.accessRequestService.Cancel(id, currentUser(c))
+	if err != nil {
+		return accessRequestErrorResponse(c, err)
+	}
+
+	return c.JSON(200, request)
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type AccessTokenController struct {
+	accessTokenService services.AccessTokenService
+}
+
+func NewAccessTokenController(accessTokenService services.AccessTokenService) AccessTokenController {
+	return AccessTokenController{accessTokenService: accessTokenService}
+}
+
+// currentUser returns the identifier of the authenticated user
+func currentUser(c echo.Context) string {
+	user, ok := c.Get("user").(*schemas.UserResponse)
+	if !ok {
+		return ""
+	}
+
+	return user.Identifier
+}
+
+// personalAccessToken reports whether the request is authenticated by a personal
+// access token instead of a login
+func personalAccessToken(c echo.Context) bool {
+	_, ok := c.Get("access_token_id").(uint)
+	return ok
+}
+
+func (controller AccessTokenController) createToken(c echo.Context, userIdentifier string, serviceAccountOnly bool) error {
+	var token schemas.PersonalAccessTokenCreate
+
+	// Um token com escopos ou papéis restritos não pode emitir outro sem essas restrições
+	if personalAccessToken(c) {
+		return c.JSON(403, "Personal access tokens cannot create other tokens")
+	}
+
+	if err := c.Bind(&token); err != nil {
+		return c.JSON(400, err)
+	}
+
+	create := controller.accessTokenService.CreateToken
+	if serviceAccountOnly {
+		create = controller.accessTokenService.CreateServiceAccountToken
+	}
+
+	createdToken, err := create(userIdentifier, &token)
+	if errors.Is(err, services.ErrNotServiceAccount) {
+		return c.JSON(403, err.Error())
+	}
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, createdToken)
+}
+
+func (controller AccessTokenController) getTokens(c echo.Context, userIdentifier string) error {
+	tokens, err := controller.accessTokenService.GetTokens(userIdentifier)
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, tokens)
+}
+
+func (controller AccessTokenController) revokeToken(c echo.Context, userIdentifier string) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, "Invalid token id")
+	}
+
+	if err := controller.accessTokenService.RevokeToken(userIdentifier, uint(id)); err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(204, "Token revoked successfully!")
+}
+
+// CreateOwnToken creates a personal access token for the authenticated user
+func (controller AccessTokenController) CreateOwnToken(c echo.Context) error {
+	if impersonating(c) {
+		return c.JSON(403, "Impersonation tokens cannot create personal access tokens")
+	}
+
+	return controller.createToken(c, currentUser(c), false)
+}
+
+func (controller AccessTokenController) GetOwnTokens(c echo.Context) error {
+	return controller.getTokens(c, currentUser(c))
+}
+
+func (controller AccessTokenController) RevokeOwnToken(c echo.Context) error {
+	return controller.revokeToken(c, currentUser(c))
+}
+
+// CreateUserToken creates an API key for a service account. Administrators can't
+// mint credentials for other humans, only for themselves.
+func (controller AccessTokenController) CreateUserToken(c echo.Context) error {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return c.JSON(403, "Only administrators can create tokens for other users")
+	}
+
+	identifier := c.Param("identifier")
+	return controller.createToken(c, identifier, identifier != admin.Identifier)
+}
+
+func (controller AccessTokenController) GetUserTokens(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can list tokens of other users")
+	}
+
+	return controller.getTokens(c, c.Param("identifier"))
+}
+
+func (controller AccessTokenController) RevokeUserToken(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can revoke tokens of other users")
+	}
+
+	return controller.revokeToken(c, c.Param("identifier"))
+}
+
+func (controller AccessTokenController) CreateServiceAccount(c echo.Context) error {
+	var account schemas.ServiceAccountCreate
+
+	if err := c.Bind(&account); err != nil {
+		return c.JSON(400, err)
+	}
+
+	createdAccount, err := controller.accessTokenService.CreateServiceAccount(&account)
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, createdAccount)
+}
+
+func (controller AccessTokenController) GetServiceAccounts(c echo.Context) error {
+	accounts, err := controller.accessTokenService.GetServiceAccounts()
+	if err != nil {
+		return c.JSON(500, err)
+	}
+
+	return c.JSON(200, accounts)
+}
@@ -0,0 +1,235 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+// AccountController serves /me, where users manage their own account
+type AccountController struct {
+	authService      services.AuthService
+	accountService   services.AccountService
+	authzRBACService services.AuthzRBACService
+	mfaService       services.MFAService
+}
+
+func NewAccountController(authService services.AuthService, accountService services.AccountService, authzRBACService services.AuthzRBACService, mfaService services.MFAService) AccountController {
+	return AccountController{
+		authService:      authService,
+		accountService:   accountService,
+		authzRBACService: authzRBACService,
+		mfaService:       mfaService,
+	}
+}
+
+func (controller AccountController) GetProfile(c echo.Context) error {
+	user, err := controller.authService.GetUser(currentUser(c))
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, user)
+}
+
+func (controller AccountController) UpdateProfile(c echo.Context) error {
+	var account schemas.AccountUpdate
+
+	if err := c.Bind(&account); err != nil {
+		return c.JSON(400, err)
+	}
+
+	user, err := controller.accountService.UpdateMetadata(currentUser(c), &account)
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, user)
+}
+
+func (controller AccountController) ChangePassword(c echo.Context) error {
+	if impersonating(c) {
+		return c.JSON(403, "Impersonation tokens cannot change the password")
+	}
+
+	var change schemas.PasswordChange
+
+	if err := c.Bind(&change); err != nil {
+		return c.JSON(400, err)
+	}
+
+	err := controller.accountService.ChangePassword(currentUser(c), &change)
+
+	switch {
+	case errors.Is(err, services.ErrInvalidCurrentPassword):
+		return c.JSON(403, err.Error())
+	case err != nil:
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, "Password changed successfully!")
+}
+
+func (controller AccountController) GetTokens(c echo.Context) error {
+	tokens, err := controller.accountService.GetTokens(currentUser(c))
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, tokens)
+}
+
+func (controller AccountController) RevokeToken(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, "Invalid token id")
+	}
+
+	if err := controller.accountService.RevokeToken(currentUser(c), uint(id)); err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(204, "Token revoked successfully!")
+}
+
+func (controller AccountController) GetRoles(c echo.Context) error {
+	roles, err := tokenRBACService(c, controller.authzRBACService).GetUserRoles(currentUser(c))
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, roles)
+}
+
+func (controller AccountController) GetPermissions(c echo.Context) error {
+	permissions, err := tokenRBACService(c, controller.authzRBACService).GetUserPermissions(currentUser(c))
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, permissions)
+}
+
+// mfaErrorResponse maps MFA errors to the responses of the factor endpoints
+func mfaErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrFactorNotFound):
+		return c.JSON(404, err.Error())
+	case errors.Is(err, services.ErrInvalidMFACode), errors.Is(err, services.ErrFactorNeedsCode), errors.Is(err, services.ErrMFARequired):
+		return c.JSON(403, err.Error())
+	}
+	return c.JSON(400, err.Error())
+}
+
+func factorID(c echo.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	return uint(id), err == nil
+}
+
+func (controller AccountController) GetFactors(c echo.Context) error {
+	if impersonating(c) {
+		return c.JSON(403, "Impersonation tokens cannot manage second factors")
+	}
+
+	factors, err := controller.mfaService.GetFactors(currentUser(c))
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, factors)
+}
+
+func (controller AccountController) EnrollTOTP(c echo.Context) error {
+	if impersonating(c) {
+		return c.JSON(403, "Impersonation tokens cannot manage second factors")
+	}
+
+	var factor schemas.MFAFactorCreate
+
+	if err := c.Bind(&factor); err != nil {
+		return c.JSON(400, err)
+	}
+
+	createdFactor, err := controller.mfaService.EnrollTOTP(currentUser(c), &factor)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	return c.JSON(200, createdFactor)
+}
+
+func (controller AccountController) ConfirmFactor(c echo.Context) error {
+	if impersonating(c) {
+		return c.JSON(403, "Impersonation tokens cannot manage second factors")
+	}
+
+	var code schemas.MFACode
+
+	if err := c.Bind(&code); err != nil {
+		return c.JSON(400, err)
+	}
+
+	id, ok := factorID(c)
+	if !ok {
+		return c.JSON(400, "Invalid factor id")
+	}
+
+	factor, err := controller.mfaService.ConfirmFactor(currentUser(c), id, code.Code)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	return c.JSON(200, factor)
+}
+
+func (controller AccountController) DeleteFactor(c echo.Context) error {
+	if impersonating(c) {
+		return c.JSON(403, "Impersonation tokens cannot manage second factors")
+	}
+
+	id, ok := factorID(c)
+	if !ok {
+		return c.JSON(400, "Invalid factor id")
+	}
+
+	if err := controller.mfaService.DeleteFactor(currentUser(c), id, c.QueryParam("code"), false); err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	return c.JSON(204, "Factor removed successfully!")
+}
+
+// GetUserFactors lists the factors of any user, for administrators
+func (controller AccountController) GetUserFactors(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can list factors of other users")
+	}
+
+	factors, err := controller.mfaService.GetFactors(c.Param("identifier"))
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, factors)
+}
+
+// DeleteUserFactor removes a factor without a code, for users who lost their device
+func (controller AccountController) DeleteUserFactor(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can remove factors of other users")
+	}
+
+	id, ok := factorID(c)
+	if !ok {
+		return c.JSON(400, "Invalid factor id")
+	}
+
+	if err := controller.mfaService.DeleteFactor(c.Param("identifier"), id, "", true); err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	return c.JSON(204, "Factor removed successfully!")
+}
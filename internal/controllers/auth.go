@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"time"
 
 	"github.com/duvrdx/whoami/internal/config"
@@ -12,17 +13,30 @@ import (
 )
 
 type Claims struct {
-	UserID   uint `json:"user_id"`
-	ClientID uint `json:"client_id"`
+	UserID    uint     `json:"user_id"`
+	ClientID  uint     `json:"client_id"`
+	Groups    []string `json:"groups,omitempty"`
+	SessionID string   `json:"sid,omitempty"` // Sessão de login à qual o token pertence
+	// Presentes apenas em tokens de personificação
+	Actor        *ActorClaim `json:"act,omitempty"`
+	Impersonated bool        `json:"impersonated,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// ActorClaim identifies who is acting on behalf of the token subject (RFC 8693)
+type ActorClaim struct {
+	Subject string `json:"sub"`
+	UserID  uint   `json:"user_id"`
+}
+
 type AuthController struct {
-	authService services.AuthService
+	authService    services.AuthService
+	mfaService     services.MFAService
+	sessionService services.SessionService
 }
 
-func NewAuthController(authService services.AuthService) AuthController {
-	return AuthController{authService: authService}
+func NewAuthController(authService services.AuthService, mfaService services.MFAService, sessionService services.SessionService) AuthController {
+	return AuthController{authService: authService, mfaService: mfaService, sessionService: sessionService}
 }
 
 func (controller AuthController) Register(c echo.Context) error {
@@ -33,12 +47,30 @@ func (controller AuthController) Register(c echo.Context) error {
 	}
 
 	if _, err := controller.authService.CreateUser(&user); err != nil {
+		if errors.Is(err, services.ErrPasswordBreached) {
+			return c.JSON(400, err.Error())
+		}
 		return c.JSON(400, err)
 	}
 
 	return c.JSON(200, "User registered successfully!")
 }
 
+func (controller AuthController) ImportUsers(c echo.Context) error {
+	var users []schemas.UserImport
+
+	if err := c.Bind(&users); err != nil {
+		return c.JSON(400, err)
+	}
+
+	imported, err := controller.authService.ImportUsers(users)
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, imported)
+}
+
 func (controller AuthController) UpdateUser(c echo.Context) error {
 	var user schemas.UserUpdate
 	var identifier = c.Param("identifier")
@@ -51,21 +83,33 @@ func (controller AuthController) UpdateUser(c echo.Context) error {
 		return c.JSON(400, "Password cannot be empty")
 	}
 
-	if user.Password != nil && *user.Password != "" {
-		hashPassword, err := utils.HashPassword(*user.Password)
-
-		if err != nil {
-			return c.JSON(400, err)
+	if _, err := controller.authService.UpdateUser(identifier, &user); err != nil {
+		if errors.Is(err, services.ErrPasswordBreached) {
+			return c.JSON(400, err.Error())
 		}
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(200, "User updated successfully!")
+}
+
+func (controller AuthController) ResetPassword(c echo.Context) error {
+	var reset schemas.PasswordReset
+	var identifier = c.Param("identifier")
 
-		user.Password = &hashPassword
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can reset passwords")
 	}
 
-	if _, err := controller.authService.UpdateUser(identifier, &user); err != nil {
+	if err := c.Bind(&reset); err != nil {
 		return c.JSON(400, err)
 	}
 
-	return c.JSON(200, "User updated successfully!")
+	if err := controller.authService.ResetPassword(identifier, reset.Password); err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, "Password reset successfully!")
 }
 
 func (controller AuthController) GetUser(c echo.Context) error {
@@ -164,18 +208,341 @@ func (controller AuthController) DeleteClient(c echo.Context) error {
 	return c.JSON(204, "Client deleted successfully!")
 }
 
-func (controller AuthController) Token(c echo.Context) error {
-	var grantType = c.FormValue("grant_type")
-	var client_id = c.FormValue("client_id")
-	var client_secret = c.FormValue("client_secret")
+// AuthController methods for groups
+
+func (controller AuthController) CreateGroup(c echo.Context) error {
+	var group schemas.GroupCreate
+
+	if err := c.Bind(&group); err != nil {
+		return c.JSON(400, err)
+	}
+
+	if group.Identifier == "" {
+		return c.JSON(400, "Identifier cannot be empty")
+	}
+
+	createdGroup, err := controller.authService.CreateGroup(&group)
+	if err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(200, createdGroup)
+}
+
+func (controller AuthController) UpdateGroup(c echo.Context) error {
+	var group schemas.GroupUpdate
+	var identifier = c.Param("identifier")
+
+	if err := c.Bind(&group); err != nil {
+		return c.JSON(400, err)
+	}
+
+	updatedGroup, err := controller.authService.UpdateGroup(identifier, &group)
+	if err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(200, updatedGroup)
+}
+
+func (controller AuthController) GetGroup(c echo.Context) error {
+	var identifier = c.Param("identifier")
+
+	group, err := controller.authService.GetGroup(identifier)
+
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, group)
+}
+
+func (controller AuthController) GetGroups(c echo.Context) error {
+	groups, err := controller.authService.GetGroups()
+
+	if err != nil {
+		return c.JSON(500, err)
+	}
+
+	return c.JSON(200, groups)
+}
+
+func (controller AuthController) DeleteGroup(c echo.Context) error {
+	var identifier = c.Param("identifier")
+
+	if err := controller.authService.DeleteGroup(identifier); err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(204, "Group deleted successfully!")
+}
+
+func (controller AuthController) GetGroupMembers(c echo.Context) error {
+	var identifier = c.Param("identifier")
+
+	members, err := controller.authService.GetGroupMembers(identifier)
+
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, members)
+}
+
+func (controller AuthController) AddGroupMembers(c echo.Context) error {
+	var members schemas.GroupMembersAdd
+	var identifier = c.Param("identifier")
+
+	if err := c.Bind(&members); err != nil {
+		return c.JSON(400, err)
+	}
+
+	if err := controller.authService.AddGroupMembers(identifier, members.Users); err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, "Members added successfully!")
+}
+
+func (controller AuthController) RemoveGroupMember(c echo.Context) error {
+	var identifier = c.Param("identifier")
+
+	if err := controller.authService.RemoveGroupMember(identifier, c.Param("user")); err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(204, "Member removed successfully!")
+}
+
+func (controller AuthController) GetSubgroups(c echo.Context) error {
+	var identifier = c.Param("identifier")
+
+	subgroups, err := controller.authService.GetSubgroups(identifier)
+
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, subgroups)
+}
+
+func (controller AuthController) AddSubgroup(c echo.Context) error {
+	var identifier = c.Param("identifier")
+
+	if err := controller.authService.AddSubgroup(identifier, c.Param("subgroup")); err != nil {
+		if errors.Is(err, services.ErrGroupCycle) {
+			return c.JSON(409, err.Error())
+		}
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(200, "Subgroup added successfully!")
+}
+
+func (controller AuthController) RemoveSubgroup(c echo.Context) error {
+	var identifier = c.Param("identifier")
+
+	if err := controller.authService.RemoveSubgroup(identifier, c.Param("subgroup")); err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(204, "Subgroup removed successfully!")
+}
+
+func (controller AuthController) GetUserGroups(c echo.Context) error {
+	var identifier = c.Param("identifier")
+
+	groups, err := controller.authService.GetUserGroups(identifier)
+
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, groups)
+}
 
-	client, err := controller.authService.GetClient(client_id)
+var errTokenSigning = errors.New("failed to generate access token")
+
+// startSession records a new login of the user on the requesting device
+func startSession(c echo.Context, sessionService services.SessionService, userID, clientID uint, methods ...string) (*schemas.SessionResponse, error) {
+	return sessionService.CreateSession(&schemas.SessionCreate{
+		UserID:    userID,
+		ClientID:  clientID,
+		IP:        c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+		Methods:   methods,
+	})
+}
+
+// issueToken signs a JWT access token for the user and client, pairs it with a
+// random refresh token and stores both within the session
+func issueToken(authService services.AuthService, userID, clientID uint, session *schemas.SessionResponse) (*schemas.TokenResponse, error) {
+	// Define o tempo de expiração do token
+	expiresIn := time.Now().Unix() + int64(config.Config.Token.Expiration)
+
+	claims, err := tokenClaims(authService, userID, clientID, session, expiresIn)
+	if err != nil {
+		return nil, err
+	}
+
+	return storeToken(authService, claims, session, nil)
+}
 
+// completeLogin issues tokens for a user whose first factor was verified. With a
+// confirmed second factor the code comes along with the login; logins that can't
+// carry it, like redirects from upstream providers, get an MFA token instead, to be
+// exchanged for the tokens at /o/mfa.
+func completeLogin(c echo.Context, authService services.AuthService, mfaService services.MFAService, sessionService services.SessionService, userID, clientID uint, method, code string) error {
+	required, err := mfaService.Required(userID)
 	if err != nil {
+		return c.JSON(500, err.Error())
+	}
+
+	methods := []string{method}
+
+	if required && code == "" {
+		token, err := mfaService.StartChallenge(userID, clientID, method)
+		if err != nil {
+			return c.JSON(500, err.Error())
+		}
+
+		return c.JSON(401, schemas.MFAChallengeResponse{
+			Error:     services.ErrMFARequired.Error(),
+			MFAToken:  token,
+			ExpiresIn: config.Config.MFA.ChallengeExpiration,
+		})
+	}
+
+	if required {
+		if err := mfaService.Verify(userID, code); err != nil {
+			return c.JSON(401, err.Error())
+		}
+		methods = append(methods, services.MFAFactorTOTP)
+	}
+
+	session, err := startSession(c, sessionService, userID, clientID, methods...)
+	if err != nil {
+		return c.JSON(500, err.Error())
+	}
+
+	tokenResponse, err := issueToken(authService, userID, clientID, session)
+	if err != nil {
+		return tokenErrorResponse(c, err)
+	}
+
+	return c.JSON(200, tokenResponse)
+}
+
+// CompleteMFA exchanges the MFA token of a login waiting for its second factor and
+// a code from the user's authenticator for the tokens
+func (controller AuthController) CompleteMFA(c echo.Context) error {
+	var request schemas.MFAChallengeRedeem
+
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, err)
+	}
+
+	client, ok := authenticateClient(controller.authService, request.ClientID, request.ClientSecret)
+
+	if !ok {
 		return c.JSON(404, "Client not found or invalid credentials")
 	}
 
-	if !controller.authService.VerifyClient(client_id, client_secret) {
+	challenge, err := controller.mfaService.CompleteChallenge(client.ID, request.MFAToken, request.Code)
+	if err != nil {
+		return c.JSON(401, err.Error())
+	}
+
+	if !challenge.User.IsActive {
+		return c.JSON(401, "User is not active")
+	}
+
+	session, err := startSession(c, controller.sessionService, challenge.UserID, client.ID, challenge.FirstFactor, services.MFAFactorTOTP)
+	if err != nil {
+		return c.JSON(500, err.Error())
+	}
+
+	tokenResponse, err := issueToken(controller.authService, challenge.UserID, client.ID, session)
+	if err != nil {
+		return tokenErrorResponse(c, err)
+	}
+
+	return c.JSON(200, tokenResponse)
+}
+
+// tokenClaims builds the JWT claims of a user token
+func tokenClaims(authService services.AuthService, userID, clientID uint, session *schemas.SessionResponse, expiresIn int64) (*Claims, error) {
+	groups, err := authService.GetGroupClaims(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Claims{
+		UserID:    userID,
+		ClientID:  clientID,
+		Groups:    groups,
+		SessionID: session.SID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Unix(expiresIn, 0)),
+		},
+	}, nil
+}
+
+// storeToken signs the claims and stores the token; actorID is set for impersonation tokens
+func storeToken(authService services.AuthService, claims *Claims, session *schemas.SessionResponse, actorID *uint) (*schemas.TokenResponse, error) {
+	// Gera o token JWT
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	accessToken, err := token.SignedString(config.Config.Token.Secret)
+
+	if err != nil {
+		return nil, errTokenSigning
+	}
+
+	// Cria o token no banco de dados
+	tokenData := schemas.TokenCreate{
+		AccessToken:  accessToken,                    // Agora é um JWT
+		RefreshToken: utils.GenerateRandomString(16), // Continua sendo uma string aleatória
+		ExpiresIn:    int(claims.ExpiresAt.Unix()),
+		UserID:       claims.UserID,
+		ClientID:     claims.ClientID,
+		SessionID:    session.ID,
+		ActorID:      actorID,
+	}
+
+	return authService.CreateToken(&tokenData)
+}
+
+// tokenErrorResponse maps issueToken errors to the responses used by the token endpoints
+func tokenErrorResponse(c echo.Context, err error) error {
+	if errors.Is(err, errTokenSigning) {
+		return c.JSON(500, "Failed to generate access token")
+	}
+	return c.JSON(400, err)
+}
+
+// authenticateClient loads the client and checks its secret
+func authenticateClient(authService services.AuthService, clientID, clientSecret string) (*schemas.ClientResponse, bool) {
+	client, err := authService.GetClient(clientID)
+
+	if err != nil {
+		return nil, false
+	}
+
+	if !authService.VerifyClient(clientID, clientSecret) {
+		return nil, false
+	}
+
+	return client, true
+}
+
+func (controller AuthController) Token(c echo.Context) error {
+	var grantType = c.FormValue("grant_type")
+	var client_id = c.FormValue("client_id")
+	var client_secret = c.FormValue("client_secret")
+
+	client, ok := authenticateClient(controller.authService, client_id, client_secret)
+
+	if !ok {
 		return c.JSON(404, "Client not found or invalid credentials")
 	}
 
@@ -187,52 +554,46 @@ func (controller AuthController) Token(c echo.Context) error {
 		var userIdentifier = c.FormValue("username")
 		var userPassword = c.FormValue("password")
 
-		user, err := controller.authService.GetUser(userIdentifier)
-
-		if err != nil {
-			return c.JSON(404, "User not found or invalid credentials")
+		if !client.AllowsLoginMethod(services.LoginMethodPassword) {
+			return c.JSON(400, "Login method not allowed for this client")
 		}
 
+		// A senha é verificada antes da busca, pois backends externos provisionam o usuário no primeiro login
 		if !controller.authService.CompareUserPassword(userIdentifier, userPassword) {
 			return c.JSON(404, "User not found or invalid credentials")
 		}
 
-		// Define o tempo de expiração do token
-		expiresIn := time.Now().Unix() + int64(config.Config.Token.Expiration)
+		user, err := controller.authService.GetUser(userIdentifier)
 
-		// Cria as claims do JWT
-		claims := &Claims{
-			UserID:   user.ID,
-			ClientID: client.ID,
-			RegisteredClaims: jwt.RegisteredClaims{
-				ExpiresAt: jwt.NewNumericDate(time.Unix(expiresIn, 0)),
-			},
+		// Usuários inativos, como os de convites pendentes, não fazem login
+		if err != nil || !user.IsActive {
+			return c.JSON(404, "User not found or invalid credentials")
 		}
 
-		// Gera o token JWT
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		accessToken, err := token.SignedString(config.Config.Token.Secret)
-
+		// Com um segundo fator confirmado, o código do autenticador acompanha a senha
+		required, err := controller.mfaService.Required(user.ID)
 		if err != nil {
-			return c.JSON(500, "Failed to generate access token")
+			return c.JSON(500, err.Error())
 		}
 
-		// Gera o refresh_token (mantido como uma string aleatória)
-		refreshToken := utils.GenerateRandomString(16)
+		methods := []string{services.LoginMethodPassword}
 
-		// Cria o token no banco de dados
-		tokenData := schemas.TokenCreate{
-			AccessToken:  accessToken,  // Agora é um JWT
-			RefreshToken: refreshToken, // Continua sendo uma string aleatória
-			ExpiresIn:    int(expiresIn),
-			UserID:       user.ID,
-			ClientID:     client.ID,
+		if required {
+			if err := controller.mfaService.Verify(user.ID, c.FormValue("mfa_code")); err != nil {
+				return c.JSON(401, err.Error())
+			}
+			methods = append(methods, services.MFAFactorTOTP)
 		}
 
-		tokenResponse, err := controller.authService.CreateToken(&tokenData)
+		session, err := startSession(c, controller.sessionService, user.ID, client.ID, methods...)
+		if err != nil {
+			return c.JSON(500, err.Error())
+		}
+
+		tokenResponse, err := issueToken(controller.authService, user.ID, client.ID, session)
 
 		if err != nil {
-			return c.JSON(400, err)
+			return tokenErrorResponse(c, err)
 		}
 
 		// Retorna a resposta com o access_token (JWT) e refresh_token
@@ -265,43 +626,38 @@ func (controller AuthController) RefreshToken(c echo.Context) error {
 		return c.JSON(404, "Token expired")
 	}
 
-	expiresIn := time.Now().Unix() + int64(config.Config.Token.Expiration)
+	// Um usuário removido é carregado vazio, e portanto inativo
+	if !token.User.IsActive {
+		return c.JSON(401, "User is inactive")
+	}
 
-	// Cria as claims do JWT
-	claims := &Claims{
-		UserID:   token.UserID,
-		ClientID: token.ClientID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Unix(expiresIn, 0)),
-		},
+	// A personificação dura apenas o token emitido; renová-la exige um novo pedido auditado
+	if token.ActorID != nil {
+		return c.JSON(400, "Impersonation tokens cannot be refreshed")
 	}
 
-	// Gera o token JWT
-	newTokenJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	newAccessToken, err := newTokenJWT.SignedString(config.Config.Token.Secret)
+	err = controller.authService.RevokeToken(token.AccessToken)
 
 	if err != nil {
-		return c.JSON(500, "Failed to generate access token")
+		return c.JSON(400, err)
 	}
 
-	newToken := schemas.TokenCreate{
-		AccessToken:  newAccessToken,
-		RefreshToken: utils.GenerateRandomString(16),
-		ExpiresIn:    int(expiresIn),
-		UserID:       token.UserID,
-		ClientID:     token.ClientID,
+	// O refresh continua a mesma sessão; tokens anteriores às sessões ganham uma nova
+	var session *schemas.SessionResponse
+	if token.SessionID != 0 {
+		session, err = controller.sessionService.GetSession(token.SessionID)
+	} else {
+		session, err = startSession(c, controller.sessionService, token.UserID, token.ClientID)
 	}
 
-	err = controller.authService.RevokeToken(token.AccessToken)
-
 	if err != nil {
-		return c.JSON(400, err)
+		return c.JSON(404, "Session not found or revoked")
 	}
 
-	newTokenResponse, err := controller.authService.CreateToken(&newToken)
+	newTokenResponse, err := issueToken(controller.authService, token.UserID, token.ClientID, session)
 
 	if err != nil {
-		return c.JSON(400, err)
+		return tokenErrorResponse(c, err)
 	}
 
 	return c.JSON(200, newTokenResponse)
@@ -1,7 +1,10 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/duvrdx/whoami/internal/schemas"
 	"github.com/duvrdx/whoami/internal/services"
@@ -16,6 +19,21 @@ func NewAuthzRBACController(authzRBACService services.AuthzRBACService) AuthzRBA
 	return AuthzRBACController{authzRBACService: authzRBACService}
 }
 
+// service returns the RBAC service limited to the roles of the personal access token used in the request, if any
+func (controller AuthzRBACController) service(c echo.Context) services.AuthzRBACService {
+	return tokenRBACService(c, controller.authzRBACService)
+}
+
+// tokenRBACService restricts the service to the roles of the personal access token
+// that authenticated the request, if it is limited to some of them
+func tokenRBACService(c echo.Context, service services.AuthzRBACService) services.AuthzRBACService {
+	if roles, ok := c.Get("token_roles").([]string); ok && len(roles) > 0 {
+		return service.WithRoles(roles)
+	}
+
+	return service
+}
+
 // RBACRole
 func (controller AuthzRBACController) CreateRole(c echo.Context) error {
 	var role schemas.RBACRoleCreate
@@ -78,6 +96,40 @@ func (controller AuthzRBACController) DeleteRole(c echo.Context) error {
 	return c.JSON(204, "Role deleted successfully!")
 }
 
+func (controller AuthzRBACController) AddParentRole(c echo.Context) error {
+	var identifier = c.Param("identifier")
+
+	if err := controller.authzRBACService.AddParentRole(identifier, c.Param("parent")); err != nil {
+		if errors.Is(err, services.ErrRoleCycle) {
+			return c.JSON(409, err.Error())
+		}
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(200, "Parent role added successfully!")
+}
+
+func (controller AuthzRBACController) RemoveParentRole(c echo.Context) error {
+	var identifier = c.Param("identifier")
+
+	if err := controller.authzRBACService.RemoveParentRole(identifier, c.Param("parent")); err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(204, "Parent role removed successfully!")
+}
+
+func (controller AuthzRBACController) GetRoleHierarchy(c echo.Context) error {
+	var identifier = c.Param("identifier")
+
+	hierarchy, err := controller.authzRBACService.GetRoleHierarchy(identifier)
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, hierarchy)
+}
+
 // RBACPermission
 func (controller AuthzRBACController) CreatePermission(c echo.Context) error {
 	var permission schemas.RBACPermissionCreate
@@ -88,6 +140,9 @@ func (controller AuthzRBACController) CreatePermission(c echo.Context) error {
 
 	createdPermission, err := controller.authzRBACService.CreatePermission(&permission)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidCondition) {
+			return c.JSON(400, err.Error())
+		}
 		return c.JSON(400, err)
 	}
 
@@ -125,6 +180,9 @@ func (controller AuthzRBACController) UpdatePermission(c echo.Context) error {
 
 	updatedPermission, err := controller.authzRBACService.UpdatePermission(identifier, &permission)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidCondition) {
+			return c.JSON(400, err.Error())
+		}
 		return c.JSON(400, err)
 	}
 
@@ -152,6 +210,17 @@ func (controller AuthzRBACController) GrantPermissionToRole(c echo.Context) erro
 	return c.JSON(200, "Permission granted successfully!")
 }
 
+func (controller AuthzRBACController) RevokePermissionFromRole(c echo.Context) error {
+	roleIdentifier := c.Param("role")
+	permissionIdentifier := c.Param("permission")
+
+	if err := controller.authzRBACService.RemoveRoleFromPermission(roleIdentifier, permissionIdentifier); err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(204, "Permission revoked successfully!")
+}
+
 // RBACResourceType
 func (controller AuthzRBACController) CreateResourceType(c echo.Context) error {
 	var resourceType schemas.RBACResourceTypeCreate
@@ -221,12 +290,13 @@ func (controller AuthzRBACController) AuthorizeByResourceType(c echo.Context) er
 
 	userJWT := c.Get("user").(*schemas.UserResponse)
 
-	authorized := controller.authzRBACService.AuthorizeUserByResourceType(userJWT.Identifier, permissionIdentifier, resourceTypeIdentifier)
-	if !authorized {
-		return c.JSON(403, "Forbidden")
+	attributes, err := authorizationContext(c)
+	if err != nil {
+		return c.JSON(400, err)
 	}
 
-	return c.JSON(200, "Authorized")
+	decision := controller.service(c).AuthorizeUserByResourceType(userJWT.Identifier, permissionIdentifier, resourceTypeIdentifier, attributes)
+	return authorizationResponse(c, decision)
 }
 
 func (controller AuthzRBACController) AuthorizeByResource(c echo.Context) error {
@@ -236,16 +306,151 @@ func (controller AuthzRBACController) AuthorizeByResource(c echo.Context) error
 
 	fmt.Println("User JWT:", userJWT)
 
-	authorized := controller.authzRBACService.AuthorizeUserByResource(userJWT.Identifier, permissionIdentifier, resourceIdentifier)
-	if !authorized {
-		return c.JSON(403, "Forbidden")
+	attributes, err := authorizationContext(c)
+	if err != nil {
+		return c.JSON(400, err)
+	}
+
+	decision := controller.service(c).AuthorizeUserByResource(userJWT.Identifier, permissionIdentifier, resourceIdentifier, attributes)
+	return authorizationResponse(c, decision)
+}
+
+// subjectService resolves the user a check is about. Checks about a user other than
+// the authenticated one are reserved to administrators.
+func (controller AuthzRBACController) subjectService(c echo.Context, subject string) (services.AuthzRBACService, string, bool) {
+	if subject == "" || subject == currentUser(c) {
+		return controller.service(c), currentUser(c), true
+	}
+
+	if _, ok := currentAdmin(c); !ok {
+		return nil, "", false
+	}
+
+	// A restrição de papéis do token vale para o próprio usuário, não para o consultado
+	return controller.authzRBACService, subject, true
+}
+
+// AuthorizeBatch answers many checks in one call, in order
+func (controller AuthzRBACController) AuthorizeBatch(c echo.Context) error {
+	var batch schemas.RBACBatchAuthorization
+
+	if err := c.Bind(&batch); err != nil {
+		return c.JSON(400, err)
+	}
+
+	service, subject, ok := controller.subjectService(c, batch.Subject)
+	if !ok {
+		return c.JSON(403, "Only administrators can check the permissions of other users")
+	}
+
+	if batch.Environment == nil {
+		batch.Environment = map[string]interface{}{}
+	}
+	batch.Environment["ip"] = c.RealIP()
+
+	response, err := service.AuthorizeUserBatch(subject, &batch)
+	if err != nil {
+		if errors.Is(err, services.ErrBatchTooLarge) {
+			return c.JSON(413, err.Error())
+		}
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, response)
+}
+
+// ExplainAuthorization returns the decision trace of a check
+func (controller AuthzRBACController) ExplainAuthorization(c echo.Context) error {
+	var request schemas.RBACExplainRequest
+
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, err)
+	}
+
+	service, subject, ok := controller.subjectService(c, request.Subject)
+	if !ok {
+		return c.JSON(403, "Only administrators can check the permissions of other users")
+	}
+
+	if request.Environment == nil {
+		request.Environment = map[string]interface{}{}
+	}
+	request.Environment["ip"] = c.RealIP()
+
+	trace, err := service.Explain(subject, &request)
+	if err != nil {
+		if errors.Is(err, services.ErrCheckAmbiguous) {
+			return c.JSON(400, err.Error())
+		}
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, trace)
+}
+
+// SimulateAuthorization evaluates a check against proposed policy changes without
+// persisting them. Simulations are reserved to administrators.
+func (controller AuthzRBACController) SimulateAuthorization(c echo.Context) error {
+	var request schemas.RBACSimulationRequest
+
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can simulate policy changes")
+	}
+
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, err)
+	}
+
+	subject := request.Subject
+	if subject == "" {
+		subject = currentUser(c)
+	}
+
+	if request.Environment == nil {
+		request.Environment = map[string]interface{}{}
+	}
+	request.Environment["ip"] = c.RealIP()
+
+	simulation, err := controller.authzRBACService.Simulate(subject, &request)
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, simulation)
+}
+
+// authorizationContext reads the attributes sent in the body for permission conditions.
+// The client IP is always taken from the request, so it can't be forged in the body.
+func authorizationContext(c echo.Context) (*schemas.RBACAuthorizationContext, error) {
+	var attributes schemas.RBACAuthorizationContext
+
+	if err := c.Bind(&attributes); err != nil {
+		return nil, err
+	}
+
+	if attributes.Environment == nil {
+		attributes.Environment = map[string]interface{}{}
 	}
+	attributes.Environment["ip"] = c.RealIP()
 
-	return c.JSON(200, "Authorized")
+	return &attributes, nil
+}
+
+// authorizationResponse answers 200 or 403 with the decision, so callers can tell which rule applied
+func authorizationResponse(c echo.Context, decision schemas.RBACDecision) error {
+	if !decision.Allowed {
+		return c.JSON(403, decision)
+	}
+
+	return c.JSON(200, decision)
 }
 
 // Gerenciamento de Papéis e Permissões
 func (controller AuthzRBACController) GrantRoleToUser(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can grant roles")
+	}
+
 	roleIdentifier := c.QueryParam("role")
 	userIdentifier := c.QueryParam("user")
 
@@ -256,7 +461,80 @@ func (controller AuthzRBACController) GrantRoleToUser(c echo.Context) error {
 	return c.JSON(200, "Role granted successfully!")
 }
 
+// AssignRole grants a role to a user within an optional time window, on behalf of
+// the authenticated administrator
+func (controller AuthzRBACController) AssignRole(c echo.Context) error {
+	var assignment schemas.RBACRoleAssignmentCreate
+
+	admin, ok := currentAdmin(c)
+	if !ok {
+		return c.JSON(403, "Only administrators can assign roles")
+	}
+
+	if err := c.Bind(&assignment); err != nil {
+		return c.JSON(400, err)
+	}
+
+	returnAssignment, err := controller.authzRBACService.AssignRole(&assignment, admin.Identifier)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAssignmentWindow) {
+			return c.JSON(400, err.Error())
+		}
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(201, returnAssignment)
+}
+
+func (controller AuthzRBACController) GetAssignments(c echo.Context) error {
+	var filter schemas.RBACRoleAssignmentFilter
+
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can list role assignments")
+	}
+
+	if err := c.Bind(&filter); err != nil {
+		return c.JSON(400, err)
+	}
+
+	assignments, err := controller.authzRBACService.GetAssignments(&filter)
+	if err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(200, assignments)
+}
+
+// GetExpiringAssignments lists the assignments expiring within the given seconds,
+// a week by default
+func (controller AuthzRBACController) GetExpiringAssignments(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can list role assignments")
+	}
+
+	within := 7 * 24 * time.Hour
+
+	if value := c.QueryParam("within"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return c.JSON(400, "within must be a positive number of seconds")
+		}
+		within = time.Duration(seconds) * time.Second
+	}
+
+	assignments, err := controller.authzRBACService.GetExpiringAssignments(within)
+	if err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(200, assignments)
+}
+
 func (controller AuthzRBACController) RevokeRoleFromUser(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can revoke roles")
+	}
+
 	roleIdentifier := c.QueryParam("role")
 	userIdentifier := c.QueryParam("user")
 
@@ -267,37 +545,111 @@ func (controller AuthzRBACController) RevokeRoleFromUser(c echo.Context) error {
 	return c.JSON(200, "Role revoked successfully!")
 }
 
+func (controller AuthzRBACController) GrantRoleToGroup(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can grant roles")
+	}
+
+	roleIdentifier := c.QueryParam("role")
+	groupIdentifier := c.QueryParam("group")
+
+	if err := controller.authzRBACService.GrantRoleToGroup(roleIdentifier, groupIdentifier); err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(200, "Role granted successfully!")
+}
+
+func (controller AuthzRBACController) RevokeRoleFromGroup(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can revoke roles")
+	}
+
+	roleIdentifier := c.QueryParam("role")
+	groupIdentifier := c.QueryParam("group")
+
+	if err := controller.authzRBACService.RevokeRoleFromGroup(roleIdentifier, groupIdentifier); err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(200, "Role revoked successfully!")
+}
+
+// The granted queries answer about the authenticated user unless another one is
+// given, which is reserved to administrators
 func (controller AuthzRBACController) ListGrantedRoles(c echo.Context) error {
-	userIdentifier := c.QueryParam("user")
+	service, userIdentifier, ok := controller.subjectService(c, c.QueryParam("user"))
+	if !ok {
+		return c.JSON(403, "Only administrators can list the access of other users")
+	}
 
-	roles, err := controller.authzRBACService.ListGrantedRoles(userIdentifier)
+	roles, err := service.ListGrantedRoles(userIdentifier)
 	if err != nil {
-		return c.JSON(400, err)
+		return c.JSON(404, err)
 	}
 
 	return c.JSON(200, roles)
 }
 
-func (controller AuthzRBACController) ListGrantedResources(c echo.Context) error {
-	userIdentifier := c.QueryParam("user")
-	permissionIdentifier := c.QueryParam("permission")
+func (controller AuthzRBACController) ListGrantedPermissions(c echo.Context) error {
+	service, userIdentifier, ok := controller.subjectService(c, c.QueryParam("user"))
+	if !ok {
+		return c.JSON(403, "Only administrators can list the access of other users")
+	}
 
-	resources, err := controller.authzRBACService.ListGrantedResources(userIdentifier, permissionIdentifier)
+	permissions, err := service.GetUserPermissions(userIdentifier)
 	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, permissions)
+}
+
+func (controller AuthzRBACController) ListGrantedResources(c echo.Context) error {
+	var filter schemas.RBACGrantedResourceFilter
+
+	if err := c.Bind(&filter); err != nil {
 		return c.JSON(400, err)
 	}
 
+	service, userIdentifier, ok := controller.subjectService(c, filter.User)
+	if !ok {
+		return c.JSON(403, "Only administrators can list the access of other users")
+	}
+
+	resources, err := service.ListGrantedResources(userIdentifier, &filter)
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
 	return c.JSON(200, resources)
 }
 
 func (controller AuthzRBACController) ListGrantedResourceTypes(c echo.Context) error {
-	userIdentifier := c.QueryParam("user")
-	permissionIdentifier := c.QueryParam("permission")
+	service, userIdentifier, ok := controller.subjectService(c, c.QueryParam("user"))
+	if !ok {
+		return c.JSON(403, "Only administrators can list the access of other users")
+	}
 
-	resourceTypes, err := controller.authzRBACService.ListGrantedResourceTypes(userIdentifier, permissionIdentifier)
+	resourceTypes, err := service.ListGrantedResourceTypes(userIdentifier, c.QueryParam("permission"))
 	if err != nil {
-		return c.JSON(400, err)
+		return c.JSON(404, err)
 	}
 
 	return c.JSON(200, resourceTypes)
 }
+
+// GetResourceAccess lists who holds a permission on a resource. It is reserved to
+// administrators.
+func (controller AuthzRBACController) GetResourceAccess(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can list who has access to a resource")
+	}
+
+	access, err := controller.authzRBACService.GetResourceAccess(c.QueryParam("resource"), c.QueryParam("permission"))
+	if err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(200, access)
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type AuthzReBACController struct {
+	authzReBACService services.AuthzReBACService
+}
+
+func NewAuthzReBACController(authzReBACService services.AuthzReBACService) AuthzReBACController {
+	return AuthzReBACController{authzReBACService: authzReBACService}
+}
+
+func rebacErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, services.ErrReBACNamespaceNotFound):
+		return c.JSON(404, err.Error())
+	case errors.Is(err, services.ErrReBACUnknownRelation), errors.Is(err, services.ErrInvalidReBACObject),
+		errors.Is(err, services.ErrInvalidRewrite), errors.Is(err, services.ErrInvalidZookie),
+		errors.Is(err, services.ErrReBACDepthExceeded):
+		return c.JSON(400, err.Error())
+	}
+	return c.JSON(400, err)
+}
+
+// currentSubject is the subject queries default to: the authenticated user
+func currentSubject(c echo.Context) string {
+	return "user:" + currentUser(c)
+}
+
+// Namespaces
+func (controller AuthzReBACController) CreateNamespace(c echo.Context) error {
+	var namespace schemas.ReBACNamespaceCreate
+
+	if err := c.Bind(&namespace); err != nil {
+		return c.JSON(400, err)
+	}
+
+	createdNamespace, err := controller.authzReBACService.CreateNamespace(&namespace)
+	if err != nil {
+		return rebacErrorResponse(c, err)
+	}
+
+	return c.JSON(200, createdNamespace)
+}
+
+func (controller AuthzReBACController) GetNamespace(c echo.Context) error {
+	namespace, err := controller.authzReBACService.GetNamespace(c.Param("name"))
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, namespace)
+}
+
+func (controller AuthzReBACController) GetNamespaces(c echo.Context) error {
+	namespaces, err := controller.authzReBACService.GetNamespaces()
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, namespaces)
+}
+
+func (controller AuthzReBACController) UpdateNamespace(c echo.Context) error {
+	var namespace schemas.ReBACNamespaceUpdate
+
+	if err := c.Bind(&namespace); err != nil {
+		return c.JSON(400, err)
+	}
+
+	updatedNamespace, err := controller.authzReBACService.UpdateNamespace(c.Param("name"), &namespace)
+	if err != nil {
+		return rebacErrorResponse(c, err)
+	}
+
+	return c.JSON(200, updatedNamespace)
+}
+
+func (controller AuthzReBACController) DeleteNamespace(c echo.Context) error {
+	if err := controller.authzReBACService.DeleteNamespace(c.Param("name")); err != nil {
+		return rebacErrorResponse(c, err)
+	}
+
+	return c.JSON(204, "Namespace deleted successfully!")
+}
+
+// Tuples
+func (controller AuthzReBACController) WriteTuples(c echo.Context) error {
+	var write schemas.ReBACTupleWrite
+
+	if err := c.Bind(&write); err != nil {
+		return c.JSON(400, err)
+	}
+
+	response, err := controller.authzReBACService.WriteTuples(&write)
+	if err != nil {
+		return rebacErrorResponse(c, err)
+	}
+
+	return c.JSON(200, response)
+}
+
+func (controller AuthzReBACController) ReadTuples(c echo.Context) error {
+	var filter schemas.ReBACTupleFilter
+
+	if err := c.Bind(&filter); err != nil {
+		return c.JSON(400, err)
+	}
+
+	tuples, err := controller.authzReBACService.ReadTuples(&filter)
+	if err != nil {
+		return rebacErrorResponse(c, err)
+	}
+
+	return c.JSON(200, tuples)
+}
+
+// Consultas
+func (controller AuthzReBACController) Check(c echo.Context) error {
+	var request schemas.ReBACCheckRequest
+
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, err)
+	}
+
+	if request.Subject == "" {
+		request.Subject = currentSubject(c)
+	}
+
+	response, err := controller.authzReBACService.Check(&request)
+	if err != nil {
+		return rebacErrorResponse(c, err)
+	}
+
+	return c.JSON(200, response)
+}
+
+func (controller AuthzReBACController) Expand(c echo.Context) error {
+	var request schemas.ReBACExpandRequest
+
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, err)
+	}
+
+	response, err := controller.authzReBACService.Expand(&request)
+	if err != nil {
+		return rebacErrorResponse(c, err)
+	}
+
+	return c.JSON(200, response)
+}
+
+func (controller AuthzReBACController) ListObjects(c echo.Context) error {
+	var request schemas.ReBACListObjectsRequest
+
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, err)
+	}
+
+	if request.Subject == "" {
+		request.Subject = currentSubject(c)
+	}
+
+	response, err := controller.authzReBACService.ListObjects(&request)
+	if err != nil {
+		return rebacErrorResponse(c, err)
+	}
+
+	return c.JSON(200, response)
+}
+
+func (controller AuthzReBACController) ListUsers(c echo.Context) error {
+	var request schemas.ReBACListUsersRequest
+
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, err)
+	}
+
+	response, err := controller.authzReBACService.ListUsers(&request)
+	if err != nil {
+		return rebacErrorResponse(c, err)
+	}
+
+	return c.JSON(200, response)
+}
@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type DirectoryController struct {
+	ldapService services.LDAPService
+}
+
+func NewDirectoryController(ldapService services.LDAPService) DirectoryController {
+	return DirectoryController{ldapService: ldapService}
+}
+
+// SyncLDAP runs a directory sync immediately instead of waiting for the periodic job
+func (controller DirectoryController) SyncLDAP(c echo.Context) error {
+	result, err := controller.ldapService.Sync()
+	if err != nil {
+		return c.JSON(502, err.Error())
+	}
+
+	return c.JSON(200, result)
+}
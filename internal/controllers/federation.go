@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type FederationController struct {
+	authService       services.AuthService
+	mfaService        services.MFAService
+	federationService services.FederationService
+	sessionService    services.SessionService
+}
+
+func NewFederationController(authService services.AuthService, mfaService services.MFAService, federationService services.FederationService, sessionService services.SessionService) FederationController {
+	return FederationController{authService: authService, mfaService: mfaService, federationService: federationService, sessionService: sessionService}
+}
+
+// Login redirects the browser to the upstream provider
+func (controller FederationController) Login(c echo.Context) error {
+	provider := c.Param("provider")
+
+	client, err := controller.authService.GetClient(c.QueryParam("client_id"))
+
+	if err != nil {
+		return c.JSON(404, "Client not found")
+	}
+
+	if !client.AllowsLoginMethod(services.LoginMethodFederation) {
+		return c.JSON(400, "Login method not allowed for this client")
+	}
+
+	redirectURL, err := controller.federationService.StartLogin(provider, client.ID)
+
+	if errors.Is(err, services.ErrUnknownProvider) {
+		return c.JSON(404, err.Error())
+	}
+
+	if err != nil {
+		return c.JSON(502, err.Error())
+	}
+
+	return c.Redirect(302, redirectURL)
+}
+
+// Callback exchanges the provider authorization code and issues whoami tokens
+func (controller FederationController) Callback(c echo.Context) error {
+	provider := c.Param("provider")
+
+	if providerError := c.QueryParam("error"); providerError != "" {
+		return c.JSON(401, providerError)
+	}
+
+	user, clientID, err := controller.federationService.CompleteLogin(provider, c.QueryParam("state"), c.QueryParam("code"))
+
+	switch {
+	case errors.Is(err, services.ErrUnknownProvider):
+		return c.JSON(404, err.Error())
+	case errors.Is(err, services.ErrInvalidFederationState), errors.Is(err, services.ErrFederatedUserNotFound):
+		return c.JSON(401, err.Error())
+	case err != nil:
+		return c.JSON(502, err.Error())
+	}
+
+	if !user.IsActive {
+		return c.JSON(401, "User is not active")
+	}
+
+	return completeLogin(c, controller.authService, controller.mfaService, controller.sessionService, user.ID, clientID, services.LoginMethodFederation, "")
+}
+
+func (controller FederationController) LinkIdentity(c echo.Context) error {
+	var identity schemas.ExternalIdentityCreate
+	var identifier = c.Param("identifier")
+
+	if err := c.Bind(&identity); err != nil {
+		return c.JSON(400, err)
+	}
+
+	linked, err := controller.federationService.LinkIdentity(identifier, &identity)
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, linked)
+}
+
+func (controller FederationController) ListIdentities(c echo.Context) error {
+	var identifier = c.Param("identifier")
+
+	identities, err := controller.federationService.ListIdentities(identifier)
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, identities)
+}
+
+func (controller FederationController) UnlinkIdentity(c echo.Context) error {
+	var identifier = c.Param("identifier")
+
+	identityID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, "Invalid identity id")
+	}
+
+	if err := controller.federationService.UnlinkIdentity(identifier, uint(identityID)); err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(204, "Identity unlinked successfully!")
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+// ImpersonationController lets support staff act as a user, leaving an audit trail
+type ImpersonationController struct {
+	authService    services.AuthService
+	sessionService services.SessionService
+	auditService   services.AuditService
+}
+
+func NewImpersonationController(authService services.AuthService, sessionService services.SessionService, auditService services.AuditService) ImpersonationController {
+	return ImpersonationController{authService: authService, sessionService: sessionService, auditService: auditService}
+}
+
+// impersonating reports whether the request carries an impersonation token.
+// Routes that manage the user's credentials refuse these tokens, so whoever
+// acts as the user can't take over the account.
+func impersonating(c echo.Context) bool {
+	_, ok := c.Get("actor_id").(uint)
+	return ok
+}
+
+// currentAdmin returns the authenticated user when it is an administrator acting as itself
+func currentAdmin(c echo.Context) (*schemas.UserResponse, bool) {
+	user, ok := c.Get("user").(*schemas.UserResponse)
+	if !ok || !user.IsAdmin {
+		return nil, false
+	}
+
+	// Um token de personificação nunca carrega os poderes de quem o emitiu
+	if impersonating(c) {
+		return nil, false
+	}
+
+	return user, true
+}
+
+// Impersonate issues a short-lived token for the target user carrying an act
+// claim that identifies the administrator
+func (controller ImpersonationController) Impersonate(c echo.Context) error {
+	var request schemas.ImpersonationCreate
+	var identifier = c.Param("identifier")
+
+	actor, ok := currentAdmin(c)
+	if !ok {
+		return c.JSON(403, "Only administrators can impersonate users")
+	}
+
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, err)
+	}
+
+	if request.Reason == "" {
+		return c.JSON(400, "A reason is required to impersonate a user")
+	}
+
+	target, err := controller.authService.GetUser(identifier)
+	if err != nil {
+		return c.JSON(404, "User not found")
+	}
+
+	switch {
+	case target.ID == actor.ID:
+		return c.JSON(400, "Administrators cannot impersonate themselves")
+	case target.IsAdmin:
+		return c.JSON(403, "Administrators cannot be impersonated")
+	case !target.IsActive:
+		return c.JSON(400, "User is not active")
+	}
+
+	client, err := controller.authService.GetClient(request.ClientID)
+	if err != nil || !client.IsActive {
+		return c.JSON(404, "Client not found")
+	}
+
+	session, err := startSession(c, controller.sessionService, target.ID, client.ID, services.AuthMethodImpersonation)
+	if err != nil {
+		return c.JSON(500, err.Error())
+	}
+
+	// O registro vem antes do token: não existe personificação sem rastro
+	err = controller.auditService.Record(&schemas.AuditLogCreate{
+		Action:    services.AuditImpersonationStart,
+		ActorID:   actor.ID,
+		UserID:    target.ID,
+		SessionID: session.ID,
+		Method:    c.Request().Method,
+		Path:      c.Request().URL.Path,
+		Status:    200,
+		IP:        c.RealIP(),
+		Reason:    request.Reason,
+	})
+	if err != nil {
+		return c.JSON(500, err.Error())
+	}
+
+	expiresIn := time.Now().Unix() + int64(config.Config.Impersonation.Expiration)
+
+	claims, err := tokenClaims(controller.authService, target.ID, client.ID, session, expiresIn)
+	if err != nil {
+		return tokenErrorResponse(c, err)
+	}
+
+	claims.Actor = &ActorClaim{Subject: actor.Identifier, UserID: actor.ID}
+	claims.Impersonated = true
+
+	tokenResponse, err := storeToken(controller.authService, claims, session, &actor.ID)
+	if err != nil {
+		return tokenErrorResponse(c, err)
+	}
+
+	// O refresh é recusado para estes tokens, então não há por que devolvê-lo
+	tokenResponse.RefreshToken = ""
+
+	return c.JSON(200, tokenResponse)
+}
+
+func (controller ImpersonationController) GetAuditLog(c echo.Context) error {
+	var filter schemas.AuditLogFilter
+
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can read the audit log")
+	}
+
+	if err := c.Bind(&filter); err != nil {
+		return c.JSON(400, err)
+	}
+
+	entries, err := controller.auditService.GetEntries(&filter)
+	if err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(200, entries)
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type InvitationController struct {
+	invitationService services.InvitationService
+}
+
+func NewInvitationController(invitationService services.InvitationService) InvitationController {
+	return InvitationController{invitationService: invitationService}
+}
+
+// invitationErrorResponse maps invitation errors to HTTP responses
+func invitationErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvitationNotFound):
+		return c.JSON(404, err.Error())
+	case errors.Is(err, services.ErrInvitationClosed):
+		return c.JSON(409, err.Error())
+	case errors.Is(err, services.ErrInvalidInvitation):
+		return c.JSON(401, err.Error())
+	}
+	return c.JSON(400, err.Error())
+}
+
+func invitationID(c echo.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	return uint(id), err == nil
+}
+
+func (controller InvitationController) CreateInvitation(c echo.Context) error {
+	var invitation schemas.InvitationCreate
+
+	if err := c.Bind(&invitation); err != nil {
+		return c.JSON(400, err)
+	}
+
+	var invitedByID uint
+	if user, ok := c.Get("user").(*schemas.UserResponse); ok {
+		invitedByID = user.ID
+	}
+
+	createdInvitation, err := controller.invitationService.CreateInvitation(&invitation, invitedByID)
+	if err != nil {
+		return invitationErrorResponse(c, err)
+	}
+
+	return c.JSON(200, createdInvitation)
+}
+
+func (controller InvitationController) GetInvitation(c echo.Context) error {
+	id, ok := invitationID(c)
+	if !ok {
+		return c.JSON(400, "Invalid invitation id")
+	}
+
+	invitation, err := controller.invitationService.GetInvitation(id)
+	if err != nil {
+		return invitationErrorResponse(c, err)
+	}
+
+	return c.JSON(200, invitation)
+}
+
+func (controller InvitationController) GetInvitations(c echo.Context) error {
+	invitations, err := controller.invitationService.GetInvitations(c.QueryParam("status"))
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, invitations)
+}
+
+func (controller InvitationController) ResendInvitation(c echo.Context) error {
+	id, ok := invitationID(c)
+	if !ok {
+		return c.JSON(400, "Invalid invitation id")
+	}
+
+	invitation, err := controller.invitationService.ResendInvitation(id)
+	if err != nil {
+		return invitationErrorResponse(c, err)
+	}
+
+	return c.JSON(200, invitation)
+}
+
+func (controller InvitationController) RevokeInvitation(c echo.Context) error {
+	id, ok := invitationID(c)
+	if !ok {
+		return c.JSON(400, "Invalid invitation id")
+	}
+
+	if err := controller.invitationService.RevokeInvitation(id); err != nil {
+		return invitationErrorResponse(c, err)
+	}
+
+	return c.JSON(204, "Invitation revoked successfully!")
+}
+
+// AcceptInvitation lets the invitee set a password, activating the account
+func (controller InvitationController) AcceptInvitation(c echo.Context) error {
+	var accept schemas.InvitationAccept
+
+	if err := c.Bind(&accept); err != nil {
+		return c.JSON(400, err)
+	}
+
+	user, err := controller.invitationService.AcceptInvitation(&accept)
+	if err != nil {
+		return invitationErrorResponse(c, err)
+	}
+
+	return c.JSON(200, user)
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type PasswordlessController struct {
+	authService         services.AuthService
+	mfaService          services.MFAService
+	passwordlessService services.PasswordlessService
+	sessionService      services.SessionService
+}
+
+func NewPasswordlessController(authService services.AuthService, mfaService services.MFAService, passwordlessService services.PasswordlessService, sessionService services.SessionService) PasswordlessController {
+	return PasswordlessController{authService: authService, mfaService: mfaService, passwordlessService: passwordlessService, sessionService: sessionService}
+}
+
+func (controller PasswordlessController) Start(c echo.Context) error {
+	var request schemas.PasswordlessStart
+
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, err)
+	}
+
+	client, ok := authenticateClient(controller.authService, request.ClientID, request.ClientSecret)
+
+	if !ok {
+		return c.JSON(404, "Client not found or invalid credentials")
+	}
+
+	if !client.AllowsLoginMethod(request.Method) {
+		return c.JSON(400, "Login method not allowed for this client")
+	}
+
+	err := controller.passwordlessService.StartLogin(client.ID, request.Username, request.Method)
+
+	switch {
+	case errors.Is(err, services.ErrTooManyLoginRequests):
+		return c.JSON(429, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// Não revela se o usuário existe
+	case err != nil:
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(202, "If the account exists, a sign-in message was sent")
+}
+
+func (controller PasswordlessController) Redeem(c echo.Context) error {
+	var request schemas.PasswordlessRedeem
+	var user *models.User
+	var err error
+
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(400, err)
+	}
+
+	client, ok := authenticateClient(controller.authService, request.ClientID, request.ClientSecret)
+
+	if !ok {
+		return c.JSON(404, "Client not found or invalid credentials")
+	}
+
+	if request.Token != "" {
+		if !client.AllowsLoginMethod(services.LoginMethodMagicLink) {
+			return c.JSON(400, "Login method not allowed for this client")
+		}
+		user, err = controller.passwordlessService.RedeemMagicLink(client.ID, request.Token)
+	} else {
+		if !client.AllowsLoginMethod(services.LoginMethodOTP) {
+			return c.JSON(400, "Login method not allowed for this client")
+		}
+		user, err = controller.passwordlessService.RedeemOTP(client.ID, request.Username, request.Code)
+	}
+
+	if err != nil {
+		return c.JSON(401, err.Error())
+	}
+
+	if !user.IsActive {
+		return c.JSON(401, "User is not active")
+	}
+
+	method := services.LoginMethodOTP
+	if request.Token != "" {
+		method = services.LoginMethodMagicLink
+	}
+
+	return completeLogin(c, controller.authService, controller.mfaService, controller.sessionService, user.ID, client.ID, method, request.MFACode)
+}
@@ -0,0 +1,320 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/saml"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+const samlSessionCookie = "whoami_saml_session"
+
+var samlLoginTemplate = template.Must(template.New("saml-login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+<h1>Sign in to {{.ServiceProvider}}</h1>
+{{if .Error}}<p>{{.Error}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+<input type="text" name="identifier" placeholder="Identifier" autofocus required>
+<input type="password" name="password" placeholder="Password" required>
+<input type="text" name="mfa_code" placeholder="Authenticator code, if enabled" inputmode="numeric" autocomplete="one-time-code">
+{{if .SAMLRequest}}<input type="hidden" name="SAMLRequest" value="{{.SAMLRequest}}">{{end}}
+{{if .RelayState}}<input type="hidden" name="RelayState" value="{{.RelayState}}">{{end}}
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+type SAMLIdPController struct {
+	authService services.AuthService
+	mfaService  services.MFAService
+	samlService services.SAMLIdPService
+}
+
+func NewSAMLIdPController(authService services.AuthService, mfaService services.MFAService, samlService services.SAMLIdPService) SAMLIdPController {
+	return SAMLIdPController{authService: authService, mfaService: mfaService, samlService: samlService}
+}
+
+// samlMessage reads a protocol message from the query (HTTP-Redirect) or from the form (HTTP-POST)
+func samlMessage(c echo.Context, parameter string) *services.SAMLMessage {
+	if value := c.QueryParam(parameter); value != "" {
+		return &services.SAMLMessage{
+			Binding:    saml.BindingHTTPRedirect,
+			Value:      value,
+			RelayState: c.QueryParam("RelayState"),
+			RawQuery:   c.Request().URL.RawQuery,
+		}
+	}
+
+	if value := c.FormValue(parameter); value != "" {
+		return &services.SAMLMessage{
+			Binding:    saml.BindingHTTPPost,
+			Value:      value,
+			RelayState: c.FormValue("RelayState"),
+		}
+	}
+
+	return nil
+}
+
+func samlSessionToken(c echo.Context) string {
+	cookie, err := c.Cookie(samlSessionCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+func setSAMLSessionCookie(c echo.Context, value string, expires time.Time) {
+	secure := strings.HasPrefix(config.Config.SAML.BaseURL, "https://")
+
+	// Com HTTPS o cookie precisa de SameSite=None para acompanhar o POST vindo do SP
+	sameSite := http.SameSiteLaxMode
+	if secure {
+		sameSite = http.SameSiteNoneMode
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     samlSessionCookie,
+		Value:    value,
+		Path:     "/saml",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+	})
+}
+
+func (controller SAMLIdPController) renderLogin(c echo.Context, status int, request *services.SSORequest, message *services.SAMLMessage, loginError string) error {
+	data := map[string]string{
+		"ServiceProvider": request.ServiceProvider.EntityID,
+		"Error":           loginError,
+		"Action":          "/saml/sso",
+	}
+
+	if request.ServiceProvider.Name != "" {
+		data["ServiceProvider"] = request.ServiceProvider.Name
+	}
+
+	// Na binding Redirect a query é reenviada intacta para que a assinatura continue válida
+	if message.Binding == saml.BindingHTTPRedirect {
+		data["Action"] = "/saml/sso?" + message.RawQuery
+	} else {
+		data["SAMLRequest"] = message.Value
+		data["RelayState"] = message.RelayState
+	}
+
+	var page bytes.Buffer
+	if err := samlLoginTemplate.Execute(&page, data); err != nil {
+		return c.JSON(500, err.Error())
+	}
+
+	return c.HTMLBlob(status, page.Bytes())
+}
+
+func (controller SAMLIdPController) Metadata(c echo.Context) error {
+	metadata, err := controller.samlService.Metadata()
+	if err != nil {
+		return c.JSON(500, err.Error())
+	}
+
+	return c.Blob(200, "application/samlmetadata+xml", metadata)
+}
+
+// SSO receives AuthnRequests through both bindings, signs the user in when
+// there is no IdP session yet and posts the assertion back to the SP
+func (controller SAMLIdPController) SSO(c echo.Context) error {
+	message := samlMessage(c, "SAMLRequest")
+	if message == nil {
+		return c.JSON(400, "SAMLRequest is required")
+	}
+
+	request, err := controller.samlService.ParseAuthnRequest(message)
+
+	if errors.Is(err, services.ErrUnknownServiceProvider) {
+		return c.JSON(404, err.Error())
+	}
+
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	sessionToken := samlSessionToken(c)
+	if _, err := controller.samlService.SessionUser(sessionToken); err != nil || request.Request.ForceAuthn {
+		sessionToken = ""
+	}
+
+	if sessionToken == "" {
+		if request.Request.IsPassive {
+			page, err := controller.samlService.FailResponse(request, saml.StatusResponder, saml.StatusNoPassive)
+			if err != nil {
+				return c.JSON(500, err.Error())
+			}
+			return c.HTMLBlob(200, page)
+		}
+
+		identifier := c.FormValue("identifier")
+		password := c.FormValue("password")
+
+		if c.Request().Method != http.MethodPost || identifier == "" || password == "" {
+			return controller.renderLogin(c, 200, request, message, "")
+		}
+
+		if !controller.authService.CompareUserPassword(identifier, password) {
+			return controller.renderLogin(c, 401, request, message, "Invalid credentials")
+		}
+
+		user, err := controller.authService.GetUser(identifier)
+		if err != nil || !user.IsActive {
+			return controller.renderLogin(c, 401, request, message, "Invalid credentials")
+		}
+
+		// Assim como no grant password, um segundo fator confirmado exige o código junto da senha
+		required, err := controller.mfaService.Required(user.ID)
+		if err != nil {
+			return c.JSON(500, err.Error())
+		}
+
+		if required {
+			if err := controller.mfaService.Verify(user.ID, c.FormValue("mfa_code")); err != nil {
+				return controller.renderLogin(c, 401, request, message, err.Error())
+			}
+		}
+
+		sessionToken, err = controller.samlService.StartSession(user.ID)
+		if err != nil {
+			return c.JSON(500, err.Error())
+		}
+
+		setSAMLSessionCookie(c, sessionToken, time.Now().Add(time.Duration(config.Config.SAML.SessionLifetime)*time.Second))
+	}
+
+	page, err := controller.samlService.IssueResponse(request, sessionToken)
+	if err != nil {
+		return c.JSON(500, err.Error())
+	}
+
+	return c.HTMLBlob(200, page)
+}
+
+// SLO handles LogoutRequests from service providers. Without a request it
+// just ends the IdP session of the browser.
+func (controller SAMLIdPController) SLO(c echo.Context) error {
+	message := samlMessage(c, "SAMLRequest")
+
+	if message == nil {
+		if sessionToken := samlSessionToken(c); sessionToken != "" {
+			if err := controller.samlService.EndSession(sessionToken); err != nil {
+				return c.JSON(500, err.Error())
+			}
+		}
+
+		setSAMLSessionCookie(c, "", time.Unix(0, 0))
+		return c.JSON(200, "Logged out successfully!")
+	}
+
+	result, err := controller.samlService.Logout(message)
+
+	if errors.Is(err, services.ErrUnknownServiceProvider) {
+		return c.JSON(404, err.Error())
+	}
+
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	setSAMLSessionCookie(c, "", time.Unix(0, 0))
+
+	if result.RedirectURL != "" {
+		return c.Redirect(302, result.RedirectURL)
+	}
+
+	return c.HTMLBlob(200, result.Form)
+}
+
+func serviceProviderID(c echo.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	return uint(id), err
+}
+
+func (controller SAMLIdPController) CreateServiceProvider(c echo.Context) error {
+	var sp schemas.SAMLServiceProviderCreate
+
+	if err := c.Bind(&sp); err != nil {
+		return c.JSON(400, err)
+	}
+
+	createdSP, err := controller.samlService.CreateServiceProvider(&sp)
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, createdSP)
+}
+
+func (controller SAMLIdPController) GetServiceProvider(c echo.Context) error {
+	id, err := serviceProviderID(c)
+	if err != nil {
+		return c.JSON(400, "Invalid service provider id")
+	}
+
+	sp, err := controller.samlService.GetServiceProvider(id)
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, sp)
+}
+
+func (controller SAMLIdPController) GetServiceProviders(c echo.Context) error {
+	sps, err := controller.samlService.GetServiceProviders()
+	if err != nil {
+		return c.JSON(500, err)
+	}
+
+	return c.JSON(200, sps)
+}
+
+func (controller SAMLIdPController) UpdateServiceProvider(c echo.Context) error {
+	var sp schemas.SAMLServiceProviderUpdate
+
+	id, err := serviceProviderID(c)
+	if err != nil {
+		return c.JSON(400, "Invalid service provider id")
+	}
+
+	if err := c.Bind(&sp); err != nil {
+		return c.JSON(400, err)
+	}
+
+	updatedSP, err := controller.samlService.UpdateServiceProvider(id, &sp)
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, updatedSP)
+}
+
+func (controller SAMLIdPController) DeleteServiceProvider(c echo.Context) error {
+	id, err := serviceProviderID(c)
+	if err != nil {
+		return c.JSON(400, "Invalid service provider id")
+	}
+
+	if err := controller.samlService.DeleteServiceProvider(id); err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(204, "Service provider deleted successfully!")
+}
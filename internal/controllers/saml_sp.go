@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type SAMLSPController struct {
+	authService    services.AuthService
+	mfaService     services.MFAService
+	samlService    services.SAMLSPService
+	sessionService services.SessionService
+}
+
+func NewSAMLSPController(authService services.AuthService, mfaService services.MFAService, samlService services.SAMLSPService, sessionService services.SessionService) SAMLSPController {
+	return SAMLSPController{authService: authService, mfaService: mfaService, samlService: samlService, sessionService: sessionService}
+}
+
+func (controller SAMLSPController) Metadata(c echo.Context) error {
+	metadata, err := controller.samlService.Metadata()
+	if err != nil {
+		return c.JSON(500, err.Error())
+	}
+
+	return c.Blob(200, "application/samlmetadata+xml", metadata)
+}
+
+// Login sends the browser to the partner identity provider
+func (controller SAMLSPController) Login(c echo.Context) error {
+	provider := c.Param("provider")
+
+	client, err := controller.authService.GetClient(c.QueryParam("client_id"))
+
+	if err != nil {
+		return c.JSON(404, "Client not found")
+	}
+
+	if !client.AllowsLoginMethod(services.LoginMethodFederation) {
+		return c.JSON(400, "Login method not allowed for this client")
+	}
+
+	result, err := controller.samlService.StartLogin(provider, client.ID)
+
+	if errors.Is(err, services.ErrUnknownProvider) {
+		return c.JSON(404, err.Error())
+	}
+
+	if err != nil {
+		return c.JSON(500, err.Error())
+	}
+
+	if result.RedirectURL != "" {
+		return c.Redirect(302, result.RedirectURL)
+	}
+
+	return c.HTMLBlob(200, result.Form)
+}
+
+// ACS consumes the identity provider Response and issues whoami tokens
+func (controller SAMLSPController) ACS(c echo.Context) error {
+	samlResponse := c.FormValue("SAMLResponse")
+	if samlResponse == "" {
+		return c.JSON(400, "SAMLResponse is required")
+	}
+
+	user, clientID, err := controller.samlService.ConsumeResponse(samlResponse)
+
+	switch {
+	case errors.Is(err, services.ErrUnknownProvider):
+		return c.JSON(404, err.Error())
+	case errors.Is(err, services.ErrInvalidSAMLResponse), errors.Is(err, services.ErrFederatedUserNotFound):
+		return c.JSON(401, err.Error())
+	case err != nil:
+		return c.JSON(500, err.Error())
+	}
+
+	if !user.IsActive {
+		return c.JSON(401, "User is not active")
+	}
+
+	return completeLogin(c, controller.authService, controller.mfaService, controller.sessionService, user.ID, clientID, services.AuthMethodSAML, "")
+}
+
+func (controller SAMLSPController) CreateIdentityProvider(c echo.Context) error {
+	var idp schemas.SAMLIdentityProviderCreate
+
+	if err := c.Bind(&idp); err != nil {
+		return c.JSON(400, err)
+	}
+
+	createdIdP, err := controller.samlService.CreateIdentityProvider(&idp)
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, createdIdP)
+}
+
+func (controller SAMLSPController) GetIdentityProvider(c echo.Context) error {
+	idp, err := controller.samlService.GetIdentityProvider(c.Param("name"))
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, idp)
+}
+
+func (controller SAMLSPController) GetIdentityProviders(c echo.Context) error {
+	idps, err := controller.samlService.GetIdentityProviders()
+	if err != nil {
+		return c.JSON(500, err)
+	}
+
+	return c.JSON(200, idps)
+}
+
+func (controller SAMLSPController) UpdateIdentityProvider(c echo.Context) error {
+	var idp schemas.SAMLIdentityProviderUpdate
+
+	if err := c.Bind(&idp); err != nil {
+		return c.JSON(400, err)
+	}
+
+	updatedIdP, err := controller.samlService.UpdateIdentityProvider(c.Param("name"), &idp)
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, updatedIdP)
+}
+
+func (controller SAMLSPController) DeleteIdentityProvider(c echo.Context) error {
+	if err := controller.samlService.DeleteIdentityProvider(c.Param("name")); err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(204, "Identity provider deleted successfully!")
+}
@@ -0,0 +1,332 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/scim"
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type SCIMController struct {
+	scimService services.SCIMService
+}
+
+func NewSCIMController(scimService services.SCIMService) SCIMController {
+	return SCIMController{scimService: scimService}
+}
+
+// scimResponse writes a SCIM message with the SCIM media type
+func scimResponse(c echo.Context, status int, body interface{}) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return c.Blob(status, scim.ContentType, content)
+}
+
+func scimErrorResponse(c echo.Context, err error) error {
+	scimErr := services.AsSCIMError(err)
+	if scimErr.Status >= 500 {
+		c.Logger().Errorf("SCIM error: %v", err)
+	}
+
+	return scimResponse(c, scimErr.Status, scimErr)
+}
+
+// scimResourceResponse writes a resource along with its ETag. A GET whose
+// If-None-Match matches the current version gets 304.
+func scimResourceResponse(c echo.Context, status int, resource scim.Resource) error {
+	if meta, ok := resource["meta"].(map[string]interface{}); ok {
+		if version, _ := meta["version"].(string); version != "" {
+			c.Response().Header().Set("ETag", version)
+
+			if c.Request().Method == "GET" && c.Request().Header.Get("If-None-Match") == version {
+				return c.NoContent(304)
+			}
+		}
+
+		if location, _ := meta["location"].(string); location != "" && status == 201 {
+			c.Response().Header().Set("Location", location)
+		}
+	}
+
+	return scimResponse(c, status, resource)
+}
+
+// decodeSCIMBody reads a JSON body; Bind does not know the application/scim+json media type
+func decodeSCIMBody(c echo.Context, target interface{}) error {
+	limit := int64(config.Config.SCIM.BulkMaxPayload)
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, limit+1))
+	if err != nil {
+		return err
+	}
+
+	if int64(len(body)) > limit {
+		return scim.NewError(413, "", "request body exceeds %d bytes", limit)
+	}
+
+	if err := json.Unmarshal(body, target); err != nil {
+		return scim.NewError(400, scim.ErrorInvalidSyntax, "invalid JSON: %v", err)
+	}
+
+	return nil
+}
+
+func (controller SCIMController) query(c echo.Context) (*scim.Query, error) {
+	return scim.ParseQuery(c.QueryParams(), config.Config.SCIM.MaxResults)
+}
+
+func (controller SCIMController) ListUsers(c echo.Context) error {
+	query, err := controller.query(c)
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	users, err := controller.scimService.ListUsers(query)
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return scimResponse(c, 200, users)
+}
+
+func (controller SCIMController) GetUser(c echo.Context) error {
+	user, err := controller.scimService.GetUser(c.Param("id"))
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return scimResourceResponse(c, 200, user)
+}
+
+func (controller SCIMController) CreateUser(c echo.Context) error {
+	var resource scim.Resource
+	if err := decodeSCIMBody(c, &resource); err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	user, err := controller.scimService.CreateUser(resource)
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return scimResourceResponse(c, 201, user)
+}
+
+func (controller SCIMController) ReplaceUser(c echo.Context) error {
+	var resource scim.Resource
+	if err := decodeSCIMBody(c, &resource); err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	user, err := controller.scimService.ReplaceUser(c.Param("id"), resource, c.Request().Header.Get("If-Match"))
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return scimResourceResponse(c, 200, user)
+}
+
+func (controller SCIMController) PatchUser(c echo.Context) error {
+	var patch scim.PatchRequest
+	if err := decodeSCIMBody(c, &patch); err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	user, err := controller.scimService.PatchUser(c.Param("id"), &patch, c.Request().Header.Get("If-Match"))
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return scimResourceResponse(c, 200, user)
+}
+
+func (controller SCIMController) DeleteUser(c echo.Context) error {
+	if err := controller.scimService.DeleteUser(c.Param("id"), c.Request().Header.Get("If-Match")); err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return c.NoContent(204)
+}
+
+func (controller SCIMController) ListGroups(c echo.Context) error {
+	query, err := controller.query(c)
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	groups, err := controller.scimService.ListGroups(query)
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return scimResponse(c, 200, groups)
+}
+
+func (controller SCIMController) GetGroup(c echo.Context) error {
+	group, err := controller.scimService.GetGroup(c.Param("id"))
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return scimResourceResponse(c, 200, group)
+}
+
+func (controller SCIMController) CreateGroup(c echo.Context) error {
+	var resource scim.Resource
+	if err := decodeSCIMBody(c, &resource); err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	group, err := controller.scimService.CreateGroup(resource)
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return scimResourceResponse(c, 201, group)
+}
+
+func (controller SCIMController) ReplaceGroup(c echo.Context) error {
+	var resource scim.Resource
+	if err := decodeSCIMBody(c, &resource); err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	group, err := controller.scimService.ReplaceGroup(c.Param("id"), resource, c.Request().Header.Get("If-Match"))
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return scimResourceResponse(c, 200, group)
+}
+
+func (controller SCIMController) PatchGroup(c echo.Context) error {
+	var patch scim.PatchRequest
+	if err := decodeSCIMBody(c, &patch); err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	group, err := controller.scimService.PatchGroup(c.Param("id"), &patch, c.Request().Header.Get("If-Match"))
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return scimResourceResponse(c, 200, group)
+}
+
+func (controller SCIMController) DeleteGroup(c echo.Context) error {
+	if err := controller.scimService.DeleteGroup(c.Param("id"), c.Request().Header.Get("If-Match")); err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return c.NoContent(204)
+}
+
+func (controller SCIMController) Bulk(c echo.Context) error {
+	var request scim.BulkRequest
+	if err := decodeSCIMBody(c, &request); err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	response, err := controller.scimService.Bulk(&request)
+	if err != nil {
+		return scimErrorResponse(c, err)
+	}
+
+	return scimResponse(c, 200, response)
+}
+
+func (controller SCIMController) ServiceProviderConfig(c echo.Context) error {
+	serviceProviderConfig := scim.ServiceProviderConfig{
+		BaseURL:           config.Config.SCIM.BaseURL,
+		MaxResults:        config.Config.SCIM.MaxResults,
+		BulkMaxOperations: config.Config.SCIM.BulkMaxOperations,
+		BulkMaxPayload:    config.Config.SCIM.BulkMaxPayload,
+	}
+
+	return scimResponse(c, 200, serviceProviderConfig.Resource())
+}
+
+func (controller SCIMController) Schemas(c echo.Context) error {
+	resources := []scim.Resource{}
+	for _, schema := range scim.Schemas {
+		resources = append(resources, scim.SchemaResource(schema, config.Config.SCIM.BaseURL))
+	}
+
+	query := scim.Query{StartIndex: 1, Count: len(resources)}
+	return scimResponse(c, 200, query.Page(resources))
+}
+
+func (controller SCIMController) GetSchema(c echo.Context) error {
+	for _, schema := range scim.Schemas {
+		if schema.ID == c.Param("id") {
+			return scimResponse(c, 200, scim.SchemaResource(schema, config.Config.SCIM.BaseURL))
+		}
+	}
+
+	return scimErrorResponse(c, scim.NewError(404, "", "schema %s not found", c.Param("id")))
+}
+
+func (controller SCIMController) ResourceTypes(c echo.Context) error {
+	resources := []scim.Resource{}
+	for _, resourceType := range scim.ResourceTypes {
+		resources = append(resources, scim.ResourceTypeResource(resourceType, config.Config.SCIM.BaseURL))
+	}
+
+	query := scim.Query{StartIndex: 1, Count: len(resources)}
+	return scimResponse(c, 200, query.Page(resources))
+}
+
+func (controller SCIMController) GetResourceType(c echo.Context) error {
+	for _, resourceType := range scim.ResourceTypes {
+		if resourceType.ID == c.Param("id") {
+			return scimResponse(c, 200, scim.ResourceTypeResource(resourceType, config.Config.SCIM.BaseURL))
+		}
+	}
+
+	return scimErrorResponse(c, scim.NewError(404, "", "resource type %s not found", c.Param("id")))
+}
+
+func (controller SCIMController) CreateToken(c echo.Context) error {
+	var token schemas.SCIMTokenCreate
+
+	if err := c.Bind(&token); err != nil {
+		return c.JSON(400, err)
+	}
+
+	createdToken, err := controller.scimService.CreateToken(&token)
+	if err != nil {
+		return c.JSON(400, err.Error())
+	}
+
+	return c.JSON(200, createdToken)
+}
+
+func (controller SCIMController) GetTokens(c echo.Context) error {
+	tokens, err := controller.scimService.GetTokens()
+	if err != nil {
+		return c.JSON(500, err)
+	}
+
+	return c.JSON(200, tokens)
+}
+
+func (controller SCIMController) DeleteToken(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, "Invalid token id")
+	}
+
+	if err := controller.scimService.DeleteToken(uint(id)); err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(204, "SCIM token deleted successfully!")
+}
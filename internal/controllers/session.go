@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+type SessionController struct {
+	sessionService services.SessionService
+}
+
+func NewSessionController(sessionService services.SessionService) SessionController {
+	return SessionController{sessionService: sessionService}
+}
+
+// currentSession returns the sid of the JWT used in the request, if any
+func currentSession(c echo.Context) string {
+	sid, _ := c.Get("sid").(string)
+	return sid
+}
+
+func (controller SessionController) getSessions(c echo.Context, userIdentifier string) error {
+	sessions, err := controller.sessionService.GetSessions(userIdentifier, currentSession(c))
+	if err != nil {
+		return c.JSON(404, err)
+	}
+
+	return c.JSON(200, sessions)
+}
+
+func (controller SessionController) revokeSession(c echo.Context, userIdentifier string) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(400, "Invalid session id")
+	}
+
+	if err := controller.sessionService.RevokeSession(userIdentifier, uint(id)); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			return c.JSON(404, err.Error())
+		}
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(204, "Session revoked successfully!")
+}
+
+func (controller SessionController) GetOwnSessions(c echo.Context) error {
+	return controller.getSessions(c, currentUser(c))
+}
+
+func (controller SessionController) RevokeOwnSession(c echo.Context) error {
+	return controller.revokeSession(c, currentUser(c))
+}
+
+// RevokeOtherSessions signs the user out everywhere but the current session
+func (controller SessionController) RevokeOtherSessions(c echo.Context) error {
+	if err := controller.sessionService.RevokeOtherSessions(currentUser(c), currentSession(c)); err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(204, "Sessions revoked successfully!")
+}
+
+func (controller SessionController) GetUserSessions(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can list sessions of other users")
+	}
+
+	return controller.getSessions(c, c.Param("identifier"))
+}
+
+func (controller SessionController) RevokeUserSession(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can revoke sessions of other users")
+	}
+
+	return controller.revokeSession(c, c.Param("identifier"))
+}
+
+// RevokeUserSessions signs the user out of every session
+func (controller SessionController) RevokeUserSessions(c echo.Context) error {
+	if _, ok := currentAdmin(c); !ok {
+		return c.JSON(403, "Only administrators can revoke sessions of other users")
+	}
+
+	if err := controller.sessionService.RevokeOtherSessions(c.Param("identifier"), ""); err != nil {
+		return c.JSON(400, err)
+	}
+
+	return c.JSON(204, "Sessions revoked successfully!")
+}
@@ -0,0 +1,243 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// Subconjunto mínimo de BER (X.690) necessário para o protocolo LDAPv3
+
+const (
+	classUniversal   = 0x00
+	classApplication = 0x40
+	classContext     = 0x80
+
+	typeConstructed = 0x20
+
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagNull        = 0x05
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x10
+	tagSet         = 0x11
+)
+
+var errMalformedPacket = errors.New("ldap: malformed BER packet")
+
+// packet is a decoded BER element. Constructed elements keep their children,
+// primitive ones their raw value.
+type packet struct {
+	class       byte
+	constructed bool
+	tag         byte
+	value       []byte
+	children    []*packet
+}
+
+func newPacket(class byte, constructed bool, tag byte) *packet {
+	return &packet{class: class, constructed: constructed, tag: tag}
+}
+
+func newSequence(children ...*packet) *packet {
+	p := newPacket(classUniversal, true, tagSequence)
+	p.children = children
+	return p
+}
+
+func newOctetString(value string) *packet {
+	p := newPacket(classUniversal, false, tagOctetString)
+	p.value = []byte(value)
+	return p
+}
+
+func newInteger(value int64) *packet {
+	p := newPacket(classUniversal, false, tagInteger)
+	p.value = encodeInteger(value)
+	return p
+}
+
+func newEnumerated(value int64) *packet {
+	p := newInteger(value)
+	p.tag = tagEnumerated
+	return p
+}
+
+func newBoolean(value bool) *packet {
+	p := newPacket(classUniversal, false, tagBoolean)
+	if value {
+		p.value = []byte{0xff}
+	} else {
+		p.value = []byte{0x00}
+	}
+	return p
+}
+
+func (p *packet) append(children ...*packet) *packet {
+	p.children = append(p.children, children...)
+	return p
+}
+
+func encodeInteger(value int64) []byte {
+	b := big.NewInt(value).Bytes()
+	if value == 0 {
+		return []byte{0}
+	}
+	// Mantém o bit de sinal zerado para valores positivos
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
+
+func (p *packet) integer() int64 {
+	var value int64
+	for i, b := range p.value {
+		if i == 0 && b&0x80 != 0 {
+			value = -1
+		}
+		value = value<<8 | int64(b)
+	}
+	return value
+}
+
+func (p *packet) str() string {
+	return string(p.value)
+}
+
+func encodeLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+
+	var b []byte
+	for length > 0 {
+		b = append([]byte{byte(length)}, b...)
+		length >>= 8
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func (p *packet) bytes() []byte {
+	value := p.value
+	if p.constructed {
+		value = nil
+		for _, child := range p.children {
+			value = append(value, child.bytes()...)
+		}
+	}
+
+	identifier := p.class | p.tag
+	if p.constructed {
+		identifier |= typeConstructed
+	}
+
+	out := []byte{identifier}
+	out = append(out, encodeLength(len(value))...)
+	return append(out, value...)
+}
+
+// readPacket reads one complete BER element from the stream
+func readPacket(r *bufio.Reader) (*packet, error) {
+	identifier, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return nil, err
+	}
+
+	return decodePacket(identifier, value)
+}
+
+func readLength(r io.ByteReader) (int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	if first&0x80 == 0 {
+		return int(first), nil
+	}
+
+	count := int(first & 0x7f)
+	if count == 0 || count > 4 {
+		return 0, errMalformedPacket
+	}
+
+	length := 0
+	for i := 0; i < count; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+
+	return length, nil
+}
+
+func decodePacket(identifier byte, value []byte) (*packet, error) {
+	p := &packet{
+		class:       identifier & 0xc0,
+		constructed: identifier&typeConstructed != 0,
+		tag:         identifier & 0x1f,
+		value:       value,
+	}
+
+	if !p.constructed {
+		return p, nil
+	}
+
+	for len(value) > 0 {
+		if len(value) < 2 {
+			return nil, errMalformedPacket
+		}
+
+		childIdentifier := value[0]
+		reader := &sliceReader{data: value[1:]}
+
+		length, err := readLength(reader)
+		if err != nil {
+			return nil, errMalformedPacket
+		}
+
+		start := 1 + reader.pos
+		if start+length > len(value) {
+			return nil, errMalformedPacket
+		}
+
+		child, err := decodePacket(childIdentifier, value[start:start+length])
+		if err != nil {
+			return nil, err
+		}
+
+		p.children = append(p.children, child)
+		value = value[start+length:]
+	}
+
+	return p, nil
+}
+
+type sliceReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *sliceReader) ReadByte() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
@@ -0,0 +1,169 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncodeInteger(t *testing.T) {
+	tests := []struct {
+		value int64
+		want  []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x00, 0x80}},
+		{255, []byte{0x00, 0xff}},
+		{256, []byte{0x01, 0x00}},
+		{65535, []byte{0x00, 0xff, 0xff}},
+	}
+
+	for _, tt := range tests {
+		got := encodeInteger(tt.value)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("encodeInteger(%d) = %x, want %x", tt.value, got, tt.want)
+		}
+
+		if decoded := newInteger(tt.value).integer(); decoded != tt.value {
+			t.Errorf("integer() of %d = %d", tt.value, decoded)
+		}
+	}
+}
+
+func TestPacketInteger(t *testing.T) {
+	tests := []struct {
+		value []byte
+		want  int64
+	}{
+		{[]byte{0x00}, 0},
+		{[]byte{0x31}, 49},
+		{[]byte{0x00, 0x80}, 128},
+		{[]byte{0xff}, -1},
+		{[]byte{0x80}, -128},
+		{[]byte{0xff, 0x7f}, -129},
+	}
+
+	for _, tt := range tests {
+		p := &packet{value: tt.value}
+		if got := p.integer(); got != tt.want {
+			t.Errorf("integer() of %x = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeLength(t *testing.T) {
+	tests := []struct {
+		length int
+		want   []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x81, 0x80}},
+		{255, []byte{0x81, 0xff}},
+		{256, []byte{0x82, 0x01, 0x00}},
+		{70000, []byte{0x83, 0x01, 0x11, 0x70}},
+	}
+
+	for _, tt := range tests {
+		got := encodeLength(tt.length)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("encodeLength(%d) = %x, want %x", tt.length, got, tt.want)
+		}
+
+		length, err := readLength(bytes.NewReader(got))
+		if err != nil || length != tt.length {
+			t.Errorf("readLength(%x) = %d, %v, want %d", got, length, err, tt.length)
+		}
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 300)
+
+	tests := []struct {
+		name   string
+		packet *packet
+	}{
+		{"octet string", newOctetString("cn=admin,dc=example,dc=com")},
+		{"empty octet string", newOctetString("")},
+		{"long octet string", newOctetString(long)},
+		{"boolean", newBoolean(true)},
+		{"enumerated", newEnumerated(2)},
+		{"empty sequence", newSequence()},
+		{"bind request", newSequence(
+			newInteger(1),
+			newPacket(classApplication, true, appBindRequest).append(
+				newInteger(3),
+				newOctetString("uid=alice,ou=people,dc=example,dc=com"),
+				&packet{class: classContext, tag: 0, value: []byte("secret")},
+			),
+		)},
+		{"nested with long child", newSequence(newSequence(newOctetString(long), newInteger(70000)))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := tt.packet.bytes()
+
+			decoded, err := readPacket(bufio.NewReader(bytes.NewReader(encoded)))
+			if err != nil {
+				t.Fatalf("readPacket: %v", err)
+			}
+
+			if !bytes.Equal(decoded.bytes(), encoded) {
+				t.Errorf("round trip = %x, want %x", decoded.bytes(), encoded)
+			}
+
+			assertSamePacket(t, decoded, tt.packet)
+		})
+	}
+}
+
+func assertSamePacket(t *testing.T, got, want *packet) {
+	t.Helper()
+
+	if got.class != want.class || got.constructed != want.constructed || got.tag != want.tag {
+		t.Fatalf("header = %x/%v/%x, want %x/%v/%x", got.class, got.constructed, got.tag, want.class, want.constructed, want.tag)
+	}
+
+	if !want.constructed {
+		if !bytes.Equal(got.value, want.value) {
+			t.Fatalf("value = %x, want %x", got.value, want.value)
+		}
+		return
+	}
+
+	if len(got.children) != len(want.children) {
+		t.Fatalf("%d children, want %d", len(got.children), len(want.children))
+	}
+
+	for i := range want.children {
+		assertSamePacket(t, got.children[i], want.children[i])
+	}
+}
+
+func TestReadPacketMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"missing length", []byte{0x30}},
+		{"indefinite length", []byte{0x30, 0x80, 0x00, 0x00}},
+		{"length too large", []byte{0x04, 0x85, 0x01, 0x00, 0x00, 0x00, 0x00}},
+		{"truncated value", []byte{0x04, 0x05, 'a', 'b'}},
+		{"child overflows parent", []byte{0x30, 0x03, 0x04, 0x05, 'a'}},
+		{"dangling child byte", []byte{0x30, 0x01, 0x04}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readPacket(bufio.NewReader(bytes.NewReader(tt.data))); err == nil {
+				t.Errorf("readPacket(%x) succeeded", tt.data)
+			}
+		})
+	}
+}
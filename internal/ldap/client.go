@@ -0,0 +1,349 @@
+// Package ldap implements the small part of LDAPv3 (RFC 4511) whoami needs to
+// authenticate users against a directory and synchronize users and groups:
+// simple bind, paged search and unbind.
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	appBindRequest           = 0
+	appBindResponse          = 1
+	appUnbindRequest         = 2
+	appSearchRequest         = 3
+	appSearchResultEntry     = 4
+	appSearchResultDone      = 5
+	appSearchResultReference = 19
+
+	resultSuccess            = 0
+	resultInvalidCredentials = 49
+
+	pagedResultsOID = "1.2.840.113556.1.4.319"
+)
+
+const (
+	ScopeBaseObject   = 0
+	ScopeSingleLevel  = 1
+	ScopeWholeSubtree = 2
+)
+
+var ErrInvalidCredentials = errors.New("ldap: invalid credentials")
+
+// ResultError is returned when the server answers with a non-success result code
+type ResultError struct {
+	Code    int64
+	Message string
+}
+
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("ldap: result code %d: %s", e.Code, e.Message)
+}
+
+type Conn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	messageID int64
+	timeout   time.Duration
+}
+
+// Dial connects to an ldap:// or ldaps:// URL
+func Dial(rawURL string, timeout time.Duration, insecureSkipVerify bool) (*Conn, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := parsed.Host
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+
+	switch parsed.Scheme {
+	case "ldap":
+		if parsed.Port() == "" {
+			host = net.JoinHostPort(host, "389")
+		}
+		conn, err = dialer.Dial("tcp", host)
+	case "ldaps":
+		if parsed.Port() == "" {
+			host = net.JoinHostPort(host, "636")
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{
+			ServerName:         parsed.Hostname(),
+			InsecureSkipVerify: insecureSkipVerify,
+		})
+	default:
+		return nil, fmt.Errorf("ldap: unsupported scheme %q", parsed.Scheme)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+func (c *Conn) send(op *packet, controls ...*packet) (int64, error) {
+	c.messageID++
+
+	message := newSequence(newInteger(c.messageID), op)
+	if len(controls) > 0 {
+		message.append(newPacket(classContext, true, 0).append(controls...))
+	}
+
+	if c.timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+
+	_, err := c.conn.Write(message.bytes())
+	return c.messageID, err
+}
+
+// receive reads the next message for the given id and returns its protocol op and controls
+func (c *Conn) receive(messageID int64) (*packet, *packet, error) {
+	for {
+		message, err := readPacket(c.reader)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(message.children) < 2 {
+			return nil, nil, errMalformedPacket
+		}
+
+		if message.children[0].integer() != messageID {
+			continue
+		}
+
+		var controls *packet
+		if len(message.children) > 2 {
+			controls = message.children[2]
+		}
+
+		return message.children[1], controls, nil
+	}
+}
+
+func resultFromPacket(op *packet) error {
+	if len(op.children) < 3 {
+		return errMalformedPacket
+	}
+
+	code := op.children[0].integer()
+	if code == resultSuccess {
+		return nil
+	}
+
+	if code == resultInvalidCredentials {
+		return ErrInvalidCredentials
+	}
+
+	return &ResultError{Code: code, Message: op.children[2].str()}
+}
+
+// Bind performs a simple bind. Empty passwords are refused because servers
+// treat them as unauthenticated binds that always succeed.
+func (c *Conn) Bind(dn, password string) error {
+	if password == "" {
+		return ErrInvalidCredentials
+	}
+
+	credentials := newPacket(classContext, false, 0)
+	credentials.value = []byte(password)
+
+	op := newPacket(classApplication, true, appBindRequest).append(
+		newInteger(3),
+		newOctetString(dn),
+		credentials,
+	)
+
+	id, err := c.send(op)
+	if err != nil {
+		return err
+	}
+
+	response, _, err := c.receive(id)
+	if err != nil {
+		return err
+	}
+
+	if response.class != classApplication || response.tag != appBindResponse {
+		return errMalformedPacket
+	}
+
+	return resultFromPacket(response)
+}
+
+type SearchRequest struct {
+	BaseDN     string
+	Scope      int
+	Filter     string
+	Attributes []string
+	// PageSize enables the paged results control, needed for directories
+	// (like Active Directory) that cap the number of entries per search
+	PageSize int
+}
+
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Get returns the first value of the attribute, matched case-insensitively
+func (e *Entry) Get(attribute string) string {
+	values := e.GetAll(attribute)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (e *Entry) GetAll(attribute string) []string {
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, attribute) {
+			return values
+		}
+	}
+	return nil
+}
+
+func (c *Conn) Search(request *SearchRequest) ([]*Entry, error) {
+	filter, err := compileFilter(request.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	var cookie []byte
+
+	for {
+		attributes := newSequence()
+		for _, attribute := range request.Attributes {
+			attributes.append(newOctetString(attribute))
+		}
+
+		op := newPacket(classApplication, true, appSearchRequest).append(
+			newOctetString(request.BaseDN),
+			newEnumerated(int64(request.Scope)),
+			newEnumerated(0), // neverDerefAliases
+			newInteger(0),
+			newInteger(0),
+			newBoolean(false),
+			filter,
+			attributes,
+		)
+
+		var controls []*packet
+		if request.PageSize > 0 {
+			pageValue := newSequence(newInteger(int64(request.PageSize)), newOctetString(string(cookie)))
+			controls = append(controls, newSequence(
+				newOctetString(pagedResultsOID),
+				newBoolean(false),
+				newOctetString(string(pageValue.bytes())),
+			))
+		}
+
+		id, err := c.send(op, controls...)
+		if err != nil {
+			return nil, err
+		}
+
+		cookie = nil
+
+		for {
+			response, responseControls, err := c.receive(id)
+			if err != nil {
+				return nil, err
+			}
+
+			if response.class != classApplication {
+				return nil, errMalformedPacket
+			}
+
+			if response.tag == appSearchResultEntry {
+				entry, err := entryFromPacket(response)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, entry)
+				continue
+			}
+
+			if response.tag == appSearchResultReference {
+				continue
+			}
+
+			if response.tag != appSearchResultDone {
+				return nil, errMalformedPacket
+			}
+
+			if err := resultFromPacket(response); err != nil {
+				return nil, err
+			}
+
+			cookie = pagingCookie(responseControls)
+			break
+		}
+
+		if len(cookie) == 0 {
+			return entries, nil
+		}
+	}
+}
+
+func entryFromPacket(p *packet) (*Entry, error) {
+	if len(p.children) < 2 {
+		return nil, errMalformedPacket
+	}
+
+	entry := &Entry{DN: p.children[0].str(), Attributes: map[string][]string{}}
+
+	for _, attribute := range p.children[1].children {
+		if len(attribute.children) < 2 {
+			return nil, errMalformedPacket
+		}
+
+		name := attribute.children[0].str()
+		for _, value := range attribute.children[1].children {
+			entry.Attributes[name] = append(entry.Attributes[name], value.str())
+		}
+	}
+
+	return entry, nil
+}
+
+// pagingCookie extracts the cookie of the paged results control, empty when the search is complete
+func pagingCookie(controls *packet) []byte {
+	if controls == nil {
+		return nil
+	}
+
+	for _, control := range controls.children {
+		if len(control.children) < 2 || control.children[0].str() != pagedResultsOID {
+			continue
+		}
+
+		value := control.children[len(control.children)-1]
+		decoded, err := readPacket(bufio.NewReader(strings.NewReader(string(value.value))))
+		if err != nil || len(decoded.children) < 2 {
+			return nil
+		}
+
+		return decoded.children[1].value
+	}
+
+	return nil
+}
+
+func (c *Conn) Close() error {
+	op := newPacket(classApplication, false, appUnbindRequest)
+	c.send(op)
+	return c.conn.Close()
+}
@@ -0,0 +1,181 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newTestDirectory(t *testing.T) *TestServer {
+	t.Helper()
+
+	server, err := NewTestServer()
+	if err != nil {
+		t.Fatalf("NewTestServer: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	server.AddEntry(&Entry{
+		DN:         "cn=admin,dc=example,dc=com",
+		Attributes: map[string][]string{"cn": {"admin"}},
+	}, "adminpass")
+
+	for _, uid := range []string{"alice", "bob", "carol"} {
+		server.AddEntry(&Entry{
+			DN: fmt.Sprintf("uid=%s,ou=people,dc=example,dc=com", uid),
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {uid},
+				"mail":        {uid + "@example.com"},
+			},
+		}, uid+"pass")
+	}
+
+	server.AddEntry(&Entry{
+		DN: "cn=eng,ou=groups,dc=example,dc=com",
+		Attributes: map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"cn":          {"eng"},
+			"member":      {"uid=alice,ou=people,dc=example,dc=com"},
+		},
+	}, "")
+
+	return server
+}
+
+func dialTestDirectory(t *testing.T, server *TestServer) *Conn {
+	t.Helper()
+
+	conn, err := Dial(server.URL, time.Second, false)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestBind(t *testing.T) {
+	server := newTestDirectory(t)
+
+	tests := []struct {
+		name     string
+		dn       string
+		password string
+		wantErr  error
+	}{
+		{"service account", "cn=admin,dc=example,dc=com", "adminpass", nil},
+		{"user", "uid=alice,ou=people,dc=example,dc=com", "alicepass", nil},
+		{"wrong password", "uid=alice,ou=people,dc=example,dc=com", "bobpass", ErrInvalidCredentials},
+		{"unknown dn", "uid=zed,ou=people,dc=example,dc=com", "zedpass", ErrInvalidCredentials},
+		{"empty password", "uid=alice,ou=people,dc=example,dc=com", "", ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dialTestDirectory(t, server)
+
+			if err := conn.Bind(tt.dn, tt.password); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Bind = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	server := newTestDirectory(t)
+	conn := dialTestDirectory(t, server)
+
+	tests := []struct {
+		name    string
+		request SearchRequest
+		want    []string
+	}{
+		{"equality", SearchRequest{
+			BaseDN: "ou=people,dc=example,dc=com", Scope: ScopeWholeSubtree, Filter: "(uid=alice)",
+		}, []string{"uid=alice,ou=people,dc=example,dc=com"}},
+		{"escaped value finds nothing", SearchRequest{
+			BaseDN: "ou=people,dc=example,dc=com", Scope: ScopeWholeSubtree, Filter: fmt.Sprintf("(uid=%s)", EscapeFilter("*")),
+		}, nil},
+		{"and with substring", SearchRequest{
+			BaseDN: "dc=example,dc=com", Scope: ScopeWholeSubtree, Filter: "(&(objectClass=person)(mail=*@example.com))",
+		}, []string{
+			"uid=alice,ou=people,dc=example,dc=com",
+			"uid=bob,ou=people,dc=example,dc=com",
+			"uid=carol,ou=people,dc=example,dc=com",
+		}},
+		{"not", SearchRequest{
+			BaseDN: "ou=people,dc=example,dc=com", Scope: ScopeWholeSubtree, Filter: "(!(uid=bob))",
+		}, []string{"uid=alice,ou=people,dc=example,dc=com", "uid=carol,ou=people,dc=example,dc=com"}},
+		{"single level", SearchRequest{
+			BaseDN: "dc=example,dc=com", Scope: ScopeSingleLevel, Filter: "(cn=*)",
+		}, []string{"cn=admin,dc=example,dc=com"}},
+		{"paged", SearchRequest{
+			BaseDN: "ou=people,dc=example,dc=com", Scope: ScopeWholeSubtree, Filter: "(objectClass=person)", PageSize: 1,
+		}, []string{
+			"uid=alice,ou=people,dc=example,dc=com",
+			"uid=bob,ou=people,dc=example,dc=com",
+			"uid=carol,ou=people,dc=example,dc=com",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := conn.Search(&tt.request)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.DN)
+			}
+			sort.Strings(got)
+
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Search = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchAttributes(t *testing.T) {
+	server := newTestDirectory(t)
+	conn := dialTestDirectory(t, server)
+
+	entries, err := conn.Search(&SearchRequest{
+		BaseDN:     "ou=groups,dc=example,dc=com",
+		Scope:      ScopeWholeSubtree,
+		Filter:     "(cn=eng)",
+		Attributes: []string{"CN", "member"},
+	})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("Search returned %d entries, want 1", len(entries))
+	}
+
+	entry := entries[0]
+	if entry.Get("cn") != "eng" {
+		t.Errorf("cn = %q, want eng", entry.Get("cn"))
+	}
+	if members := entry.GetAll("member"); len(members) != 1 || members[0] != "uid=alice,ou=people,dc=example,dc=com" {
+		t.Errorf("member = %v", members)
+	}
+	if entry.Get("objectClass") != "" {
+		t.Errorf("objectClass was returned without being requested")
+	}
+}
+
+func TestSearchInvalidFilter(t *testing.T) {
+	server := newTestDirectory(t)
+	conn := dialTestDirectory(t, server)
+
+	if _, err := conn.Search(&SearchRequest{BaseDN: "dc=example,dc=com", Filter: "(uid=alice"}); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("Search = %v, want ErrInvalidFilter", err)
+	}
+}
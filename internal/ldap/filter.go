@@ -0,0 +1,217 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidFilter = errors.New("ldap: invalid search filter")
+
+const (
+	filterAnd            = 0
+	filterOr             = 1
+	filterNot            = 2
+	filterEqualityMatch  = 3
+	filterSubstrings     = 4
+	filterGreaterOrEqual = 5
+	filterLessOrEqual    = 6
+	filterPresent        = 7
+	filterApproxMatch    = 8
+)
+
+// EscapeFilter escapes a value so it can be safely placed inside a search filter (RFC 4515)
+func EscapeFilter(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch c {
+		case '\\', '*', '(', ')', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// compileFilter converts the string representation of a search filter to its BER encoding
+func compileFilter(filter string) (*packet, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return nil, ErrInvalidFilter
+	}
+
+	// Aceita filtros simples sem os parênteses externos, como "uid=john"
+	if filter[0] != '(' {
+		filter = "(" + filter + ")"
+	}
+
+	p, rest, err := parseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if rest != "" {
+		return nil, ErrInvalidFilter
+	}
+
+	return p, nil
+}
+
+func parseFilter(filter string) (*packet, string, error) {
+	if len(filter) < 3 || filter[0] != '(' {
+		return nil, "", ErrInvalidFilter
+	}
+
+	switch filter[1] {
+	case '&', '|':
+		tag := byte(filterAnd)
+		if filter[1] == '|' {
+			tag = filterOr
+		}
+
+		p := newPacket(classContext, true, tag)
+		rest := filter[2:]
+
+		for len(rest) > 0 && rest[0] == '(' {
+			child, remaining, err := parseFilter(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			p.append(child)
+			rest = remaining
+		}
+
+		if len(rest) == 0 || rest[0] != ')' || len(p.children) == 0 {
+			return nil, "", ErrInvalidFilter
+		}
+
+		return p, rest[1:], nil
+	case '!':
+		child, rest, err := parseFilter(filter[2:])
+		if err != nil {
+			return nil, "", err
+		}
+
+		if len(rest) == 0 || rest[0] != ')' {
+			return nil, "", ErrInvalidFilter
+		}
+
+		return newPacket(classContext, true, filterNot).append(child), rest[1:], nil
+	}
+
+	end := strings.IndexByte(filter, ')')
+	if end < 0 {
+		return nil, "", ErrInvalidFilter
+	}
+
+	p, err := parseItem(filter[1:end])
+	if err != nil {
+		return nil, "", err
+	}
+
+	return p, filter[end+1:], nil
+}
+
+func parseItem(item string) (*packet, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, ErrInvalidFilter
+	}
+
+	attribute := item[:eq]
+	value := item[eq+1:]
+	tag := byte(filterEqualityMatch)
+
+	switch attribute[len(attribute)-1] {
+	case '>':
+		tag = filterGreaterOrEqual
+		attribute = attribute[:len(attribute)-1]
+	case '<':
+		tag = filterLessOrEqual
+		attribute = attribute[:len(attribute)-1]
+	case '~':
+		tag = filterApproxMatch
+		attribute = attribute[:len(attribute)-1]
+	}
+
+	if attribute == "" {
+		return nil, ErrInvalidFilter
+	}
+
+	if tag == filterEqualityMatch && value == "*" {
+		p := newPacket(classContext, false, filterPresent)
+		p.value = []byte(attribute)
+		return p, nil
+	}
+
+	if tag == filterEqualityMatch && strings.Contains(value, "*") {
+		return parseSubstrings(attribute, value)
+	}
+
+	unescaped, err := unescapeFilterValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPacket(classContext, true, tag).append(newOctetString(attribute), newOctetString(unescaped)), nil
+}
+
+func parseSubstrings(attribute, value string) (*packet, error) {
+	parts := strings.Split(value, "*")
+	substrings := newSequence()
+
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+
+		unescaped, err := unescapeFilterValue(part)
+		if err != nil {
+			return nil, err
+		}
+
+		tag := byte(1) // any
+		if i == 0 {
+			tag = 0 // initial
+		} else if i == len(parts)-1 {
+			tag = 2 // final
+		}
+
+		p := newPacket(classContext, false, tag)
+		p.value = []byte(unescaped)
+		substrings.append(p)
+	}
+
+	return newPacket(classContext, true, filterSubstrings).append(newOctetString(attribute), substrings), nil
+}
+
+func unescapeFilterValue(value string) (string, error) {
+	if !strings.Contains(value, "\\") {
+		return value, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+
+		if i+2 >= len(value) {
+			return "", ErrInvalidFilter
+		}
+
+		decoded, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return "", ErrInvalidFilter
+		}
+
+		b.Write(decoded)
+		i += 2
+	}
+
+	return b.String(), nil
+}
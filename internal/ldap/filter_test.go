@@ -0,0 +1,105 @@
+package ldap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEscapeFilter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"alice", "alice"},
+		{"a*", `a\2a`},
+		{"(admin)", `\28admin\29`},
+		{`back\slash`, `back\5cslash`},
+		{"nul\x00", `nul\00`},
+		{"*)(uid=*", `\2a\29\28uid=\2a`},
+	}
+
+	for _, tt := range tests {
+		if got := EscapeFilter(tt.value); got != tt.want {
+			t.Errorf("EscapeFilter(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func item(tag byte, attribute, value string) *packet {
+	return newPacket(classContext, true, tag).append(newOctetString(attribute), newOctetString(value))
+}
+
+func substring(tag byte, value string) *packet {
+	p := newPacket(classContext, false, tag)
+	p.value = []byte(value)
+	return p
+}
+
+func TestCompileFilter(t *testing.T) {
+	present := newPacket(classContext, false, filterPresent)
+	present.value = []byte("objectClass")
+
+	tests := []struct {
+		filter string
+		want   *packet
+	}{
+		{"(uid=alice)", item(filterEqualityMatch, "uid", "alice")},
+		{"uid=alice", item(filterEqualityMatch, "uid", "alice")},
+		{"  (uid=alice)  ", item(filterEqualityMatch, "uid", "alice")},
+		{"(uidNumber>=1000)", item(filterGreaterOrEqual, "uidNumber", "1000")},
+		{"(uidNumber<=1000)", item(filterLessOrEqual, "uidNumber", "1000")},
+		{"(cn~=alice)", item(filterApproxMatch, "cn", "alice")},
+		{"(objectClass=*)", present},
+		{`(cn=a\2ab)`, item(filterEqualityMatch, "cn", "a*b")},
+		{`(cn=\28x\29)`, item(filterEqualityMatch, "cn", "(x)")},
+		{"(cn=al*)", newPacket(classContext, true, filterSubstrings).append(
+			newOctetString("cn"), newSequence(substring(0, "al")))},
+		{"(cn=*ic*)", newPacket(classContext, true, filterSubstrings).append(
+			newOctetString("cn"), newSequence(substring(1, "ic")))},
+		{"(cn=a*l*e)", newPacket(classContext, true, filterSubstrings).append(
+			newOctetString("cn"), newSequence(substring(0, "a"), substring(1, "l"), substring(2, "e")))},
+		{"(&(objectClass=person)(uid=alice))", newPacket(classContext, true, filterAnd).append(
+			item(filterEqualityMatch, "objectClass", "person"),
+			item(filterEqualityMatch, "uid", "alice"))},
+		{"(|(uid=alice)(!(uid=bob)))", newPacket(classContext, true, filterOr).append(
+			item(filterEqualityMatch, "uid", "alice"),
+			newPacket(classContext, true, filterNot).append(item(filterEqualityMatch, "uid", "bob")))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			got, err := compileFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("compileFilter: %v", err)
+			}
+
+			if !bytes.Equal(got.bytes(), tt.want.bytes()) {
+				t.Errorf("compileFilter(%q) = %x, want %x", tt.filter, got.bytes(), tt.want.bytes())
+			}
+		})
+	}
+}
+
+func TestCompileFilterInvalid(t *testing.T) {
+	filters := []string{
+		"",
+		"()",
+		"(uid)",
+		"(=alice)",
+		"(>=1)",
+		"(uid=alice",
+		"(uid=alice))",
+		"(&)",
+		"(&(uid=alice)",
+		"(!(uid=alice)",
+		`(cn=a\2)`,
+		`(cn=a\zz)`,
+		"(uid=alice)(uid=bob)",
+	}
+
+	for _, filter := range filters {
+		if _, err := compileFilter(filter); err == nil {
+			t.Errorf("compileFilter(%q) succeeded", filter)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package ldap
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TestServer is an in-memory directory served over LDAP on a loopback port, so the
+// identity backend and the directory sync can be exercised without a real server.
+// It understands the same subset of the protocol as Conn: simple bind, search
+// (with paged results) and unbind.
+type TestServer struct {
+	URL string
+
+	listener  net.Listener
+	mu        sync.Mutex
+	entries   []*Entry
+	passwords map[string]string
+	wg        sync.WaitGroup
+}
+
+// NewTestServer starts a server with an empty directory
+func NewTestServer() (*TestServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &TestServer{
+		URL:       "ldap://" + listener.Addr().String(),
+		listener:  listener,
+		passwords: map[string]string{},
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// AddEntry adds or replaces an entry. A non-empty password lets the entry bind.
+func (s *TestServer) AddEntry(entry *Entry, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeEntry(entry.DN)
+	s.entries = append(s.entries, entry)
+
+	if password != "" {
+		s.passwords[strings.ToLower(entry.DN)] = password
+	}
+}
+
+func (s *TestServer) RemoveEntry(dn string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeEntry(dn)
+}
+
+func (s *TestServer) removeEntry(dn string) {
+	for i, entry := range s.entries {
+		if strings.EqualFold(entry.DN, dn) {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			break
+		}
+	}
+	delete(s.passwords, strings.ToLower(dn))
+}
+
+// Close stops accepting connections and waits for the open ones to finish
+func (s *TestServer) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *TestServer) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *TestServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		message, err := readPacket(reader)
+		if err != nil || len(message.children) < 2 {
+			return
+		}
+
+		id := message.children[0].integer()
+		op := message.children[1]
+
+		var controls *packet
+		if len(message.children) > 2 {
+			controls = message.children[2]
+		}
+
+		var responses []*packet
+		switch {
+		case op.class == classApplication && op.tag == appBindRequest:
+			responses = []*packet{s.bind(id, op)}
+		case op.class == classApplication && op.tag == appSearchRequest:
+			responses = s.search(id, op, controls)
+		default:
+			// Unbind, ou uma operação que o servidor não implementa
+			return
+		}
+
+		for _, response := range responses {
+			if _, err := conn.Write(response.bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func ldapResult(tag byte, code int64, message string) *packet {
+	return newPacket(classApplication, true, tag).append(
+		newEnumerated(code),
+		newOctetString(""),
+		newOctetString(message),
+	)
+}
+
+func (s *TestServer) bind(id int64, op *packet) *packet {
+	response := newSequence(newInteger(id))
+
+	if len(op.children) < 3 {
+		return response.append(ldapResult(appBindResponse, 2, "malformed bind request"))
+	}
+
+	s.mu.Lock()
+	password, ok := s.passwords[strings.ToLower(op.children[1].str())]
+	s.mu.Unlock()
+
+	if !ok || password != op.children[2].str() {
+		return response.append(ldapResult(appBindResponse, resultInvalidCredentials, "invalid credentials"))
+	}
+
+	return response.append(ldapResult(appBindResponse, resultSuccess, ""))
+}
+
+func (s *TestServer) search(id int64, op *packet, controls *packet) []*packet {
+	if len(op.children) < 8 {
+		return []*packet{newSequence(newInteger(id), ldapResult(appSearchResultDone, 2, "malformed search request"))}
+	}
+
+	base := op.children[0].str()
+	scope := op.children[1].integer()
+	filter := op.children[6]
+
+	requested := []string{}
+	for _, attribute := range op.children[7].children {
+		requested = append(requested, attribute.str())
+	}
+
+	s.mu.Lock()
+	var matches []*Entry
+	for _, entry := range s.entries {
+		if inScope(entry.DN, base, scope) && matchFilter(filter, entry) {
+			matches = append(matches, entry)
+		}
+	}
+	s.mu.Unlock()
+
+	// Paginação: o cookie é a posição do próximo resultado
+	pageSize, offset := 0, 0
+	if controls != nil {
+		for _, control := range controls.children {
+			if len(control.children) < 2 || control.children[0].str() != pagedResultsOID {
+				continue
+			}
+
+			value, err := readPacket(bufio.NewReader(strings.NewReader(control.children[len(control.children)-1].str())))
+			if err != nil || len(value.children) < 2 {
+				continue
+			}
+
+			pageSize = int(value.children[0].integer())
+			offset, _ = strconv.Atoi(value.children[1].str())
+		}
+	}
+
+	if offset > len(matches) {
+		offset = len(matches)
+	}
+	matches = matches[offset:]
+
+	cookie := ""
+	if pageSize > 0 && len(matches) > pageSize {
+		matches = matches[:pageSize]
+		cookie = strconv.Itoa(offset + pageSize)
+	}
+
+	var responses []*packet
+	for _, entry := range matches {
+		attributes := newSequence()
+		for name, values := range entry.Attributes {
+			if !requestedAttribute(requested, name) {
+				continue
+			}
+
+			set := newPacket(classUniversal, true, tagSet)
+			for _, value := range values {
+				set.append(newOctetString(value))
+			}
+			attributes.append(newSequence(newOctetString(name), set))
+		}
+
+		responses = append(responses, newSequence(
+			newInteger(id),
+			newPacket(classApplication, true, appSearchResultEntry).append(newOctetString(entry.DN), attributes),
+		))
+	}
+
+	done := newSequence(newInteger(id), ldapResult(appSearchResultDone, resultSuccess, ""))
+	if pageSize > 0 {
+		pageValue := newSequence(newInteger(int64(pageSize)), newOctetString(cookie))
+		done.append(newPacket(classContext, true, 0).append(newSequence(
+			newOctetString(pagedResultsOID),
+			newOctetString(string(pageValue.bytes())),
+		)))
+	}
+
+	return append(responses, done)
+}
+
+func requestedAttribute(requested []string, name string) bool {
+	if len(requested) == 0 {
+		return true
+	}
+
+	for _, attribute := range requested {
+		if strings.EqualFold(attribute, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func inScope(dn, base string, scope int64) bool {
+	dn, base = strings.ToLower(dn), strings.ToLower(base)
+
+	switch scope {
+	case ScopeBaseObject:
+		return dn == base
+	case ScopeSingleLevel:
+		_, parent, found := strings.Cut(dn, ",")
+		return found && parent == base
+	}
+
+	return base == "" || dn == base || strings.HasSuffix(dn, ","+base)
+}
+
+// matchFilter evaluates a compiled filter against the entry, comparing values
+// case-insensitively as directories do for the usual string attributes
+func matchFilter(filter *packet, entry *Entry) bool {
+	switch filter.tag {
+	case filterAnd:
+		for _, child := range filter.children {
+			if !matchFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, child := range filter.children {
+			if matchFilter(child, entry) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return len(filter.children) == 1 && !matchFilter(filter.children[0], entry)
+	case filterPresent:
+		return len(entry.GetAll(filter.str())) > 0
+	case filterEqualityMatch, filterApproxMatch, filterGreaterOrEqual, filterLessOrEqual:
+		if len(filter.children) != 2 {
+			return false
+		}
+
+		assertion := strings.ToLower(filter.children[1].str())
+		for _, value := range entry.GetAll(filter.children[0].str()) {
+			value = strings.ToLower(value)
+
+			switch {
+			case filter.tag == filterGreaterOrEqual && value >= assertion,
+				filter.tag == filterLessOrEqual && value <= assertion,
+				value == assertion:
+				return true
+			}
+		}
+		return false
+	case filterSubstrings:
+		if len(filter.children) != 2 {
+			return false
+		}
+
+		for _, value := range entry.GetAll(filter.children[0].str()) {
+			if matchSubstrings(strings.ToLower(value), filter.children[1].children) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return false
+}
+
+func matchSubstrings(value string, parts []*packet) bool {
+	for _, part := range parts {
+		substring := strings.ToLower(part.str())
+
+		switch part.tag {
+		case 0: // initial
+			if !strings.HasPrefix(value, substring) {
+				return false
+			}
+			value = value[len(substring):]
+		case 1: // any
+			index := strings.Index(value, substring)
+			if index < 0 {
+				return false
+			}
+			value = value[index+len(substring):]
+		case 2: // final
+			if !strings.HasSuffix(value, substring) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"errors"
+
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+// AuditMiddleware records every request made with an impersonation token,
+// attributed to the administrator named in its act claim
+func AuditMiddleware(auditService services.AuditService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+
+			actorID, ok := c.Get("actor_id").(uint)
+			if !ok {
+				return err
+			}
+
+			// Erros devolvidos pelo handler ainda não foram escritos na resposta
+			status := c.Response().Status
+			var httpError *echo.HTTPError
+			if err != nil && errors.As(err, &httpError) {
+				status = httpError.Code
+			} else if err != nil {
+				status = 500
+			}
+
+			entry := schemas.AuditLogCreate{
+				Action:  services.AuditImpersonationRequest,
+				ActorID: actorID,
+				Method:  c.Request().Method,
+				Path:    c.Request().URL.RequestURI(),
+				Status:  status,
+				IP:      c.RealIP(),
+			}
+
+			if user, ok := c.Get("user").(*schemas.UserResponse); ok {
+				entry.UserID = user.ID
+			}
+
+			if auditErr := auditService.Record(&entry); auditErr != nil {
+				c.Logger().Errorf("Error recording audit entry: %v", auditErr)
+			}
+
+			return err
+		}
+	}
+}
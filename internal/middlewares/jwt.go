@@ -4,24 +4,40 @@ import (
 	"strings"
 
 	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/schemas"
 	"github.com/duvrdx/whoami/internal/services"
 
+	"github.com/golang-jwt/jwt/v5"
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 )
 
+// Rotas públicas, autenticadas pelos próprios protocolos (OAuth2, SAML e SCIM)
+var publicPrefixes = []string{"/o", "/saml", "/scim"}
+
+func isPublicRoute(c echo.Context) bool {
+	for _, prefix := range publicPrefixes {
+		if strings.HasPrefix(c.Path(), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetJWTMiddleware authenticates API requests with a JWT access token or a
+// personal access token (API key)
 func GetJWTMiddleware() echo.MiddlewareFunc {
+	sessionService := services.NewSessionService()
+
 	var configJWT = echojwt.Config{
 		SigningKey:    config.Config.Token.Secret,
 		SigningMethod: "HS256",
-		Skipper: func(c echo.Context) bool {
-			return strings.HasPrefix(c.Path(), "/o")
-		},
+		Skipper:       isPublicRoute,
 		BeforeFunc: func(c echo.Context) {
 			token := c.Request().Header.Get("Authorization")
+			// Sem token, o echojwt responde 401 pelo ErrorHandler
 			if token == "" {
 				c.Logger().Info("Token is not provided")
-				c.JSON(401, "Token is not provided")
 				return
 			} else {
 				c.Logger().Infof("Token recebido: %s", token)
@@ -31,36 +47,101 @@ func GetJWTMiddleware() echo.MiddlewareFunc {
 			c.Logger().Errorf("Error: %v", err)
 			return echo.ErrUnauthorized
 		},
-		SuccessHandler: func(c echo.Context) {
-			token := c.Request().Header.Get("Authorization")
-			authService := services.NewAuthService()
+	}
 
-			tokenSplit := strings.Split(token, "Bearer ")
-			if len(tokenSplit) != 2 {
-				c.Logger().Error("Invalid token format")
-				c.JSON(401, "Invalid token format")
-				return
-			}
+	jwtMiddleware := echojwt.WithConfig(configJWT)
+	accessTokenService := services.NewAccessTokenService()
+	authService := services.NewAuthService()
 
-			token = tokenSplit[1]
+	// authenticate roda depois da validação da assinatura e antes do handler. O
+	// SuccessHandler do echojwt não pode interromper a requisição, por isso a
+	// conferência do token no banco fica aqui.
+	authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// O echojwt guarda o token decodificado em "user" antes de ser substituído pelo usuário
+			parsed, ok := c.Get("user").(*jwt.Token)
+			if !ok {
+				return echo.ErrUnauthorized
+			}
 
-			tokenInDb, err := authService.GetTokenByAccessToken(token)
+			var sid string
+			var actor map[string]interface{}
+			if claims, ok := parsed.Claims.(jwt.MapClaims); ok {
+				sid, _ = claims["sid"].(string)
+				actor, _ = claims["act"].(map[string]interface{})
+			}
 
+			// Tokens revogados, de sessões encerradas ou de usuários desativados deixam de existir ou de valer
+			tokenInDb, err := authService.GetTokenByAccessToken(parsed.Raw)
 			if err != nil {
 				c.Logger().Errorf("Error searching token in DB: %v", err)
-				c.JSON(401, "Invalid token")
-				return
+				return echo.ErrUnauthorized
 			}
 
-			if tokenInDb == nil {
-				c.Logger().Error("Token not found")
-				c.JSON(401, "Invalid token")
-				return
+			if !tokenInDb.User.IsActive {
+				c.Logger().Error("User is inactive")
+				return echo.ErrUnauthorized
 			}
 
 			c.Set("user", tokenInDb.User)
-		},
+
+			if sid != "" {
+				c.Set("sid", sid)
+				sessionService.Touch(sid)
+			}
+
+			// Tokens de personificação identificam o administrador real para a auditoria
+			if actorID, ok := actor["user_id"].(float64); ok {
+				c.Set("actor_id", uint(actorID))
+			}
+
+			return next(c)
+		}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		jwtHandler := jwtMiddleware(authenticate(next))
+
+		return func(c echo.Context) error {
+			token := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+
+			if isPublicRoute(c) {
+				return next(c)
+			}
+
+			if !services.IsPersonalAccessToken(token) {
+				return jwtHandler(c)
+			}
+
+			accessToken, err := accessTokenService.Authenticate(token)
+			if err != nil {
+				c.Logger().Errorf("Error authenticating access token: %v", err)
+				return c.JSON(401, "Invalid token")
+			}
+
+			// O escopo é o primeiro segmento da rota: /auth, /authz ou /me
+			scopes := strings.Split(accessToken.Scopes, ",")
+			scope := strings.SplitN(strings.TrimPrefix(c.Path(), "/"), "/", 2)[0]
+			if accessToken.Scopes != "" && !containsScope(scopes, scope) {
+				return c.JSON(403, "Token scope does not allow this route")
+			}
+
+			c.Set("user", schemas.UserResponseFromModel(&accessToken.User))
+			c.Set("access_token_id", accessToken.ID)
+			if accessToken.Roles != "" {
+				c.Set("token_roles", strings.Split(accessToken.Roles, ","))
+			}
+
+			return next(c)
+		}
 	}
+}
 
-	return echojwt.WithConfig(configJWT)
+func containsScope(scopes []string, scope string) bool {
+	for _, allowed := range scopes {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/duvrdx/whoami/internal/scim"
+	"github.com/duvrdx/whoami/internal/services"
+	"github.com/labstack/echo/v4"
+)
+
+// SCIMAuthMiddleware authenticates provisioning clients with a SCIM bearer token
+func SCIMAuthMiddleware(scimService services.SCIMService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+
+			if err := scimService.Authenticate(token); err != nil {
+				c.Logger().Errorf("SCIM authentication failed: %v", err)
+
+				body, _ := json.Marshal(scim.NewError(401, "", "Invalid SCIM token"))
+				c.Response().Header().Set("WWW-Authenticate", `Bearer realm="whoami-scim"`)
+				return c.Blob(401, scim.ContentType, body)
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RBACApprovalPolicy makes a role requestable and sets who approves its requests
+type RBACApprovalPolicy struct {
+	gorm.Model
+	RoleID            uint   `json:"role_id" gorm:"uniqueIndex"`
+	Approvers         string `json:"approvers"`       // Identificadores de usuários, separados por vírgulas
+	ApproverGroups    string `json:"approver_groups"` // Membros dos grupos, inclusive dos subgrupos, também aprovam
+	RequiredApprovals int    `json:"required_approvals" gorm:"default:1"`
+	MaxDuration       int    `json:"max_duration"` // Segundos; 0 usa access_request.max_duration
+
+	Role RBACRole `json:"role"`
+}
+
+// RBACAccessRequest is a user's request for a role for a limited time. Once approved
+// by enough approvers, the role is assigned until GrantExpiresAt.
+type RBACAccessRequest struct {
+	gorm.Model
+	RoleID            uint       `json:"role_id" gorm:"index"`
+	RequesterID       uint       `json:"requester_id" gorm:"index"`
+	Justification     string     `json:"justification"`
+	Duration          int        `json:"duration"` // Segundos de acesso pedidos
+	Status            string     `json:"status" gorm:"index;default:'pending'"`
+	RequiredApprovals int        `json:"required_approvals"` // Copiado da política quando o pedido é feito
+	ExpiresAt         time.Time  `json:"expires_at"`         // Prazo para a decisão
+	DecidedAt         *time.Time `json:"decided_at"`
+	GrantExpiresAt    *time.Time `json:"grant_expires_at"`
+
+	Role      RBACRole                 `json:"role"`
+	Requester User                     `json:"requester"`
+	Events    []RBACAccessRequestEvent `json:"events" gorm:"foreignKey:AccessRequestID"`
+}
+
+// RBACAccessRequestEvent is an entry of the history of an access request
+type RBACAccessRequestEvent struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	AccessRequestID uint      `json:"access_request_id" gorm:"index"`
+	ActorID         uint      `json:"actor_id"`
+	Action          string    `json:"action"` // requested, approved, denied, cancelled ou granted
+	Comment         string    `json:"comment"`
+	CreatedAt       time.Time `json:"created_at"`
+
+	Actor User `json:"actor"`
+}
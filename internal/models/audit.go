@@ -0,0 +1,21 @@
+package models
+
+import "gorm.io/gorm"
+
+// AuditLog records sensitive actions, attributed to the real actor even when
+// they act through another user's token
+type AuditLog struct {
+	gorm.Model
+	Action    string `json:"action" gorm:"index"`
+	ActorID   uint   `json:"actor_id" gorm:"index"`
+	UserID    uint   `json:"user_id" gorm:"index"` // Usuário afetado ou personificado
+	SessionID uint   `json:"session_id"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Status    int    `json:"status"`
+	IP        string `json:"ip"`
+	Reason    string `json:"reason"`
+
+	Actor User `json:"actor"`
+	User  User `json:"user"`
+}
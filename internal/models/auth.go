@@ -1,34 +1,49 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type User struct {
 	gorm.Model
-	Identifier string   `json:"identifier" gorm:"unique"`
-	Password   string   `json:"password"`
-	IsActive   bool     `gorm:"type:boolean;default:true" json:"is_active"`
-	IsAdmin    bool     `gorm:"type:boolean;default:false" json:"is_admin"`
-	Metadata   string   `gorm:"default:'{}'" json:"metadata"`
-	Groups     []*Group `gorm:"many2many:group_users;"`
+	Identifier       string   `json:"identifier" gorm:"unique"`
+	Password         string   `json:"password"`
+	PasswordBreached bool     `gorm:"type:boolean;default:false" json:"password_breached"`
+	IsActive         bool     `gorm:"type:boolean;default:true" json:"is_active"`
+	IsAdmin          bool     `gorm:"type:boolean;default:false" json:"is_admin"`
+	Metadata         string   `gorm:"default:'{}'" json:"metadata"`
+	Source           string   `gorm:"default:'local'" json:"source"` // Origem do usuário: local ou o provedor externo que o criou
+	Type             string   `gorm:"default:'human'" json:"type"`   // human ou service_account, que não faz login interativo
+	Groups           []*Group `gorm:"many2many:group_users;"`
 }
 
 type Group struct {
 	gorm.Model
-	Identifier  string  `json:"identifier" gorm:"unique"`
-	Description string  `gorm:"default:''" json:"description"`
-	Metadata    string  `gorm:"default:'{}'" json:"metadata"`
-	IsActive    bool    `gorm:"type:boolean;default:true" json:"is_active"`
-	Users       []*User `gorm:"many2many:group_users;"`
+	Identifier  string   `json:"identifier" gorm:"unique"`
+	Description string   `gorm:"default:''" json:"description"`
+	Metadata    string   `gorm:"default:'{}'" json:"metadata"`
+	IsActive    bool     `gorm:"type:boolean;default:true" json:"is_active"`
+	Source      string   `gorm:"default:'local'" json:"source"`
+	Users       []*User  `gorm:"many2many:group_users;"`
+	Subgroups   []*Group `gorm:"many2many:group_subgroups;joinForeignKey:GroupID;joinReferences:SubgroupID"` // Membros dos subgrupos também são membros do grupo
+}
+
+// GroupClosure holds every (ancestor, descendant) pair of the group nesting
+// graph, so effective memberships are resolved without walking it at request time
+type GroupClosure struct {
+	AncestorID   uint `json:"ancestor_id" gorm:"primaryKey;autoIncrement:false"`
+	DescendantID uint `json:"descendant_id" gorm:"primaryKey;autoIncrement:false;index"`
 }
 
 type Client struct {
 	gorm.Model
-	Identifier string `json:"identifier" gorm:"unique"`
-	Secret     string `json:"secret"`
-	IsActive   bool   `gorm:"type:boolean;default:true" json:"is_active"`
-	Grant      string `json:"grant"`
+	Identifier   string `json:"identifier" gorm:"unique"`
+	Secret       string `json:"secret"`
+	IsActive     bool   `gorm:"type:boolean;default:true" json:"is_active"`
+	Grant        string `json:"grant"`
+	LoginMethods string `gorm:"default:'password'" json:"login_methods"` // Lista separada por vírgulas: password, magic_link, otp
 }
 
 type Token struct {
@@ -38,7 +53,119 @@ type Token struct {
 	ExpiresIn    int    `json:"expires_in"`
 	UserID       uint   `json:"user_id"`
 	ClientID     uint   `json:"client_id"`
+	SessionID    uint   `json:"session_id" gorm:"index"`
+	ActorID      *uint  `json:"actor_id"` // Administrador que personifica o usuário, se houver
+
+	User   User   `json:"user"`
+	Client Client `json:"client"`
+}
+
+// Session is a login on a device. It outlives the tokens refreshed within it, and
+// revoking it removes all of them.
+type Session struct {
+	gorm.Model
+	SID        string    `json:"sid" gorm:"column:sid;uniqueIndex"` // Enviado na claim sid dos JWTs
+	UserID     uint      `json:"user_id" gorm:"index"`
+	ClientID   uint      `json:"client_id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Device     string    `json:"device"`
+	Methods    string    `json:"methods"` // Métodos de autenticação usados, separados por vírgulas
+	LastSeenAt time.Time `json:"last_seen_at"`
+
+	User   User   `json:"user"`
+	Client Client `json:"client"`
+}
+
+// PersonalAccessToken is a long-lived credential for scripts. Tokens of service
+// accounts are called API keys; both are stored only as hashes.
+type PersonalAccessToken struct {
+	gorm.Model
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // Início do token, para reconhecê-lo na listagem
+	TokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Scopes     string     `json:"scopes"` // Lista separada por vírgulas; vazia permite todas as rotas
+	Roles      string     `json:"roles"`  // Lista separada por vírgulas; vazia mantém todos os papéis do usuário
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+
+	User User `json:"user"`
+}
+
+// MFAFactor is a second factor enrolled by a user. Only TOTP is supported; a
+// factor counts for login once the user confirms it with a first code.
+type MFAFactor struct {
+	gorm.Model
+	UserID       uint       `json:"user_id" gorm:"index"`
+	Type         string     `json:"type"`
+	Name         string     `json:"name"`
+	Secret       string     `json:"-"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	LastUsedStep int64      `json:"-"` // Último intervalo aceito, para que um código não seja usado duas vezes
+}
+
+// LoginChallenge is a single-use magic link or one-time code issued for passwordless
+// login, or the token of a login waiting for its second factor
+type LoginChallenge struct {
+	gorm.Model
+	Method      string     `json:"method"`
+	FirstFactor string     `json:"first_factor,omitempty"` // Método já verificado de um login à espera do segundo fator
+	SecretHash  string     `json:"-" gorm:"index"`
+	UserID      uint       `json:"user_id" gorm:"index"`
+	ClientID    uint       `json:"client_id"`
+	Attempts    int        `json:"attempts" gorm:"default:0"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	ConsumedAt  *time.Time `json:"consumed_at"`
 
 	User   User   `json:"user"`
 	Client Client `json:"client"`
 }
+
+// LoginRequest records a passwordless sign-in request by the identifier it was made
+// for, so the rate limit applies the same whether or not the account exists
+type LoginRequest struct {
+	gorm.Model
+	Identifier string `json:"identifier" gorm:"index"`
+	ClientID   uint   `json:"client_id"`
+}
+
+// ExternalIdentity links a user to its account at an upstream identity provider
+type ExternalIdentity struct {
+	gorm.Model
+	Provider string `json:"provider" gorm:"uniqueIndex:idx_external_identity"`
+	Subject  string `json:"subject" gorm:"uniqueIndex:idx_external_identity"`
+	UserID   uint   `json:"user_id" gorm:"index"`
+	Claims   string `json:"claims" gorm:"default:'{}'"`
+
+	User User `json:"user"`
+}
+
+// FederationState tracks an in-flight login at an upstream provider
+type FederationState struct {
+	gorm.Model
+	State        string    `json:"state" gorm:"uniqueIndex"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"-"`
+	Provider     string    `json:"provider"`
+	ClientID     uint      `json:"client_id"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// Invitation is a single-use link for a pending user to set a password. The
+// pending user stays inactive, and so cannot log in, until it is accepted.
+type Invitation struct {
+	gorm.Model
+	Identifier  string     `json:"identifier"` // Mantido após a revogação, que remove o usuário pendente
+	UserID      uint       `json:"user_id" gorm:"index"`
+	TokenHash   string     `json:"-" gorm:"uniqueIndex"`
+	Groups      string     `json:"groups"` // Lista separada por vírgulas
+	Roles       string     `json:"roles"`  // Lista separada por vírgulas
+	InvitedByID *uint      `json:"invited_by_id"`
+	SentCount   int        `json:"sent_count"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+
+	InvitedBy *User `json:"invited_by"`
+}
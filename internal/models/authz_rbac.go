@@ -1,16 +1,52 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type RBACRole struct {
 	gorm.Model
-	Identifier  string           `json:"identifier" gorm:"unique"`
-	Name        string           `json:"name"`
-	Description string           `json:"description" gorm:"default:''"`
-	Permissions []RBACPermission `gorm:"many2many:rbac_role_permissions;"` // Relação many2many com RBACPermission
-	Users       []User           `gorm:"many2many:rbac_role_users;"`       // Relação many2many com User
+	Identifier  string               `json:"identifier" gorm:"unique"`
+	Name        string               `json:"name"`
+	Description string               `json:"description" gorm:"default:''"`
+	Permissions []RBACPermission     `gorm:"many2many:rbac_role_permissions;"` // Relação many2many com RBACPermission
+	Assignments []RBACRoleAssignment `gorm:"foreignKey:RoleID"`                // Atribuições do papel a usuários
+	Groups      []Group              `gorm:"many2many:rbac_role_groups;"`      // Relação many2many com Group, herdada pelos membros
+
+	// Papéis cujas permissões este papel herda
+	Parents []*RBACRole `gorm:"many2many:rbac_role_parents;joinForeignKey:RoleID;joinReferences:ParentID"`
+}
+
+// RBACRoleAssignment grants a role to a user, optionally only within a time window.
+// Assignments outside their window are ignored by authorization, and expired ones
+// are removed by a background job.
+type RBACRoleAssignment struct {
+	RoleID    uint       `json:"role_id" gorm:"column:rbac_role_id;primaryKey;autoIncrement:false"`
+	UserID    uint       `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	NotBefore *time.Time `json:"not_before" gorm:"index"` // Nula vale desde a criação
+	ExpiresAt *time.Time `json:"expires_at" gorm:"index"` // Nula não expira
+	Reason    string     `json:"reason" gorm:"default:''"`
+	GrantorID *uint      `json:"grantor_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	Role    RBACRole `json:"role" gorm:"foreignKey:RoleID"`
+	User    User     `json:"user"`
+	Grantor *User    `json:"grantor"`
+}
+
+// A tabela é a mesma da antiga relação many2many entre papéis e usuários
+func (RBACRoleAssignment) TableName() string {
+	return "rbac_role_users"
+}
+
+// RBACRoleClosure holds every (role, ancestor) pair of the role hierarchy, so
+// inherited permissions are resolved without walking it at request time
+type RBACRoleClosure struct {
+	RoleID     uint `json:"role_id" gorm:"primaryKey;autoIncrement:false"`
+	AncestorID uint `json:"ancestor_id" gorm:"primaryKey;autoIncrement:false;index"`
 }
 
 type RBACPermission struct {
@@ -23,11 +59,24 @@ type RBACPermission struct {
 
 	ResourceType  *RBACResourceType `json:"resourcetype" gorm:"foreignKey:ResourceTypeID"` // Relação belongs to RBACResourceType
 	AcceptedRoles []RBACRole        `gorm:"many2many:rbac_role_permissions;"`              // Relação many2many com RBACRole
+
+	// Permissões com a mesma ação são avaliadas juntas, o que permite negar parte do que outra concede
+	Action   string `json:"action" gorm:"default:'';index"` // Vazia equivale ao próprio identifier
+	Effect   string `json:"effect" gorm:"default:'allow'"`  // allow ou deny
+	Priority int    `json:"priority" gorm:"default:0"`      // Ordem de avaliação em first-applicable, menor primeiro
+
+	// Expressão CEL sobre user, resource e env; a permissão só se aplica quando ela é verdadeira
+	Condition string `json:"condition" gorm:"default:''"`
 }
 
+// RBACResourceIdentifier is a resource, or a glob of resources, permissions apply to.
+// Identifiers are hierarchical (project:42:doc:7), and a grant on a resource also
+// covers its descendants.
 type RBACResourceIdentifier struct {
 	gorm.Model
 	Identifier string `json:"identifier" gorm:"unique; uniqueIndex"`
+	Kind       string `json:"kind" gorm:"default:'exact';index:idx_rbac_resource_pattern"` // exact ou glob
+	Prefix     string `json:"prefix" gorm:"default:'';index:idx_rbac_resource_pattern"`    // Segmentos literais antes do primeiro curinga de um glob
 }
 
 type RBACResourceType struct {
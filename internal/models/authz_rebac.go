@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReBACNamespace is an object type of the relationship-based model, e.g. doc or folder,
+// with the relations its objects have and how each one is computed
+type ReBACNamespace struct {
+	gorm.Model
+	Name      string `json:"name" gorm:"unique"`
+	Relations string `json:"relations" gorm:"default:'{}'"` // Mapa JSON de relação para reescrita de userset
+}
+
+// ReBACTuple is a relationship: the subject, a user or the userset of another object
+// (group:eng#member), has the relation with the object (doc:readme#viewer)
+type ReBACTuple struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	Namespace        string    `json:"namespace" gorm:"uniqueIndex:idx_rebac_tuple;index:idx_rebac_object"`
+	ObjectID         string    `json:"object_id" gorm:"uniqueIndex:idx_rebac_tuple;index:idx_rebac_object"`
+	Relation         string    `json:"relation" gorm:"uniqueIndex:idx_rebac_tuple;index:idx_rebac_object"`
+	SubjectNamespace string    `json:"subject_namespace" gorm:"uniqueIndex:idx_rebac_tuple;index:idx_rebac_subject"`
+	SubjectObjectID  string    `json:"subject_object_id" gorm:"uniqueIndex:idx_rebac_tuple;index:idx_rebac_subject"`
+	SubjectRelation  string    `json:"subject_relation" gorm:"uniqueIndex:idx_rebac_tuple;default:''"` // Vazia quando o sujeito é o próprio objeto
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// ReBACChange records every write to the tuple store. Its ID is the revision zookies
+// refer to.
+type ReBACChange struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Operation string    `json:"operation"` // write ou delete
+	Tuple     string    `json:"tuple"`
+	CreatedAt time.Time `json:"created_at"`
+}
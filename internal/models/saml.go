@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SAMLServiceProvider is an application that signs users in with whoami acting as its SAML identity provider
+type SAMLServiceProvider struct {
+	gorm.Model
+	EntityID           string `json:"entity_id" gorm:"unique"`
+	Name               string `json:"name"`
+	ACSURL             string `json:"acs_url"`
+	SLOURL             string `json:"slo_url"`
+	SLOBinding         string `json:"slo_binding"`
+	NameIDFormat       string `json:"name_id_format"`
+	Certificate        string `json:"certificate"` // PEM usado para verificar requisições assinadas pelo SP
+	WantRequestsSigned bool   `gorm:"type:boolean;default:false" json:"want_requests_signed"`
+	SignResponse       bool   `gorm:"type:boolean;default:false" json:"sign_response"`
+	Attributes         string `gorm:"default:'{}'" json:"attributes"` // Mapa JSON de nome do atributo SAML para a sua origem
+	IsActive           bool   `gorm:"type:boolean;default:true" json:"is_active"`
+}
+
+// SAMLBrowserSession is the identity provider login session kept in a cookie,
+// so users reach other service providers without signing in again
+type SAMLBrowserSession struct {
+	gorm.Model
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+
+	User User `json:"user"`
+}
+
+// SAMLSession records an assertion issued to a service provider, which single logout looks up
+type SAMLSession struct {
+	gorm.Model
+	SessionIndex      string `json:"session_index" gorm:"uniqueIndex"`
+	BrowserSessionID  uint   `json:"browser_session_id" gorm:"index"`
+	ServiceProviderID uint   `json:"service_provider_id"`
+	UserID            uint   `json:"user_id"`
+	NameID            string `json:"name_id"`
+	NameIDFormat      string `json:"name_id_format"`
+}
+
+// SAMLIdentityProvider is a partner identity provider whose users sign in to whoami through SAML
+type SAMLIdentityProvider struct {
+	gorm.Model
+	Name                string `json:"name" gorm:"unique"` // Usado na URL de login
+	EntityID            string `json:"entity_id" gorm:"unique"`
+	SSOURL              string `json:"sso_url"`
+	SSOBinding          string `json:"sso_binding"`
+	Certificates        string `json:"certificates"` // Um ou mais PEM, vários permitem a troca de chaves do IdP
+	SignRequests        bool   `gorm:"type:boolean;default:false" json:"sign_requests"`
+	NameIDFormat        string `json:"name_id_format"`
+	IdentifierAttribute string `json:"identifier_attribute"` // Vazio usa o próprio NameID
+	GroupsAttribute     string `json:"groups_attribute"`
+	MetadataAttributes  string `gorm:"default:'{}'" json:"metadata_attributes"` // Mapa JSON de chave do metadata para atributo SAML
+	Provision           bool   `gorm:"type:boolean;default:false" json:"provision"`
+	LinkExisting        bool   `gorm:"type:boolean;default:false" json:"link_existing"`
+	IsActive            bool   `gorm:"type:boolean;default:true" json:"is_active"`
+}
+
+// SAMLAuthnRequest is an AuthnRequest sent to a partner identity provider;
+// only responses to a pending request are accepted, and each only once
+type SAMLAuthnRequest struct {
+	gorm.Model
+	RequestID string    `json:"request_id" gorm:"uniqueIndex"`
+	Provider  string    `json:"provider"`
+	ClientID  uint      `json:"client_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SAMLConsumedAssertion remembers assertions already used to sign in until they expire
+type SAMLConsumedAssertion struct {
+	gorm.Model
+	AssertionID string    `json:"assertion_id" gorm:"uniqueIndex"`
+	Provider    string    `json:"provider"`
+	ExpiresAt   time.Time `json:"expires_at" gorm:"index"`
+}
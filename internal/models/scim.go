@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SCIMToken is the bearer credential a provisioning client, such as an HR system, uses on the SCIM API
+type SCIMToken struct {
+	gorm.Model
+	Name       string     `json:"name" gorm:"unique"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
@@ -1,6 +1,7 @@
 package routing
 
 import (
+	"github.com/duvrdx/whoami/internal/config"
 	"github.com/duvrdx/whoami/internal/controllers"
 	"github.com/duvrdx/whoami/internal/middlewares"
 	"github.com/duvrdx/whoami/internal/services"
@@ -13,15 +14,35 @@ type Routing struct {
 
 func (Routing Routing) GetRoutes() *echo.Echo {
 	e := echo.New()
+	auditService := services.NewAuditService()
 
 	e.Use(middlewares.LoggerMiddleware)
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
 	e.Use(middlewares.GetJWTMiddleware())
+	e.Use(middlewares.AuditMiddleware(auditService))
 
 	// Controllers and Services definitions
 	authService := services.NewAuthService()
-	authController := controllers.NewAuthController(authService)
+	mfaService := services.NewMFAService()
+	sessionService := services.NewSessionService()
+	authController := controllers.NewAuthController(authService, mfaService, sessionService)
+	sessionController := controllers.NewSessionController(sessionService)
+	impersonationController := controllers.NewImpersonationController(authService, sessionService, auditService)
+	notifier := services.NewNotifier()
+	invitationController := controllers.NewInvitationController(services.NewInvitationService(notifier))
+	passwordlessService := services.NewPasswordlessService(notifier)
+	passwordlessController := controllers.NewPasswordlessController(authService, mfaService, passwordlessService, sessionService)
+	federationService := services.NewFederationService()
+	federationController := controllers.NewFederationController(authService, mfaService, federationService, sessionService)
+	samlIdPService := services.NewSAMLIdPService()
+	samlIdPController := controllers.NewSAMLIdPController(authService, mfaService, samlIdPService)
+	samlSPController := controllers.NewSAMLSPController(authService, mfaService, services.NewSAMLSPService(), sessionService)
+	scimService := services.NewSCIMService()
+	scimController := controllers.NewSCIMController(scimService)
+	accessTokenController := controllers.NewAccessTokenController(services.NewAccessTokenService())
+	authzRBACService := services.NewAuthzRBACService()
+	accountController := controllers.NewAccountController(authService, services.NewAccountService(), authzRBACService, mfaService)
 
 	// OAuth2 routes
 	oauth := e.Group("/o")
@@ -29,14 +50,132 @@ func (Routing Routing) GetRoutes() *echo.Echo {
 	oauth.DELETE("/token/:identifier", authController.RevokeToken)
 	oauth.POST("/token/authorize", authController.Authorize)
 	oauth.POST("/token/refresh", authController.RefreshToken)
+	oauth.POST("/mfa", authController.CompleteMFA)
+	oauth.POST("/passwordless/start", passwordlessController.Start)
+	oauth.POST("/passwordless/token", passwordlessController.Redeem)
+	oauth.POST("/invitation/accept", invitationController.AcceptInvitation)
+	oauth.GET("/federation/:provider/login", federationController.Login)
+	oauth.GET("/federation/:provider/callback", federationController.Callback)
+
+	// SAML identity provider routes
+	samlGroup := e.Group("/saml")
+	samlGroup.GET("/metadata", samlIdPController.Metadata)
+	samlGroup.GET("/sso", samlIdPController.SSO)
+	samlGroup.POST("/sso", samlIdPController.SSO)
+	samlGroup.GET("/slo", samlIdPController.SLO)
+	samlGroup.POST("/slo", samlIdPController.SLO)
+
+	// SAML service provider routes, for users of partner identity providers
+	samlGroup.GET("/sp/metadata", samlSPController.Metadata)
+	samlGroup.GET("/login/:provider", samlSPController.Login)
+	samlGroup.POST("/acs", samlSPController.ACS)
+
+	// SCIM 2.0 provisioning routes, authenticated by SCIM tokens
+	scimGroup := e.Group("/scim/v2", middlewares.SCIMAuthMiddleware(scimService))
+	scimGroup.GET("/Users", scimController.ListUsers)
+	scimGroup.POST("/Users", scimController.CreateUser)
+	scimGroup.GET("/Users/:id", scimController.GetUser)
+	scimGroup.PUT("/Users/:id", scimController.ReplaceUser)
+	scimGroup.PATCH("/Users/:id", scimController.PatchUser)
+	scimGroup.DELETE("/Users/:id", scimController.DeleteUser)
+	scimGroup.GET("/Groups", scimController.ListGroups)
+	scimGroup.POST("/Groups", scimController.CreateGroup)
+	scimGroup.GET("/Groups/:id", scimController.GetGroup)
+	scimGroup.PUT("/Groups/:id", scimController.ReplaceGroup)
+	scimGroup.PATCH("/Groups/:id", scimController.PatchGroup)
+	scimGroup.DELETE("/Groups/:id", scimController.DeleteGroup)
+	scimGroup.POST("/Bulk", scimController.Bulk)
+	scimGroup.GET("/ServiceProviderConfig", scimController.ServiceProviderConfig)
+	scimGroup.GET("/Schemas", scimController.Schemas)
+	scimGroup.GET("/Schemas/:id", scimController.GetSchema)
+	scimGroup.GET("/ResourceTypes", scimController.ResourceTypes)
+	scimGroup.GET("/ResourceTypes/:id", scimController.GetResourceType)
+
+	// Self-service routes for the authenticated user
+	me := e.Group("/me")
+	me.GET("", accountController.GetProfile)
+	me.PUT("", accountController.UpdateProfile)
+	me.POST("/password", accountController.ChangePassword)
+	me.GET("/token", accountController.GetTokens)
+	me.DELETE("/token/:id", accountController.RevokeToken)
+	me.GET("/session", sessionController.GetOwnSessions)
+	me.DELETE("/session", sessionController.RevokeOtherSessions)
+	me.DELETE("/session/:id", sessionController.RevokeOwnSession)
+	me.POST("/pat", accessTokenController.CreateOwnToken)
+	me.DELETE("/pat/:id", accessTokenController.RevokeOwnToken)
+	me.GET("/pat", accessTokenController.GetOwnTokens)
+	me.GET("/role", accountController.GetRoles)
+	me.GET("/permission", accountController.GetPermissions)
+	me.GET("/mfa", accountController.GetFactors)
+	me.POST("/mfa/totp", accountController.EnrollTOTP)
+	me.POST("/mfa/:id/confirm", accountController.ConfirmFactor)
+	me.DELETE("/mfa/:id", accountController.DeleteFactor)
 
 	// Auth routes
 	auth := e.Group("/auth")
 	auth.POST("/user", authController.Register)
+	auth.POST("/user/import", authController.ImportUsers)
 	auth.PUT("/user/:identifier", authController.UpdateUser)
+	auth.POST("/user/:identifier/password/reset", authController.ResetPassword)
 	auth.DELETE("/user/:identifier", authController.DeleteUser)
 	auth.GET("/user/:identifier", authController.GetUser)
 	auth.GET("/user", authController.GetUsers)
+	auth.GET("/user/:identifier/group", authController.GetUserGroups)
+	auth.POST("/user/:identifier/pat", accessTokenController.CreateUserToken)
+	auth.DELETE("/user/:identifier/pat/:id", accessTokenController.RevokeUserToken)
+	auth.GET("/user/:identifier/pat", accessTokenController.GetUserTokens)
+	auth.GET("/user/:identifier/mfa", accountController.GetUserFactors)
+	auth.DELETE("/user/:identifier/mfa/:id", accountController.DeleteUserFactor)
+	auth.GET("/user/:identifier/session", sessionController.GetUserSessions)
+	auth.DELETE("/user/:identifier/session", sessionController.RevokeUserSessions)
+	auth.DELETE("/user/:identifier/session/:id", sessionController.RevokeUserSession)
+	auth.POST("/user/:identifier/impersonate", impersonationController.Impersonate)
+	auth.GET("/audit", impersonationController.GetAuditLog)
+
+	auth.POST("/invitation", invitationController.CreateInvitation)
+	auth.GET("/invitation/:id", invitationController.GetInvitation)
+	auth.GET("/invitation", invitationController.GetInvitations)
+	auth.POST("/invitation/:id/resend", invitationController.ResendInvitation)
+	auth.DELETE("/invitation/:id", invitationController.RevokeInvitation)
+
+	auth.POST("/serviceaccount", accessTokenController.CreateServiceAccount)
+	auth.GET("/serviceaccount", accessTokenController.GetServiceAccounts)
+	auth.GET("/user/:identifier/identity", federationController.ListIdentities)
+	auth.POST("/user/:identifier/identity", federationController.LinkIdentity)
+	auth.DELETE("/user/:identifier/identity/:id", federationController.UnlinkIdentity)
+
+	if config.Config.LDAP.Enabled {
+		directoryController := controllers.NewDirectoryController(services.NewLDAPService())
+		auth.POST("/ldap/sync", directoryController.SyncLDAP)
+	}
+
+	auth.POST("/saml/sp", samlIdPController.CreateServiceProvider)
+	auth.PUT("/saml/sp/:id", samlIdPController.UpdateServiceProvider)
+	auth.DELETE("/saml/sp/:id", samlIdPController.DeleteServiceProvider)
+	auth.GET("/saml/sp/:id", samlIdPController.GetServiceProvider)
+	auth.GET("/saml/sp", samlIdPController.GetServiceProviders)
+
+	auth.POST("/saml/idp", samlSPController.CreateIdentityProvider)
+	auth.PUT("/saml/idp/:name", samlSPController.UpdateIdentityProvider)
+	auth.DELETE("/saml/idp/:name", samlSPController.DeleteIdentityProvider)
+	auth.GET("/saml/idp/:name", samlSPController.GetIdentityProvider)
+	auth.GET("/saml/idp", samlSPController.GetIdentityProviders)
+
+	auth.POST("/scim/token", scimController.CreateToken)
+	auth.DELETE("/scim/token/:id", scimController.DeleteToken)
+	auth.GET("/scim/token", scimController.GetTokens)
+
+	auth.POST("/group", authController.CreateGroup)
+	auth.PUT("/group/:identifier", authController.UpdateGroup)
+	auth.DELETE("/group/:identifier", authController.DeleteGroup)
+	auth.GET("/group/:identifier", authController.GetGroup)
+	auth.GET("/group", authController.GetGroups)
+	auth.GET("/group/:identifier/member", authController.GetGroupMembers)
+	auth.POST("/group/:identifier/member", authController.AddGroupMembers)
+	auth.DELETE("/group/:identifier/member/:user", authController.RemoveGroupMember)
+	auth.GET("/group/:identifier/subgroup", authController.GetSubgroups)
+	auth.POST("/group/:identifier/subgroup/:subgroup", authController.AddSubgroup)
+	auth.DELETE("/group/:identifier/subgroup/:subgroup", authController.RemoveSubgroup)
 
 	auth.POST("/client", authController.CreateClient)
 	auth.PUT("/client/:identifier", authController.UpdateClient)
@@ -45,8 +184,8 @@ func (Routing Routing) GetRoutes() *echo.Echo {
 	auth.GET("/client", authController.GetClients)
 
 	// Authz RBAC routes
-	authzRBACService := services.NewAuthzRBACService()
 	authzRBACController := controllers.NewAuthzRBACController(authzRBACService)
+	accessRequestController := controllers.NewAccessRequestController(services.NewAccessRequestService(notifier))
 
 	authz := e.Group("/authz")
 	rbac := authz.Group("/rbac")
@@ -57,6 +196,24 @@ func (Routing Routing) GetRoutes() *echo.Echo {
 	rbac.GET("/role", authzRBACController.GetRoles)
 	rbac.POST("/role/grant", authzRBACController.GrantRoleToUser)
 	rbac.POST("/role/revoke", authzRBACController.RevokeRoleFromUser)
+	rbac.POST("/role/grant/group", authzRBACController.GrantRoleToGroup)
+	rbac.POST("/role/revoke/group", authzRBACController.RevokeRoleFromGroup)
+	rbac.POST("/assignment", authzRBACController.AssignRole)
+	rbac.GET("/assignment", authzRBACController.GetAssignments)
+	rbac.GET("/assignment/expiring", authzRBACController.GetExpiringAssignments)
+	rbac.PUT("/role/:identifier/approval", accessRequestController.SetApprovalPolicy)
+	rbac.GET("/role/:identifier/approval", accessRequestController.GetApprovalPolicy)
+	rbac.DELETE("/role/:identifier/approval", accessRequestController.DeleteApprovalPolicy)
+	rbac.GET("/approval", accessRequestController.GetApprovalPolicies)
+	rbac.POST("/request", accessRequestController.CreateRequest)
+	rbac.GET("/request", accessRequestController.GetRequests)
+	rbac.GET("/request/:id", accessRequestController.GetRequest)
+	rbac.POST("/request/:id/approve", accessRequestController.Approve)
+	rbac.POST("/request/:id/deny", accessRequestController.Deny)
+	rbac.POST("/request/:id/cancel", accessRequestController.Cancel)
+	rbac.GET("/role/:identifier/hierarchy", authzRBACController.GetRoleHierarchy)
+	rbac.POST("/role/:identifier/parent/:parent", authzRBACController.AddParentRole)
+	rbac.DELETE("/role/:identifier/parent/:parent", authzRBACController.RemoveParentRole)
 
 	rbac.POST("/permission", authzRBACController.CreatePermission)
 	rbac.PUT("/permission/:identifier", authzRBACController.UpdatePermission)
@@ -64,6 +221,7 @@ func (Routing Routing) GetRoutes() *echo.Echo {
 	rbac.GET("/permission/:identifier", authzRBACController.GetPermission)
 	rbac.GET("/permission", authzRBACController.GetPermissions)
 	rbac.POST("/permission/:permission/grant/:role", authzRBACController.GrantPermissionToRole)
+	rbac.DELETE("/permission/:permission/grant/:role", authzRBACController.RevokePermissionFromRole)
 
 	rbac.POST("/resourcetype", authzRBACController.CreateResourceType)
 	rbac.PUT("/resourcetype/:identifier", authzRBACController.UpdateResourceType)
@@ -73,10 +231,33 @@ func (Routing Routing) GetRoutes() *echo.Echo {
 
 	rbac.POST("/authorize/resource", authzRBACController.AuthorizeByResource)
 	rbac.POST("/authorize/resourcetype", authzRBACController.AuthorizeByResourceType)
+	rbac.POST("/authorize/batch", authzRBACController.AuthorizeBatch)
+	rbac.POST("/authorize/explain", authzRBACController.ExplainAuthorization)
+	rbac.POST("/authorize/simulate", authzRBACController.SimulateAuthorization)
+
+	rbac.GET("/role/granted", authzRBACController.ListGrantedRoles)
+	rbac.GET("/permission/granted", authzRBACController.ListGrantedPermissions)
+	rbac.GET("/resource/granted", authzRBACController.ListGrantedResources)
+	rbac.GET("/resourcetype/granted", authzRBACController.ListGrantedResourceTypes)
+	rbac.GET("/resource/access", authzRBACController.GetResourceAccess)
+
+	// Authz ReBAC routes
+	authzReBACController := controllers.NewAuthzReBACController(services.NewAuthzReBACService())
+
+	rebac := authz.Group("/rebac")
+	rebac.POST("/namespace", authzReBACController.CreateNamespace)
+	rebac.PUT("/namespace/:name", authzReBACController.UpdateNamespace)
+	rebac.DELETE("/namespace/:name", authzReBACController.DeleteNamespace)
+	rebac.GET("/namespace/:name", authzReBACController.GetNamespace)
+	rebac.GET("/namespace", authzReBACController.GetNamespaces)
+
+	rebac.POST("/tuple", authzReBACController.WriteTuples)
+	rebac.GET("/tuple", authzReBACController.ReadTuples)
 
-	// rbac.GET("/role/granted", authzRBACController.ListGrantedRoles)
-	// rbac.GET("/resource/granted", authzRBACController.ListGrantedResources)
-	// rbac.GET("/resourcetype/granted", authzRBACController.ListGrantedResourceTypes)
+	rebac.POST("/check", authzReBACController.Check)
+	rebac.POST("/expand", authzReBACController.Expand)
+	rebac.POST("/objects", authzReBACController.ListObjects)
+	rebac.POST("/users", authzReBACController.ListUsers)
 
 	return e
 }
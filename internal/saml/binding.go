@@ -0,0 +1,107 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"html/template"
+	"io"
+	"net/url"
+)
+
+// Limite para mensagens descomprimidas, evitando bombas de deflate
+const maxMessageSize = 1 << 20
+
+// DecodeRedirect decodes a message received through the HTTP-Redirect binding (deflate + base64)
+func DecodeRedirect(value string) (*Element, error) {
+	compressed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrMalformedMessage
+	}
+
+	reader := flate.NewReader(bytes.NewReader(compressed))
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxMessageSize+1))
+	if err != nil || len(data) > maxMessageSize {
+		return nil, ErrMalformedMessage
+	}
+
+	return Parse(data)
+}
+
+// DecodePost decodes a message received through the HTTP-POST binding (base64)
+func DecodePost(value string) (*Element, error) {
+	data, err := base64.StdEncoding.DecodeString(removeWhitespace(value))
+	if err != nil || len(data) > maxMessageSize {
+		return nil, ErrMalformedMessage
+	}
+
+	return Parse(data)
+}
+
+// RedirectURL builds the HTTP-Redirect binding URL for a message. When sign
+// is set the query is signed with it (see SignQuery), since this binding
+// carries signatures outside of the deflated XML.
+func RedirectURL(location, parameter string, message *Element, relayState string, sign func(string) (string, error)) (string, error) {
+	var compressed bytes.Buffer
+
+	writer, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	writer.Write(message.Bytes())
+	writer.Close()
+
+	query := parameter + "=" + url.QueryEscape(base64.StdEncoding.EncodeToString(compressed.Bytes()))
+	if relayState != "" {
+		query += "&RelayState=" + url.QueryEscape(relayState)
+	}
+
+	if sign != nil {
+		query, err = sign(query)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	parsed, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+
+	if parsed.RawQuery != "" {
+		return location + "&" + query, nil
+	}
+	return location + "?" + query, nil
+}
+
+var postFormTemplate = template.Must(template.New("saml-post").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Redirecting...</title></head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="{{.Parameter}}" value="{{.Message}}">
+{{if .RelayState}}<input type="hidden" name="RelayState" value="{{.RelayState}}">{{end}}
+<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body>
+</html>
+`))
+
+// PostForm renders the auto-submitting page of the HTTP-POST binding
+func PostForm(action, parameter string, message *Element, relayState string) ([]byte, error) {
+	var b bytes.Buffer
+
+	err := postFormTemplate.Execute(&b, map[string]interface{}{
+		"Action":     action,
+		"Parameter":  parameter,
+		"Message":    base64.StdEncoding.EncodeToString(message.Bytes()),
+		"RelayState": relayState,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,145 @@
+package saml
+
+import (
+	"bytes"
+	"sort"
+)
+
+// canonicalize renders the subtree using Exclusive XML Canonicalization
+// without comments (https://www.w3.org/TR/xml-exc-c14n/). The excluded
+// element, when set, is left out of the output, which is how the enveloped
+// signature transform is applied. inclusivePrefixes is the optional
+// InclusiveNamespaces PrefixList, where "#default" names the default namespace.
+func canonicalize(el *Element, inclusivePrefixes []string, excluded *Element) []byte {
+	var b bytes.Buffer
+
+	inclusive := map[string]bool{}
+	for _, prefix := range inclusivePrefixes {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		inclusive[prefix] = true
+	}
+
+	writeCanonical(&b, el, map[string]string{}, inclusive, excluded)
+	return b.Bytes()
+}
+
+func isNamespaceDeclaration(attr Attr) bool {
+	return attr.Prefix == "xmlns" || (attr.Prefix == "" && attr.Local == "xmlns")
+}
+
+func writeCanonical(b *bytes.Buffer, el *Element, rendered map[string]string, inclusive map[string]bool, excluded *Element) {
+	// Prefixos visivelmente utilizados pelo elemento e pelos seus atributos
+	utilized := map[string]bool{el.Prefix: true}
+	for _, attr := range el.Attrs {
+		if !isNamespaceDeclaration(attr) && attr.Prefix != "" && attr.Prefix != "xml" {
+			utilized[attr.Prefix] = true
+		}
+	}
+
+	for prefix := range inclusive {
+		if prefix == "" || el.LookupNamespace(prefix) != "" {
+			utilized[prefix] = true
+		}
+	}
+
+	scope := make(map[string]string, len(rendered))
+	for prefix, uri := range rendered {
+		scope[prefix] = uri
+	}
+
+	var declarations []Attr
+	for prefix := range utilized {
+		uri := el.LookupNamespace(prefix)
+
+		if prefix == "" {
+			// xmlns="" só é emitido para desfazer um namespace padrão já renderizado
+			if uri == rendered[""] {
+				continue
+			}
+			declarations = append(declarations, Attr{Local: "xmlns", Value: uri})
+			scope[""] = uri
+			continue
+		}
+
+		if prefix == "xml" || uri == "" {
+			continue
+		}
+
+		if current, ok := rendered[prefix]; ok && current == uri {
+			continue
+		}
+
+		declarations = append(declarations, Attr{Prefix: "xmlns", Local: prefix, Value: uri})
+		scope[prefix] = uri
+	}
+
+	sort.Slice(declarations, func(i, j int) bool {
+		return declarations[i].Prefix+":"+declarations[i].Local < declarations[j].Prefix+":"+declarations[j].Local
+	})
+
+	type namespacedAttr struct {
+		Attr
+		namespace string
+	}
+
+	var attrs []namespacedAttr
+	for _, attr := range el.Attrs {
+		if isNamespaceDeclaration(attr) {
+			continue
+		}
+
+		namespace := ""
+		if attr.Prefix != "" {
+			namespace = el.LookupNamespace(attr.Prefix)
+		}
+		attrs = append(attrs, namespacedAttr{Attr: attr, namespace: namespace})
+	}
+
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].namespace != attrs[j].namespace {
+			return attrs[i].namespace < attrs[j].namespace
+		}
+		return attrs[i].Local < attrs[j].Local
+	})
+
+	name := qualifiedName(el.Prefix, el.Local)
+
+	b.WriteByte('<')
+	b.WriteString(name)
+
+	for _, declaration := range declarations {
+		b.WriteByte(' ')
+		b.WriteString(qualifiedName(declaration.Prefix, declaration.Local))
+		b.WriteString(`="`)
+		b.WriteString(escapeAttr(declaration.Value))
+		b.WriteByte('"')
+	}
+
+	for _, attr := range attrs {
+		b.WriteByte(' ')
+		b.WriteString(qualifiedName(attr.Prefix, attr.Local))
+		b.WriteString(`="`)
+		b.WriteString(escapeAttr(attr.Value))
+		b.WriteByte('"')
+	}
+
+	b.WriteByte('>')
+
+	for _, node := range el.Children {
+		switch n := node.(type) {
+		case *Element:
+			if n == excluded {
+				continue
+			}
+			writeCanonical(b, n, scope, inclusive, excluded)
+		case CharData:
+			b.WriteString(escapeText(string(n)))
+		}
+	}
+
+	b.WriteString("</")
+	b.WriteString(name)
+	b.WriteByte('>')
+}
@@ -0,0 +1,163 @@
+package saml
+
+import "testing"
+
+// Os resultados esperados dos documentos inteiros conferem com xmllint --exc-c14n
+func TestCanonicalizeDocument(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			"unused namespace is dropped",
+			`<a:root xmlns:a="urn:a" xmlns:b="urn:b"><a:child/></a:root>`,
+			`<a:root xmlns:a="urn:a"><a:child></a:child></a:root>`,
+		},
+		{
+			"namespaces and attributes are sorted",
+			`<r xmlns:z="urn:a" xmlns:y="urn:b" z:x="1" b="2" a="3" y:w="4"/>`,
+			`<r xmlns:y="urn:b" xmlns:z="urn:a" a="3" b="2" z:x="1" y:w="4"></r>`,
+		},
+		{
+			"default namespace",
+			`<root xmlns="urn:d"><child/></root>`,
+			`<root xmlns="urn:d"><child></child></root>`,
+		},
+		{
+			"default namespace undeclared",
+			`<root xmlns="urn:d"><child xmlns=""/></root>`,
+			`<root xmlns="urn:d"><child xmlns=""></child></root>`,
+		},
+		{
+			"superfluous empty default namespace",
+			`<root><child xmlns=""/></root>`,
+			`<root><child></child></root>`,
+		},
+		{
+			"redeclarations",
+			`<a:root xmlns:a="urn:a"><a:child xmlns:a="urn:a"/><a:other xmlns:a="urn:other"/></a:root>`,
+			`<a:root xmlns:a="urn:a"><a:child></a:child><a:other xmlns:a="urn:other"></a:other></a:root>`,
+		},
+		{
+			"namespace pushed down to where it is used",
+			`<root xmlns:b="urn:b"><child b:attr="1"/></root>`,
+			`<root><child xmlns:b="urn:b" b:attr="1"></child></root>`,
+		},
+		{
+			"escaping",
+			`<root attr="a&quot;&lt;&amp;&#9;&#10;b">x &lt; y &amp; z &gt; w "q" 's'</root>`,
+			`<root attr="a&quot;&lt;&amp;&#x9;&#xA;b">x &lt; y &amp; z &gt; w "q" 's'</root>`,
+		},
+		{
+			"whitespace inside tags is normalized, text is kept",
+			`<root   b = "2"   a="1"  >  <x/>  </root>`,
+			`<root a="1" b="2">  <x></x>  </root>`,
+		},
+		{
+			"xml prefix is never declared",
+			`<root xml:lang="en" xmlns:xml="http://www.w3.org/XML/1998/namespace"/>`,
+			`<root xml:lang="en"></root>`,
+		},
+		{
+			"CDATA becomes text",
+			`<root><![CDATA[<a> & b]]></root>`,
+			`<root>&lt;a&gt; &amp; b</root>`,
+		},
+		{
+			"comments are removed",
+			`<root><!-- comment --><a/></root>`,
+			`<root><a></a></root>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el, err := Parse([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			if got := string(canonicalize(el, nil, nil)); got != tt.want {
+				t.Errorf("canonicalize =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeSubtree(t *testing.T) {
+	const document = `<a:root xmlns:a="urn:a" xmlns:b="urn:b" xmlns="urn:d">` +
+		`<b:child attr="1"><a:leaf/></b:child>` +
+		`<a:sibling><plain/></a:sibling>` +
+		`</a:root>`
+
+	root, err := Parse([]byte(document))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	children := root.ChildElements()
+	child, sibling := children[0], children[1]
+
+	tests := []struct {
+		name      string
+		el        *Element
+		inclusive []string
+		excluded  *Element
+		want      string
+	}{
+		{
+			"ancestor namespaces are declared on the apex",
+			child, nil, nil,
+			`<b:child xmlns:b="urn:b" attr="1"><a:leaf xmlns:a="urn:a"></a:leaf></b:child>`,
+		},
+		{
+			"inherited default namespace",
+			sibling, nil, nil,
+			`<a:sibling xmlns:a="urn:a"><plain xmlns="urn:d"></plain></a:sibling>`,
+		},
+		{
+			"inclusive prefix",
+			child, []string{"a"}, nil,
+			`<b:child xmlns:a="urn:a" xmlns:b="urn:b" attr="1"><a:leaf></a:leaf></b:child>`,
+		},
+		{
+			"inclusive default namespace",
+			child, []string{"#default"}, nil,
+			`<b:child xmlns="urn:d" xmlns:b="urn:b" attr="1"><a:leaf xmlns:a="urn:a"></a:leaf></b:child>`,
+		},
+		{
+			"inclusive prefix that is not in scope",
+			child, []string{"zzz"}, nil,
+			`<b:child xmlns:b="urn:b" attr="1"><a:leaf xmlns:a="urn:a"></a:leaf></b:child>`,
+		},
+		{
+			"excluded element",
+			root, nil, child,
+			`<a:root xmlns:a="urn:a"><a:sibling><plain xmlns="urn:d"></plain></a:sibling></a:root>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(canonicalize(tt.el, tt.inclusive, tt.excluded)); got != tt.want {
+				t.Errorf("canonicalize =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejectsDirectives(t *testing.T) {
+	inputs := []string{
+		`<!DOCTYPE root [<!ENTITY e "x">]><root>&e;</root>`,
+		`<root>`,
+		`<root></other>`,
+		``,
+		`<a/><b/>`,
+	}
+
+	for _, input := range inputs {
+		if _, err := Parse([]byte(input)); err == nil {
+			t.Errorf("Parse(%q) succeeded", input)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+// Package saml implements the parts of SAML 2.0 whoami needs to act as an
+// identity provider and as a service provider: the protocol messages, the
+// HTTP-Redirect and HTTP-POST bindings, metadata and XML signatures.
+package saml
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const (
+	NamespaceAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	NamespaceProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	NamespaceMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	NamespaceDSig      = "http://www.w3.org/2000/09/xmldsig#"
+
+	BindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	BindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	NameIDFormatUnspecified  = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	NameIDFormatEmailAddress = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent   = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	NameIDFormatTransient    = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+
+	// Top-level status codes
+	StatusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	StatusRequester = "urn:oasis:names:tc:SAML:2.0:status:Requester"
+	StatusResponder = "urn:oasis:names:tc:SAML:2.0:status:Responder"
+
+	// Second-level status codes, nested under a top-level one
+	StatusAuthnFailed         = "urn:oasis:names:tc:SAML:2.0:status:AuthnFailed"
+	StatusInvalidNameIDPolicy = "urn:oasis:names:tc:SAML:2.0:status:InvalidNameIDPolicy"
+	StatusNoPassive           = "urn:oasis:names:tc:SAML:2.0:status:NoPassive"
+	StatusRequestDenied       = "urn:oasis:names:tc:SAML:2.0:status:RequestDenied"
+
+	AttributeNameFormatBasic = "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"
+
+	ConfirmationMethodBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	AuthnContextPasswordProtectedTransport = "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"
+)
+
+const timeFormat = "2006-01-02T15:04:05Z"
+
+// ClockSkew is the clock difference tolerated between whoami and its SAML peers
+const ClockSkew = 2 * time.Minute
+
+var ErrMalformedMessage = errors.New("saml: malformed message")
+
+// NewID returns a message identifier. IDs must not start with a digit (xs:ID).
+func NewID() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return "_" + hex.EncodeToString(b)
+}
+
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+func parseTime(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+func childText(el *Element, namespace, local string) string {
+	if child := el.Child(namespace, local); child != nil {
+		return child.Text()
+	}
+	return ""
+}
+
+func checkProtocolMessage(el *Element, local string) error {
+	if !el.Is(NamespaceProtocol, local) || el.Attr("Version") != "2.0" || el.Attr("ID") == "" {
+		return ErrMalformedMessage
+	}
+	return nil
+}
+
+type AuthnRequest struct {
+	ID                          string
+	Issuer                      string
+	Destination                 string
+	AssertionConsumerServiceURL string
+	ProtocolBinding             string
+	NameIDFormat                string
+	ForceAuthn                  bool
+	IsPassive                   bool
+	IssueInstant                time.Time
+}
+
+func ParseAuthnRequest(el *Element) (*AuthnRequest, error) {
+	if err := checkProtocolMessage(el, "AuthnRequest"); err != nil {
+		return nil, err
+	}
+
+	request := &AuthnRequest{
+		ID:                          el.Attr("ID"),
+		Issuer:                      childText(el, NamespaceAssertion, "Issuer"),
+		Destination:                 el.Attr("Destination"),
+		AssertionConsumerServiceURL: el.Attr("AssertionConsumerServiceURL"),
+		ProtocolBinding:             el.Attr("ProtocolBinding"),
+		ForceAuthn:                  el.Attr("ForceAuthn") == "true",
+		IsPassive:                   el.Attr("IsPassive") == "true",
+		IssueInstant:                parseTime(el.Attr("IssueInstant")),
+	}
+
+	if policy := el.Child(NamespaceProtocol, "NameIDPolicy"); policy != nil {
+		request.NameIDFormat = policy.Attr("Format")
+	}
+
+	if request.Issuer == "" {
+		return nil, ErrMalformedMessage
+	}
+
+	return request, nil
+}
+
+func (r *AuthnRequest) Element() *Element {
+	request := NewElement("samlp", "AuthnRequest").
+		SetAttr("xmlns:samlp", NamespaceProtocol).
+		SetAttr("xmlns:saml", NamespaceAssertion).
+		SetAttr("ID", r.ID).
+		SetAttr("Version", "2.0").
+		SetAttr("IssueInstant", FormatTime(r.IssueInstant)).
+		SetAttr("Destination", r.Destination).
+		SetAttr("AssertionConsumerServiceURL", r.AssertionConsumerServiceURL).
+		SetAttr("ProtocolBinding", r.ProtocolBinding)
+
+	if r.ForceAuthn {
+		request.SetAttr("ForceAuthn", "true")
+	}
+
+	request.AddChild(NewElement("saml", "Issuer").SetText(r.Issuer))
+
+	if r.NameIDFormat != "" {
+		request.AddChild(NewElement("samlp", "NameIDPolicy").
+			SetAttr("Format", r.NameIDFormat).
+			SetAttr("AllowCreate", "true"))
+	}
+
+	return request
+}
+
+type LogoutRequest struct {
+	ID             string
+	Issuer         string
+	Destination    string
+	NameID         string
+	NameIDFormat   string
+	SessionIndexes []string
+	IssueInstant   time.Time
+	NotOnOrAfter   time.Time
+}
+
+func ParseLogoutRequest(el *Element) (*LogoutRequest, error) {
+	if err := checkProtocolMessage(el, "LogoutRequest"); err != nil {
+		return nil, err
+	}
+
+	request := &LogoutRequest{
+		ID:           el.Attr("ID"),
+		Issuer:       childText(el, NamespaceAssertion, "Issuer"),
+		Destination:  el.Attr("Destination"),
+		IssueInstant: parseTime(el.Attr("IssueInstant")),
+		NotOnOrAfter: parseTime(el.Attr("NotOnOrAfter")),
+	}
+
+	nameID := el.Child(NamespaceAssertion, "NameID")
+	if request.Issuer == "" || nameID == nil {
+		return nil, ErrMalformedMessage
+	}
+
+	request.NameID = nameID.Text()
+	request.NameIDFormat = nameID.Attr("Format")
+
+	for _, index := range el.ChildrenNamed(NamespaceProtocol, "SessionIndex") {
+		request.SessionIndexes = append(request.SessionIndexes, index.Text())
+	}
+
+	return request, nil
+}
+
+type Attribute struct {
+	Name   string
+	Values []string
+}
+
+// Assertion holds what the identity provider states about an authenticated subject
+type Assertion struct {
+	ID           string
+	Issuer       string
+	Audience     string
+	Recipient    string
+	InResponseTo string
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	IssueInstant time.Time
+	NotBefore    time.Time
+	NotOnOrAfter time.Time
+	AuthnInstant time.Time
+	Attributes   []Attribute
+}
+
+func (a *Assertion) Element() *Element {
+	confirmationData := NewElement("saml", "SubjectConfirmationData").
+		SetAttr("NotOnOrAfter", FormatTime(a.NotOnOrAfter)).
+		SetAttr("Recipient", a.Recipient)
+	if a.InResponseTo != "" {
+		confirmationData.SetAttr("InResponseTo", a.InResponseTo)
+	}
+
+	assertion := NewElement("saml", "Assertion").
+		SetAttr("xmlns:saml", NamespaceAssertion).
+		SetAttr("ID", a.ID).
+		SetAttr("Version", "2.0").
+		SetAttr("IssueInstant", FormatTime(a.IssueInstant)).
+		AddChild(
+			NewElement("saml", "Issuer").SetText(a.Issuer),
+			NewElement("saml", "Subject").AddChild(
+				NewElement("saml", "NameID").SetAttr("Format", a.NameIDFormat).SetText(a.NameID),
+				NewElement("saml", "SubjectConfirmation").SetAttr("Method", ConfirmationMethodBearer).AddChild(confirmationData),
+			),
+			NewElement("saml", "Conditions").
+				SetAttr("NotBefore", FormatTime(a.NotBefore)).
+				SetAttr("NotOnOrAfter", FormatTime(a.NotOnOrAfter)).
+				AddChild(
+					NewElement("saml", "AudienceRestriction").AddChild(
+						NewElement("saml", "Audience").SetText(a.Audience),
+					),
+				),
+			NewElement("saml", "AuthnStatement").
+				SetAttr("AuthnInstant", FormatTime(a.AuthnInstant)).
+				SetAttr("SessionIndex", a.SessionIndex).
+				AddChild(
+					NewElement("saml", "AuthnContext").AddChild(
+						NewElement("saml", "AuthnContextClassRef").SetText(AuthnContextPasswordProtectedTransport),
+					),
+				),
+		)
+
+	if len(a.Attributes) > 0 {
+		statement := NewElement("saml", "AttributeStatement")
+		for _, attribute := range a.Attributes {
+			el := NewElement("saml", "Attribute").
+				SetAttr("Name", attribute.Name).
+				SetAttr("NameFormat", AttributeNameFormatBasic)
+			for _, value := range attribute.Values {
+				el.AddChild(NewElement("saml", "AttributeValue").SetText(value))
+			}
+			statement.AddChild(el)
+		}
+		assertion.AddChild(statement)
+	}
+
+	return assertion
+}
+
+type Response struct {
+	ID            string
+	InResponseTo  string
+	Destination   string
+	Issuer        string
+	IssueInstant  time.Time
+	StatusCode    string
+	SubStatusCode string
+	StatusMessage string
+	// Assertion is the (usually signed) assertion element, nil on failures
+	Assertion *Element
+}
+
+func (r *Response) Element() *Element {
+	response := newStatusResponse("Response", r.ID, r.InResponseTo, r.Destination, r.Issuer, r.IssueInstant, r.StatusCode, r.SubStatusCode, r.StatusMessage)
+	if r.Assertion != nil {
+		response.AddChild(r.Assertion)
+	}
+	return response
+}
+
+type LogoutResponse struct {
+	ID           string
+	InResponseTo string
+	Destination  string
+	Issuer       string
+	IssueInstant time.Time
+	StatusCode   string
+}
+
+func (r *LogoutResponse) Element() *Element {
+	return newStatusResponse("LogoutResponse", r.ID, r.InResponseTo, r.Destination, r.Issuer, r.IssueInstant, r.StatusCode, "", "")
+}
+
+func newStatusResponse(local, id, inResponseTo, destination, issuer string, issueInstant time.Time, statusCode, subStatusCode, statusMessage string) *Element {
+	el := NewElement("samlp", local).
+		SetAttr("xmlns:samlp", NamespaceProtocol).
+		SetAttr("xmlns:saml", NamespaceAssertion).
+		SetAttr("ID", id).
+		SetAttr("Version", "2.0").
+		SetAttr("IssueInstant", FormatTime(issueInstant))
+
+	if destination != "" {
+		el.SetAttr("Destination", destination)
+	}
+	if inResponseTo != "" {
+		el.SetAttr("InResponseTo", inResponseTo)
+	}
+
+	code := NewElement("samlp", "StatusCode").SetAttr("Value", statusCode)
+	if subStatusCode != "" {
+		code.AddChild(NewElement("samlp", "StatusCode").SetAttr("Value", subStatusCode))
+	}
+
+	status := NewElement("samlp", "Status").AddChild(code)
+	if statusMessage != "" {
+		status.AddChild(NewElement("samlp", "StatusMessage").SetText(statusMessage))
+	}
+
+	return el.AddChild(
+		NewElement("saml", "Issuer").SetText(issuer),
+		status,
+	)
+}
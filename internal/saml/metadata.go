@@ -0,0 +1,263 @@
+package saml
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type EntityDescriptor struct {
+	XMLName          xml.Name       `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID         string         `xml:"entityID,attr"`
+	SPSSODescriptor  *SSODescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata SPSSODescriptor"`
+	IDPSSODescriptor *SSODescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata IDPSSODescriptor"`
+}
+
+type entitiesDescriptor struct {
+	EntityDescriptors []EntityDescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+}
+
+// SSODescriptor covers both SPSSODescriptor and IDPSSODescriptor, each side
+// only fills in the elements that apply to it
+type SSODescriptor struct {
+	AuthnRequestsSigned       bool            `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned      bool            `xml:"WantAssertionsSigned,attr"`
+	WantAuthnRequestsSigned   bool            `xml:"WantAuthnRequestsSigned,attr"`
+	KeyDescriptors            []KeyDescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+	NameIDFormats             []string        `xml:"urn:oasis:names:tc:SAML:2.0:metadata NameIDFormat"`
+	SingleLogoutServices      []Endpoint      `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleLogoutService"`
+	AssertionConsumerServices []Endpoint      `xml:"urn:oasis:names:tc:SAML:2.0:metadata AssertionConsumerService"`
+	SingleSignOnServices      []Endpoint      `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
+}
+
+type KeyDescriptor struct {
+	Use     string  `xml:"use,attr"`
+	KeyInfo keyInfo `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo"`
+}
+
+type keyInfo struct {
+	X509Data struct {
+		X509Certificates []string `xml:"http://www.w3.org/2000/09/xmldsig# X509Certificate"`
+	} `xml:"http://www.w3.org/2000/09/xmldsig# X509Data"`
+}
+
+type Endpoint struct {
+	Binding          string `xml:"Binding,attr"`
+	Location         string `xml:"Location,attr"`
+	ResponseLocation string `xml:"ResponseLocation,attr"`
+	IsDefault        bool   `xml:"isDefault,attr"`
+}
+
+// ParseMetadata reads an EntityDescriptor, or an EntitiesDescriptor that
+// describes exactly one entity
+func ParseMetadata(data []byte) (*EntityDescriptor, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, ErrMalformedMessage
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if start.Name.Space != NamespaceMetadata {
+			return nil, ErrMalformedMessage
+		}
+
+		switch start.Name.Local {
+		case "EntityDescriptor":
+			var descriptor EntityDescriptor
+			if err := decoder.DecodeElement(&descriptor, &start); err != nil {
+				return nil, err
+			}
+			return &descriptor, nil
+		case "EntitiesDescriptor":
+			var entities entitiesDescriptor
+			if err := decoder.DecodeElement(&entities, &start); err != nil {
+				return nil, err
+			}
+			if len(entities.EntityDescriptors) != 1 {
+				return nil, fmt.Errorf("saml: metadata describes %d entities, expected one", len(entities.EntityDescriptors))
+			}
+			return &entities.EntityDescriptors[0], nil
+		default:
+			return nil, ErrMalformedMessage
+		}
+	}
+}
+
+// SigningCertificates returns the certificates usable to verify signatures
+func (d *SSODescriptor) SigningCertificates() ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	for _, descriptor := range d.KeyDescriptors {
+		if descriptor.Use != "" && descriptor.Use != "signing" {
+			continue
+		}
+
+		for _, encoded := range descriptor.KeyInfo.X509Data.X509Certificates {
+			cert, err := ParseCertificate(encoded)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+	}
+
+	return certs, nil
+}
+
+// FindEndpoint picks the endpoint for the first supported binding, preferring the default one
+func FindEndpoint(endpoints []Endpoint, bindings ...string) *Endpoint {
+	for _, binding := range bindings {
+		var found *Endpoint
+		for i := range endpoints {
+			if endpoints[i].Binding != binding {
+				continue
+			}
+			if found == nil || endpoints[i].IsDefault {
+				found = &endpoints[i]
+			}
+		}
+
+		if found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// ParseCertificate accepts a PEM block or the bare base64 DER used inside metadata
+func ParseCertificate(encoded string) (*x509.Certificate, error) {
+	if block, _ := pem.Decode([]byte(encoded)); block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(removeWhitespace(encoded))
+	if err != nil {
+		return nil, errors.New("saml: invalid certificate encoding")
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+// ParseCertificates reads one or more concatenated PEM certificates, or a
+// single bare base64 one. Several certificates allow signing key rollover.
+func ParseCertificates(encoded string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	rest := []byte(encoded)
+	for {
+		block, remaining := pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, cert)
+		rest = remaining
+	}
+
+	if len(certs) > 0 {
+		return certs, nil
+	}
+
+	cert, err := ParseCertificate(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*x509.Certificate{cert}, nil
+}
+
+// IdPMetadata describes whoami as an identity provider
+type IdPMetadata struct {
+	EntityID      string
+	Certificate   *x509.Certificate
+	SSOURL        string
+	SLOURL        string
+	NameIDFormats []string
+}
+
+func (m *IdPMetadata) Element() *Element {
+	descriptor := NewElement("md", "IDPSSODescriptor").
+		SetAttr("WantAuthnRequestsSigned", "false").
+		SetAttr("protocolSupportEnumeration", NamespaceProtocol).
+		AddChild(
+			NewElement("md", "KeyDescriptor").SetAttr("use", "signing").AddChild(
+				NewElement("ds", "KeyInfo").SetAttr("xmlns:ds", NamespaceDSig).AddChild(
+					NewElement("ds", "X509Data").AddChild(
+						NewElement("ds", "X509Certificate").SetText(base64.StdEncoding.EncodeToString(m.Certificate.Raw)),
+					),
+				),
+			),
+		)
+
+	for _, binding := range []string{BindingHTTPRedirect, BindingHTTPPost} {
+		descriptor.AddChild(NewElement("md", "SingleLogoutService").SetAttr("Binding", binding).SetAttr("Location", m.SLOURL))
+	}
+
+	for _, format := range m.NameIDFormats {
+		descriptor.AddChild(NewElement("md", "NameIDFormat").SetText(format))
+	}
+
+	for _, binding := range []string{BindingHTTPRedirect, BindingHTTPPost} {
+		descriptor.AddChild(NewElement("md", "SingleSignOnService").SetAttr("Binding", binding).SetAttr("Location", m.SSOURL))
+	}
+
+	return NewElement("md", "EntityDescriptor").
+		SetAttr("xmlns:md", NamespaceMetadata).
+		SetAttr("entityID", m.EntityID).
+		AddChild(descriptor)
+}
+
+// SPMetadata describes whoami as a service provider of partner identity providers
+type SPMetadata struct {
+	EntityID            string
+	Certificate         *x509.Certificate
+	ACSURL              string
+	AuthnRequestsSigned bool
+}
+
+func (m *SPMetadata) Element() *Element {
+	return NewElement("md", "EntityDescriptor").
+		SetAttr("xmlns:md", NamespaceMetadata).
+		SetAttr("entityID", m.EntityID).
+		AddChild(
+			NewElement("md", "SPSSODescriptor").
+				SetAttr("AuthnRequestsSigned", fmt.Sprint(m.AuthnRequestsSigned)).
+				SetAttr("WantAssertionsSigned", "true").
+				SetAttr("protocolSupportEnumeration", NamespaceProtocol).
+				AddChild(
+					NewElement("md", "KeyDescriptor").SetAttr("use", "signing").AddChild(
+						NewElement("ds", "KeyInfo").SetAttr("xmlns:ds", NamespaceDSig).AddChild(
+							NewElement("ds", "X509Data").AddChild(
+								NewElement("ds", "X509Certificate").SetText(base64.StdEncoding.EncodeToString(m.Certificate.Raw)),
+							),
+						),
+					),
+					NewElement("md", "AssertionConsumerService").
+						SetAttr("Binding", BindingHTTPPost).
+						SetAttr("Location", m.ACSURL).
+						SetAttr("index", "0").
+						SetAttr("isDefault", "true"),
+				),
+		)
+}
@@ -0,0 +1,225 @@
+package saml
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AssertionInfo is what a validated assertion states about the subject
+type AssertionInfo struct {
+	ID           string
+	Issuer       string
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	// NotOnOrAfter is when the assertion stops being usable, which bounds how long replay protection must remember it
+	NotOnOrAfter time.Time
+	Attributes   map[string][]string
+}
+
+// ResponseValidation holds what a Response must match to be accepted
+type ResponseValidation struct {
+	Certificates []*x509.Certificate
+	IdPEntityID  string
+	SPEntityID   string
+	ACSURL       string
+	RequestID    string
+	Now          time.Time
+}
+
+// PeekResponse reads the issuer and the InResponseTo of a Response before it
+// is validated, so the caller can find the provider and request to check it
+// against. Nothing returned here is trusted.
+func PeekResponse(el *Element) (issuer, inResponseTo string) {
+	issuer = childText(el, NamespaceAssertion, "Issuer")
+	if issuer == "" {
+		if assertion := el.Child(NamespaceAssertion, "Assertion"); assertion != nil {
+			issuer = childText(assertion, NamespaceAssertion, "Issuer")
+		}
+	}
+
+	return issuer, el.Attr("InResponseTo")
+}
+
+func invalidResponse(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrMalformedMessage, fmt.Sprintf(format, args...))
+}
+
+// ValidateResponse checks a Response to an AuthnRequest following the web
+// browser SSO profile: signatures, issuer, destination, audience, validity
+// window and bearer subject confirmation. Either the Response or its single
+// Assertion must be signed, and only data from the verified tree is used.
+func ValidateResponse(el *Element, v *ResponseValidation) (*AssertionInfo, error) {
+	if err := checkProtocolMessage(el, "Response"); err != nil {
+		return nil, err
+	}
+
+	if destination := el.Attr("Destination"); destination != "" && destination != v.ACSURL {
+		return nil, invalidResponse("wrong destination %s", destination)
+	}
+
+	if el.Attr("InResponseTo") != v.RequestID {
+		return nil, invalidResponse("response does not answer the pending request")
+	}
+
+	if issuer := childText(el, NamespaceAssertion, "Issuer"); issuer != "" && issuer != v.IdPEntityID {
+		return nil, invalidResponse("unexpected issuer %s", issuer)
+	}
+
+	if status := el.Child(NamespaceProtocol, "Status"); status != nil {
+		code := status.Child(NamespaceProtocol, "StatusCode")
+		if code == nil || code.Attr("Value") != StatusSuccess {
+			detail := ""
+			if code != nil {
+				detail = code.Attr("Value")
+				if sub := code.Child(NamespaceProtocol, "StatusCode"); sub != nil {
+					detail += " " + sub.Attr("Value")
+				}
+			}
+			return nil, fmt.Errorf("saml: identity provider returned status %s", detail)
+		}
+	} else {
+		return nil, invalidResponse("response has no status")
+	}
+
+	responseSigned := false
+	switch err := Verify(el, v.Certificates); {
+	case err == nil:
+		responseSigned = true
+	case !errors.Is(err, ErrMissingSignature):
+		return nil, err
+	}
+
+	if el.Child(NamespaceAssertion, "EncryptedAssertion") != nil {
+		return nil, errors.New("saml: encrypted assertions are not supported")
+	}
+
+	assertions := el.ChildrenNamed(NamespaceAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, invalidResponse("expected exactly one assertion, got %d", len(assertions))
+	}
+	assertion := assertions[0]
+
+	switch err := Verify(assertion, v.Certificates); {
+	case errors.Is(err, ErrMissingSignature):
+		if !responseSigned {
+			return nil, ErrMissingSignature
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	if assertion.Attr("Version") != "2.0" || assertion.Attr("ID") == "" {
+		return nil, ErrMalformedMessage
+	}
+
+	info := &AssertionInfo{
+		ID:         assertion.Attr("ID"),
+		Issuer:     childText(assertion, NamespaceAssertion, "Issuer"),
+		Attributes: map[string][]string{},
+	}
+
+	if info.Issuer != v.IdPEntityID {
+		return nil, invalidResponse("unexpected assertion issuer %s", info.Issuer)
+	}
+
+	if err := checkConditions(assertion, v); err != nil {
+		return nil, err
+	}
+
+	subject := assertion.Child(NamespaceAssertion, "Subject")
+	if subject == nil {
+		return nil, invalidResponse("assertion has no subject")
+	}
+
+	nameID := subject.Child(NamespaceAssertion, "NameID")
+	if nameID == nil || nameID.Text() == "" {
+		return nil, invalidResponse("assertion has no NameID")
+	}
+	info.NameID = nameID.Text()
+	info.NameIDFormat = nameID.Attr("Format")
+
+	notOnOrAfter, err := checkBearerConfirmation(subject, v)
+	if err != nil {
+		return nil, err
+	}
+	info.NotOnOrAfter = notOnOrAfter
+
+	if statement := assertion.Child(NamespaceAssertion, "AuthnStatement"); statement != nil {
+		info.SessionIndex = statement.Attr("SessionIndex")
+	}
+
+	for _, statement := range assertion.ChildrenNamed(NamespaceAssertion, "AttributeStatement") {
+		for _, attribute := range statement.ChildrenNamed(NamespaceAssertion, "Attribute") {
+			name := attribute.Attr("Name")
+			for _, value := range attribute.ChildrenNamed(NamespaceAssertion, "AttributeValue") {
+				info.Attributes[name] = append(info.Attributes[name], value.Text())
+			}
+		}
+	}
+
+	return info, nil
+}
+
+func checkConditions(assertion *Element, v *ResponseValidation) error {
+	conditions := assertion.Child(NamespaceAssertion, "Conditions")
+	if conditions == nil {
+		return invalidResponse("assertion has no conditions")
+	}
+
+	if notBefore := parseTime(conditions.Attr("NotBefore")); !notBefore.IsZero() && v.Now.Add(ClockSkew).Before(notBefore) {
+		return invalidResponse("assertion is not yet valid")
+	}
+
+	if notOnOrAfter := parseTime(conditions.Attr("NotOnOrAfter")); !notOnOrAfter.IsZero() && !v.Now.Add(-ClockSkew).Before(notOnOrAfter) {
+		return invalidResponse("assertion has expired")
+	}
+
+	// Cada AudienceRestriction precisa incluir este SP, e ao menos uma é exigida
+	restrictions := conditions.ChildrenNamed(NamespaceAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return invalidResponse("assertion has no audience restriction")
+	}
+
+	for _, restriction := range restrictions {
+		allowed := false
+		for _, audience := range restriction.ChildrenNamed(NamespaceAssertion, "Audience") {
+			allowed = allowed || audience.Text() == v.SPEntityID
+		}
+		if !allowed {
+			return invalidResponse("assertion is not addressed to this service provider")
+		}
+	}
+
+	return nil
+}
+
+// checkBearerConfirmation requires one valid bearer confirmation and returns its expiry
+func checkBearerConfirmation(subject *Element, v *ResponseValidation) (time.Time, error) {
+	for _, confirmation := range subject.ChildrenNamed(NamespaceAssertion, "SubjectConfirmation") {
+		if confirmation.Attr("Method") != ConfirmationMethodBearer {
+			continue
+		}
+
+		data := confirmation.Child(NamespaceAssertion, "SubjectConfirmationData")
+		if data == nil {
+			continue
+		}
+
+		notOnOrAfter := parseTime(data.Attr("NotOnOrAfter"))
+
+		if data.Attr("Recipient") != v.ACSURL ||
+			notOnOrAfter.IsZero() ||
+			!v.Now.Add(-ClockSkew).Before(notOnOrAfter) ||
+			data.Attr("NotBefore") != "" ||
+			(data.Attr("InResponseTo") != "" && data.Attr("InResponseTo") != v.RequestID) {
+			continue
+		}
+
+		return notOnOrAfter, nil
+	}
+
+	return time.Time{}, invalidResponse("assertion has no valid bearer subject confirmation")
+}
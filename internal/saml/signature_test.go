@@ -0,0 +1,246 @@
+package saml
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "whoami test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+
+	return key, cert
+}
+
+const testAssertion = `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_a1" Version="2.0" IssueInstant="2024-01-01T00:00:00Z">` +
+	`<saml:Issuer>https://idp.example.com</saml:Issuer>` +
+	`<saml:Subject><saml:NameID>alice</saml:NameID></saml:Subject>` +
+	`</saml:Assertion>`
+
+// signedTestAssertion signs the assertion and returns it serialized, as a peer would send it
+func signedTestAssertion(t *testing.T, key *rsa.PrivateKey, cert *x509.Certificate) string {
+	t.Helper()
+
+	el, err := Parse([]byte(testAssertion))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if err := Sign(el, key, cert); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	return string(el.Bytes())
+}
+
+func TestSignPlacesSignatureAfterIssuer(t *testing.T) {
+	key, cert := newTestCertificate(t)
+
+	el, err := Parse([]byte(signedTestAssertion(t, key, cert)))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	children := el.ChildElements()
+	if len(children) != 3 || !children[0].Is(NamespaceAssertion, "Issuer") || !children[1].Is(NamespaceDSig, "Signature") {
+		t.Errorf("unexpected layout: %s", el.Bytes())
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	_, otherCert := newTestCertificate(t)
+	signed := signedTestAssertion(t, key, cert)
+
+	tests := []struct {
+		name    string
+		modify  func(string) string
+		certs   []*x509.Certificate
+		wantErr error
+	}{
+		{"valid", nil, []*x509.Certificate{cert}, nil},
+		{"valid among several certificates", nil, []*x509.Certificate{otherCert, cert}, nil},
+		{
+			"equivalent serialization",
+			func(s string) string {
+				// Declarações extras e aspas simples não mudam a forma canônica
+				s = strings.Replace(s, `<saml:Assertion `, `<saml:Assertion xmlns:unused="urn:unused" `, 1)
+				return strings.Replace(s, `Version="2.0"`, `Version='2.0'`, 1)
+			},
+			[]*x509.Certificate{cert}, nil,
+		},
+		{"untrusted certificate", nil, []*x509.Certificate{otherCert}, ErrInvalidSignature},
+		{"no certificates", nil, nil, ErrInvalidSignature},
+		{
+			"modified content",
+			func(s string) string { return strings.Replace(s, ">alice<", ">admin<", 1) },
+			[]*x509.Certificate{cert}, ErrInvalidSignature,
+		},
+		{
+			"modified attribute",
+			func(s string) string {
+				return strings.Replace(s, `IssueInstant="2024-01-01T00:00:00Z"`, `IssueInstant="2030-01-01T00:00:00Z"`, 1)
+			},
+			[]*x509.Certificate{cert}, ErrInvalidSignature,
+		},
+		{
+			"reference to another element",
+			func(s string) string { return strings.Replace(s, `ID="_a1"`, `ID="_a2"`, 1) },
+			[]*x509.Certificate{cert}, ErrInvalidSignature,
+		},
+		{
+			"SHA-1 digest",
+			func(s string) string {
+				return strings.Replace(s, AlgorithmSHA256, "http://www.w3.org/2000/09/xmldsig#sha1", 1)
+			},
+			[]*x509.Certificate{cert}, ErrInvalidSignature,
+		},
+		{
+			"RSA-SHA1 signature",
+			func(s string) string {
+				return strings.Replace(s, AlgorithmRSASHA256, "http://www.w3.org/2000/09/xmldsig#rsa-sha1", 1)
+			},
+			[]*x509.Certificate{cert}, ErrInvalidSignature,
+		},
+		{
+			"unknown transform",
+			func(s string) string {
+				return strings.Replace(s, AlgorithmEnvelopedSignature, "http://www.w3.org/TR/1999/REC-xpath-19991116", 1)
+			},
+			[]*x509.Certificate{cert}, ErrInvalidSignature,
+		},
+		{
+			"second reference",
+			func(s string) string {
+				return strings.Replace(s, `</ds:SignedInfo>`, `<ds:Reference URI="#_a1"></ds:Reference></ds:SignedInfo>`, 1)
+			},
+			[]*x509.Certificate{cert}, ErrInvalidSignature,
+		},
+		{
+			"signature value altered",
+			func(s string) string {
+				start := strings.Index(s, "<ds:SignatureValue>") + len("<ds:SignatureValue>")
+				flipped := "A"
+				if s[start] == 'A' {
+					flipped = "B"
+				}
+				return s[:start] + flipped + s[start+1:]
+			},
+			[]*x509.Certificate{cert}, ErrInvalidSignature,
+		},
+		{
+			"signature removed",
+			func(s string) string {
+				start := strings.Index(s, "<ds:Signature ")
+				end := strings.Index(s, "</ds:Signature>") + len("</ds:Signature>")
+				return s[:start] + s[end:]
+			},
+			[]*x509.Certificate{cert}, ErrMissingSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document := signed
+			if tt.modify != nil {
+				document = tt.modify(document)
+			}
+
+			el, err := Parse([]byte(document))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			if err := Verify(el, tt.certs); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Uma assinatura válida movida para dentro de outro elemento não o autentica
+func TestVerifySignatureWrapping(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	signed := signedTestAssertion(t, key, cert)
+
+	wrapped := `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_evil" Version="2.0">` +
+		`<saml:Issuer>https://idp.example.com</saml:Issuer>` +
+		`<saml:Subject><saml:NameID>admin</saml:NameID></saml:Subject>` +
+		`<saml:Advice>` + signed + `</saml:Advice>` +
+		`</saml:Assertion>`
+
+	el, err := Parse([]byte(wrapped))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if err := Verify(el, []*x509.Certificate{cert}); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("Verify = %v, want ErrMissingSignature", err)
+	}
+}
+
+func TestVerifyQuery(t *testing.T) {
+	key, cert := newTestCertificate(t)
+	_, otherCert := newTestCertificate(t)
+
+	query := "SAMLRequest=" + url.QueryEscape("fZBBa8MwDIX/ivG9seOtbBMJLWyXQXdpyy67Ca/p/Q==") + "&RelayState=" + url.QueryEscape("/app?x=1")
+
+	signed, err := SignQuery(query, key)
+	if err != nil {
+		t.Fatalf("SignQuery: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		certs   []*x509.Certificate
+		wantErr error
+	}{
+		{"valid", signed, []*x509.Certificate{cert}, nil},
+		{"untrusted certificate", signed, []*x509.Certificate{otherCert}, ErrInvalidSignature},
+		{"modified relay state", strings.Replace(signed, "RelayState=", "RelayState=evil", 1), []*x509.Certificate{cert}, ErrInvalidSignature},
+		{"unsigned", query, []*x509.Certificate{cert}, ErrMissingSignature},
+		{
+			"RSA-SHA1",
+			strings.Replace(signed, url.QueryEscape(AlgorithmRSASHA256), url.QueryEscape("http://www.w3.org/2000/09/xmldsig#rsa-sha1"), 1),
+			[]*x509.Certificate{cert}, ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyQuery(tt.query, "SAMLRequest", tt.certs); !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifyQuery = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Element is a minimal XML DOM node. Unlike encoding/xml's struct decoding it
+// keeps namespace prefixes and declarations, which canonicalization needs.
+type Element struct {
+	Prefix   string
+	Local    string
+	Attrs    []Attr
+	Children []Node
+	Parent   *Element
+}
+
+type Attr struct {
+	Prefix string
+	Local  string
+	Value  string
+}
+
+// Node is either an *Element or a CharData
+type Node interface{}
+
+type CharData string
+
+func NewElement(prefix, local string) *Element {
+	return &Element{Prefix: prefix, Local: local}
+}
+
+func (e *Element) SetAttr(name, value string) *Element {
+	prefix, local := splitName(name)
+
+	for i, attr := range e.Attrs {
+		if attr.Prefix == prefix && attr.Local == local {
+			e.Attrs[i].Value = value
+			return e
+		}
+	}
+
+	e.Attrs = append(e.Attrs, Attr{Prefix: prefix, Local: local, Value: value})
+	return e
+}
+
+// Attr returns the value of an unqualified attribute
+func (e *Element) Attr(local string) string {
+	for _, attr := range e.Attrs {
+		if attr.Prefix == "" && attr.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func (e *Element) AddChild(children ...*Element) *Element {
+	for _, child := range children {
+		child.Parent = e
+		e.Children = append(e.Children, child)
+	}
+	return e
+}
+
+// InsertChild places the child at the given position among the node's children
+func (e *Element) InsertChild(index int, child *Element) {
+	child.Parent = e
+	e.Children = append(e.Children, nil)
+	copy(e.Children[index+1:], e.Children[index:])
+	e.Children[index] = child
+}
+
+func (e *Element) RemoveChild(child *Element) {
+	for i, node := range e.Children {
+		if node == child {
+			e.Children = append(e.Children[:i], e.Children[i+1:]...)
+			child.Parent = nil
+			return
+		}
+	}
+}
+
+func (e *Element) SetText(text string) *Element {
+	e.Children = []Node{CharData(text)}
+	return e
+}
+
+func (e *Element) Text() string {
+	var b strings.Builder
+	for _, node := range e.Children {
+		if text, ok := node.(CharData); ok {
+			b.WriteString(string(text))
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// ChildElements returns the element children, skipping text
+func (e *Element) ChildElements() []*Element {
+	var elements []*Element
+	for _, node := range e.Children {
+		if child, ok := node.(*Element); ok {
+			elements = append(elements, child)
+		}
+	}
+	return elements
+}
+
+// Namespace resolves the element's own namespace URI
+func (e *Element) Namespace() string {
+	return e.LookupNamespace(e.Prefix)
+}
+
+// LookupNamespace resolves a prefix in the scope of this element
+func (e *Element) LookupNamespace(prefix string) string {
+	for el := e; el != nil; el = el.Parent {
+		for _, attr := range el.Attrs {
+			if prefix == "" && attr.Prefix == "" && attr.Local == "xmlns" {
+				return attr.Value
+			}
+			if prefix != "" && attr.Prefix == "xmlns" && attr.Local == prefix {
+				return attr.Value
+			}
+		}
+	}
+
+	if prefix == "xml" {
+		return "http://www.w3.org/XML/1998/namespace"
+	}
+
+	return ""
+}
+
+// Is reports whether the element has the given namespace and local name
+func (e *Element) Is(namespace, local string) bool {
+	return e.Local == local && e.Namespace() == namespace
+}
+
+// Child returns the first child element with the namespace and local name
+func (e *Element) Child(namespace, local string) *Element {
+	for _, child := range e.ChildElements() {
+		if child.Is(namespace, local) {
+			return child
+		}
+	}
+	return nil
+}
+
+// ChildrenNamed returns all child elements with the namespace and local name
+func (e *Element) ChildrenNamed(namespace, local string) []*Element {
+	var found []*Element
+	for _, child := range e.ChildElements() {
+		if child.Is(namespace, local) {
+			found = append(found, child)
+		}
+	}
+	return found
+}
+
+// FindByID searches the subtree for the element whose ID attribute matches
+func (e *Element) FindByID(id string) *Element {
+	if e.Attr("ID") == id {
+		return e
+	}
+
+	for _, child := range e.ChildElements() {
+		if found := child.FindByID(id); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+func splitName(name string) (string, string) {
+	if prefix, local, found := strings.Cut(name, ":"); found {
+		return prefix, local
+	}
+	return "", name
+}
+
+// Parse reads an XML document into a DOM, rejecting DTDs to rule out entity expansion attacks
+func Parse(data []byte) (*Element, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+
+	var root *Element
+	var current *Element
+
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			el := &Element{Prefix: t.Name.Space, Local: t.Name.Local}
+			for _, attr := range t.Attr {
+				el.Attrs = append(el.Attrs, Attr{Prefix: attr.Name.Space, Local: attr.Name.Local, Value: attr.Value})
+			}
+
+			if current == nil {
+				if root != nil {
+					return nil, errors.New("saml: multiple root elements")
+				}
+				root = el
+			} else {
+				current.AddChild(el)
+			}
+			current = el
+		case xml.EndElement:
+			// RawToken não confere o fechamento das tags
+			if current == nil || t.Name.Space != current.Prefix || t.Name.Local != current.Local {
+				return nil, errors.New("saml: unbalanced XML")
+			}
+			current = current.Parent
+		case xml.CharData:
+			if current != nil {
+				current.Children = append(current.Children, CharData(string(t)))
+			}
+		case xml.Directive:
+			return nil, errors.New("saml: XML directives are not allowed")
+		}
+	}
+
+	if root == nil || current != nil {
+		return nil, errors.New("saml: empty or truncated XML document")
+	}
+
+	return root, nil
+}
+
+// Bytes serializes the subtree as written, with no canonicalization
+func (e *Element) Bytes() []byte {
+	var b bytes.Buffer
+	e.write(&b)
+	return b.Bytes()
+}
+
+func (e *Element) write(b *bytes.Buffer) {
+	b.WriteByte('<')
+	b.WriteString(qualifiedName(e.Prefix, e.Local))
+
+	for _, attr := range e.Attrs {
+		b.WriteByte(' ')
+		b.WriteString(qualifiedName(attr.Prefix, attr.Local))
+		b.WriteString(`="`)
+		b.WriteString(escapeAttr(attr.Value))
+		b.WriteByte('"')
+	}
+
+	if len(e.Children) == 0 {
+		b.WriteString("/>")
+		return
+	}
+
+	b.WriteByte('>')
+	for _, node := range e.Children {
+		switch n := node.(type) {
+		case *Element:
+			n.write(b)
+		case CharData:
+			b.WriteString(escapeText(string(n)))
+		}
+	}
+	b.WriteString("</")
+	b.WriteString(qualifiedName(e.Prefix, e.Local))
+	b.WriteByte('>')
+}
+
+func qualifiedName(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+func escapeText(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	s = strings.ReplaceAll(s, ">", "&gt;")
+	return strings.ReplaceAll(s, "\r", "&#xD;")
+}
+
+func escapeAttr(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	s = strings.ReplaceAll(s, `"`, "&quot;")
+	s = strings.ReplaceAll(s, "\t", "&#x9;")
+	s = strings.ReplaceAll(s, "\n", "&#xA;")
+	return strings.ReplaceAll(s, "\r", "&#xD;")
+}
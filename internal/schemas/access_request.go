@@ -0,0 +1,117 @@
+package schemas
+
+import (
+	"github.com/duvrdx/whoami/internal/models"
+)
+
+// Approval policy schemas
+type RBACApprovalPolicyUpdate struct {
+	Approvers      []string `json:"approvers"`
+	ApproverGroups []string `json:"approver_groups"`
+	// RequiredApprovals distinct approvers must approve a request; defaults to 1
+	RequiredApprovals int `json:"required_approvals"`
+	MaxDuration       int `json:"max_duration"` // Segundos; 0 usa access_request.max_duration
+}
+
+type RBACApprovalPolicyResponse struct {
+	Role              string   `json:"role"`
+	Approvers         []string `json:"approvers"`
+	ApproverGroups    []string `json:"approver_groups"`
+	RequiredApprovals int      `json:"required_approvals"`
+	MaxDuration       int      `json:"max_duration"`
+	CreatedAt         string   `json:"created_at"`
+	UpdatedAt         string   `json:"updated_at"`
+}
+
+func RBACApprovalPolicyResponseFromModel(policy *models.RBACApprovalPolicy) *RBACApprovalPolicyResponse {
+	return &RBACApprovalPolicyResponse{
+		Role:              policy.Role.Identifier,
+		Approvers:         splitList(policy.Approvers),
+		ApproverGroups:    splitList(policy.ApproverGroups),
+		RequiredApprovals: policy.RequiredApprovals,
+		MaxDuration:       policy.MaxDuration,
+		CreatedAt:         policy.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:         policy.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// Access request schemas
+type RBACAccessRequestCreate struct {
+	Role          string `json:"role"`
+	Justification string `json:"justification"`
+	Duration      int    `json:"duration"` // Segundos de acesso
+}
+
+type RBACAccessRequestDecision struct {
+	Comment string `json:"comment"`
+}
+
+type RBACAccessRequestFilter struct {
+	Status    string `query:"status"`
+	Role      string `query:"role"`
+	Requester string `query:"requester"`
+}
+
+type RBACAccessRequestEventResponse struct {
+	Action    string `json:"action"`
+	Actor     string `json:"actor"`
+	Comment   string `json:"comment,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type RBACAccessRequestResponse struct {
+	ID                uint                             `json:"id"`
+	Role              string                           `json:"role"`
+	Requester         string                           `json:"requester"`
+	Justification     string                           `json:"justification"`
+	Duration          int                              `json:"duration"`
+	Status            string                           `json:"status"`
+	RequiredApprovals int                              `json:"required_approvals"`
+	Approvals         []string                         `json:"approvals"`
+	ExpiresAt         string                           `json:"expires_at"`
+	DecidedAt         string                           `json:"decided_at,omitempty"`
+	GrantExpiresAt    string                           `json:"grant_expires_at,omitempty"`
+	History           []RBACAccessRequestEventResponse `json:"history"`
+	CreatedAt         string                           `json:"created_at"`
+}
+
+// RBACAccessRequestResponseFromModel describes the request along with its history;
+// status is computed by the caller, since expiry depends on the current time
+func RBACAccessRequestResponseFromModel(request *models.RBACAccessRequest, status string) *RBACAccessRequestResponse {
+	response := &RBACAccessRequestResponse{
+		ID:                request.ID,
+		Role:              request.Role.Identifier,
+		Requester:         request.Requester.Identifier,
+		Justification:     request.Justification,
+		Duration:          request.Duration,
+		Status:            status,
+		RequiredApprovals: request.RequiredApprovals,
+		Approvals:         []string{},
+		ExpiresAt:         request.ExpiresAt.Format("2006-01-02 15:04:05"),
+		History:           []RBACAccessRequestEventResponse{},
+		CreatedAt:         request.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+
+	if request.DecidedAt != nil {
+		response.DecidedAt = request.DecidedAt.Format("2006-01-02 15:04:05")
+	}
+
+	if request.GrantExpiresAt != nil {
+		response.GrantExpiresAt = request.GrantExpiresAt.Format("2006-01-02 15:04:05")
+	}
+
+	for _, event := range request.Events {
+		if event.Action == "approved" {
+			response.Approvals = append(response.Approvals, event.Actor.Identifier)
+		}
+
+		response.History = append(response.History, RBACAccessRequestEventResponse{
+			Action:    event.Action,
+			Actor:     event.Actor.Identifier,
+			Comment:   event.Comment,
+			CreatedAt: event.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	return response
+}
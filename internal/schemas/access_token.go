@@ -0,0 +1,65 @@
+package schemas
+
+import (
+	"strings"
+
+	"github.com/duvrdx/whoami/internal/models"
+)
+
+// Personal access token schemas
+type PersonalAccessTokenCreate struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	ExpiresIn *int     `json:"expires_in,omitempty"` // Segundos; sem valor o token não expira
+}
+
+type PersonalAccessTokenResponse struct {
+	ID     uint     `json:"id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	Roles  []string `json:"roles"`
+	// Token is only returned when the token is created
+	Token      string `json:"token,omitempty"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func PersonalAccessTokenResponseFromModel(token *models.PersonalAccessToken) *PersonalAccessTokenResponse {
+	response := &PersonalAccessTokenResponse{
+		ID:        token.ID,
+		Name:      token.Name,
+		Prefix:    token.Prefix,
+		Scopes:    splitList(token.Scopes),
+		Roles:     splitList(token.Roles),
+		CreatedAt: token.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+
+	if token.ExpiresAt != nil {
+		response.ExpiresAt = token.ExpiresAt.Format("2006-01-02 15:04:05")
+	}
+
+	if token.LastUsedAt != nil {
+		response.LastUsedAt = token.LastUsedAt.Format("2006-01-02 15:04:05")
+	}
+
+	return response
+}
+
+// Service account schemas
+type ServiceAccountCreate struct {
+	Identifier string  `json:"identifier"`
+	Metadata   *string `json:"metadata,omitempty"`
+}
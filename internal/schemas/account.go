@@ -0,0 +1,87 @@
+package schemas
+
+import (
+	"time"
+
+	"github.com/duvrdx/whoami/internal/models"
+)
+
+// Self-service account schemas
+type AccountUpdate struct {
+	// Metadata keys to set; a null value removes the key
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// AccountTokenResponse describes an OAuth token of the user without exposing it
+type AccountTokenResponse struct {
+	ID        uint   `json:"id"`
+	Client    string `json:"client"`
+	ExpiresAt string `json:"expires_at"`
+	CreatedAt string `json:"created_at"`
+}
+
+func AccountTokenResponseFromModel(token *models.Token) *AccountTokenResponse {
+	return &AccountTokenResponse{
+		ID:        token.ID,
+		Client:    token.Client.Identifier,
+		ExpiresAt: time.Unix(int64(token.ExpiresIn), 0).Format("2006-01-02 15:04:05"),
+		CreatedAt: token.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// MFA schemas
+type MFAFactorCreate struct {
+	Name string `json:"name"`
+}
+
+type MFACode struct {
+	Code string `json:"code"`
+}
+
+// MFAChallengeResponse is returned instead of the tokens when a login that can't
+// carry a code needs the second factor
+type MFAChallengeResponse struct {
+	Error     string `json:"error"`
+	MFAToken  string `json:"mfa_token"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+type MFAChallengeRedeem struct {
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+	MFAToken     string `json:"mfa_token" form:"mfa_token"`
+	Code         string `json:"code" form:"code"`
+}
+
+type MFAFactorResponse struct {
+	ID          uint   `json:"id"`
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Confirmed   bool   `json:"confirmed"`
+	ConfirmedAt string `json:"confirmed_at,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	// Secret and URI are only returned when the factor is enrolled
+	Secret string `json:"secret,omitempty"`
+	URI    string `json:"uri,omitempty"`
+}
+
+func MFAFactorResponseFromModel(factor *models.MFAFactor) *MFAFactorResponse {
+	response := &MFAFactorResponse{
+		ID:        factor.ID,
+		Type:      factor.Type,
+		Name:      factor.Name,
+		Confirmed: factor.ConfirmedAt != nil,
+		CreatedAt: factor.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+
+	if factor.ConfirmedAt != nil {
+		response.ConfirmedAt = factor.ConfirmedAt.Format("2006-01-02 15:04:05")
+	}
+
+	return response
+}
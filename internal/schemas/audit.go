@@ -0,0 +1,59 @@
+package schemas
+
+import "github.com/duvrdx/whoami/internal/models"
+
+// Audit schemas
+type AuditLogCreate struct {
+	Action    string
+	ActorID   uint
+	UserID    uint
+	SessionID uint
+	Method    string
+	Path      string
+	Status    int
+	IP        string
+	Reason    string
+}
+
+type AuditLogFilter struct {
+	Actor  string `query:"actor"`
+	User   string `query:"user"`
+	Action string `query:"action"`
+	Limit  int    `query:"limit"`
+}
+
+type AuditLogResponse struct {
+	ID        uint   `json:"id"`
+	Action    string `json:"action"`
+	Actor     string `json:"actor"`
+	User      string `json:"user,omitempty"`
+	SessionID uint   `json:"session_id,omitempty"`
+	Method    string `json:"method,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Status    int    `json:"status,omitempty"`
+	IP        string `json:"ip"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+func AuditLogResponseFromModel(entry *models.AuditLog) *AuditLogResponse {
+	return &AuditLogResponse{
+		ID:        entry.ID,
+		Action:    entry.Action,
+		Actor:     entry.Actor.Identifier,
+		User:      entry.User.Identifier,
+		SessionID: entry.SessionID,
+		Method:    entry.Method,
+		Path:      entry.Path,
+		Status:    entry.Status,
+		IP:        entry.IP,
+		Reason:    entry.Reason,
+		CreatedAt: entry.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// Impersonation schemas
+type ImpersonationCreate struct {
+	ClientID string `json:"client_id"`
+	Reason   string `json:"reason"`
+}
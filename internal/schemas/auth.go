@@ -1,6 +1,8 @@
 package schemas
 
 import (
+	"strings"
+
 	"github.com/duvrdx/whoami/internal/models"
 	"github.com/duvrdx/whoami/internal/utils"
 )
@@ -20,26 +22,44 @@ type UserUpdate struct {
 	IsActive   *bool   `json:"is_active,omitempty"`
 }
 
+// UserImport carries a user migrated from a legacy system with an already hashed password
+type UserImport struct {
+	Identifier   string  `json:"identifier"`
+	PasswordHash string  `json:"password_hash"`
+	Metadata     *string `json:"metadata,omitempty"`
+	IsActive     *bool   `json:"is_active,omitempty"`
+}
+
 type UserResponse struct {
-	ID         uint    `json:"id"`
-	Identifier string  `json:"identifier"`
-	Metadata   *string `json:"metadata"`
-	IsActive   bool    `json:"is_active"`
-	IsAdmin    bool    `json:"is_admin"`
-	CreatedAt  string  `json:"created_at"`
-	UpdatedAt  string  `json:"updated_at"`
+	ID               uint    `json:"id"`
+	Identifier       string  `json:"identifier"`
+	Metadata         *string `json:"metadata"`
+	IsActive         bool    `json:"is_active"`
+	IsAdmin          bool    `json:"is_admin"`
+	PasswordBreached bool    `json:"password_breached"`
+	Source           string  `json:"source"`
+	Type             string  `json:"type"`
+	CreatedAt        string  `json:"created_at"`
+	UpdatedAt        string  `json:"updated_at"`
+}
+
+type PasswordReset struct {
+	Password string `json:"password"`
 }
 
 func UserResponseFromModel(user *models.User) *UserResponse {
 
 	return &UserResponse{
-		ID:         user.ID,
-		Identifier: user.Identifier,
-		Metadata:   &user.Metadata,
-		IsActive:   user.IsActive,
-		IsAdmin:    user.IsAdmin,
-		CreatedAt:  user.CreatedAt.Format("2006-01-02 15:04:05"),
-		UpdatedAt:  user.UpdatedAt.Format("2006-01-02 15:04:05"),
+		ID:               user.ID,
+		Identifier:       user.Identifier,
+		Metadata:         &user.Metadata,
+		IsActive:         user.IsActive,
+		IsAdmin:          user.IsAdmin,
+		PasswordBreached: user.PasswordBreached,
+		Source:           user.Source,
+		Type:             user.Type,
+		CreatedAt:        user.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:        user.UpdatedAt.Format("2006-01-02 15:04:05"),
 	}
 }
 
@@ -77,6 +97,29 @@ func UserFromCreate(user *UserCreate) *models.User {
 	return userModel
 }
 
+func UserFromImport(user *UserImport) *models.User {
+	if user == nil {
+		return nil
+	}
+
+	userModel := &models.User{
+		Identifier: user.Identifier,
+		Password:   user.PasswordHash,
+		Metadata:   "{}",
+		IsActive:   true,
+	}
+
+	if user.Metadata != nil {
+		userModel.Metadata = *user.Metadata
+	}
+
+	if user.IsActive != nil {
+		userModel.IsActive = *user.IsActive
+	}
+
+	return userModel
+}
+
 func UserFromUpdate(user *UserUpdate) *models.User {
 	if user == nil {
 		return nil
@@ -124,10 +167,15 @@ type GroupResponse struct {
 	Description *string `json:"description"`
 	Metadata    *string `json:"metadata"`
 	IsActive    bool    `json:"is_active"`
+	Source      string  `json:"source"`
 	CreatedAt   string  `json:"created_at"`
 	UpdatedAt   string  `json:"updated_at"`
 }
 
+type GroupMembersAdd struct {
+	Users []string `json:"users"`
+}
+
 func GroupResponseFromModel(group *models.Group) *GroupResponse {
 	return &GroupResponse{
 		ID:          group.ID,
@@ -135,6 +183,7 @@ func GroupResponseFromModel(group *models.Group) *GroupResponse {
 		Description: &group.Description,
 		Metadata:    &group.Metadata,
 		IsActive:    group.IsActive,
+		Source:      group.Source,
 		CreatedAt:   group.CreatedAt.Format("2006-01-02 15:04:05"),
 		UpdatedAt:   group.UpdatedAt.Format("2006-01-02 15:04:05"),
 	}
@@ -196,48 +245,67 @@ func GroupFromUpdate(group *GroupUpdate) *models.Group {
 
 // Client schemas
 type ClientCreate struct {
-	Identifier string `json:"identifier"`
-	Secret     string `json:"secret"`
-	Grant      string `json:"grant"`
-	IsActive   *bool  `json:"is_active,omitempty"`
+	Identifier   string  `json:"identifier"`
+	Secret       string  `json:"secret"`
+	Grant        string  `json:"grant"`
+	LoginMethods *string `json:"login_methods,omitempty"`
+	IsActive     *bool   `json:"is_active,omitempty"`
 }
 
 type ClientUpdate struct {
-	Identifier *string `json:"identifier,omitempty"`
-	Secret     *string `json:"secret,omitempty"`
-	Grant      *string `json:"grant,omitempty"`
-	IsActive   *bool   `json:"is_active,omitempty"`
+	Identifier   *string `json:"identifier,omitempty"`
+	Secret       *string `json:"secret,omitempty"`
+	Grant        *string `json:"grant,omitempty"`
+	LoginMethods *string `json:"login_methods,omitempty"`
+	IsActive     *bool   `json:"is_active,omitempty"`
 }
 
 type ClientResponse struct {
-	ID         uint   `json:"id"`
-	Identifier string `json:"identifier"`
-	Grant      string `json:"grant"`
-	IsActive   bool   `json:"is_active"`
-	CreatedAt  string `json:"created_at"`
-	UpdatedAt  string `json:"updated_at"`
+	ID           uint   `json:"id"`
+	Identifier   string `json:"identifier"`
+	Grant        string `json:"grant"`
+	LoginMethods string `json:"login_methods"`
+	IsActive     bool   `json:"is_active"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
 }
 
 func ClientResponseFromModel(client *models.Client) *ClientResponse {
 	return &ClientResponse{
-		ID:         client.ID,
-		Identifier: client.Identifier,
-		Grant:      client.Grant,
-		IsActive:   client.IsActive,
-		CreatedAt:  client.CreatedAt.Format("2006-01-02 15:04:05"),
-		UpdatedAt:  client.UpdatedAt.Format("2006-01-02 15:04:05"),
+		ID:           client.ID,
+		Identifier:   client.Identifier,
+		Grant:        client.Grant,
+		LoginMethods: client.LoginMethods,
+		IsActive:     client.IsActive,
+		CreatedAt:    client.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:    client.UpdatedAt.Format("2006-01-02 15:04:05"),
 	}
 }
 
+// AllowsLoginMethod reports whether the client accepts the given login method
+func (client *ClientResponse) AllowsLoginMethod(method string) bool {
+	for _, allowed := range strings.Split(client.LoginMethods, ",") {
+		if strings.TrimSpace(allowed) == method {
+			return true
+		}
+	}
+	return false
+}
+
 func ClientFromCreate(client *ClientCreate) *models.Client {
 	if client == nil {
 		return nil
 	}
 
 	clientModel := &models.Client{
-		Identifier: client.Identifier,
-		Secret:     client.Secret,
-		Grant:      client.Grant,
+		Identifier:   client.Identifier,
+		Secret:       client.Secret,
+		Grant:        client.Grant,
+		LoginMethods: "password",
+	}
+
+	if client.LoginMethods != nil {
+		clientModel.LoginMethods = *client.LoginMethods
 	}
 
 	if client.IsActive != nil {
@@ -268,6 +336,10 @@ func ClientFromUpdate(client *ClientUpdate) *models.Client {
 		clientModel.Grant = *client.Grant
 	}
 
+	if client.LoginMethods != nil {
+		clientModel.LoginMethods = *client.LoginMethods
+	}
+
 	if client.IsActive != nil {
 		clientModel.IsActive = *client.IsActive
 	}
@@ -289,6 +361,8 @@ type TokenCreate struct {
 	ExpiresIn    int    `json:"expires_in"`
 	UserID       uint   `json:"user_id"`
 	ClientID     uint   `json:"client_id"`
+	SessionID    uint   `json:"session_id"`
+	ActorID      *uint  `json:"actor_id,omitempty"`
 }
 
 type TokenResponse struct {
@@ -296,7 +370,7 @@ type TokenResponse struct {
 	AccessToken  string        `json:"access_token"`
 	RefreshToken string        `json:"refresh_token"`
 	ExpiresIn    int           `json:"expires_in"`
-	User         *UserResponse `json:"user, omitempty"`
+	User         *UserResponse `json:"user,omitempty"`
 }
 
 func TokenResponseFromModel(token *models.Token) *TokenResponse {
@@ -316,5 +390,60 @@ func TokenFromCreate(token *TokenCreate) *models.Token {
 		ExpiresIn:    token.ExpiresIn,
 		UserID:       token.UserID,
 		ClientID:     token.ClientID,
+		SessionID:    token.SessionID,
+		ActorID:      token.ActorID,
 	}
 }
+
+// Passwordless schemas
+type PasswordlessStart struct {
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+	Username     string `json:"username" form:"username"`
+	Method       string `json:"method" form:"method"`
+}
+
+type PasswordlessRedeem struct {
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+	Username     string `json:"username,omitempty" form:"username"`
+	Code         string `json:"code,omitempty" form:"code"`
+	Token        string `json:"token,omitempty" form:"token"`
+	MFACode      string `json:"mfa_code,omitempty" form:"mfa_code"`
+}
+
+// External identity schemas
+type ExternalIdentityCreate struct {
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+}
+
+type ExternalIdentityResponse struct {
+	ID        uint   `json:"id"`
+	Provider  string `json:"provider"`
+	Subject   string `json:"subject"`
+	Claims    string `json:"claims"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+func ExternalIdentityResponseFromModel(identity *models.ExternalIdentity) *ExternalIdentityResponse {
+	return &ExternalIdentityResponse{
+		ID:        identity.ID,
+		Provider:  identity.Provider,
+		Subject:   identity.Subject,
+		Claims:    identity.Claims,
+		CreatedAt: identity.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt: identity.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// Directory sync schemas
+type DirectorySyncResult struct {
+	UsersCreated      int `json:"users_created"`
+	UsersUpdated      int `json:"users_updated"`
+	UsersDeactivated  int `json:"users_deactivated"`
+	GroupsCreated     int `json:"groups_created"`
+	GroupsUpdated     int `json:"groups_updated"`
+	GroupsDeactivated int `json:"groups_deactivated"`
+}
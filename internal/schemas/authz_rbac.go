@@ -1,6 +1,8 @@
 package schemas
 
 import (
+	"time"
+
 	"github.com/duvrdx/whoami/internal/models"
 )
 
@@ -37,6 +39,19 @@ func RBACRoleResponseFromModel(role *models.RBACRole) *RBACRoleResponse {
 	}
 }
 
+// RBACRoleInheritance is a node of the inheritance chain of a role
+type RBACRoleInheritance struct {
+	Identifier string                `json:"identifier"`
+	Parents    []RBACRoleInheritance `json:"parents"`
+}
+
+type RBACRoleHierarchyResponse struct {
+	Role string `json:"role"`
+	// Inherited lists every role whose permissions the role inherits
+	Inherited []string              `json:"inherited"`
+	Parents   []RBACRoleInheritance `json:"parents"`
+}
+
 func RBACRoleFromCreate(role *RBACRoleCreate) *models.RBACRole {
 	if role == nil {
 		return nil
@@ -78,6 +93,65 @@ func RBACRoleFromUpdate(role *RBACRoleUpdate) *models.RBACRole {
 	return roleModel
 }
 
+// RBACRoleAssignment schemas
+type RBACRoleAssignmentCreate struct {
+	Role      string     `json:"role"`
+	User      string     `json:"user"`
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Reason    string     `json:"reason"`
+}
+
+type RBACRoleAssignmentFilter struct {
+	Role string `query:"role"`
+	User string `query:"user"`
+}
+
+type RBACRoleAssignmentResponse struct {
+	Role      string `json:"role"`
+	User      string `json:"user"`
+	Status    string `json:"status"` // scheduled, active ou expired
+	NotBefore string `json:"not_before,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	Reason    string `json:"reason"`
+	Grantor   string `json:"grantor,omitempty"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+func RBACRoleAssignmentResponseFromModel(assignment *models.RBACRoleAssignment) *RBACRoleAssignmentResponse {
+	now := time.Now()
+
+	response := &RBACRoleAssignmentResponse{
+		Role:      assignment.Role.Identifier,
+		User:      assignment.User.Identifier,
+		Status:    "active",
+		Reason:    assignment.Reason,
+		CreatedAt: assignment.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt: assignment.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+
+	if assignment.NotBefore != nil {
+		response.NotBefore = assignment.NotBefore.Format(time.RFC3339)
+		if now.Before(*assignment.NotBefore) {
+			response.Status = "scheduled"
+		}
+	}
+
+	if assignment.ExpiresAt != nil {
+		response.ExpiresAt = assignment.ExpiresAt.Format(time.RFC3339)
+		if !now.Before(*assignment.ExpiresAt) {
+			response.Status = "expired"
+		}
+	}
+
+	if assignment.Grantor != nil {
+		response.Grantor = assignment.Grantor.Identifier
+	}
+
+	return response
+}
+
 // RBACPermission schemas
 type RBACPermissionCreate struct {
 	Identifier          string   `json:"identifier"`
@@ -85,6 +159,10 @@ type RBACPermissionCreate struct {
 	Description         *string  `json:"description,omitempty"`
 	ResourceTypeID      *uint    `json:"resourcetype_id,omitempty"`
 	ResourceIdentifiers []string `json:"resource_identifiers,omitempty"`
+	Action              string   `json:"action,omitempty"`
+	Effect              string   `json:"effect,omitempty"`
+	Priority            int      `json:"priority,omitempty"`
+	Condition           string   `json:"condition,omitempty"`
 }
 
 type RBACPermissionUpdate struct {
@@ -93,6 +171,10 @@ type RBACPermissionUpdate struct {
 	Description         *string  `json:"description,omitempty"`
 	ResourceTypeID      *uint    `json:"resourcetype_id,omitempty"`
 	ResourceIdentifiers []string `json:"resource_identifiers,omitempty"`
+	Action              *string  `json:"action,omitempty"`
+	Effect              *string  `json:"effect,omitempty"`
+	Priority            *int     `json:"priority,omitempty"`
+	Condition           *string  `json:"condition,omitempty"`
 }
 
 type RBACPermissionResponse struct {
@@ -102,6 +184,10 @@ type RBACPermissionResponse struct {
 	Description         string   `json:"description"`
 	ResourceTypeID      *uint    `json:"resourcetype_id,omitempty"`
 	ResourceIdentifiers []string `json:"resource_identifiers,omitempty"`
+	Action              string   `json:"action,omitempty"`
+	Effect              string   `json:"effect"`
+	Priority            int      `json:"priority"`
+	Condition           string   `json:"condition,omitempty"`
 	CreatedAt           string   `json:"created_at"`
 	UpdatedAt           string   `json:"updated_at"`
 }
@@ -119,6 +205,10 @@ func RBACPermissionResponseFromModel(permission *models.RBACPermission) *RBACPer
 		Description:         permission.Description,
 		ResourceTypeID:      permission.ResourceTypeID,
 		ResourceIdentifiers: resourceIdentifiers,
+		Action:              permission.Action,
+		Effect:              permission.Effect,
+		Priority:            permission.Priority,
+		Condition:           permission.Condition,
 		CreatedAt:           permission.CreatedAt.Format("2006-01-02 15:04:05"),
 		UpdatedAt:           permission.UpdatedAt.Format("2006-01-02 15:04:05"),
 	}
@@ -133,6 +223,10 @@ func RBACPermissionFromCreate(permission *RBACPermissionCreate) *models.RBACPerm
 		Identifier:     permission.Identifier,
 		Name:           permission.Name,
 		ResourceTypeID: permission.ResourceTypeID,
+		Action:         permission.Action,
+		Effect:         permission.Effect,
+		Priority:       permission.Priority,
+		Condition:      permission.Condition,
 	}
 
 	if permission.Description != nil {
@@ -178,6 +272,22 @@ func RBACPermissionFromUpdate(permission *RBACPermissionUpdate) *models.RBACPerm
 		permissionModel.ResourceTypeID = permission.ResourceTypeID
 	}
 
+	if permission.Action != nil {
+		permissionModel.Action = *permission.Action
+	}
+
+	if permission.Effect != nil {
+		permissionModel.Effect = *permission.Effect
+	}
+
+	if permission.Priority != nil {
+		permissionModel.Priority = *permission.Priority
+	}
+
+	if permission.Condition != nil {
+		permissionModel.Condition = *permission.Condition
+	}
+
 	// Convert resource identifiers to models
 	if len(permission.ResourceIdentifiers) > 0 {
 		resourceIdentifiers := make([]models.RBACResourceIdentifier, len(permission.ResourceIdentifiers))
@@ -192,6 +302,152 @@ func RBACPermissionFromUpdate(permission *RBACPermissionUpdate) *models.RBACPerm
 	return permissionModel
 }
 
+// RBACAuthorizationContext carries the attributes permission conditions are evaluated
+// against, besides the user: those of the resource and of the environment
+type RBACAuthorizationContext struct {
+	Resource    map[string]interface{} `json:"resource,omitempty"`
+	Environment map[string]interface{} `json:"environment,omitempty"`
+}
+
+// RBACDecision is the outcome of an authorization request. Rule, Effect, Role and
+// Resource identify the permission that decided it, and are empty when none applied.
+type RBACDecision struct {
+	Allowed   bool   `json:"allowed"`
+	Algorithm string `json:"algorithm"`
+	Rule      string `json:"rule,omitempty"`
+	Effect    string `json:"effect,omitempty"`
+	Role      string `json:"role,omitempty"`     // Papel pelo qual a permissão foi concedida
+	Resource  string `json:"resource,omitempty"` // Recurso, padrão ou tipo de recurso que a permissão cobre
+	Reason    string `json:"reason"`
+}
+
+// RBACAuthorizationCheck is one question of a batch: the permission on either a
+// resource or a resource type
+type RBACAuthorizationCheck struct {
+	Permission   string `json:"permission"`
+	Resource     string `json:"resource,omitempty"`
+	ResourceType string `json:"resource_type,omitempty"`
+	// Attributes of the resource for permission conditions
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+type RBACBatchAuthorization struct {
+	// Subject is the user the checks are about, the authenticated user by default
+	Subject     string                   `json:"subject,omitempty"`
+	Environment map[string]interface{}   `json:"environment,omitempty"`
+	Checks      []RBACAuthorizationCheck `json:"checks"`
+}
+
+// RBACBatchAuthorizationResponse has a decision for each check, in the order they were sent
+type RBACBatchAuthorizationResponse struct {
+	Subject   string         `json:"subject"`
+	Decisions []RBACDecision `json:"decisions"`
+}
+
+// RBACExplainRequest asks for the decision trace of a single check
+type RBACExplainRequest struct {
+	// Subject is the user the check is about, the authenticated user by default
+	Subject string `json:"subject,omitempty"`
+	RBACAuthorizationCheck
+	Environment map[string]interface{} `json:"environment,omitempty"`
+}
+
+// RBACTraceRole is an effective role of the subject and how it holds it: directly
+// (user), through one of its groups (group) or inherited from another role (inherited)
+type RBACTraceRole struct {
+	Identifier string `json:"identifier"`
+	Via        string `json:"via"`
+}
+
+// RBACTracePermission is a permission named or acting as the checked one, with each
+// requirement for it to apply: being granted to an effective role, being linked to the
+// resource or resource type and having its condition hold
+type RBACTracePermission struct {
+	Identifier      string   `json:"identifier"`
+	Action          string   `json:"action,omitempty"`
+	Effect          string   `json:"effect"`
+	Priority        int      `json:"priority"`
+	GrantedThrough  []string `json:"granted_through"`
+	Linked          bool     `json:"linked"`
+	Match           string   `json:"match,omitempty"` // Recurso, padrão ou tipo de recurso que cobre a verificação
+	Condition       string   `json:"condition,omitempty"`
+	ConditionResult *bool    `json:"condition_result,omitempty"`
+	ConditionError  string   `json:"condition_error,omitempty"`
+	Applies         bool     `json:"applies"`
+}
+
+type RBACDecisionTrace struct {
+	Subject      string                `json:"subject"`
+	Permission   string                `json:"permission"`
+	Resource     string                `json:"resource,omitempty"`
+	ResourceType string                `json:"resource_type,omitempty"`
+	Roles        []RBACTraceRole       `json:"roles"`
+	Permissions  []RBACTracePermission `json:"permissions"`
+	Decision     RBACDecision          `json:"decision"`
+}
+
+// RBACPolicyChange is a change evaluated by a simulation without being persisted.
+// Operation tells which of the other fields are used, e.g. grant_role takes Role and
+// User, and update_permission takes Permission and Update.
+type RBACPolicyChange struct {
+	Operation  string                `json:"operation"`
+	Role       string                `json:"role,omitempty"`
+	User       string                `json:"user,omitempty"`
+	Group      string                `json:"group,omitempty"`
+	Parent     string                `json:"parent,omitempty"`
+	Permission string                `json:"permission,omitempty"`
+	Create     *RBACPermissionCreate `json:"create,omitempty"`
+	Update     *RBACPermissionUpdate `json:"update,omitempty"`
+}
+
+type RBACSimulationRequest struct {
+	RBACExplainRequest
+	Changes []RBACPolicyChange `json:"changes"`
+}
+
+type RBACSimulationResponse struct {
+	Before  RBACDecisionTrace `json:"before"`
+	After   RBACDecisionTrace `json:"after"`
+	Changed bool              `json:"changed"` // Se as mudanças alteram a decisão
+}
+
+// Access query schemas. Grants whose decision depends on a condition are reported as
+// conditional, since the attributes it is evaluated against are only known per request.
+type RBACAccessHolder struct {
+	Identifier  string   `json:"identifier"`
+	Roles       []string `json:"roles"` // Papéis pelos quais a permissão é concedida
+	Conditional bool     `json:"conditional,omitempty"`
+}
+
+// RBACResourceAccess lists who holds a permission on a resource: the users it is
+// granted to, however they hold the role, and the groups holding a granting role
+type RBACResourceAccess struct {
+	Resource   string             `json:"resource"`
+	Permission string             `json:"permission"`
+	Users      []RBACAccessHolder `json:"users"`
+	Groups     []RBACAccessHolder `json:"groups"`
+}
+
+type RBACGrantedResourceFilter struct {
+	User       string `query:"user"`
+	Permission string `query:"permission"`
+	Limit      int    `query:"limit"`
+	After      string `query:"after"` // Cursor: o next da página anterior
+}
+
+type RBACGrantedResource struct {
+	Identifier  string `json:"identifier"`
+	Kind        string `json:"kind,omitempty"` // exact ou glob; a concessão cobre também os descendentes
+	Conditional bool   `json:"conditional,omitempty"`
+}
+
+type RBACGrantedResources struct {
+	Subject    string                `json:"subject"`
+	Permission string                `json:"permission"`
+	Resources  []RBACGrantedResource `json:"resources"`
+	Next       string                `json:"next,omitempty"`
+}
+
 // RBACResourceType schemas
 type RBACResourceTypeCreate struct {
 	Identifier  string  `json:"identifier"`
@@ -0,0 +1,174 @@
+package schemas
+
+import (
+	"encoding/json"
+
+	"github.com/duvrdx/whoami/internal/models"
+)
+
+// ReBACUsersetRewrite computes the subjects of a relation. Exactly one field is set:
+// This holds the subjects of the relation's own tuples, ComputedUserset those of
+// another relation of the same object, TupleToUserset those of a relation of the
+// objects the tuples of Tupleset point to, and Union, Intersection and Exclusion
+// combine other rewrites.
+type ReBACUsersetRewrite struct {
+	This            *struct{}             `json:"this,omitempty"`
+	ComputedUserset string                `json:"computed_userset,omitempty"`
+	TupleToUserset  *ReBACTupleToUserset  `json:"tuple_to_userset,omitempty"`
+	Union           []ReBACUsersetRewrite `json:"union,omitempty"`
+	Intersection    []ReBACUsersetRewrite `json:"intersection,omitempty"`
+	Exclusion       *ReBACExclusion       `json:"exclusion,omitempty"`
+}
+
+type ReBACTupleToUserset struct {
+	Tupleset        string `json:"tupleset"`
+	ComputedUserset string `json:"computed_userset"`
+}
+
+type ReBACExclusion struct {
+	Base     ReBACUsersetRewrite `json:"base"`
+	Subtract ReBACUsersetRewrite `json:"subtract"`
+}
+
+// ReBACNamespace schemas
+type ReBACNamespaceCreate struct {
+	Name string `json:"name"`
+	// Relations without a rewrite only hold their own tuples
+	Relations map[string]*ReBACUsersetRewrite `json:"relations"`
+}
+
+type ReBACNamespaceUpdate struct {
+	Relations map[string]*ReBACUsersetRewrite `json:"relations"`
+}
+
+type ReBACNamespaceResponse struct {
+	ID        uint                            `json:"id"`
+	Name      string                          `json:"name"`
+	Relations map[string]*ReBACUsersetRewrite `json:"relations"`
+	CreatedAt string                          `json:"created_at"`
+	UpdatedAt string                          `json:"updated_at"`
+}
+
+func ReBACNamespaceResponseFromModel(namespace *models.ReBACNamespace) *ReBACNamespaceResponse {
+	relations := map[string]*ReBACUsersetRewrite{}
+	json.Unmarshal([]byte(namespace.Relations), &relations)
+
+	return &ReBACNamespaceResponse{
+		ID:        namespace.ID,
+		Name:      namespace.Name,
+		Relations: relations,
+		CreatedAt: namespace.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt: namespace.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// ReBACTuple is a relationship written as namespace:object, relation and subject,
+// the subject being namespace:object or the userset namespace:object#relation
+type ReBACTuple struct {
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+	Subject  string `json:"subject"`
+}
+
+func (tuple ReBACTuple) String() string {
+	return tuple.Object + "#" + tuple.Relation + "@" + tuple.Subject
+}
+
+func ReBACTupleFromModel(tuple *models.ReBACTuple) ReBACTuple {
+	subject := tuple.SubjectNamespace + ":" + tuple.SubjectObjectID
+	if tuple.SubjectRelation != "" {
+		subject += "#" + tuple.SubjectRelation
+	}
+
+	return ReBACTuple{
+		Object:   tuple.Namespace + ":" + tuple.ObjectID,
+		Relation: tuple.Relation,
+		Subject:  subject,
+	}
+}
+
+// ReBACTupleWrite applies the deletes and writes atomically
+type ReBACTupleWrite struct {
+	Writes  []ReBACTuple `json:"writes"`
+	Deletes []ReBACTuple `json:"deletes"`
+}
+
+type ReBACTupleFilter struct {
+	Namespace string `query:"namespace"`
+	Object    string `query:"object"`
+	Relation  string `query:"relation"`
+	Subject   string `query:"subject"`
+	Zookie    string `query:"zookie"`
+}
+
+// ReBACWriteResponse carries the zookie of the write, which reads pass along to be
+// evaluated at a revision at least as fresh
+type ReBACWriteResponse struct {
+	Zookie string `json:"zookie"`
+}
+
+type ReBACTuplesResponse struct {
+	Tuples []ReBACTuple `json:"tuples"`
+	Zookie string       `json:"zookie"`
+}
+
+// ReBAC query schemas
+type ReBACCheckRequest struct {
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+	// Subject defaults to the authenticated user, as user:<identifier>
+	Subject string `json:"subject,omitempty"`
+	Zookie  string `json:"zookie,omitempty"`
+}
+
+type ReBACCheckResponse struct {
+	Allowed bool   `json:"allowed"`
+	Zookie  string `json:"zookie"`
+}
+
+type ReBACExpandRequest struct {
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+	Zookie   string `json:"zookie,omitempty"`
+}
+
+// ReBACUsersetTree is the expansion of object#relation. Leaves list the subjects of
+// the relation's own tuples, usersets of other objects included unexpanded.
+type ReBACUsersetTree struct {
+	Operation string             `json:"operation"` // leaf, union, intersection ou exclusion
+	Object    string             `json:"object,omitempty"`
+	Relation  string             `json:"relation,omitempty"`
+	Subjects  []string           `json:"subjects,omitempty"`
+	Children  []ReBACUsersetTree `json:"children,omitempty"`
+}
+
+type ReBACExpandResponse struct {
+	Tree   ReBACUsersetTree `json:"tree"`
+	Zookie string           `json:"zookie"`
+}
+
+type ReBACListObjectsRequest struct {
+	Namespace string `json:"namespace"`
+	Relation  string `json:"relation"`
+	// Subject defaults to the authenticated user, as user:<identifier>
+	Subject string `json:"subject,omitempty"`
+	Zookie  string `json:"zookie,omitempty"`
+}
+
+type ReBACListObjectsResponse struct {
+	Objects []string `json:"objects"`
+	Zookie  string   `json:"zookie"`
+}
+
+type ReBACListUsersRequest struct {
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+	// SubjectNamespace keeps only the subjects of the namespace, e.g. user
+	SubjectNamespace string `json:"subject_namespace,omitempty"`
+	Zookie           string `json:"zookie,omitempty"`
+}
+
+type ReBACListUsersResponse struct {
+	Subjects []string `json:"subjects"`
+	Zookie   string   `json:"zookie"`
+}
@@ -0,0 +1,59 @@
+package schemas
+
+import "github.com/duvrdx/whoami/internal/models"
+
+// Invitation schemas
+type InvitationCreate struct {
+	Identifier string   `json:"identifier"`
+	Metadata   *string  `json:"metadata,omitempty"`
+	Groups     []string `json:"groups"`
+	Roles      []string `json:"roles"`
+}
+
+type InvitationAccept struct {
+	Token    string `json:"token" form:"token"`
+	Password string `json:"password" form:"password"`
+}
+
+type InvitationResponse struct {
+	ID         uint     `json:"id"`
+	Identifier string   `json:"identifier"`
+	Groups     []string `json:"groups"`
+	Roles      []string `json:"roles"`
+	Status     string   `json:"status"`
+	InvitedBy  string   `json:"invited_by,omitempty"`
+	SentCount  int      `json:"sent_count"`
+	ExpiresAt  string   `json:"expires_at"`
+	AcceptedAt string   `json:"accepted_at,omitempty"`
+	RevokedAt  string   `json:"revoked_at,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// InvitationResponseFromModel describes the invitation; status is computed by
+// the caller, since expiry depends on the current time
+func InvitationResponseFromModel(invitation *models.Invitation, status string) *InvitationResponse {
+	response := &InvitationResponse{
+		ID:         invitation.ID,
+		Identifier: invitation.Identifier,
+		Groups:     splitList(invitation.Groups),
+		Roles:      splitList(invitation.Roles),
+		Status:     status,
+		SentCount:  invitation.SentCount,
+		ExpiresAt:  invitation.ExpiresAt.Format("2006-01-02 15:04:05"),
+		CreatedAt:  invitation.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+
+	if invitation.InvitedBy != nil {
+		response.InvitedBy = invitation.InvitedBy.Identifier
+	}
+
+	if invitation.AcceptedAt != nil {
+		response.AcceptedAt = invitation.AcceptedAt.Format("2006-01-02 15:04:05")
+	}
+
+	if invitation.RevokedAt != nil {
+		response.RevokedAt = invitation.RevokedAt.Format("2006-01-02 15:04:05")
+	}
+
+	return response
+}
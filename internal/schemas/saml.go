@@ -0,0 +1,222 @@
+package schemas
+
+import (
+	"encoding/json"
+
+	"github.com/duvrdx/whoami/internal/models"
+)
+
+// SAML service provider schemas
+type SAMLServiceProviderCreate struct {
+	// Metadata is the SP metadata XML, filling every field not given explicitly
+	Metadata           string            `json:"metadata,omitempty"`
+	EntityID           string            `json:"entity_id"`
+	Name               string            `json:"name"`
+	ACSURL             string            `json:"acs_url"`
+	SLOURL             string            `json:"slo_url"`
+	SLOBinding         string            `json:"slo_binding"`
+	NameIDFormat       string            `json:"name_id_format"`
+	Certificate        string            `json:"certificate"`
+	WantRequestsSigned *bool             `json:"want_requests_signed,omitempty"`
+	SignResponse       bool              `json:"sign_response"`
+	Attributes         map[string]string `json:"attributes,omitempty"`
+	IsActive           *bool             `json:"is_active,omitempty"`
+}
+
+type SAMLServiceProviderUpdate struct {
+	Name               *string            `json:"name,omitempty"`
+	ACSURL             *string            `json:"acs_url,omitempty"`
+	SLOURL             *string            `json:"slo_url,omitempty"`
+	SLOBinding         *string            `json:"slo_binding,omitempty"`
+	NameIDFormat       *string            `json:"name_id_format,omitempty"`
+	Certificate        *string            `json:"certificate,omitempty"`
+	WantRequestsSigned *bool              `json:"want_requests_signed,omitempty"`
+	SignResponse       *bool              `json:"sign_response,omitempty"`
+	Attributes         *map[string]string `json:"attributes,omitempty"`
+	IsActive           *bool              `json:"is_active,omitempty"`
+}
+
+type SAMLServiceProviderResponse struct {
+	ID                 uint              `json:"id"`
+	EntityID           string            `json:"entity_id"`
+	Name               string            `json:"name"`
+	ACSURL             string            `json:"acs_url"`
+	SLOURL             string            `json:"slo_url"`
+	SLOBinding         string            `json:"slo_binding"`
+	NameIDFormat       string            `json:"name_id_format"`
+	Certificate        string            `json:"certificate"`
+	WantRequestsSigned bool              `json:"want_requests_signed"`
+	SignResponse       bool              `json:"sign_response"`
+	Attributes         map[string]string `json:"attributes"`
+	IsActive           bool              `json:"is_active"`
+	CreatedAt          string            `json:"created_at"`
+	UpdatedAt          string            `json:"updated_at"`
+}
+
+func SAMLServiceProviderResponseFromModel(sp *models.SAMLServiceProvider) *SAMLServiceProviderResponse {
+	attributes := map[string]string{}
+	json.Unmarshal([]byte(sp.Attributes), &attributes)
+
+	return &SAMLServiceProviderResponse{
+		ID:                 sp.ID,
+		EntityID:           sp.EntityID,
+		Name:               sp.Name,
+		ACSURL:             sp.ACSURL,
+		SLOURL:             sp.SLOURL,
+		SLOBinding:         sp.SLOBinding,
+		NameIDFormat:       sp.NameIDFormat,
+		Certificate:        sp.Certificate,
+		WantRequestsSigned: sp.WantRequestsSigned,
+		SignResponse:       sp.SignResponse,
+		Attributes:         attributes,
+		IsActive:           sp.IsActive,
+		CreatedAt:          sp.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:          sp.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func SAMLServiceProviderFromCreate(sp *SAMLServiceProviderCreate) *models.SAMLServiceProvider {
+	if sp == nil {
+		return nil
+	}
+
+	spModel := &models.SAMLServiceProvider{
+		EntityID:     sp.EntityID,
+		Name:         sp.Name,
+		ACSURL:       sp.ACSURL,
+		SLOURL:       sp.SLOURL,
+		SLOBinding:   sp.SLOBinding,
+		NameIDFormat: sp.NameIDFormat,
+		Certificate:  sp.Certificate,
+		SignResponse: sp.SignResponse,
+		Attributes:   "{}",
+		IsActive:     true,
+	}
+
+	if sp.WantRequestsSigned != nil {
+		spModel.WantRequestsSigned = *sp.WantRequestsSigned
+	}
+
+	if sp.Attributes != nil {
+		attributes, _ := json.Marshal(sp.Attributes)
+		spModel.Attributes = string(attributes)
+	}
+
+	if sp.IsActive != nil {
+		spModel.IsActive = *sp.IsActive
+	}
+
+	return spModel
+}
+
+// SAML identity provider schemas
+type SAMLIdentityProviderCreate struct {
+	// Metadata is the IdP metadata XML, filling every field not given explicitly
+	Metadata            string            `json:"metadata,omitempty"`
+	Name                string            `json:"name"`
+	EntityID            string            `json:"entity_id"`
+	SSOURL              string            `json:"sso_url"`
+	SSOBinding          string            `json:"sso_binding"`
+	Certificates        string            `json:"certificates"`
+	SignRequests        *bool             `json:"sign_requests,omitempty"`
+	NameIDFormat        string            `json:"name_id_format"`
+	IdentifierAttribute string            `json:"identifier_attribute"`
+	GroupsAttribute     string            `json:"groups_attribute"`
+	MetadataAttributes  map[string]string `json:"metadata_attributes,omitempty"`
+	Provision           bool              `json:"provision"`
+	LinkExisting        bool              `json:"link_existing"`
+	IsActive            *bool             `json:"is_active,omitempty"`
+}
+
+type SAMLIdentityProviderUpdate struct {
+	SSOURL              *string            `json:"sso_url,omitempty"`
+	SSOBinding          *string            `json:"sso_binding,omitempty"`
+	Certificates        *string            `json:"certificates,omitempty"`
+	SignRequests        *bool              `json:"sign_requests,omitempty"`
+	NameIDFormat        *string            `json:"name_id_format,omitempty"`
+	IdentifierAttribute *string            `json:"identifier_attribute,omitempty"`
+	GroupsAttribute     *string            `json:"groups_attribute,omitempty"`
+	MetadataAttributes  *map[string]string `json:"metadata_attributes,omitempty"`
+	Provision           *bool              `json:"provision,omitempty"`
+	LinkExisting        *bool              `json:"link_existing,omitempty"`
+	IsActive            *bool              `json:"is_active,omitempty"`
+}
+
+type SAMLIdentityProviderResponse struct {
+	ID                  uint              `json:"id"`
+	Name                string            `json:"name"`
+	EntityID            string            `json:"entity_id"`
+	SSOURL              string            `json:"sso_url"`
+	SSOBinding          string            `json:"sso_binding"`
+	Certificates        string            `json:"certificates"`
+	SignRequests        bool              `json:"sign_requests"`
+	NameIDFormat        string            `json:"name_id_format"`
+	IdentifierAttribute string            `json:"identifier_attribute"`
+	GroupsAttribute     string            `json:"groups_attribute"`
+	MetadataAttributes  map[string]string `json:"metadata_attributes"`
+	Provision           bool              `json:"provision"`
+	LinkExisting        bool              `json:"link_existing"`
+	IsActive            bool              `json:"is_active"`
+	CreatedAt           string            `json:"created_at"`
+	UpdatedAt           string            `json:"updated_at"`
+}
+
+func SAMLIdentityProviderResponseFromModel(idp *models.SAMLIdentityProvider) *SAMLIdentityProviderResponse {
+	metadataAttributes := map[string]string{}
+	json.Unmarshal([]byte(idp.MetadataAttributes), &metadataAttributes)
+
+	return &SAMLIdentityProviderResponse{
+		ID:                  idp.ID,
+		Name:                idp.Name,
+		EntityID:            idp.EntityID,
+		SSOURL:              idp.SSOURL,
+		SSOBinding:          idp.SSOBinding,
+		Certificates:        idp.Certificates,
+		SignRequests:        idp.SignRequests,
+		NameIDFormat:        idp.NameIDFormat,
+		IdentifierAttribute: idp.IdentifierAttribute,
+		GroupsAttribute:     idp.GroupsAttribute,
+		MetadataAttributes:  metadataAttributes,
+		Provision:           idp.Provision,
+		LinkExisting:        idp.LinkExisting,
+		IsActive:            idp.IsActive,
+		CreatedAt:           idp.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:           idp.UpdatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+func SAMLIdentityProviderFromCreate(idp *SAMLIdentityProviderCreate) *models.SAMLIdentityProvider {
+	if idp == nil {
+		return nil
+	}
+
+	idpModel := &models.SAMLIdentityProvider{
+		Name:                idp.Name,
+		EntityID:            idp.EntityID,
+		SSOURL:              idp.SSOURL,
+		SSOBinding:          idp.SSOBinding,
+		Certificates:        idp.Certificates,
+		NameIDFormat:        idp.NameIDFormat,
+		IdentifierAttribute: idp.IdentifierAttribute,
+		GroupsAttribute:     idp.GroupsAttribute,
+		MetadataAttributes:  "{}",
+		Provision:           idp.Provision,
+		LinkExisting:        idp.LinkExisting,
+		IsActive:            true,
+	}
+
+	if idp.SignRequests != nil {
+		idpModel.SignRequests = *idp.SignRequests
+	}
+
+	if idp.MetadataAttributes != nil {
+		metadataAttributes, _ := json.Marshal(idp.MetadataAttributes)
+		idpModel.MetadataAttributes = string(metadataAttributes)
+	}
+
+	if idp.IsActive != nil {
+		idpModel.IsActive = *idp.IsActive
+	}
+
+	return idpModel
+}
@@ -0,0 +1,31 @@
+package schemas
+
+import "github.com/duvrdx/whoami/internal/models"
+
+// SCIM token schemas
+type SCIMTokenCreate struct {
+	Name string `json:"name"`
+}
+
+type SCIMTokenResponse struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	// Token is only returned when the token is created
+	Token      string `json:"token,omitempty"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+func SCIMTokenResponseFromModel(token *models.SCIMToken) *SCIMTokenResponse {
+	response := &SCIMTokenResponse{
+		ID:        token.ID,
+		Name:      token.Name,
+		CreatedAt: token.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+
+	if token.LastUsedAt != nil {
+		response.LastUsedAt = token.LastUsedAt.Format("2006-01-02 15:04:05")
+	}
+
+	return response
+}
@@ -0,0 +1,48 @@
+package schemas
+
+import (
+	"strings"
+
+	"github.com/duvrdx/whoami/internal/models"
+)
+
+// Session schemas
+type SessionCreate struct {
+	UserID    uint
+	ClientID  uint
+	IP        string
+	UserAgent string
+	Methods   []string
+}
+
+type SessionResponse struct {
+	ID         uint     `json:"id"`
+	SID        string   `json:"sid"`
+	Client     string   `json:"client,omitempty"`
+	IP         string   `json:"ip"`
+	UserAgent  string   `json:"user_agent"`
+	Device     string   `json:"device"`
+	Methods    []string `json:"methods"`
+	Current    bool     `json:"current"`
+	LastSeenAt string   `json:"last_seen_at"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+func SessionResponseFromModel(session *models.Session) *SessionResponse {
+	methods := []string{}
+	if session.Methods != "" {
+		methods = strings.Split(session.Methods, ",")
+	}
+
+	return &SessionResponse{
+		ID:         session.ID,
+		SID:        session.SID,
+		Client:     session.Client.Identifier,
+		IP:         session.IP,
+		UserAgent:  session.UserAgent,
+		Device:     session.Device,
+		Methods:    methods,
+		LastSeenAt: session.LastSeenAt.Format("2006-01-02 15:04:05"),
+		CreatedAt:  session.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
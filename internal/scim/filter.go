@@ -0,0 +1,676 @@
+package scim
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AttributePath is an attribute reference such as "name.givenName" or
+// "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department".
+// Name is empty when the path names a whole extension.
+type AttributePath struct {
+	URI  string
+	Name string
+	Sub  string
+}
+
+func (p AttributePath) String() string {
+	path := p.Name
+	if p.Sub != "" {
+		path += "." + p.Sub
+	}
+	if p.URI != "" {
+		path = p.URI + ":" + path
+	}
+	return path
+}
+
+// Expression is a node of a parsed filter
+type Expression interface {
+	expression()
+}
+
+type LogicalExpression struct {
+	Operator    string // "and" ou "or"
+	Left, Right Expression
+}
+
+type NotExpression struct {
+	Expression Expression
+}
+
+// AttributeExpression compares an attribute with a value; Operator "pr" takes no value
+type AttributeExpression struct {
+	Path     AttributePath
+	Operator string
+	Value    interface{}
+}
+
+// ValuePathExpression selects the values of a multi-valued attribute matching Filter
+type ValuePathExpression struct {
+	Path   AttributePath
+	Filter Expression
+}
+
+func (LogicalExpression) expression()   {}
+func (NotExpression) expression()       {}
+func (AttributeExpression) expression() {}
+func (ValuePathExpression) expression() {}
+
+var compareOperators = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "lt": true, "ge": true, "le": true,
+}
+
+var attributeName = regexp.MustCompile(`^[A-Za-z$][A-Za-z0-9_$-]*$`)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenLeftParen
+	tokenRightParen
+	tokenLeftBracket
+	tokenRightBracket
+	tokenEOF
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value string // Valor decodificado de strings JSON
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(input); {
+		switch c := input[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")"})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokenLeftBracket, text: "["})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokenRightBracket, text: "]"})
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(input) && input[end] != '"'; end++ {
+				if input[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(input) {
+				return nil, NewError(400, ErrorInvalidFilter, "unterminated string in filter")
+			}
+
+			var value string
+			if err := json.Unmarshal([]byte(input[i:end+1]), &value); err != nil {
+				return nil, NewError(400, ErrorInvalidFilter, "invalid string in filter")
+			}
+
+			tokens = append(tokens, token{kind: tokenString, text: input[i : end+1], value: value})
+			i = end + 1
+		default:
+			end := i
+			for end < len(input) && !strings.ContainsRune(" \t\n\r()[]\"", rune(input[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: input[i:end]})
+			i = end
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	// scimType used for errors, invalidFilter or invalidPath
+	errorType string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	return t.kind == tokenWord && strings.EqualFold(t.text, word)
+}
+
+func (p *parser) fail(format string, args ...interface{}) error {
+	return NewError(400, p.errorType, format, args...)
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if p.next().kind != kind {
+		return p.fail("expected %q in %s", text, p.describe())
+	}
+	return nil
+}
+
+func (p *parser) describe() string {
+	var parts []string
+	for _, t := range p.tokens {
+		parts = append(parts, t.text)
+	}
+	return strings.TrimSpace(strings.Join(parts, " "))
+}
+
+func (p *parser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = LogicalExpression{Operator: "or", Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = LogicalExpression{Operator: "and", Left: left, Right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expression, error) {
+	if p.keyword("not") {
+		p.next()
+		if err := p.expect(tokenLeftParen, "("); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRightParen, ")"); err != nil {
+			return nil, err
+		}
+		return NotExpression{Expression: inner}, nil
+	}
+
+	if p.peek().kind == tokenLeftParen {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRightParen, ")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+
+	return p.parseAttributeExpression()
+}
+
+func (p *parser) parseAttributeExpression() (Expression, error) {
+	t := p.next()
+	if t.kind != tokenWord {
+		return nil, p.fail("expected an attribute in %s", p.describe())
+	}
+
+	path, err := parseAttributePath(t.text, p.errorType)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind == tokenLeftBracket {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRightBracket, "]"); err != nil {
+			return nil, err
+		}
+		return ValuePathExpression{Path: path, Filter: inner}, nil
+	}
+
+	operator := p.next()
+	if operator.kind != tokenWord {
+		return nil, p.fail("expected an operator after %s", t.text)
+	}
+
+	op := strings.ToLower(operator.text)
+	if op == "pr" {
+		return AttributeExpression{Path: path, Operator: op}, nil
+	}
+
+	if !compareOperators[op] {
+		return nil, p.fail("unknown operator %q", operator.text)
+	}
+
+	value := p.next()
+	switch {
+	case value.kind == tokenString:
+		return AttributeExpression{Path: path, Operator: op, Value: value.value}, nil
+	case value.kind != tokenWord:
+		return nil, p.fail("expected a value after %s %s", t.text, operator.text)
+	}
+
+	expression := AttributeExpression{Path: path, Operator: op}
+
+	switch strings.ToLower(value.text) {
+	case "true":
+		expression.Value = true
+	case "false":
+		expression.Value = false
+	case "null":
+		expression.Value = nil
+	default:
+		number, err := strconv.ParseFloat(value.text, 64)
+		if err != nil {
+			return nil, p.fail("invalid value %q", value.text)
+		}
+		expression.Value = number
+	}
+
+	return expression, nil
+}
+
+func isExtensionURI(path string) bool {
+	return strings.EqualFold(path, SchemaEnterpriseUser)
+}
+
+func parseAttributePath(text, errorType string) (AttributePath, error) {
+	var path AttributePath
+	rest := text
+
+	// A URI do schema contém ":" e "." (como em "2.0"), então é separada antes do nome
+	if strings.HasPrefix(strings.ToLower(text), "urn:") {
+		if isExtensionURI(text) {
+			return AttributePath{URI: text}, nil
+		}
+
+		i := strings.LastIndex(text, ":")
+		path.URI, rest = text[:i], text[i+1:]
+	}
+
+	path.Name = rest
+	if i := strings.Index(rest, "."); i >= 0 {
+		path.Name, path.Sub = rest[:i], rest[i+1:]
+		if !attributeName.MatchString(path.Sub) {
+			return path, NewError(400, errorType, "invalid attribute path %q", text)
+		}
+	}
+
+	if !attributeName.MatchString(path.Name) {
+		return path, NewError(400, errorType, "invalid attribute path %q", text)
+	}
+
+	return path, nil
+}
+
+// ParseFilter parses a filter expression (RFC 7644 section 3.4.2.2)
+func ParseFilter(filter string) (Expression, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, errorType: ErrorInvalidFilter}
+
+	expression, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind != tokenEOF {
+		return nil, p.fail("unexpected %q in filter", p.peek().text)
+	}
+
+	return expression, nil
+}
+
+// PatchPath is the target of a PATCH operation: an attribute, optionally
+// narrowed to the values matching Filter and to one of their sub-attributes
+type PatchPath struct {
+	Attribute AttributePath
+	Filter    Expression
+	Sub       string
+}
+
+func ParsePath(path string) (*PatchPath, error) {
+	tokens, err := tokenize(path)
+	if err != nil {
+		return nil, NewError(400, ErrorInvalidPath, "invalid path %q", path)
+	}
+
+	p := &parser{tokens: tokens, errorType: ErrorInvalidPath}
+
+	t := p.next()
+	if t.kind != tokenWord {
+		return nil, p.fail("invalid path %q", path)
+	}
+
+	attribute, err := parseAttributePath(t.text, ErrorInvalidPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PatchPath{Attribute: attribute}
+
+	if p.peek().kind == tokenLeftBracket {
+		if attribute.Sub != "" || attribute.Name == "" {
+			return nil, p.fail("invalid path %q", path)
+		}
+
+		p.next()
+		p.errorType = ErrorInvalidFilter
+		if result.Filter, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+		p.errorType = ErrorInvalidPath
+
+		if err := p.expect(tokenRightBracket, "]"); err != nil {
+			return nil, err
+		}
+
+		if p.peek().kind == tokenWord {
+			sub := p.next().text
+			if !strings.HasPrefix(sub, ".") || !attributeName.MatchString(sub[1:]) {
+				return nil, p.fail("invalid path %q", path)
+			}
+			result.Sub = sub[1:]
+		}
+	}
+
+	if p.peek().kind != tokenEOF {
+		return nil, p.fail("invalid path %q", path)
+	}
+
+	return result, nil
+}
+
+// lookup finds a key ignoring case, since attribute names are case-insensitive
+func lookup(object map[string]interface{}, name string) (string, interface{}, bool) {
+	if value, ok := object[name]; ok {
+		return name, value, true
+	}
+
+	for key, value := range object {
+		if strings.EqualFold(key, name) {
+			return key, value, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// matcher evaluates filters over an object, either a resource or one value of a multi-valued attribute
+type matcher struct {
+	get       func(path AttributePath) (interface{}, bool)
+	attribute func(path AttributePath) *Attribute
+}
+
+func (rt *ResourceType) resourceMatcher(resource Resource) *matcher {
+	return &matcher{
+		get: func(path AttributePath) (interface{}, bool) {
+			container := rt.container(resource, path.URI, false)
+			if container == nil {
+				return nil, false
+			}
+			_, value, ok := lookup(container, path.Name)
+			return value, ok
+		},
+		attribute: rt.Attribute,
+	}
+}
+
+func elementMatcher(parent *Attribute, element map[string]interface{}) *matcher {
+	return &matcher{
+		get: func(path AttributePath) (interface{}, bool) {
+			_, value, ok := lookup(element, path.Name)
+			return value, ok
+		},
+		attribute: func(path AttributePath) *Attribute {
+			if parent == nil {
+				return nil
+			}
+			return parent.SubAttribute(path.Name)
+		},
+	}
+}
+
+// Match reports whether a resource satisfies a filter
+func (rt *ResourceType) Match(resource Resource, filter Expression) bool {
+	return rt.resourceMatcher(resource).match(filter)
+}
+
+func (m *matcher) match(expression Expression) bool {
+	switch e := expression.(type) {
+	case LogicalExpression:
+		if e.Operator == "and" {
+			return m.match(e.Left) && m.match(e.Right)
+		}
+		return m.match(e.Left) || m.match(e.Right)
+	case NotExpression:
+		return !m.match(e.Expression)
+	case ValuePathExpression:
+		value, _ := m.get(e.Path)
+		parent := m.attribute(e.Path)
+		for _, element := range asList(value) {
+			if object, ok := element.(map[string]interface{}); ok && elementMatcher(parent, object).match(e.Filter) {
+				return true
+			}
+		}
+		return false
+	case AttributeExpression:
+		return m.compare(e)
+	}
+	return false
+}
+
+func asList(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	case []map[string]interface{}:
+		list := make([]interface{}, len(v))
+		for i := range v {
+			list[i] = v[i]
+		}
+		return list
+	}
+	return []interface{}{value}
+}
+
+// candidates lists the values a comparison applies to. Complex values
+// without a sub-attribute compare through their "value" sub-attribute.
+func candidates(value interface{}, sub string) []interface{} {
+	var values []interface{}
+
+	for _, element := range asList(value) {
+		object, ok := element.(map[string]interface{})
+		if !ok {
+			if sub == "" {
+				values = append(values, element)
+			}
+			continue
+		}
+
+		name := sub
+		if name == "" {
+			name = "value"
+		}
+		if _, v, ok := lookup(object, name); ok {
+			values = append(values, asList(v)...)
+		}
+	}
+
+	return values
+}
+
+func (m *matcher) compare(e AttributeExpression) bool {
+	value, _ := m.get(e.Path)
+	values := candidates(value, e.Path.Sub)
+
+	attribute := m.attribute(e.Path)
+	if attribute != nil && e.Path.Sub != "" {
+		attribute = attribute.SubAttribute(e.Path.Sub)
+	}
+
+	if e.Operator == "pr" {
+		for _, v := range values {
+			if s, ok := v.(string); v != nil && (!ok || s != "") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if e.Value == nil {
+		present := len(values) > 0
+		if e.Operator == "ne" {
+			return present
+		}
+		return e.Operator == "eq" && !present
+	}
+
+	if e.Operator == "ne" {
+		for _, v := range values {
+			if compareValue(attribute, v, "eq", e.Value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, v := range values {
+		if compareValue(attribute, v, e.Operator, e.Value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func ordered(cmp int, operator string) bool {
+	switch operator {
+	case "eq":
+		return cmp == 0
+	case "gt":
+		return cmp > 0
+	case "ge":
+		return cmp >= 0
+	case "lt":
+		return cmp < 0
+	case "le":
+		return cmp <= 0
+	}
+	return false
+}
+
+func compareValue(attribute *Attribute, actual interface{}, operator string, expected interface{}) bool {
+	if b, ok := actual.(bool); ok {
+		e, ok := expected.(bool)
+		return ok && operator == "eq" && b == e
+	}
+
+	if a, ok := toNumber(actual); ok {
+		e, ok := toNumber(expected)
+		if !ok {
+			return false
+		}
+		switch {
+		case a < e:
+			return ordered(-1, operator)
+		case a > e:
+			return ordered(1, operator)
+		}
+		return ordered(0, operator)
+	}
+
+	a, ok := actual.(string)
+	e, ok2 := expected.(string)
+	if !ok || !ok2 {
+		return false
+	}
+
+	if attribute != nil && attribute.Type == "dateTime" {
+		at, err1 := time.Parse(time.RFC3339, a)
+		et, err2 := time.Parse(time.RFC3339, e)
+		if err1 == nil && err2 == nil {
+			switch operator {
+			case "eq", "gt", "ge", "lt", "le":
+				return ordered(at.Compare(et), operator)
+			}
+		}
+	}
+
+	if attribute == nil || !attribute.CaseExact {
+		a, e = strings.ToLower(a), strings.ToLower(e)
+	}
+
+	switch operator {
+	case "co":
+		return strings.Contains(a, e)
+	case "sw":
+		return strings.HasPrefix(a, e)
+	case "ew":
+		return strings.HasSuffix(a, e)
+	}
+
+	return ordered(strings.Compare(a, e), operator)
+}
@@ -0,0 +1,252 @@
+package scim
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	userName := AttributePath{Name: "userName"}
+
+	tests := []struct {
+		name   string
+		filter string
+		want   Expression
+	}{
+		{
+			"equality",
+			`userName eq "bjensen"`,
+			AttributeExpression{Path: userName, Operator: "eq", Value: "bjensen"},
+		},
+		{
+			"operator is case-insensitive",
+			`userName EQ "bjensen"`,
+			AttributeExpression{Path: userName, Operator: "eq", Value: "bjensen"},
+		},
+		{
+			"escaped string",
+			`userName eq "a \"quoted\" name"`,
+			AttributeExpression{Path: userName, Operator: "eq", Value: `a "quoted" name`},
+		},
+		{
+			"present",
+			`title pr`,
+			AttributeExpression{Path: AttributePath{Name: "title"}, Operator: "pr"},
+		},
+		{
+			"boolean, null and number values",
+			`active eq true and nickName eq null or meta.version gt 2.5`,
+			LogicalExpression{
+				Operator: "or",
+				Left: LogicalExpression{
+					Operator: "and",
+					Left:     AttributeExpression{Path: AttributePath{Name: "active"}, Operator: "eq", Value: true},
+					Right:    AttributeExpression{Path: AttributePath{Name: "nickName"}, Operator: "eq", Value: nil},
+				},
+				Right: AttributeExpression{Path: AttributePath{Name: "meta", Sub: "version"}, Operator: "gt", Value: 2.5},
+			},
+		},
+		{
+			"and binds tighter than or",
+			`a eq 1 or b eq 2 and c eq 3`,
+			LogicalExpression{
+				Operator: "or",
+				Left:     AttributeExpression{Path: AttributePath{Name: "a"}, Operator: "eq", Value: 1.0},
+				Right: LogicalExpression{
+					Operator: "and",
+					Left:     AttributeExpression{Path: AttributePath{Name: "b"}, Operator: "eq", Value: 2.0},
+					Right:    AttributeExpression{Path: AttributePath{Name: "c"}, Operator: "eq", Value: 3.0},
+				},
+			},
+		},
+		{
+			"parentheses and not",
+			`not (a eq 1 or b eq 2) and c pr`,
+			LogicalExpression{
+				Operator: "and",
+				Left: NotExpression{Expression: LogicalExpression{
+					Operator: "or",
+					Left:     AttributeExpression{Path: AttributePath{Name: "a"}, Operator: "eq", Value: 1.0},
+					Right:    AttributeExpression{Path: AttributePath{Name: "b"}, Operator: "eq", Value: 2.0},
+				}},
+				Right: AttributeExpression{Path: AttributePath{Name: "c"}, Operator: "pr"},
+			},
+		},
+		{
+			"value path",
+			`emails[type eq "work" and value co "@example.com"]`,
+			ValuePathExpression{
+				Path: AttributePath{Name: "emails"},
+				Filter: LogicalExpression{
+					Operator: "and",
+					Left:     AttributeExpression{Path: AttributePath{Name: "type"}, Operator: "eq", Value: "work"},
+					Right:    AttributeExpression{Path: AttributePath{Name: "value"}, Operator: "co", Value: "@example.com"},
+				},
+			},
+		},
+		{
+			"schema URI",
+			`urn:ietf:params:scim:schemas:core:2.0:User:userName sw "b"`,
+			AttributeExpression{
+				Path:     AttributePath{URI: "urn:ietf:params:scim:schemas:core:2.0:User", Name: "userName"},
+				Operator: "sw",
+				Value:    "b",
+			},
+		},
+		{
+			"extension attribute",
+			SchemaEnterpriseUser + `:department eq "Sales"`,
+			AttributeExpression{
+				Path:     AttributePath{URI: SchemaEnterpriseUser, Name: "department"},
+				Operator: "eq",
+				Value:    "Sales",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("ParseFilter: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilter =\n%#v\nwant\n%#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	filters := []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName like "b"`,
+		`userName eq bjensen`,
+		`userName eq "unterminated`,
+		`(userName eq "b"`,
+		`userName eq "b")`,
+		`not userName eq "b"`,
+		`emails[type eq "work"`,
+		`userName eq "b" and`,
+		`user..name eq "b"`,
+		`1name eq "b"`,
+		`userName eq "b" "c"`,
+	}
+
+	for _, filter := range filters {
+		t.Run(filter, func(t *testing.T) {
+			_, err := ParseFilter(filter)
+
+			var scimErr *Error
+			if !errors.As(err, &scimErr) {
+				t.Fatalf("ParseFilter = %v, want a SCIM error", err)
+			}
+			if scimErr.Status != 400 || scimErr.ScimType != ErrorInvalidFilter {
+				t.Errorf("ParseFilter = %d %s, want 400 %s", scimErr.Status, scimErr.ScimType, ErrorInvalidFilter)
+			}
+		})
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    *PatchPath
+		wantErr string
+	}{
+		{"attribute", "displayName", &PatchPath{Attribute: AttributePath{Name: "displayName"}}, ""},
+		{"sub-attribute", "name.givenName", &PatchPath{Attribute: AttributePath{Name: "name", Sub: "givenName"}}, ""},
+		{"whole extension", SchemaEnterpriseUser, &PatchPath{Attribute: AttributePath{URI: SchemaEnterpriseUser}}, ""},
+		{
+			"filtered values with a sub-attribute",
+			`emails[type eq "work"].value`,
+			&PatchPath{
+				Attribute: AttributePath{Name: "emails"},
+				Filter:    AttributeExpression{Path: AttributePath{Name: "type"}, Operator: "eq", Value: "work"},
+				Sub:       "value",
+			},
+			"",
+		},
+		{"empty", "", nil, ErrorInvalidPath},
+		{"trailing tokens", "displayName extra", nil, ErrorInvalidPath},
+		{"filter on a sub-attribute", `name.givenName[value eq "x"]`, nil, ErrorInvalidPath},
+		{"invalid sub-attribute after filter", `emails[type eq "work"]value`, nil, ErrorInvalidPath},
+		{"invalid filter", `emails[type zz "work"]`, nil, ErrorInvalidFilter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePath(tt.path)
+
+			if tt.wantErr != "" {
+				var scimErr *Error
+				if !errors.As(err, &scimErr) || scimErr.ScimType != tt.wantErr {
+					t.Fatalf("ParsePath = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParsePath: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePath =\n%#v\nwant\n%#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	resource := Resource{
+		"userName": "BJensen",
+		"active":   true,
+		"name":     map[string]interface{}{"givenName": "Barbara"},
+		"emails": []interface{}{
+			map[string]interface{}{"type": "work", "value": "bjensen@example.com"},
+			map[string]interface{}{"type": "home", "value": "babs@jensen.org"},
+		},
+		"meta":               map[string]interface{}{"lastModified": "2024-05-01T10:00:00Z"},
+		SchemaEnterpriseUser: map[string]interface{}{"department": "Sales"},
+	}
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "bjensen"`, true},
+		{`userName ne "bjensen"`, false},
+		{`userName sw "bj" and userName ew "sen"`, true},
+		{`name.givenName co "arb"`, true},
+		{`active eq true`, true},
+		{`active eq false`, false},
+		{`title pr`, false},
+		{`title eq null`, true},
+		{`not (title pr)`, true},
+		{`emails co "jensen.org"`, true},
+		{`emails[type eq "work" and value ew "jensen.org"]`, false},
+		{`emails[type eq "home" and value ew "jensen.org"]`, true},
+		{`emails.type eq "home"`, true},
+		{`meta.lastModified gt "2024-01-01T00:00:00Z"`, true},
+		{`meta.lastModified lt "2024-01-01T00:00:00+00:00"`, false},
+		{SchemaEnterpriseUser + `:department eq "sales"`, true},
+		{`userName eq "nobody" or active eq true`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			filter, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("ParseFilter: %v", err)
+			}
+
+			if got := UserResourceType.Match(resource, filter); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
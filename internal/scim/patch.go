@@ -0,0 +1,585 @@
+package scim
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// Normalize converts any JSON-serializable value into a Resource made only of
+// JSON types (maps, slices, strings, float64 and bool), which the filter and
+// PATCH code expect
+func Normalize(value interface{}) (Resource, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var resource Resource
+	if err := json.Unmarshal(data, &resource); err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// container returns the object holding the attributes of a schema: the
+// resource itself for the core schema, or the extension object
+func (rt *ResourceType) container(resource Resource, uri string, create bool) map[string]interface{} {
+	if uri == "" || strings.EqualFold(uri, rt.Schema.ID) {
+		return resource
+	}
+
+	schema := rt.extension(uri)
+	if schema == nil {
+		return nil
+	}
+
+	if _, value, ok := lookup(resource, schema.ID); ok {
+		if object, ok := value.(map[string]interface{}); ok {
+			return object
+		}
+	}
+
+	if !create {
+		return nil
+	}
+
+	object := map[string]interface{}{}
+	resource[schema.ID] = object
+
+	schemas := asList(resource["schemas"])
+	if !containsFold(stringList(schemas), schema.ID) {
+		resource["schemas"] = append(schemas, schema.ID)
+	}
+
+	return object
+}
+
+func stringList(values []interface{}) []string {
+	var list []string
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// ApplyPatch applies the operations of a PATCH request to a resource, in order
+func (rt *ResourceType) ApplyPatch(resource Resource, request *PatchRequest) error {
+	if !containsFold(request.Schemas, MessagePatchOp) {
+		return NewError(400, ErrorInvalidSyntax, "PATCH requests must use the %s schema", MessagePatchOp)
+	}
+
+	for _, operation := range request.Operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return NewError(400, ErrorInvalidSyntax, "unknown operation %q", operation.Op)
+		}
+
+		if operation.Path != "" {
+			path, err := ParsePath(operation.Path)
+			if err != nil {
+				return err
+			}
+			if err := rt.apply(resource, op, path, operation.Value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if op == "remove" {
+			return NewError(400, ErrorNoTarget, "remove operations require a path")
+		}
+
+		// Sem path, o valor é um objeto com os atributos a alterar
+		object, ok := operation.Value.(map[string]interface{})
+		if !ok {
+			return NewError(400, ErrorInvalidSyntax, "operations without a path need an object value")
+		}
+
+		for key, value := range object {
+			if strings.EqualFold(key, "schemas") {
+				continue
+			}
+
+			path, err := ParsePath(key)
+			if err != nil {
+				return err
+			}
+			if err := rt.apply(resource, op, path, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (rt *ResourceType) apply(resource Resource, op string, path *PatchPath, value interface{}) error {
+	target := path.Attribute
+
+	// O path pode apontar para a extensão inteira
+	if target.Name == "" {
+		schema := rt.extension(target.URI)
+		if schema == nil {
+			return NewError(400, ErrorInvalidPath, "unknown schema %s", target.URI)
+		}
+
+		if op == "remove" {
+			if key, _, ok := lookup(resource, schema.ID); ok {
+				delete(resource, key)
+			}
+			return nil
+		}
+
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return NewError(400, ErrorInvalidValue, "%s must be an object", schema.ID)
+		}
+
+		for key, v := range object {
+			attribute, err := parseAttributePath(key, ErrorInvalidPath)
+			if err != nil {
+				return err
+			}
+			attribute.URI = schema.ID
+			if err := rt.apply(resource, op, &PatchPath{Attribute: attribute}, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	attribute := rt.Attribute(target)
+	if attribute == nil {
+		return NewError(400, ErrorInvalidPath, "unknown attribute %s", target)
+	}
+
+	sub := target.Sub
+	if path.Sub != "" {
+		sub = path.Sub
+	}
+	if sub != "" && attribute.SubAttribute(sub) == nil {
+		return NewError(400, ErrorInvalidPath, "unknown attribute %s.%s", attribute.Name, sub)
+	}
+
+	container := rt.container(resource, target.URI, op != "remove")
+	if container == nil {
+		return nil
+	}
+
+	key, current, exists := lookup(container, target.Name)
+	if !exists {
+		key = attribute.Name
+	}
+
+	if attribute.Mutability == "readOnly" {
+		// Alguns clientes reenviam o id junto das alterações; o mesmo valor é ignorado
+		if op != "remove" && path.Filter == nil && sub == "" && reflect.DeepEqual(current, value) {
+			return nil
+		}
+		return NewError(400, ErrorMutability, "attribute %s is read-only", attribute.Name)
+	}
+
+	if path.Filter != nil {
+		if !attribute.MultiValued {
+			return NewError(400, ErrorInvalidPath, "attribute %s is not multi-valued", attribute.Name)
+		}
+		return applyFiltered(container, key, attribute, current, op, path.Filter, sub, value)
+	}
+
+	if attribute.MultiValued {
+		return applyMultiValued(container, key, current, op, sub, value)
+	}
+
+	if sub != "" {
+		object, _ := current.(map[string]interface{})
+		if object == nil {
+			object = map[string]interface{}{}
+		}
+
+		subKey, _, ok := lookup(object, sub)
+		if !ok {
+			subKey = attribute.SubAttribute(sub).Name
+		}
+
+		if op == "remove" {
+			delete(object, subKey)
+		} else {
+			object[subKey] = value
+		}
+
+		container[key] = object
+		return nil
+	}
+
+	if op == "remove" {
+		delete(container, key)
+		return nil
+	}
+
+	// Atributos complexos são mesclados: sub-atributos omitidos continuam como estão
+	if object, ok := value.(map[string]interface{}); ok && attribute.Type == "complex" {
+		existing, _ := current.(map[string]interface{})
+		if existing == nil {
+			existing = map[string]interface{}{}
+		}
+		merge(existing, object)
+		container[key] = existing
+		return nil
+	}
+
+	container[key] = value
+	return nil
+}
+
+func merge(target, source map[string]interface{}) {
+	for name, value := range source {
+		if key, _, ok := lookup(target, name); ok {
+			delete(target, key)
+		}
+		target[name] = value
+	}
+}
+
+func setList(container map[string]interface{}, key string, list []interface{}) {
+	if len(list) == 0 {
+		delete(container, key)
+		return
+	}
+	container[key] = list
+}
+
+// sameValue compares values of a multi-valued attribute, by their "value" sub-attribute when they have one
+func sameValue(a, b interface{}) bool {
+	objectA, okA := a.(map[string]interface{})
+	objectB, okB := b.(map[string]interface{})
+
+	if okA && okB {
+		_, valueA, hasA := lookup(objectA, "value")
+		_, valueB, hasB := lookup(objectB, "value")
+		if hasA && hasB {
+			return reflect.DeepEqual(valueA, valueB)
+		}
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func isPrimary(value interface{}) bool {
+	if object, ok := value.(map[string]interface{}); ok {
+		_, primary, _ := lookup(object, "primary")
+		return primary == true
+	}
+	return false
+}
+
+func applyMultiValued(container map[string]interface{}, key string, current interface{}, op, sub string, value interface{}) error {
+	list := asList(current)
+
+	if sub != "" {
+		for _, element := range list {
+			if object, ok := element.(map[string]interface{}); ok {
+				if subKey, _, found := lookup(object, sub); found {
+					delete(object, subKey)
+				}
+				if op != "remove" {
+					object[sub] = value
+				}
+			}
+		}
+		return nil
+	}
+
+	switch op {
+	case "remove":
+		// Sem filtro, um valor indica quais elementos remover (como faz o Azure AD)
+		if value == nil {
+			delete(container, key)
+			return nil
+		}
+
+		var kept []interface{}
+		for _, element := range list {
+			removed := false
+			for _, target := range asList(value) {
+				removed = removed || sameValue(element, target)
+			}
+			if !removed {
+				kept = append(kept, element)
+			}
+		}
+		setList(container, key, kept)
+	case "add":
+		for _, added := range asList(value) {
+			exists := false
+			for _, element := range list {
+				exists = exists || sameValue(element, added)
+			}
+			if exists {
+				continue
+			}
+
+			// Só um valor pode ser o primário
+			if isPrimary(added) {
+				for _, element := range list {
+					if object, ok := element.(map[string]interface{}); ok {
+						if primaryKey, _, found := lookup(object, "primary"); found {
+							object[primaryKey] = false
+						}
+					}
+				}
+			}
+
+			list = append(list, added)
+		}
+		setList(container, key, list)
+	case "replace":
+		setList(container, key, asList(value))
+	}
+
+	return nil
+}
+
+// equalities returns the attribute values fixed by a filter made only of eq
+// comparisons joined by "and", used to create the value a filtered path targets
+func equalities(filter Expression) (map[string]interface{}, bool) {
+	switch e := filter.(type) {
+	case AttributeExpression:
+		if e.Operator != "eq" || e.Path.Sub != "" || e.Value == nil {
+			return nil, false
+		}
+		return map[string]interface{}{e.Path.Name: e.Value}, true
+	case LogicalExpression:
+		if e.Operator != "and" {
+			return nil, false
+		}
+		left, ok := equalities(e.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := equalities(e.Right)
+		if !ok {
+			return nil, false
+		}
+		merge(left, right)
+		return left, true
+	}
+	return nil, false
+}
+
+func applyFiltered(container map[string]interface{}, key string, attribute *Attribute, current interface{}, op string, filter Expression, sub string, value interface{}) error {
+	var kept []interface{}
+	matched := false
+
+	for _, element := range asList(current) {
+		object, ok := element.(map[string]interface{})
+		if !ok || !elementMatcher(attribute, object).match(filter) {
+			kept = append(kept, element)
+			continue
+		}
+
+		matched = true
+
+		switch {
+		case op == "remove" && sub == "":
+			continue
+		case op == "remove":
+			if subKey, _, found := lookup(object, sub); found {
+				delete(object, subKey)
+			}
+		case sub != "":
+			if subKey, _, found := lookup(object, sub); found {
+				delete(object, subKey)
+			}
+			object[sub] = value
+		default:
+			replacement, ok := value.(map[string]interface{})
+			if !ok {
+				return NewError(400, ErrorInvalidValue, "value for %s must be an object", attribute.Name)
+			}
+			if op == "replace" {
+				object = map[string]interface{}{}
+			}
+			merge(object, replacement)
+		}
+
+		kept = append(kept, object)
+	}
+
+	if !matched {
+		if op == "remove" {
+			return NewError(400, ErrorNoTarget, "no value of %s matches the filter", attribute.Name)
+		}
+
+		// Clientes como o Azure AD usam "emails[type eq \"work\"].value" para criar o valor
+		object, ok := equalities(filter)
+		if !ok {
+			return NewError(400, ErrorNoTarget, "no value of %s matches the filter", attribute.Name)
+		}
+
+		if sub != "" {
+			object[sub] = value
+		} else if replacement, ok := value.(map[string]interface{}); ok {
+			merge(object, replacement)
+		} else {
+			return NewError(400, ErrorInvalidValue, "value for %s must be an object", attribute.Name)
+		}
+
+		kept = append(kept, object)
+	}
+
+	setList(container, key, kept)
+	return nil
+}
+
+// Project applies the attributes and excludedAttributes parameters. The id
+// and schemas are always returned.
+func (rt *ResourceType) Project(resource Resource, attributes, excluded []string) Resource {
+	if len(attributes) == 0 && len(excluded) == 0 {
+		return resource
+	}
+
+	copied, err := Normalize(resource)
+	if err != nil {
+		return resource
+	}
+
+	if len(attributes) > 0 {
+		projected := Resource{"schemas": copied["schemas"], "id": copied["id"]}
+
+		for _, name := range attributes {
+			path, err := parseAttributePath(name, ErrorInvalidPath)
+			if err != nil {
+				continue
+			}
+
+			source := rt.container(copied, path.URI, false)
+			if source == nil {
+				continue
+			}
+
+			if path.Name == "" {
+				if key, value, ok := lookup(copied, path.URI); ok {
+					projected[key] = value
+				}
+				continue
+			}
+
+			key, value, ok := lookup(source, path.Name)
+			if !ok {
+				continue
+			}
+
+			target := rt.container(projected, path.URI, true)
+			if path.Sub == "" {
+				target[key] = value
+				continue
+			}
+
+			target[key] = keepSub(value, path.Sub, target[key])
+		}
+
+		return projected
+	}
+
+	for _, name := range excluded {
+		path, err := parseAttributePath(name, ErrorInvalidPath)
+		if err != nil {
+			continue
+		}
+
+		if attribute := rt.Attribute(path); attribute != nil && attribute.Returned == "always" {
+			continue
+		}
+
+		if path.Name == "" {
+			if key, _, ok := lookup(copied, path.URI); ok {
+				delete(copied, key)
+			}
+			continue
+		}
+
+		source := rt.container(copied, path.URI, false)
+		if source == nil {
+			continue
+		}
+
+		key, value, ok := lookup(source, path.Name)
+		if !ok {
+			continue
+		}
+
+		if path.Sub == "" {
+			delete(source, key)
+			continue
+		}
+
+		for _, element := range asList(value) {
+			if object, ok := element.(map[string]interface{}); ok {
+				if subKey, _, found := lookup(object, path.Sub); found {
+					delete(object, subKey)
+				}
+			}
+		}
+	}
+
+	return copied
+}
+
+// keepSub copies one sub-attribute of a complex value into what was already projected
+func keepSub(value interface{}, sub string, projected interface{}) interface{} {
+	if object, ok := value.(map[string]interface{}); ok {
+		target, _ := projected.(map[string]interface{})
+		if target == nil {
+			target = map[string]interface{}{}
+		}
+		if key, v, found := lookup(object, sub); found {
+			target[key] = v
+		}
+		return target
+	}
+
+	list := asList(value)
+	previous := asList(projected)
+	result := make([]interface{}, len(list))
+
+	for i, element := range list {
+		target := map[string]interface{}{}
+		if i < len(previous) {
+			if object, ok := previous[i].(map[string]interface{}); ok {
+				target = object
+			}
+		}
+		if object, ok := element.(map[string]interface{}); ok {
+			if key, v, found := lookup(object, sub); found {
+				target[key] = v
+			}
+		}
+		result[i] = target
+	}
+
+	return result
+}
@@ -0,0 +1,408 @@
+package scim
+
+import "strings"
+
+// Attribute describes a schema attribute (RFC 7643 section 7)
+type Attribute struct {
+	Name           string       `json:"name"`
+	Type           string       `json:"type"`
+	MultiValued    bool         `json:"multiValued"`
+	Description    string       `json:"description,omitempty"`
+	Required       bool         `json:"required"`
+	CaseExact      bool         `json:"caseExact"`
+	Mutability     string       `json:"mutability"`
+	Returned       string       `json:"returned"`
+	Uniqueness     string       `json:"uniqueness"`
+	ReferenceTypes []string     `json:"referenceTypes,omitempty"`
+	SubAttributes  []*Attribute `json:"subAttributes,omitempty"`
+}
+
+func (a *Attribute) SubAttribute(name string) *Attribute {
+	return findAttribute(a.SubAttributes, name)
+}
+
+type Schema struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Attributes  []*Attribute `json:"attributes"`
+}
+
+// ResourceType ties an endpoint to its core schema and extensions
+type ResourceType struct {
+	ID         string
+	Name       string
+	Endpoint   string
+	Schema     *Schema
+	Extensions []*Schema
+}
+
+func findAttribute(attributes []*Attribute, name string) *Attribute {
+	for _, attribute := range attributes {
+		if strings.EqualFold(attribute.Name, name) {
+			return attribute
+		}
+	}
+	return nil
+}
+
+// extension returns the extension schema with the given URI
+func (rt *ResourceType) extension(uri string) *Schema {
+	for _, schema := range rt.Extensions {
+		if strings.EqualFold(schema.ID, uri) {
+			return schema
+		}
+	}
+	return nil
+}
+
+// Attribute returns the definition of the top-level attribute of a path, or nil when it is unknown
+func (rt *ResourceType) Attribute(path AttributePath) *Attribute {
+	if path.URI != "" && !strings.EqualFold(path.URI, rt.Schema.ID) {
+		if schema := rt.extension(path.URI); schema != nil {
+			return findAttribute(schema.Attributes, path.Name)
+		}
+		return nil
+	}
+
+	if attribute := findAttribute(commonAttributes, path.Name); attribute != nil {
+		return attribute
+	}
+
+	return findAttribute(rt.Schema.Attributes, path.Name)
+}
+
+func simple(name, kind string, caseExact bool, mutability string) *Attribute {
+	return &Attribute{Name: name, Type: kind, CaseExact: caseExact, Mutability: mutability, Returned: "default", Uniqueness: "none"}
+}
+
+func multiValued(name string, subAttributes ...*Attribute) *Attribute {
+	return &Attribute{Name: name, Type: "complex", MultiValued: true, Mutability: "readWrite", Returned: "default", Uniqueness: "none", SubAttributes: subAttributes}
+}
+
+// Sub-atributos padrão de atributos multivalorados como emails e phoneNumbers
+func typedValue() []*Attribute {
+	return []*Attribute{
+		simple("value", "string", false, "readWrite"),
+		simple("display", "string", false, "readWrite"),
+		simple("type", "string", false, "readWrite"),
+		simple("primary", "boolean", false, "readWrite"),
+	}
+}
+
+func reference(mutability string, referenceTypes ...string) []*Attribute {
+	ref := simple("$ref", "reference", false, mutability)
+	ref.ReferenceTypes = referenceTypes
+
+	return []*Attribute{
+		simple("value", "string", true, mutability),
+		ref,
+		simple("display", "string", false, "readOnly"),
+		simple("type", "string", false, mutability),
+	}
+}
+
+var commonAttributes = []*Attribute{
+	{Name: "id", Type: "string", CaseExact: true, Mutability: "readOnly", Returned: "always", Uniqueness: "server"},
+	simple("externalId", "string", true, "readWrite"),
+	{Name: "meta", Type: "complex", Mutability: "readOnly", Returned: "default", Uniqueness: "none", SubAttributes: []*Attribute{
+		simple("resourceType", "string", true, "readOnly"),
+		simple("created", "dateTime", false, "readOnly"),
+		simple("lastModified", "dateTime", false, "readOnly"),
+		simple("location", "reference", true, "readOnly"),
+		simple("version", "string", true, "readOnly"),
+	}},
+}
+
+var UserSchema = &Schema{
+	ID:          SchemaUser,
+	Name:        "User",
+	Description: "User Account",
+	Attributes: []*Attribute{
+		{Name: "userName", Type: "string", Required: true, Mutability: "readWrite", Returned: "default", Uniqueness: "server"},
+		{Name: "name", Type: "complex", Mutability: "readWrite", Returned: "default", Uniqueness: "none", SubAttributes: []*Attribute{
+			simple("formatted", "string", false, "readWrite"),
+			simple("familyName", "string", false, "readWrite"),
+			simple("givenName", "string", false, "readWrite"),
+			simple("middleName", "string", false, "readWrite"),
+			simple("honorificPrefix", "string", false, "readWrite"),
+			simple("honorificSuffix", "string", false, "readWrite"),
+		}},
+		simple("displayName", "string", false, "readWrite"),
+		simple("nickName", "string", false, "readWrite"),
+		simple("profileUrl", "reference", false, "readWrite"),
+		simple("title", "string", false, "readWrite"),
+		simple("userType", "string", false, "readWrite"),
+		simple("preferredLanguage", "string", false, "readWrite"),
+		simple("locale", "string", false, "readWrite"),
+		simple("timezone", "string", false, "readWrite"),
+		simple("active", "boolean", false, "readWrite"),
+		{Name: "password", Type: "string", Mutability: "writeOnly", Returned: "never", Uniqueness: "none"},
+		multiValued("emails", typedValue()...),
+		multiValued("phoneNumbers", typedValue()...),
+		multiValued("ims", typedValue()...),
+		multiValued("photos", typedValue()...),
+		multiValued("addresses",
+			simple("formatted", "string", false, "readWrite"),
+			simple("streetAddress", "string", false, "readWrite"),
+			simple("locality", "string", false, "readWrite"),
+			simple("region", "string", false, "readWrite"),
+			simple("postalCode", "string", false, "readWrite"),
+			simple("country", "string", false, "readWrite"),
+			simple("type", "string", false, "readWrite"),
+			simple("primary", "boolean", false, "readWrite"),
+		),
+		{Name: "groups", Type: "complex", MultiValued: true, Mutability: "readOnly", Returned: "default", Uniqueness: "none", SubAttributes: reference("readOnly", "Group")},
+		multiValued("entitlements", typedValue()...),
+		multiValued("roles", typedValue()...),
+	},
+}
+
+var EnterpriseUserSchema = &Schema{
+	ID:          SchemaEnterpriseUser,
+	Name:        "EnterpriseUser",
+	Description: "Enterprise User",
+	Attributes: []*Attribute{
+		simple("employeeNumber", "string", false, "readWrite"),
+		simple("costCenter", "string", false, "readWrite"),
+		simple("organization", "string", false, "readWrite"),
+		simple("division", "string", false, "readWrite"),
+		simple("department", "string", false, "readWrite"),
+		{Name: "manager", Type: "complex", Mutability: "readWrite", Returned: "default", Uniqueness: "none", SubAttributes: []*Attribute{
+			simple("value", "string", true, "readWrite"),
+			{Name: "$ref", Type: "reference", Mutability: "readWrite", Returned: "default", Uniqueness: "none", ReferenceTypes: []string{"User"}},
+			simple("displayName", "string", false, "readOnly"),
+		}},
+	},
+}
+
+var GroupSchema = &Schema{
+	ID:          SchemaGroup,
+	Name:        "Group",
+	Description: "Group",
+	Attributes: []*Attribute{
+		{Name: "displayName", Type: "string", Required: true, Mutability: "readWrite", Returned: "default", Uniqueness: "server"},
+		{Name: "members", Type: "complex", MultiValued: true, Mutability: "readWrite", Returned: "default", Uniqueness: "none", SubAttributes: reference("immutable", "User", "Group")},
+	},
+}
+
+var (
+	UserResourceType = &ResourceType{
+		ID:         "User",
+		Name:       "User",
+		Endpoint:   "/Users",
+		Schema:     UserSchema,
+		Extensions: []*Schema{EnterpriseUserSchema},
+	}
+
+	GroupResourceType = &ResourceType{
+		ID:       "Group",
+		Name:     "Group",
+		Endpoint: "/Groups",
+		Schema:   GroupSchema,
+	}
+
+	ResourceTypes = []*ResourceType{UserResourceType, GroupResourceType}
+	Schemas       = []*Schema{UserSchema, EnterpriseUserSchema, GroupSchema}
+)
+
+// SchemaResource returns the representation of a schema served on /Schemas
+func SchemaResource(schema *Schema, baseURL string) Resource {
+	return Resource{
+		"schemas":     []string{SchemaSchema},
+		"id":          schema.ID,
+		"name":        schema.Name,
+		"description": schema.Description,
+		"attributes":  schema.Attributes,
+		"meta": map[string]interface{}{
+			"resourceType": "Schema",
+			"location":     baseURL + "/Schemas/" + schema.ID,
+		},
+	}
+}
+
+// ResourceTypeResource returns the representation of a resource type served on /ResourceTypes
+func ResourceTypeResource(rt *ResourceType, baseURL string) Resource {
+	extensions := []map[string]interface{}{}
+	for _, extension := range rt.Extensions {
+		extensions = append(extensions, map[string]interface{}{"schema": extension.ID, "required": false})
+	}
+
+	return Resource{
+		"schemas":          []string{SchemaResourceType},
+		"id":               rt.ID,
+		"name":             rt.Name,
+		"endpoint":         rt.Endpoint,
+		"schema":           rt.Schema.ID,
+		"schemaExtensions": extensions,
+		"meta": map[string]interface{}{
+			"resourceType": "ResourceType",
+			"location":     baseURL + "/ResourceTypes/" + rt.ID,
+		},
+	}
+}
+
+// ServiceProviderConfig describes the supported features and limits
+type ServiceProviderConfig struct {
+	BaseURL           string
+	MaxResults        int
+	BulkMaxOperations int
+	BulkMaxPayload    int
+}
+
+func (c *ServiceProviderConfig) Resource() Resource {
+	return Resource{
+		"schemas":          []string{SchemaServiceProviderConfig},
+		"documentationUri": "",
+		"patch":            map[string]interface{}{"supported": true},
+		"bulk": map[string]interface{}{
+			"supported":      true,
+			"maxOperations":  c.BulkMaxOperations,
+			"maxPayloadSize": c.BulkMaxPayload,
+		},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": c.MaxResults},
+		"changePassword": map[string]interface{}{"supported": true},
+		"sort":           map[string]interface{}{"supported": false},
+		"etag":           map[string]interface{}{"supported": true},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "SCIM bearer token issued by a whoami administrator",
+			"primary":     true,
+		}},
+		"meta": map[string]interface{}{
+			"resourceType": "ServiceProviderConfig",
+			"location":     c.BaseURL + "/ServiceProviderConfig",
+		},
+	}
+}
+
+// Canonicalize validates a resource sent by a client and returns its
+// writable attributes under their canonical names. Unknown and read-only
+// attributes are dropped, as RFC 7644 asks of POST and PUT.
+func (rt *ResourceType) Canonicalize(resource Resource) (Resource, error) {
+	canonical := Resource{}
+
+	for key, value := range resource {
+		if strings.EqualFold(key, "schemas") {
+			continue
+		}
+
+		if schema := rt.extension(key); schema != nil {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, NewError(400, ErrorInvalidValue, "%s must be an object", schema.ID)
+			}
+
+			extension, err := canonicalAttributes(schema.Attributes, object)
+			if err != nil {
+				return nil, err
+			}
+			if len(extension) > 0 {
+				canonical[schema.ID] = extension
+			}
+			continue
+		}
+
+		attribute := rt.Attribute(AttributePath{Name: key})
+		if attribute == nil || attribute.Mutability == "readOnly" {
+			continue
+		}
+
+		checked, err := checkValue(attribute, value)
+		if err != nil {
+			return nil, err
+		}
+		if checked != nil {
+			canonical[attribute.Name] = checked
+		}
+	}
+
+	for _, attribute := range rt.Schema.Attributes {
+		if _, ok := canonical[attribute.Name]; attribute.Required && !ok {
+			return nil, NewError(400, ErrorInvalidValue, "%s is required", attribute.Name)
+		}
+	}
+
+	return canonical, nil
+}
+
+func canonicalAttributes(attributes []*Attribute, object map[string]interface{}) (map[string]interface{}, error) {
+	canonical := map[string]interface{}{}
+
+	for key, value := range object {
+		attribute := findAttribute(attributes, key)
+		if attribute == nil || attribute.Mutability == "readOnly" {
+			continue
+		}
+
+		checked, err := checkValue(attribute, value)
+		if err != nil {
+			return nil, err
+		}
+		if checked != nil {
+			canonical[attribute.Name] = checked
+		}
+	}
+
+	return canonical, nil
+}
+
+// checkValue validates a value against its attribute type. Booleans sent as
+// strings ("True"), as some clients do, are converted.
+func checkValue(attribute *Attribute, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	if attribute.MultiValued {
+		var values []interface{}
+		single := *attribute
+		single.MultiValued = false
+
+		for _, element := range asList(value) {
+			checked, err := checkValue(&single, element)
+			if err != nil {
+				return nil, err
+			}
+			if checked != nil {
+				values = append(values, checked)
+			}
+		}
+
+		if len(values) == 0 {
+			return nil, nil
+		}
+		return values, nil
+	}
+
+	switch attribute.Type {
+	case "complex":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, NewError(400, ErrorInvalidValue, "%s must be an object", attribute.Name)
+		}
+		return canonicalAttributes(attribute.SubAttributes, object)
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if strings.EqualFold(v, "true") || strings.EqualFold(v, "false") {
+				return strings.EqualFold(v, "true"), nil
+			}
+		}
+		return nil, NewError(400, ErrorInvalidValue, "%s must be a boolean", attribute.Name)
+	case "integer", "decimal":
+		if _, ok := toNumber(value); !ok {
+			return nil, NewError(400, ErrorInvalidValue, "%s must be a number", attribute.Name)
+		}
+		return value, nil
+	}
+
+	if _, ok := value.(string); !ok {
+		return nil, NewError(400, ErrorInvalidValue, "%s must be a string", attribute.Name)
+	}
+
+	return value, nil
+}
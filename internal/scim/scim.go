@@ -0,0 +1,216 @@
+// Package scim implements the protocol side of SCIM 2.0 (RFC 7643 and RFC
+// 7644) for the whoami provisioning API: schemas, filters, PATCH operations,
+// list and bulk messages and errors. Resources are handled as generic JSON
+// objects; mapping them onto whoami models is up to the caller.
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaEnterpriseUser        = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	SchemaSchema                = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+
+	MessageListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	MessagePatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	MessageBulkRequest  = "urn:ietf:params:scim:api:messages:2.0:BulkRequest"
+	MessageBulkResponse = "urn:ietf:params:scim:api:messages:2.0:BulkResponse"
+	MessageError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	ContentType = "application/scim+json"
+)
+
+// Detail error types (RFC 7644 section 3.12)
+const (
+	ErrorInvalidFilter  = "invalidFilter"
+	ErrorTooMany        = "tooMany"
+	ErrorUniqueness     = "uniqueness"
+	ErrorMutability     = "mutability"
+	ErrorInvalidSyntax  = "invalidSyntax"
+	ErrorInvalidPath    = "invalidPath"
+	ErrorNoTarget       = "noTarget"
+	ErrorInvalidValue   = "invalidValue"
+	ErrorInvalidVersion = "invalidVers"
+)
+
+// Error is a SCIM error response. Services return it for anything the client
+// did wrong; it serializes to the error message schema.
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func NewError(status int, scimType, format string, args ...interface{}) *Error {
+	return &Error{Status: status, ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	body := map[string]interface{}{
+		"schemas": []string{MessageError},
+		"status":  strconv.Itoa(e.Status),
+		"detail":  e.Detail,
+	}
+	if e.ScimType != "" {
+		body["scimType"] = e.ScimType
+	}
+	return json.Marshal(body)
+}
+
+// Resource is a SCIM resource as a JSON object
+type Resource map[string]interface{}
+
+type ListResponse struct {
+	Schemas      []string   `json:"schemas"`
+	TotalResults int        `json:"totalResults"`
+	StartIndex   int        `json:"startIndex"`
+	ItemsPerPage int        `json:"itemsPerPage"`
+	Resources    []Resource `json:"Resources"`
+}
+
+// Query holds the list parameters of a GET on a resource endpoint
+type Query struct {
+	Filter             Expression
+	StartIndex         int
+	Count              int
+	Attributes         []string
+	ExcludedAttributes []string
+}
+
+func splitAttributes(value string) []string {
+	var attributes []string
+	for _, attribute := range strings.Split(value, ",") {
+		if attribute = strings.TrimSpace(attribute); attribute != "" {
+			attributes = append(attributes, attribute)
+		}
+	}
+	return attributes
+}
+
+// ParseQuery reads the filter, pagination and projection parameters. Count
+// defaults to, and is capped at, maxResults.
+func ParseQuery(values url.Values, maxResults int) (*Query, error) {
+	query := &Query{
+		StartIndex:         1,
+		Count:              maxResults,
+		Attributes:         splitAttributes(values.Get("attributes")),
+		ExcludedAttributes: splitAttributes(values.Get("excludedAttributes")),
+	}
+
+	if filter := values.Get("filter"); filter != "" {
+		expression, err := ParseFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		query.Filter = expression
+	}
+
+	// Valores fora do intervalo são ajustados, como pede a RFC 7644
+	if value := values.Get("startIndex"); value != "" {
+		startIndex, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, NewError(400, ErrorInvalidValue, "startIndex must be an integer")
+		}
+		if startIndex > 1 {
+			query.StartIndex = startIndex
+		}
+	}
+
+	if value := values.Get("count"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, NewError(400, ErrorInvalidValue, "count must be an integer")
+		}
+		if count < 0 {
+			count = 0
+		}
+		if count < maxResults {
+			query.Count = count
+		}
+	}
+
+	return query, nil
+}
+
+// Page slices the matching resources according to the query and wraps them in a ListResponse
+func (q *Query) Page(resources []Resource) *ListResponse {
+	response := &ListResponse{
+		Schemas:      []string{MessageListResponse},
+		TotalResults: len(resources),
+		StartIndex:   q.StartIndex,
+		Resources:    []Resource{},
+	}
+
+	start := q.StartIndex - 1
+	if start > len(resources) {
+		start = len(resources)
+	}
+
+	end := start + q.Count
+	if end > len(resources) {
+		end = len(resources)
+	}
+
+	response.Resources = append(response.Resources, resources[start:end]...)
+	response.ItemsPerPage = len(response.Resources)
+
+	return response
+}
+
+// ETag returns the weak entity tag of a resource last modified at the given time
+func ETag(lastModified time.Time) string {
+	return fmt.Sprintf(`W/"%d"`, lastModified.UnixNano())
+}
+
+// Meta builds the meta attribute of a resource
+func Meta(resourceType, location string, created, lastModified time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"resourceType": resourceType,
+		"created":      created.UTC().Format(time.RFC3339),
+		"lastModified": lastModified.UTC().Format(time.RFC3339),
+		"location":     location,
+		"version":      ETag(lastModified),
+	}
+}
+
+type BulkOperation struct {
+	Method  string          `json:"method"`
+	BulkID  string          `json:"bulkId,omitempty"`
+	Version string          `json:"version,omitempty"`
+	Path    string          `json:"path"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+type BulkRequest struct {
+	Schemas      []string        `json:"schemas"`
+	FailOnErrors int             `json:"failOnErrors,omitempty"`
+	Operations   []BulkOperation `json:"Operations"`
+}
+
+type BulkOperationResult struct {
+	Method   string      `json:"method"`
+	BulkID   string      `json:"bulkId,omitempty"`
+	Version  string      `json:"version,omitempty"`
+	Location string      `json:"location,omitempty"`
+	Status   string      `json:"status"`
+	Response interface{} `json:"response,omitempty"`
+}
+
+type BulkResponse struct {
+	Schemas    []string              `json:"schemas"`
+	Operations []BulkOperationResult `json:"Operations"`
+}
@@ -0,0 +1,736 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"gorm.io/gorm"
+)
+
+const (
+	AccessRequestPending   = "pending"
+	AccessRequestApproved  = "approved"
+	AccessRequestDenied    = "denied"
+	AccessRequestCancelled = "cancelled"
+	AccessRequestExpired   = "expired"
+
+	// Ações registradas no histórico de um pedido
+	accessRequestRequested = "requested"
+	accessRequestApproval  = "approved"
+	accessRequestDenial    = "denied"
+	accessRequestCancel    = "cancelled"
+	accessRequestGrant     = "granted"
+)
+
+var (
+	ErrAccessRequestNotFound   = errors.New("access request not found")
+	ErrAccessRequestClosed     = errors.New("access request was already decided, cancelled or expired")
+	ErrAccessRequestDuplicated = errors.New("there is already a pending request for this role")
+	ErrRoleNotRequestable      = errors.New("role has no approval policy and can't be requested")
+	ErrRoleAlreadyHeld         = errors.New("role is already assigned without expiry")
+	ErrRoleScheduled           = errors.New("role is assigned from a date after the requested access would end")
+	ErrInvalidAccessDuration   = errors.New("duration must be positive and within the maximum of the role")
+	ErrJustificationRequired   = errors.New("a justification is required")
+	ErrInvalidApprovalPolicy   = errors.New("an approval policy needs at least one approver or approver group")
+	ErrNotApprover             = errors.New("not an approver of this role")
+	ErrSelfApproval            = errors.New("requesters can't decide their own requests")
+	ErrAlreadyApproved         = errors.New("request already approved by this approver")
+	ErrNotRequester            = errors.New("only the requester can cancel the request")
+)
+
+type AccessRequestService interface {
+	// SetApprovalPolicy makes the role requestable, replacing its current policy
+	SetApprovalPolicy(roleIdentifier string, policy *schemas.RBACApprovalPolicyUpdate) (*schemas.RBACApprovalPolicyResponse, error)
+	GetApprovalPolicy(roleIdentifier string) (*schemas.RBACApprovalPolicyResponse, error)
+	GetApprovalPolicies() ([]schemas.RBACApprovalPolicyResponse, error)
+	DeleteApprovalPolicy(roleIdentifier string) error
+
+	// CreateRequest files a request for a role and notifies its approvers
+	CreateRequest(requesterIdentifier string, request *schemas.RBACAccessRequestCreate) (*schemas.RBACAccessRequestResponse, error)
+	// GetRequest and GetRequests only return the requests the viewer made or can
+	// decide, unless all is set
+	GetRequest(id uint, viewerIdentifier string, all bool) (*schemas.RBACAccessRequestResponse, error)
+	GetRequests(filter *schemas.RBACAccessRequestFilter, viewerIdentifier string, all bool) ([]schemas.RBACAccessRequestResponse, error)
+	// Approve records an approval. The last one required assigns the role to the
+	// requester for the requested duration.
+	Approve(id uint, approverIdentifier string, decision *schemas.RBACAccessRequestDecision) (*schemas.RBACAccessRequestResponse, error)
+	Deny(id uint, approverIdentifier string, decision *schemas.RBACAccessRequestDecision) (*schemas.RBACAccessRequestResponse, error)
+	Cancel(id uint, requesterIdentifier string) (*schemas.RBACAccessRequestResponse, error)
+}
+
+type accessRequestService struct {
+	db       *gorm.DB
+	notifier Notifier
+}
+
+func NewAccessRequestService(notifier Notifier) AccessRequestService {
+	return &accessRequestService{
+		db:       config.GetDB(),
+		notifier: notifier,
+	}
+}
+
+func accessRequestStatus(request *models.RBACAccessRequest) string {
+	if request.Status == AccessRequestPending && time.Now().After(request.ExpiresAt) {
+		return AccessRequestExpired
+	}
+	return request.Status
+}
+
+func accessRequestResponse(request *models.RBACAccessRequest) *schemas.RBACAccessRequestResponse {
+	return schemas.RBACAccessRequestResponseFromModel(request, accessRequestStatus(request))
+}
+
+// Políticas de aprovação
+func (s *accessRequestService) SetApprovalPolicy(roleIdentifier string, policy *schemas.RBACApprovalPolicyUpdate) (*schemas.RBACApprovalPolicyResponse, error) {
+	var role models.RBACRole
+
+	if err := s.db.Where("identifier = ?", roleIdentifier).First(&role).Error; err != nil {
+		return nil, err
+	}
+
+	if len(policy.Approvers) == 0 && len(policy.ApproverGroups) == 0 {
+		return nil, ErrInvalidApprovalPolicy
+	}
+
+	if policy.MaxDuration < 0 {
+		return nil, ErrInvalidAccessDuration
+	}
+
+	var count int64
+	if err := s.db.Model(&models.User{}).Where("identifier IN ?", policy.Approvers).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if int(count) != len(policy.Approvers) {
+		return nil, errors.New("approvers reference unknown users")
+	}
+
+	if err := s.db.Model(&models.Group{}).Where("identifier IN ?", policy.ApproverGroups).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if int(count) != len(policy.ApproverGroups) {
+		return nil, errors.New("approver groups reference unknown groups")
+	}
+
+	var policyModel models.RBACApprovalPolicy
+	if err := s.db.Where("role_id = ?", role.ID).First(&policyModel).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	policyModel.RoleID = role.ID
+	policyModel.Approvers = strings.Join(policy.Approvers, ",")
+	policyModel.ApproverGroups = strings.Join(policy.ApproverGroups, ",")
+	policyModel.RequiredApprovals = policy.RequiredApprovals
+	policyModel.MaxDuration = policy.MaxDuration
+
+	if policyModel.RequiredApprovals <= 0 {
+		policyModel.RequiredApprovals = 1
+	}
+
+	if err := s.db.Save(&policyModel).Error; err != nil {
+		return nil, err
+	}
+
+	policyModel.Role = role
+	return schemas.RBACApprovalPolicyResponseFromModel(&policyModel), nil
+}
+
+func (s *accessRequestService) findPolicy(roleIdentifier string) (*models.RBACApprovalPolicy, error) {
+	var policy models.RBACApprovalPolicy
+
+	err := s.db.Preload("Role").
+		Where("role_id IN (?)", s.db.Model(&models.RBACRole{}).Select("id").Where("identifier = ?", roleIdentifier)).
+		First(&policy).Error
+
+	return &policy, err
+}
+
+func (s *accessRequestService) GetApprovalPolicy(roleIdentifier string) (*schemas.RBACApprovalPolicyResponse, error) {
+	policy, err := s.findPolicy(roleIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return schemas.RBACApprovalPolicyResponseFromModel(policy), nil
+}
+
+func (s *accessRequestService) GetApprovalPolicies() ([]schemas.RBACApprovalPolicyResponse, error) {
+	var policies []models.RBACApprovalPolicy
+
+	if err := s.db.Preload("Role").Order("id").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	returnPolicies := []schemas.RBACApprovalPolicyResponse{}
+	for _, policy := range policies {
+		returnPolicies = append(returnPolicies, *schemas.RBACApprovalPolicyResponseFromModel(&policy))
+	}
+
+	return returnPolicies, nil
+}
+
+func (s *accessRequestService) DeleteApprovalPolicy(roleIdentifier string) error {
+	policy, err := s.findPolicy(roleIdentifier)
+	if err != nil {
+		return err
+	}
+
+	// Remoção definitiva, para que o papel possa receber uma nova política
+	return s.db.Unscoped().Delete(policy).Error
+}
+
+// approvers returns a query for the active users who can decide requests under the
+// policy: the listed users and the members of the listed groups or their subgroups
+func (s *accessRequestService) approvers(policy *models.RBACApprovalPolicy) *gorm.DB {
+	groups := s.db.Model(&models.Group{}).Select("id").
+		Where("is_active = ? AND identifier IN ?", true, strings.Split(policy.ApproverGroups, ","))
+	subgroups := s.db.Model(&models.GroupClosure{}).Select("descendant_id").Where("ancestor_id IN (?)", groups)
+	members := s.db.Table("group_users").Select("user_id").Where("group_id IN (?) OR group_id IN (?)", groups, subgroups)
+
+	return s.db.Model(&models.User{}).
+		Where("is_active = ?", true).
+		Where("identifier IN ? OR id IN (?)", strings.Split(policy.Approvers, ","), members)
+}
+
+func (s *accessRequestService) canApprove(policy *models.RBACApprovalPolicy, user *models.User) (bool, error) {
+	var count int64
+	err := s.approvers(policy).Where("id = ?", user.ID).Count(&count).Error
+
+	return count > 0, err
+}
+
+// checkApprover ensures the user may decide the request under the current policy of the role
+func (s *accessRequestService) checkApprover(request *models.RBACAccessRequest, user *models.User) error {
+	if user.ID == request.RequesterID {
+		return ErrSelfApproval
+	}
+
+	var policy models.RBACApprovalPolicy
+	if err := s.db.Where("role_id = ?", request.RoleID).First(&policy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotApprover
+		}
+		return err
+	}
+
+	ok, err := s.canApprove(&policy, user)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotApprover
+	}
+
+	return nil
+}
+
+func (s *accessRequestService) findUser(identifier string) (*models.User, error) {
+	var user models.User
+
+	if err := s.db.Where("identifier = ?", identifier).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *accessRequestService) findRequest(id uint) (*models.RBACAccessRequest, error) {
+	var request models.RBACAccessRequest
+
+	err := s.db.Preload("Role").Preload("Requester").
+		Preload("Events", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Events.Actor").
+		First(&request, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAccessRequestNotFound
+		}
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+// Pedidos de acesso
+func (s *accessRequestService) CreateRequest(requesterIdentifier string, request *schemas.RBACAccessRequestCreate) (*schemas.RBACAccessRequestResponse, error) {
+	requester, err := s.findUser(requesterIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := s.findPolicy(request.Role)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotRequestable
+		}
+		return nil, err
+	}
+
+	if strings.TrimSpace(request.Justification) == "" {
+		return nil, ErrJustificationRequired
+	}
+
+	maxDuration := policy.MaxDuration
+	if maxDuration == 0 {
+		maxDuration = config.Config.AccessRequest.MaxDuration
+	}
+
+	if request.Duration <= 0 || request.Duration > maxDuration {
+		return nil, ErrInvalidAccessDuration
+	}
+
+	now := time.Now()
+
+	var count int64
+	if err := s.db.Model(&models.RBACRoleAssignment{}).
+		Where("rbac_role_id = ? AND user_id = ? AND expires_at IS NULL", policy.RoleID, requester.ID).
+		Where("not_before IS NULL OR not_before <= ?", now).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrRoleAlreadyHeld
+	}
+
+	if err := s.db.Model(&models.RBACAccessRequest{}).
+		Where("role_id = ? AND requester_id = ? AND status = ? AND expires_at > ?", policy.RoleID, requester.ID, AccessRequestPending, now).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrAccessRequestDuplicated
+	}
+
+	requestModel := models.RBACAccessRequest{
+		RoleID:            policy.RoleID,
+		RequesterID:       requester.ID,
+		Justification:     request.Justification,
+		Duration:          request.Duration,
+		Status:            AccessRequestPending,
+		RequiredApprovals: policy.RequiredApprovals,
+		ExpiresAt:         now.Add(time.Duration(config.Config.AccessRequest.Expiration) * time.Second),
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&requestModel).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.RBACAccessRequestEvent{
+			AccessRequestID: requestModel.ID,
+			ActorID:         requester.ID,
+			Action:          accessRequestRequested,
+			Comment:         request.Justification,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var approvers []models.User
+	if err := s.approvers(policy).Where("id <> ?", requester.ID).Find(&approvers).Error; err != nil {
+		log.Printf("access request %d: listing approvers failed: %v", requestModel.ID, err)
+	}
+
+	requestModel.Role = policy.Role
+	requestModel.Requester = *requester
+	s.notify(approvers, "access_request", fmt.Sprintf("%s requests the role %s", requester.Identifier, policy.Role.Identifier),
+		fmt.Sprintf("Justification: %s\nDuration: %s", request.Justification, time.Duration(request.Duration)*time.Second), &requestModel)
+
+	return s.GetRequest(requestModel.ID, "", true)
+}
+
+// notify delivers a notification about the request to each user. Notifications are
+// sent after the change is committed, and a failed delivery doesn't undo it.
+func (s *accessRequestService) notify(users []models.User, kind, subject, body string, request *models.RBACAccessRequest) {
+	for _, user := range users {
+		notification := Notification{
+			Kind:      kind,
+			Recipient: user.Identifier,
+			Address:   notificationAddress(user.Identifier, user.Metadata),
+			Subject:   subject,
+			Body:      body,
+			Data: map[string]string{
+				"request_id": strconv.FormatUint(uint64(request.ID), 10),
+				"role":       request.Role.Identifier,
+				"requester":  request.Requester.Identifier,
+			},
+		}
+
+		if err := s.notifier.Notify(notification); err != nil {
+			log.Printf("access request %d: notifying %s failed: %v", request.ID, user.Identifier, err)
+		}
+	}
+}
+
+func (s *accessRequestService) GetRequest(id uint, viewerIdentifier string, all bool) (*schemas.RBACAccessRequestResponse, error) {
+	request, err := s.findRequest(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !all {
+		visible, err := s.visibleRoleIDs(viewerIdentifier)
+		if err != nil {
+			return nil, err
+		}
+
+		// Pedidos que o usuário não fez nem pode decidir não existem para ele
+		if request.Requester.Identifier != viewerIdentifier && !visible[request.RoleID] {
+			return nil, ErrAccessRequestNotFound
+		}
+	}
+
+	return accessRequestResponse(request), nil
+}
+
+// visibleRoleIDs returns the roles whose requests the user can decide
+func (s *accessRequestService) visibleRoleIDs(userIdentifier string) (map[uint]bool, error) {
+	user, err := s.findUser(userIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []models.RBACApprovalPolicy
+	if err := s.db.Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	roleIDs := map[uint]bool{}
+	for _, policy := range policies {
+		ok, err := s.canApprove(&policy, user)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			roleIDs[policy.RoleID] = true
+		}
+	}
+
+	return roleIDs, nil
+}
+
+func (s *accessRequestService) GetRequests(filter *schemas.RBACAccessRequestFilter, viewerIdentifier string, all bool) ([]schemas.RBACAccessRequestResponse, error) {
+	query := s.db.Preload("Role").Preload("Requester").
+		Preload("Events", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Events.Actor").
+		Order("id DESC")
+	now := time.Now()
+
+	switch filter.Status {
+	case "":
+	case AccessRequestPending:
+		query = query.Where("status = ? AND expires_at > ?", AccessRequestPending, now)
+	case AccessRequestExpired:
+		query = query.Where("status = ? AND expires_at <= ?", AccessRequestPending, now)
+	case AccessRequestApproved, AccessRequestDenied, AccessRequestCancelled:
+		query = query.Where("status = ?", filter.Status)
+	default:
+		return nil, fmt.Errorf("unknown access request status %s", filter.Status)
+	}
+
+	if filter.Role != "" {
+		query = query.Where("role_id IN (?)", s.db.Model(&models.RBACRole{}).Select("id").Where("identifier = ?", filter.Role))
+	}
+
+	if filter.Requester != "" {
+		query = query.Where("requester_id IN (?)", s.db.Model(&models.User{}).Select("id").Where("identifier = ?", filter.Requester))
+	}
+
+	if !all {
+		viewer, err := s.findUser(viewerIdentifier)
+		if err != nil {
+			return nil, err
+		}
+
+		visible, err := s.visibleRoleIDs(viewerIdentifier)
+		if err != nil {
+			return nil, err
+		}
+
+		roleIDs := []uint{}
+		for roleID := range visible {
+			roleIDs = append(roleIDs, roleID)
+		}
+
+		query = query.Where("requester_id = ? OR role_id IN ?", viewer.ID, roleIDs)
+	}
+
+	var requests []models.RBACAccessRequest
+
+	if err := query.Find(&requests).Error; err != nil {
+		return nil, err
+	}
+
+	returnRequests := []schemas.RBACAccessRequestResponse{}
+	for _, request := range requests {
+		returnRequests = append(returnRequests, *accessRequestResponse(&request))
+	}
+
+	return returnRequests, nil
+}
+
+func (s *accessRequestService) Approve(id uint, approverIdentifier string, decision *schemas.RBACAccessRequestDecision) (*schemas.RBACAccessRequestResponse, error) {
+	request, err := s.findRequest(id)
+	if err != nil {
+		return nil, err
+	}
+
+	approver, err := s.findUser(approverIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkApprover(request, approver); err != nil {
+		return nil, err
+	}
+
+	if accessRequestStatus(request) != AccessRequestPending {
+		return nil, ErrAccessRequestClosed
+	}
+
+	for _, event := range request.Events {
+		if event.Action == accessRequestApproval && event.ActorID == approver.ID {
+			return nil, ErrAlreadyApproved
+		}
+	}
+
+	granted := false
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Atualizar o pedido antes de tudo bloqueia a linha até o commit, então aprovações
+		// simultâneas são contadas uma depois da outra e a última sempre vê as demais
+		result := tx.Model(&models.RBACAccessRequest{}).
+			Where("id = ? AND status = ?", request.ID, AccessRequestPending).
+			UpdateColumn("updated_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAccessRequestClosed
+		}
+
+		var mine int64
+		if err := tx.Model(&models.RBACAccessRequestEvent{}).
+			Where("access_request_id = ? AND action = ? AND actor_id = ?", request.ID, accessRequestApproval, approver.ID).
+			Count(&mine).Error; err != nil {
+			return err
+		}
+		if mine > 0 {
+			return ErrAlreadyApproved
+		}
+
+		if err := tx.Create(&models.RBACAccessRequestEvent{
+			AccessRequestID: request.ID,
+			ActorID:         approver.ID,
+			Action:          accessRequestApproval,
+			Comment:         decision.Comment,
+		}).Error; err != nil {
+			return err
+		}
+
+		var approvals int64
+		if err := tx.Model(&models.RBACAccessRequestEvent{}).
+			Where("access_request_id = ? AND action = ?", request.ID, accessRequestApproval).
+			Distinct("actor_id").
+			Count(&approvals).Error; err != nil {
+			return err
+		}
+
+		if int(approvals) < request.RequiredApprovals {
+			return nil
+		}
+
+		now := time.Now()
+		until := now.Add(time.Duration(request.Duration) * time.Second)
+
+		if err := s.close(tx, request, AccessRequestApproved, map[string]interface{}{"grant_expires_at": until}); err != nil {
+			return err
+		}
+
+		if err := s.grant(tx, request, approver, until); err != nil {
+			return err
+		}
+
+		granted = true
+		return tx.Create(&models.RBACAccessRequestEvent{
+			AccessRequestID: request.ID,
+			ActorID:         approver.ID,
+			Action:          accessRequestGrant,
+			Comment:         fmt.Sprintf("role %s assigned until %s", request.Role.Identifier, until.Format(time.RFC3339)),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if granted {
+		s.notify([]models.User{request.Requester}, "access_request_approved",
+			fmt.Sprintf("Your request for the role %s was approved", request.Role.Identifier),
+			fmt.Sprintf("The role is yours for %s.", time.Duration(request.Duration)*time.Second), request)
+	}
+
+	return s.GetRequest(request.ID, "", true)
+}
+
+// close moves a pending request to its final status. The status is checked again in
+// the update, so concurrent decisions can't both close the request.
+func (s *accessRequestService) close(tx *gorm.DB, request *models.RBACAccessRequest, status string, fields map[string]interface{}) error {
+	fields["status"] = status
+	fields["decided_at"] = time.Now()
+
+	result := tx.Model(&models.RBACAccessRequest{}).
+		Where("id = ? AND status = ?", request.ID, AccessRequestPending).
+		Updates(fields)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAccessRequestClosed
+	}
+
+	return nil
+}
+
+// grantWindowEnd returns the end of an assignment starting now that covers both
+// the current assignment and access until the given time; nil means it doesn't
+// expire. It fails when the current assignment starts after that access ends, as
+// a single assignment can't leave the gap between them.
+func grantWindowEnd(current *models.RBACRoleAssignment, until time.Time) (*time.Time, bool) {
+	if current.NotBefore != nil && current.NotBefore.After(until) {
+		return nil, false
+	}
+
+	if current.ExpiresAt == nil || current.ExpiresAt.After(until) {
+		return current.ExpiresAt, true
+	}
+
+	return &until, true
+}
+
+// grant assigns the role from now until the given time. An assignment that already
+// exists is widened, never cut short: one that lasts longer or starts later keeps
+// its end, and only a started one that ends later is left untouched.
+func (s *accessRequestService) grant(tx *gorm.DB, request *models.RBACAccessRequest, approver *models.User, until time.Time) error {
+	reason := fmt.Sprintf("access request #%d: %s", request.ID, request.Justification)
+
+	var current models.RBACRoleAssignment
+
+	err := tx.Where("rbac_role_id = ? AND user_id = ?", request.RoleID, request.RequesterID).First(&current).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		rbac := &authzRBACService{db: tx}
+		_, err = rbac.AssignRole(&schemas.RBACRoleAssignmentCreate{
+			Role:      request.Role.Identifier,
+			User:      request.Requester.Identifier,
+			ExpiresAt: &until,
+			Reason:    reason,
+		}, approver.Identifier)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	expiresAt, ok := grantWindowEnd(&current, until)
+	if !ok {
+		return ErrRoleScheduled
+	}
+
+	started := current.NotBefore == nil || !current.NotBefore.After(time.Now())
+	extended := expiresAt != nil && expiresAt.Equal(until)
+	if started && !extended {
+		return nil
+	}
+
+	updates := map[string]interface{}{"not_before": nil, "expires_at": expiresAt}
+
+	// O motivo e quem concedeu só mudam quando é o pedido que define o fim da atribuição
+	if extended {
+		updates["reason"] = reason
+		updates["grantor_id"] = approver.ID
+	}
+
+	return tx.Model(&models.RBACRoleAssignment{}).
+		Where("rbac_role_id = ? AND user_id = ?", request.RoleID, request.RequesterID).
+		Updates(updates).Error
+}
+
+func (s *accessRequestService) Deny(id uint, approverIdentifier string, decision *schemas.RBACAccessRequestDecision) (*schemas.RBACAccessRequestResponse, error) {
+	request, err := s.findRequest(id)
+	if err != nil {
+		return nil, err
+	}
+
+	approver, err := s.findUser(approverIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkApprover(request, approver); err != nil {
+		return nil, err
+	}
+
+	if accessRequestStatus(request) != AccessRequestPending {
+		return nil, ErrAccessRequestClosed
+	}
+
+	// Uma única negação encerra o pedido
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.close(tx, request, AccessRequestDenied, map[string]interface{}{}); err != nil {
+			return err
+		}
+
+		return tx.Create(&models.RBACAccessRequestEvent{
+			AccessRequestID: request.ID,
+			ActorID:         approver.ID,
+			Action:          accessRequestDenial,
+			Comment:         decision.Comment,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify([]models.User{request.Requester}, "access_request_denied",
+		fmt.Sprintf("Your request for the role %s was denied", request.Role.Identifier), decision.Comment, request)
+
+	return s.GetRequest(request.ID, "", true)
+}
+
+func (s *accessRequestService) Cancel(id uint, requesterIdentifier string) (*schemas.RBACAccessRequestResponse, error) {
+	request, err := s.findRequest(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Requester.Identifier != requesterIdentifier {
+		return nil, ErrNotRequester
+	}
+
+	if accessRequestStatus(request) != AccessRequestPending {
+		return nil, ErrAccessRequestClosed
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.close(tx, request, AccessRequestCancelled, map[string]interface{}{}); err != nil {
+			return err
+		}
+
+		return tx.Create(&models.RBACAccessRequestEvent{
+			AccessRequestID: request.ID,
+			ActorID:         request.RequesterID,
+			Action:          accessRequestCancel,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetRequest(request.ID, "", true)
+}
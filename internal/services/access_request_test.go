@@ -0,0 +1,179 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"gorm.io/gorm"
+)
+
+func TestGrantWindowEnd(t *testing.T) {
+	now := time.Now()
+	until := now.Add(time.Hour)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name    string
+		current models.RBACRoleAssignment
+		want    *time.Time
+		wantOK  bool
+	}{
+		{"permanent", models.RBACRoleAssignment{}, nil, true},
+		{"ends before the grant", models.RBACRoleAssignment{ExpiresAt: at(time.Minute)}, &until, true},
+		{"already expired", models.RBACRoleAssignment{NotBefore: at(-2 * time.Hour), ExpiresAt: at(-time.Hour)}, &until, true},
+		{"ends after the grant", models.RBACRoleAssignment{ExpiresAt: at(2 * time.Hour)}, at(2 * time.Hour), true},
+		{"scheduled permanent within the grant", models.RBACRoleAssignment{NotBefore: at(30 * time.Minute)}, nil, true},
+		{"scheduled permanent right as the grant ends", models.RBACRoleAssignment{NotBefore: &until}, nil, true},
+		{"scheduled window within the grant", models.RBACRoleAssignment{NotBefore: at(10 * time.Minute), ExpiresAt: at(20 * time.Minute)}, &until, true},
+		{"scheduled after the grant", models.RBACRoleAssignment{NotBefore: at(2 * time.Hour)}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := grantWindowEnd(&tt.current, until)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+
+			if (got == nil) != (tt.want == nil) || got != nil && !got.Equal(*tt.want) {
+				t.Errorf("grantWindowEnd = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestAccessRequests creates the role ops, requestable by alice and approved by
+// two of bob, carol and dave
+func newTestAccessRequests(t *testing.T) (*accessRequestService, *gorm.DB) {
+	t.Helper()
+
+	db := newTestDB(t)
+	config.Config.AccessRequest = config.AccessRequestConfig{Expiration: 3600, MaxDuration: 86400}
+
+	for _, identifier := range []string{"alice", "bob", "carol", "dave"} {
+		db.Create(&models.User{Identifier: identifier, Metadata: "{}", IsActive: true})
+	}
+	db.Create(&models.RBACRole{Identifier: "ops"})
+
+	service := &accessRequestService{db: db, notifier: logNotifier{}}
+	if _, err := service.SetApprovalPolicy("ops", &schemas.RBACApprovalPolicyUpdate{
+		Approvers:         []string{"bob", "carol", "dave"},
+		RequiredApprovals: 2,
+	}); err != nil {
+		t.Fatalf("SetApprovalPolicy: %v", err)
+	}
+
+	return service, db
+}
+
+func requestTestAccess(t *testing.T, service *accessRequestService) uint {
+	t.Helper()
+
+	request, err := service.CreateRequest("alice", &schemas.RBACAccessRequestCreate{Role: "ops", Justification: "incident", Duration: 3600})
+	if err != nil {
+		t.Fatalf("CreateRequest: %v", err)
+	}
+	return request.ID
+}
+
+func findTestAssignment(t *testing.T, db *gorm.DB) models.RBACRoleAssignment {
+	t.Helper()
+
+	alice := findTestUser(t, db, "alice")
+
+	var assignment models.RBACRoleAssignment
+	if err := db.Where("user_id = ?", alice.ID).First(&assignment).Error; err != nil {
+		t.Fatalf("finding assignment: %v", err)
+	}
+	return assignment
+}
+
+func TestApprove(t *testing.T) {
+	service, db := newTestAccessRequests(t)
+	id := requestTestAccess(t, service)
+	decision := &schemas.RBACAccessRequestDecision{}
+
+	if _, err := service.Approve(id, "bob", decision); err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	if _, err := service.Approve(id, "bob", decision); !errors.Is(err, ErrAlreadyApproved) {
+		t.Errorf("second approval by bob = %v, want ErrAlreadyApproved", err)
+	}
+
+	var count int64
+	db.Model(&models.RBACRoleAssignment{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("the role was assigned after a single approval")
+	}
+
+	response, err := service.Approve(id, "carol", decision)
+	if err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	if response.Status != AccessRequestApproved {
+		t.Errorf("status = %s, want %s", response.Status, AccessRequestApproved)
+	}
+
+	assignment := findTestAssignment(t, db)
+	if assignment.ExpiresAt == nil || assignment.ExpiresAt.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("assignment expires at %v, want in an hour", assignment.ExpiresAt)
+	}
+
+	if _, err := service.Approve(id, "dave", decision); !errors.Is(err, ErrAccessRequestClosed) {
+		t.Errorf("approval after the grant = %v, want ErrAccessRequestClosed", err)
+	}
+}
+
+func TestApproveKeepsScheduledAssignments(t *testing.T) {
+	tests := []struct {
+		name      string
+		notBefore time.Duration
+		wantErr   error
+	}{
+		{"permanent assignment starting during the access", 30 * time.Minute, nil},
+		{"permanent assignment starting after the access", 3 * time.Hour, ErrRoleScheduled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, db := newTestAccessRequests(t)
+
+			notBefore := time.Now().Add(tt.notBefore)
+			rbac := &authzRBACService{db: db}
+			if _, err := rbac.AssignRole(&schemas.RBACRoleAssignmentCreate{
+				Role: "ops", User: "alice", NotBefore: &notBefore, Reason: "joins the on-call rotation",
+			}, "bob"); err != nil {
+				t.Fatalf("AssignRole: %v", err)
+			}
+
+			id := requestTestAccess(t, service)
+			service.Approve(id, "bob", &schemas.RBACAccessRequestDecision{})
+
+			_, err := service.Approve(id, "carol", &schemas.RBACAccessRequestDecision{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Approve = %v, want %v", err, tt.wantErr)
+			}
+
+			assignment := findTestAssignment(t, db)
+			if assignment.ExpiresAt != nil {
+				t.Errorf("the permanent assignment now expires at %v", assignment.ExpiresAt)
+			}
+			if assignment.Reason != "joins the on-call rotation" {
+				t.Errorf("reason = %q, want the one of the permanent assignment", assignment.Reason)
+			}
+
+			// Aprovado, o acesso começa agora; recusado, o agendamento fica como estava
+			startsNow := assignment.NotBefore == nil
+			if startsNow != (tt.wantErr == nil) {
+				t.Errorf("not_before = %v", assignment.NotBefore)
+			}
+		})
+	}
+}
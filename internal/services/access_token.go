@@ -0,0 +1,246 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	UserTypeHuman          = "human"
+	UserTypeServiceAccount = "service_account"
+
+	personalAccessTokenPrefix = "whoami_pat_"
+	apiKeyPrefix              = "whoami_key_"
+)
+
+// AccessTokenScopes are the route groups a personal access token can be limited to
+var AccessTokenScopes = []string{"auth", "authz", "me"}
+
+var (
+	ErrInvalidAccessToken = errors.New("invalid or expired access token")
+	ErrNotServiceAccount  = errors.New("tokens can only be created for service accounts")
+)
+
+// IsPersonalAccessToken reports whether the bearer credential is a personal access token or API key rather than a JWT
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix) || strings.HasPrefix(token, apiKeyPrefix)
+}
+
+type AccessTokenService interface {
+	CreateToken(userIdentifier string, token *schemas.PersonalAccessTokenCreate) (*schemas.PersonalAccessTokenResponse, error)
+	// CreateServiceAccountToken is CreateToken restricted to service accounts
+	CreateServiceAccountToken(userIdentifier string, token *schemas.PersonalAccessTokenCreate) (*schemas.PersonalAccessTokenResponse, error)
+	GetTokens(userIdentifier string) ([]schemas.PersonalAccessTokenResponse, error)
+	RevokeToken(userIdentifier string, id uint) error
+	// Authenticate returns the token, with its user, for a valid bearer credential
+	Authenticate(token string) (*models.PersonalAccessToken, error)
+
+	CreateServiceAccount(account *schemas.ServiceAccountCreate) (*schemas.UserResponse, error)
+	GetServiceAccounts() ([]schemas.UserResponse, error)
+}
+
+type accessTokenService struct {
+	db *gorm.DB
+}
+
+func NewAccessTokenService() AccessTokenService {
+	return &accessTokenService{
+		db: config.GetDB(),
+	}
+}
+
+func (s *accessTokenService) CreateToken(userIdentifier string, token *schemas.PersonalAccessTokenCreate) (*schemas.PersonalAccessTokenResponse, error) {
+	var user models.User
+
+	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	if token.Name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	for _, scope := range token.Scopes {
+		if !containsString(AccessTokenScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %s", scope)
+		}
+	}
+
+	if len(token.Roles) > 0 {
+		var count int64
+		if err := s.db.Model(&models.RBACRole{}).Where("identifier IN ?", token.Roles).Count(&count).Error; err != nil {
+			return nil, err
+		}
+
+		if int(count) != len(token.Roles) {
+			return nil, errors.New("roles reference unknown RBAC roles")
+		}
+	}
+
+	// O prefixo identifica o tipo de credencial e permite ao middleware separá-la de um JWT
+	prefix := personalAccessTokenPrefix
+	if user.Type == UserTypeServiceAccount {
+		prefix = apiKeyPrefix
+	}
+	secret := prefix + utils.GenerateSecureString(40)
+
+	tokenModel := models.PersonalAccessToken{
+		Name:      token.Name,
+		Prefix:    secret[:len(prefix)+6],
+		TokenHash: utils.HashToken(secret),
+		UserID:    user.ID,
+		Scopes:    strings.Join(token.Scopes, ","),
+		Roles:     strings.Join(token.Roles, ","),
+	}
+
+	if token.ExpiresIn != nil {
+		if *token.ExpiresIn <= 0 {
+			return nil, errors.New("expires_in must be positive")
+		}
+
+		expiresAt := time.Now().Add(time.Duration(*token.ExpiresIn) * time.Second)
+		tokenModel.ExpiresAt = &expiresAt
+	}
+
+	if err := s.db.Create(&tokenModel).Error; err != nil {
+		return nil, err
+	}
+
+	response := schemas.PersonalAccessTokenResponseFromModel(&tokenModel)
+	response.Token = secret
+
+	return response, nil
+}
+
+func (s *accessTokenService) CreateServiceAccountToken(userIdentifier string, token *schemas.PersonalAccessTokenCreate) (*schemas.PersonalAccessTokenResponse, error) {
+	var user models.User
+
+	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	if user.Type != UserTypeServiceAccount {
+		return nil, ErrNotServiceAccount
+	}
+
+	return s.CreateToken(userIdentifier, token)
+}
+
+func (s *accessTokenService) GetTokens(userIdentifier string) ([]schemas.PersonalAccessTokenResponse, error) {
+	var user models.User
+
+	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	var tokens []models.PersonalAccessToken
+
+	if err := s.db.Where("user_id = ?", user.ID).Order("id").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+
+	returnTokens := []schemas.PersonalAccessTokenResponse{}
+	for _, token := range tokens {
+		returnTokens = append(returnTokens, *schemas.PersonalAccessTokenResponseFromModel(&token))
+	}
+
+	return returnTokens, nil
+}
+
+func (s *accessTokenService) RevokeToken(userIdentifier string, id uint) error {
+	var user models.User
+
+	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
+		return err
+	}
+
+	// Filtrar pelo usuário impede revogar tokens de outras contas
+	var token models.PersonalAccessToken
+
+	if err := s.db.Where("id = ? AND user_id = ?", id, user.ID).First(&token).Error; err != nil {
+		return err
+	}
+
+	return s.db.Unscoped().Delete(&token).Error
+}
+
+func (s *accessTokenService) Authenticate(token string) (*models.PersonalAccessToken, error) {
+	var accessToken models.PersonalAccessToken
+
+	if err := s.db.Preload("User").Where("token_hash = ?", utils.HashToken(token)).First(&accessToken).Error; err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+
+	now := time.Now()
+
+	if accessToken.ExpiresAt != nil && now.After(*accessToken.ExpiresAt) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	if !accessToken.User.IsActive {
+		return nil, ErrInvalidAccessToken
+	}
+
+	if err := s.db.Model(&accessToken).UpdateColumn("last_used_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	return &accessToken, nil
+}
+
+// CreateServiceAccount creates a non-human user. It has no password, so it can
+// only authenticate with API keys.
+func (s *accessTokenService) CreateServiceAccount(account *schemas.ServiceAccountCreate) (*schemas.UserResponse, error) {
+	if account.Identifier == "" {
+		return nil, errors.New("identifier cannot be empty")
+	}
+
+	userModel := models.User{
+		Identifier: account.Identifier,
+		Metadata:   "{}",
+		IsActive:   true,
+		Type:       UserTypeServiceAccount,
+	}
+
+	if account.Metadata != nil {
+		userModel.Metadata = *account.Metadata
+	}
+
+	if err := s.db.Create(&userModel).Error; err != nil {
+		return nil, err
+	}
+
+	return schemas.UserResponseFromModel(&userModel), nil
+}
+
+func (s *accessTokenService) GetServiceAccounts() ([]schemas.UserResponse, error) {
+	var users []models.User
+
+	if err := s.db.Where("type = ?", UserTypeServiceAccount).Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	returnUsers := []schemas.UserResponse{}
+	for _, user := range users {
+		returnUsers = append(returnUsers, *schemas.UserResponseFromModel(&user))
+	}
+
+	return returnUsers, nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
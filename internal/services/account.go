@@ -0,0 +1,157 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+	ErrNoLocalPassword        = errors.New("this account has no password managed by whoami")
+)
+
+// AccountService holds the self-service operations users run on their own account
+type AccountService interface {
+	UpdateMetadata(identifier string, account *schemas.AccountUpdate) (*schemas.UserResponse, error)
+	ChangePassword(identifier string, change *schemas.PasswordChange) error
+	GetTokens(identifier string) ([]schemas.AccountTokenResponse, error)
+	RevokeToken(identifier string, id uint) error
+}
+
+type accountService struct {
+	db *gorm.DB
+}
+
+func NewAccountService() AccountService {
+	return &accountService{
+		db: config.GetDB(),
+	}
+}
+
+func (s *accountService) findUser(identifier string) (*models.User, error) {
+	var user models.User
+
+	if err := s.db.Where("identifier = ?", identifier).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UpdateMetadata changes the metadata keys users may edit themselves. The other
+// keys, such as the email used for passwordless login, stay with administrators.
+func (s *accountService) UpdateMetadata(identifier string, account *schemas.AccountUpdate) (*schemas.UserResponse, error) {
+	user, err := s.findUser(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	for key := range account.Metadata {
+		if !containsString(config.Config.Account.EditableMetadata, key) {
+			return nil, fmt.Errorf("metadata key %s cannot be changed", key)
+		}
+	}
+
+	metadata := map[string]interface{}{}
+	json.Unmarshal([]byte(user.Metadata), &metadata)
+
+	for key, value := range account.Metadata {
+		if value == nil {
+			delete(metadata, key)
+		} else {
+			metadata[key] = value
+		}
+	}
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(user).Update("metadata", string(metadataJSON)).Error; err != nil {
+		return nil, err
+	}
+
+	return schemas.UserResponseFromModel(user), nil
+}
+
+func (s *accountService) ChangePassword(identifier string, change *schemas.PasswordChange) error {
+	user, err := s.findUser(identifier)
+	if err != nil {
+		return err
+	}
+
+	// Usuários de diretórios e provedores externos trocam a senha na origem
+	if user.Password == "" || user.Source == SourceLDAP {
+		return ErrNoLocalPassword
+	}
+
+	if ok, _ := utils.VerifyPassword(change.CurrentPassword, user.Password); !ok {
+		return ErrInvalidCurrentPassword
+	}
+
+	if change.NewPassword == "" {
+		return errors.New("new password cannot be empty")
+	}
+
+	flagged, err := checkPasswordBreach(change.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(change.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Model(user).Updates(map[string]interface{}{
+		"password":          hashedPassword,
+		"password_breached": flagged,
+	}).Error
+}
+
+func (s *accountService) GetTokens(identifier string) ([]schemas.AccountTokenResponse, error) {
+	user, err := s.findUser(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []models.Token
+
+	if err := s.db.Preload("Client").
+		Where("user_id = ? AND expires_in > ?", user.ID, time.Now().Unix()).
+		Order("id").
+		Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+
+	returnTokens := []schemas.AccountTokenResponse{}
+	for _, token := range tokens {
+		returnTokens = append(returnTokens, *schemas.AccountTokenResponseFromModel(&token))
+	}
+
+	return returnTokens, nil
+}
+
+func (s *accountService) RevokeToken(identifier string, id uint) error {
+	user, err := s.findUser(identifier)
+	if err != nil {
+		return err
+	}
+
+	var token models.Token
+
+	if err := s.db.Where("id = ? AND user_id = ?", id, user.ID).First(&token).Error; err != nil {
+		return err
+	}
+
+	return s.db.Delete(&token).Error
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"gorm.io/gorm"
+)
+
+const (
+	AuditImpersonationStart    = "impersonation.start"
+	AuditImpersonationRequest  = "impersonation.request"
+	AuditRoleAssignmentExpired = "rbac.assignment.expired"
+
+	// AuthMethodImpersonation marks sessions opened by an administrator for another user
+	AuthMethodImpersonation = "impersonation"
+
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+type AuditService interface {
+	Record(entry *schemas.AuditLogCreate) error
+	// GetEntries lists the newest entries first
+	GetEntries(filter *schemas.AuditLogFilter) ([]schemas.AuditLogResponse, error)
+}
+
+type auditService struct {
+	db *gorm.DB
+}
+
+func NewAuditService() AuditService {
+	return &auditService{
+		db: config.GetDB(),
+	}
+}
+
+func (s *auditService) Record(entry *schemas.AuditLogCreate) error {
+	return s.db.Create(&models.AuditLog{
+		Action:    entry.Action,
+		ActorID:   entry.ActorID,
+		UserID:    entry.UserID,
+		SessionID: entry.SessionID,
+		Method:    entry.Method,
+		Path:      entry.Path,
+		Status:    entry.Status,
+		IP:        entry.IP,
+		Reason:    entry.Reason,
+	}).Error
+}
+
+func (s *auditService) GetEntries(filter *schemas.AuditLogFilter) ([]schemas.AuditLogResponse, error) {
+	query := s.db.Preload("Actor").Preload("User").Order("id DESC")
+
+	if filter.Actor != "" {
+		query = query.Where("actor_id IN (?)", s.db.Model(&models.User{}).Select("id").Where("identifier = ?", filter.Actor))
+	}
+
+	if filter.User != "" {
+		query = query.Where("user_id IN (?)", s.db.Model(&models.User{}).Select("id").Where("identifier = ?", filter.User))
+	}
+
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = auditDefaultLimit
+	} else if limit > auditMaxLimit {
+		limit = auditMaxLimit
+	}
+
+	var entries []models.AuditLog
+
+	if err := query.Limit(limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	returnEntries := []schemas.AuditLogResponse{}
+	for _, entry := range entries {
+		returnEntries = append(returnEntries, *schemas.AuditLogResponseFromModel(&entry))
+	}
+
+	return returnEntries, nil
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/duvrdx/whoami/internal/config"
@@ -18,6 +20,8 @@ type AuthService interface {
 	GetUsers() ([]schemas.UserResponse, error)
 	UpdateUser(identifier string, user *schemas.UserUpdate) (*schemas.UserResponse, error)
 	DeleteUser(identifier string) error
+	ResetPassword(identifier, password string) error
+	ImportUsers(users []schemas.UserImport) ([]schemas.UserResponse, error)
 	CompareUserPassword(identifier, hashedPassword string) bool
 
 	CreateClient(client *schemas.ClientCreate) (*schemas.ClientResponse, error)
@@ -29,8 +33,17 @@ type AuthService interface {
 
 	CreateGroup(group *schemas.GroupCreate) (*schemas.GroupResponse, error)
 	GetGroup(identifier string) (*schemas.GroupResponse, error)
+	GetGroups() ([]schemas.GroupResponse, error)
 	UpdateGroup(identifier string, group *schemas.GroupUpdate) (*schemas.GroupResponse, error)
 	DeleteGroup(identifier string) error
+	GetGroupMembers(identifier string) ([]schemas.UserResponse, error)
+	AddGroupMembers(identifier string, users []string) error
+	RemoveGroupMember(identifier, user string) error
+	GetUserGroups(identifier string) ([]schemas.GroupResponse, error)
+	GetSubgroups(identifier string) ([]schemas.GroupResponse, error)
+	AddSubgroup(identifier, subgroup string) error
+	RemoveSubgroup(identifier, subgroup string) error
+	GetGroupClaims(userID uint) ([]string, error)
 
 	CreateToken(token *schemas.TokenCreate) (*schemas.TokenResponse, error)
 	GetToken(identifier string) (*schemas.TokenResponse, error)
@@ -43,19 +56,35 @@ type AuthService interface {
 
 // AuthService implementation
 type authService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	backends []IdentityBackend
 }
 
 // NewAuthService creates a new auth service
 func NewAuthService() AuthService {
+	var backends []IdentityBackend
+
+	if config.Config.LDAP.Enabled {
+		backends = append(backends, NewLDAPService())
+	}
+
 	return &authService{
-		db: config.GetDB(),
+		db:       config.GetDB(),
+		backends: backends,
 	}
 }
 
 func (s *authService) CreateUser(user *schemas.UserCreate) (*schemas.UserResponse, error) {
+	flagged, err := checkPasswordBreach(user.Password)
+	if err != nil {
+		return nil, err
+	}
 
 	userModel := schemas.UserFromCreate(user)
+	if userModel == nil {
+		return nil, errors.New("identifier and password are required")
+	}
+	userModel.PasswordBreached = flagged
 
 	if err := s.db.Create(userModel).Error; err != nil {
 		return nil, err
@@ -102,13 +131,44 @@ func (s *authService) UpdateUser(identifier string, user *schemas.UserUpdate) (*
 		return nil, err
 	}
 
+	if user.Password != nil {
+		flagged, err := checkPasswordBreach(*user.Password)
+		if err != nil {
+			return nil, err
+		}
+
+		hashedPassword, err := utils.HashPassword(*user.Password)
+		if err != nil {
+			return nil, err
+		}
+
+		user.Password = &hashedPassword
+		existing.PasswordBreached = flagged
+	}
+
 	updateData := utils.MakeObjectWithoutNilFields(user)
 
 	if len(updateData) == 0 {
 		return schemas.UserResponseFromModel(&existing), nil
 	}
 
-	if err := s.db.Model(&existing).Updates(updateData).Error; err != nil {
+	if user.Password != nil {
+		updateData["PasswordBreached"] = existing.PasswordBreached
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&existing).Updates(updateData).Error; err != nil {
+			return err
+		}
+
+		// Desativar a conta encerra as sessões e os tokens em uso
+		if user.IsActive != nil && !*user.IsActive {
+			return revokeUserSessions(tx, existing.ID)
+		}
+
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -123,21 +183,130 @@ func (s *authService) DeleteUser(identifier string) error {
 		return err
 	}
 
-	if err := s.db.Delete(&user).Error; err != nil {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := revokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.PersonalAccessToken{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&user).Error
+	})
+}
+
+// ResetPassword replaces the user's password without requiring the current one
+func (s *authService) ResetPassword(identifier, password string) error {
+	var user models.User
+
+	if err := s.db.Where("identifier = ?", identifier).First(&user).Error; err != nil {
+		return err
+	}
+
+	if password == "" {
+		return errors.New("password cannot be empty")
+	}
+
+	flagged, err := checkPasswordBreach(password)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Model(&user).Updates(map[string]interface{}{
+		"password":          hashedPassword,
+		"password_breached": flagged,
+	}).Error
+}
+
+// ImportUsers creates users whose passwords were already hashed by a legacy system.
+// The whole batch is rejected if any hash is in an unsupported format.
+func (s *authService) ImportUsers(users []schemas.UserImport) ([]schemas.UserResponse, error) {
+	var returnUsers []schemas.UserResponse
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, user := range users {
+			if user.Identifier == "" {
+				return errors.New("identifier cannot be empty")
+			}
+
+			if !utils.IsSupportedPasswordHash(user.PasswordHash) {
+				return fmt.Errorf("unsupported password hash for user %s", user.Identifier)
+			}
+
+			userModel := schemas.UserFromImport(&user)
+			active := userModel.IsActive
+
+			if err := tx.Create(userModel).Error; err != nil {
+				return err
+			}
+
+			// O default da coluna ignora o false na criação, então ele é gravado explicitamente
+			if !active {
+				if err := tx.Model(userModel).Update("is_active", false).Error; err != nil {
+					return err
+				}
+			}
+
+			returnUsers = append(returnUsers, *schemas.UserResponseFromModel(userModel))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return returnUsers, nil
 }
 
 func (s *authService) CompareUserPassword(identifier, password string) bool {
 	var user models.User
 
-	if err := s.db.Where("identifier = ?", identifier).First(&user).Error; err != nil {
+	err := s.db.Where("identifier = ?", identifier).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false
+	}
+	found := err == nil
+
+	// Contas de serviço só se autenticam com API keys
+	if found && user.Type == UserTypeServiceAccount {
 		return false
 	}
 
-	return utils.CheckPassword(password, user.Password)
+	// Usuários de diretórios externos (e usuários ainda desconhecidos) são autenticados pelo backend
+	for _, backend := range s.backends {
+		if found && user.Source != backend.Source() {
+			continue
+		}
+
+		_, err := backend.Authenticate(identifier, password)
+		return err == nil
+	}
+
+	if !found {
+		return false
+	}
+
+	ok, needsRehash := utils.VerifyPassword(password, user.Password)
+	if !ok {
+		return false
+	}
+
+	// Atualiza o hash de forma transparente quando o algoritmo ou os parâmetros estão desatualizados
+	if needsRehash {
+		if hashedPassword, err := utils.HashPassword(password); err == nil {
+			s.db.Model(&user).Update("password", hashedPassword)
+		}
+	}
+
+	return true
 }
 
 func (s *authService) CreateClient(client *schemas.ClientCreate) (*schemas.ClientResponse, error) {
@@ -249,6 +418,22 @@ func (s *authService) GetGroup(identifier string) (*schemas.GroupResponse, error
 	return returnGroup, nil
 }
 
+func (s *authService) GetGroups() ([]schemas.GroupResponse, error) {
+	var groups []models.Group
+
+	if err := s.db.Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	returnGroups := []schemas.GroupResponse{}
+
+	for _, group := range groups {
+		returnGroups = append(returnGroups, *schemas.GroupResponseFromModel(&group))
+	}
+
+	return returnGroups, nil
+}
+
 func (s *authService) UpdateGroup(identifier string, group *schemas.GroupUpdate) (*schemas.GroupResponse, error) {
 	var existing models.Group
 
@@ -277,11 +462,171 @@ func (s *authService) DeleteGroup(identifier string) error {
 		return err
 	}
 
-	if err := s.db.Delete(&group).Error; err != nil {
+	// Os subgrupos deixam de herdar pelo grupo removido
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&group).Error; err != nil {
+			return err
+		}
+
+		return rebuildGroupClosure(tx)
+	})
+}
+
+func (s *authService) GetGroupMembers(identifier string) ([]schemas.UserResponse, error) {
+	var group models.Group
+
+	if err := s.db.Preload("Users").Where("identifier = ?", identifier).First(&group).Error; err != nil {
+		return nil, err
+	}
+
+	returnUsers := []schemas.UserResponse{}
+
+	for _, user := range group.Users {
+		returnUsers = append(returnUsers, *schemas.UserResponseFromModel(user))
+	}
+
+	return returnUsers, nil
+}
+
+// AddGroupMembers adds the users to the group. Users that are already members are
+// left as they are; an unknown user fails the whole request.
+func (s *authService) AddGroupMembers(identifier string, users []string) error {
+	var group models.Group
+
+	if err := s.db.Where("identifier = ?", identifier).First(&group).Error; err != nil {
+		return err
+	}
+
+	if len(users) == 0 {
+		return errors.New("users cannot be empty")
+	}
+
+	var members []*models.User
+
+	if err := s.db.Where("identifier IN ?", users).Find(&members).Error; err != nil {
 		return err
 	}
 
-	return nil
+	// Compara com os identificadores distintos, já que a lista pode ter repetições
+	found := map[string]bool{}
+	for _, member := range members {
+		found[member.Identifier] = true
+	}
+
+	for _, user := range users {
+		if !found[user] {
+			return fmt.Errorf("user %s not found", user)
+		}
+	}
+
+	return s.db.Model(&group).Association("Users").Append(members)
+}
+
+func (s *authService) RemoveGroupMember(identifier, user string) error {
+	var group models.Group
+
+	if err := s.db.Where("identifier = ?", identifier).First(&group).Error; err != nil {
+		return err
+	}
+
+	var member models.User
+
+	if err := s.db.Where("identifier = ?", user).First(&member).Error; err != nil {
+		return err
+	}
+
+	return s.db.Model(&group).Association("Users").Delete(&member)
+}
+
+func (s *authService) GetUserGroups(identifier string) ([]schemas.GroupResponse, error) {
+	var user models.User
+
+	if err := s.db.Preload("Groups").Where("identifier = ?", identifier).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	returnGroups := []schemas.GroupResponse{}
+
+	for _, group := range user.Groups {
+		returnGroups = append(returnGroups, *schemas.GroupResponseFromModel(group))
+	}
+
+	return returnGroups, nil
+}
+
+func (s *authService) GetSubgroups(identifier string) ([]schemas.GroupResponse, error) {
+	var group models.Group
+
+	if err := s.db.Preload("Subgroups").Where("identifier = ?", identifier).First(&group).Error; err != nil {
+		return nil, err
+	}
+
+	returnGroups := []schemas.GroupResponse{}
+
+	for _, subgroup := range group.Subgroups {
+		returnGroups = append(returnGroups, *schemas.GroupResponseFromModel(subgroup))
+	}
+
+	return returnGroups, nil
+}
+
+// AddSubgroup nests a group inside another; members of the subgroup become
+// effective members of the group and of all its ancestors
+func (s *authService) AddSubgroup(identifier, subgroup string) error {
+	var group, child models.Group
+
+	if err := s.db.Where("identifier = ?", identifier).First(&group).Error; err != nil {
+		return err
+	}
+
+	if err := s.db.Where("identifier = ?", subgroup).First(&child).Error; err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// Há ciclo se o grupo já descende do subgrupo
+		var count int64
+		if err := tx.Model(&models.GroupClosure{}).
+			Where("ancestor_id = ? AND descendant_id = ?", child.ID, group.ID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count > 0 || child.ID == group.ID {
+			return ErrGroupCycle
+		}
+
+		if err := tx.Model(&group).Association("Subgroups").Append(&child); err != nil {
+			return err
+		}
+
+		return rebuildGroupClosure(tx)
+	})
+}
+
+func (s *authService) RemoveSubgroup(identifier, subgroup string) error {
+	var group, child models.Group
+
+	if err := s.db.Where("identifier = ?", identifier).First(&group).Error; err != nil {
+		return err
+	}
+
+	if err := s.db.Where("identifier = ?", subgroup).First(&child).Error; err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&group).Association("Subgroups").Delete(&child); err != nil {
+			return err
+		}
+
+		return rebuildGroupClosure(tx)
+	})
+}
+
+// GetGroupClaims returns the identifiers of the user's effective groups, as carried in access tokens
+func (s *authService) GetGroupClaims(userID uint) ([]string, error) {
+	return effectiveGroupIdentifiers(s.db, userID)
 }
 
 func (s *authService) CreateToken(token *schemas.TokenCreate) (*schemas.TokenResponse, error) {
@@ -317,7 +662,7 @@ func (s *authService) GetToken(identifier string) (*schemas.TokenResponse, error
 func (s *authService) GetTokenByRefreshToken(refreshToken string) (*models.Token, error) {
 	var token models.Token
 
-	if err := s.db.Where("refresh_token = ?", refreshToken).First(&token).Error; err != nil {
+	if err := s.db.Preload("User").Where("refresh_token = ?", refreshToken).First(&token).Error; err != nil {
 		return nil, err
 	}
 
@@ -1,11 +1,14 @@
 package services
 
 import (
+	"time"
+
 	"github.com/duvrdx/whoami/internal/config"
 	"github.com/duvrdx/whoami/internal/models"
 	"github.com/duvrdx/whoami/internal/schemas"
 	"github.com/duvrdx/whoami/internal/utils"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AuthzRBACService interface {
@@ -14,6 +17,10 @@ type AuthzRBACService interface {
 	GetRoles() ([]schemas.RBACRoleResponse, error)
 	UpdateRole(identifier string, role *schemas.RBACRoleUpdate) (*schemas.RBACRoleResponse, error)
 	DeleteRole(identifier string) error
+	// AddParentRole makes the role inherit every permission of the parent role
+	AddParentRole(roleIdentifier, parentIdentifier string) error
+	RemoveParentRole(roleIdentifier, parentIdentifier string) error
+	GetRoleHierarchy(identifier string) (*schemas.RBACRoleHierarchyResponse, error)
 
 	CreatePermission(permission *schemas.RBACPermissionCreate) (*schemas.RBACPermissionResponse, error)
 	GetPermission(identifier string) (*schemas.RBACPermissionResponse, error)
@@ -21,6 +28,7 @@ type AuthzRBACService interface {
 	UpdatePermission(identifier string, permission *schemas.RBACPermissionUpdate) (*schemas.RBACPermissionResponse, error)
 	DeletePermission(identifier string) error
 	AddRoleToPermission(roleIdentifier, permissionIdentifier string) error
+	RemoveRoleFromPermission(roleIdentifier, permissionIdentifier string) error
 
 	CreateResourceType(resourceType *schemas.RBACResourceTypeCreate) (*schemas.RBACResourceTypeResponse, error)
 	GetResourceType(identifier string) (*schemas.RBACResourceTypeResponse, error)
@@ -28,20 +36,56 @@ type AuthzRBACService interface {
 	UpdateResourceType(identifier string, resourceType *schemas.RBACResourceTypeUpdate) (*schemas.RBACResourceTypeResponse, error)
 	DeleteResourceType(identifier string) error
 
-	AuthorizeByResourceType(roleIdentifier, permissionIdentifier, resourceTypeIdentifier string) bool
-	AuthorizeUserByResourceType(userIdentifier, permissionIdentifier, resourceTypeIdentifier string) bool
-	AuthorizeByResource(roleIdentifier, permissionIdentifier, resourceIdentifier string) bool
-	AuthorizeUserByResource(userIdentifier, permissionIdentifier, resourceIdentifier string) bool
+	// The Authorize methods combine every permission that applies to the request, allow
+	// and deny alike, with the configured algorithm and report the rule that decided it.
+	// The permission identifier also matches permissions declaring it as their action,
+	// and permissions with a condition only apply when it holds for the attributes.
+	AuthorizeByResourceType(roleIdentifier, permissionIdentifier, resourceTypeIdentifier string, attributes *schemas.RBACAuthorizationContext) schemas.RBACDecision
+	AuthorizeUserByResourceType(userIdentifier, permissionIdentifier, resourceTypeIdentifier string, attributes *schemas.RBACAuthorizationContext) schemas.RBACDecision
+	AuthorizeByResource(roleIdentifier, permissionIdentifier, resourceIdentifier string, attributes *schemas.RBACAuthorizationContext) schemas.RBACDecision
+	AuthorizeUserByResource(userIdentifier, permissionIdentifier, resourceIdentifier string, attributes *schemas.RBACAuthorizationContext) schemas.RBACDecision
+	// AuthorizeUserBatch answers many checks for the user, loading its roles and the
+	// permissions involved once for the whole batch
+	AuthorizeUserBatch(userIdentifier string, batch *schemas.RBACBatchAuthorization) (*schemas.RBACBatchAuthorizationResponse, error)
+	// Explain returns the decision of a check along with every role and permission considered
+	Explain(userIdentifier string, request *schemas.RBACExplainRequest) (*schemas.RBACDecisionTrace, error)
+	// Simulate explains a check as it is and as it would be after the policy changes,
+	// without persisting them
+	Simulate(userIdentifier string, request *schemas.RBACSimulationRequest) (*schemas.RBACSimulationResponse, error)
 
 	GrantRoleToUser(roleIdentifier, userIdentifier string) error
+	// AssignRole grants a role to a user within an optional time window, replacing the
+	// window of an existing assignment. Assignments only count while within it.
+	AssignRole(assignment *schemas.RBACRoleAssignmentCreate, grantorIdentifier string) (*schemas.RBACRoleAssignmentResponse, error)
+	GetAssignments(filter *schemas.RBACRoleAssignmentFilter) ([]schemas.RBACRoleAssignmentResponse, error)
+	// GetExpiringAssignments lists the assignments expiring within the duration, soonest first
+	GetExpiringAssignments(within time.Duration) ([]schemas.RBACRoleAssignmentResponse, error)
+	// ExpireAssignments removes the expired assignments, recording an audit event for each
+	ExpireAssignments() (int, error)
 	RevokeRoleFromUser(roleIdentifier, userIdentifier string) error
+	GrantRoleToGroup(roleIdentifier, groupIdentifier string) error
+	RevokeRoleFromGroup(roleIdentifier, groupIdentifier string) error
 	ListGrantedRoles(userIdentifier string) ([]string, error)
-	ListGrantedResources(userIdentifier, permissionIdentifier string) ([]string, error)
-	ListGrantedResourceTypes(userIdentifier, permissionIdentifier string) ([]string, error)
+	// ListGrantedRoles, GetUserRoles and GetUserPermissions resolve the effective role set:
+	// roles held directly or through groups, plus the roles they inherit from
+	GetUserRoles(userIdentifier string) ([]schemas.RBACRoleResponse, error)
+	GetUserPermissions(userIdentifier string) ([]schemas.RBACPermissionResponse, error)
+	// ListGrantedResources lists, a page at a time, the resources the user can act on
+	// with the permission: the identifiers and patterns it is granted on, which cover
+	// their descendants, minus those a deny rule takes away
+	ListGrantedResources(userIdentifier string, filter *schemas.RBACGrantedResourceFilter) (*schemas.RBACGrantedResources, error)
+	ListGrantedResourceTypes(userIdentifier, permissionIdentifier string) ([]schemas.RBACGrantedResource, error)
+	// GetResourceAccess lists the users and groups holding the permission on the resource
+	GetResourceAccess(resourceIdentifier, permissionIdentifier string) (*schemas.RBACResourceAccess, error)
+
+	// WithRoles returns a service whose user authorization only considers the given roles,
+	// as requested by personal access tokens limited to a subset of the user's roles
+	WithRoles(roles []string) AuthzRBACService
 }
 
 type authzRBACService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	roles []string
 }
 
 // NewAuthzRBACService cria uma nova instância do serviço de RBAC
@@ -120,11 +164,118 @@ func (s *authzRBACService) DeleteRole(identifier string) error {
 		return err
 	}
 
-	if err := s.db.Delete(&role).Error; err != nil {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&role).Error; err != nil {
+			return err
+		}
+
+		// Papéis que herdavam do removido deixam de herdar por meio dele
+		return rebuildRoleClosure(tx)
+	})
+}
+
+func (s *authzRBACService) AddParentRole(roleIdentifier, parentIdentifier string) error {
+	var role, parent models.RBACRole
+
+	if err := s.db.Where("identifier = ?", roleIdentifier).First(&role).Error; err != nil {
 		return err
 	}
 
-	return nil
+	if err := s.db.Where("identifier = ?", parentIdentifier).First(&parent).Error; err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// Há ciclo se o pai já herda do papel
+		var count int64
+		if err := tx.Model(&models.RBACRoleClosure{}).
+			Where("role_id = ? AND ancestor_id = ?", parent.ID, role.ID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count > 0 || parent.ID == role.ID {
+			return ErrRoleCycle
+		}
+
+		if err := tx.Model(&role).Association("Parents").Append(&parent); err != nil {
+			return err
+		}
+
+		return rebuildRoleClosure(tx)
+	})
+}
+
+func (s *authzRBACService) RemoveParentRole(roleIdentifier, parentIdentifier string) error {
+	var role, parent models.RBACRole
+
+	if err := s.db.Where("identifier = ?", roleIdentifier).First(&role).Error; err != nil {
+		return err
+	}
+
+	if err := s.db.Where("identifier = ?", parentIdentifier).First(&parent).Error; err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Association("Parents").Delete(&parent); err != nil {
+			return err
+		}
+
+		return rebuildRoleClosure(tx)
+	})
+}
+
+// GetRoleHierarchy returns the roles the role inherits from, both flattened and as a tree of parents
+func (s *authzRBACService) GetRoleHierarchy(identifier string) (*schemas.RBACRoleHierarchyResponse, error) {
+	var role models.RBACRole
+
+	if err := s.db.Where("identifier = ?", identifier).First(&role).Error; err != nil {
+		return nil, err
+	}
+
+	var edges []struct {
+		Role   string
+		Parent string
+	}
+
+	err := s.db.Table("rbac_role_parents").
+		Select("roles.identifier AS role, parents.identifier AS parent").
+		Joins("JOIN rbac_roles roles ON roles.id = rbac_role_parents.role_id AND roles.deleted_at IS NULL").
+		Joins("JOIN rbac_roles parents ON parents.id = rbac_role_parents.parent_id AND parents.deleted_at IS NULL").
+		Order("parents.identifier").
+		Scan(&edges).Error
+	if err != nil {
+		return nil, err
+	}
+
+	parents := map[string][]string{}
+	for _, edge := range edges {
+		parents[edge.Role] = append(parents[edge.Role], edge.Parent)
+	}
+
+	var inherited []string
+	if err := s.db.Model(&models.RBACRole{}).
+		Where("id IN (?)", s.db.Model(&models.RBACRoleClosure{}).Select("ancestor_id").Where("role_id = ?", role.ID)).
+		Order("identifier").
+		Pluck("identifier", &inherited).Error; err != nil {
+		return nil, err
+	}
+
+	var chain func(identifier string) []schemas.RBACRoleInheritance
+	chain = func(identifier string) []schemas.RBACRoleInheritance {
+		nodes := []schemas.RBACRoleInheritance{}
+		for _, parent := range parents[identifier] {
+			nodes = append(nodes, schemas.RBACRoleInheritance{Identifier: parent, Parents: chain(parent)})
+		}
+		return nodes
+	}
+
+	return &schemas.RBACRoleHierarchyResponse{
+		Role:      role.Identifier,
+		Inherited: inherited,
+		Parents:   chain(role.Identifier),
+	}, nil
 }
 
 // RBACPermission
@@ -159,8 +310,18 @@ func (s *authzRBACService) GetPermissions() ([]schemas.RBACPermissionResponse, e
 
 func (s *authzRBACService) CreatePermission(permission *schemas.RBACPermissionCreate) (*schemas.RBACPermissionResponse, error) {
 	permissionModel := schemas.RBACPermissionFromCreate(permission)
+	// Os recursos são criados por associateResources, que classifica os padrões
+	permissionModel.ResourceIdentifiers = nil
 
-	if err := s.associateResources(permissionModel, permission.ResourceIdentifiers); err != nil {
+	if err := validateResourceIdentifiers(permission.ResourceIdentifiers); err != nil {
+		return nil, err
+	}
+
+	if err := validateEffect(permission.Effect); err != nil {
+		return nil, err
+	}
+
+	if err := validateCondition(permission.Condition); err != nil {
 		return nil, err
 	}
 
@@ -168,6 +329,11 @@ func (s *authzRBACService) CreatePermission(permission *schemas.RBACPermissionCr
 		return nil, err
 	}
 
+	// A associação precisa do ID da permissão já criada
+	if err := s.associateResources(permissionModel, permission.ResourceIdentifiers); err != nil {
+		return nil, err
+	}
+
 	return schemas.RBACPermissionResponseFromModel(permissionModel), nil
 }
 
@@ -179,6 +345,22 @@ func (s *authzRBACService) UpdatePermission(identifier string, permission *schem
 
 	updateData := utils.MakeObjectWithoutNilFields(permission)
 
+	if err := validateResourceIdentifiers(permission.ResourceIdentifiers); err != nil {
+		return nil, err
+	}
+
+	if permission.Effect != nil {
+		if err := validateEffect(*permission.Effect); err != nil {
+			return nil, err
+		}
+	}
+
+	if permission.Condition != nil {
+		if err := validateCondition(*permission.Condition); err != nil {
+			return nil, err
+		}
+	}
+
 	if permission.ResourceIdentifiers != nil {
 		if err := s.associateResources(&existing, permission.ResourceIdentifiers); err != nil {
 			return nil, err
@@ -210,9 +392,11 @@ func (s *authzRBACService) associateResources(permission *models.RBACPermission,
 	var newResources []models.RBACResourceIdentifier
 	for _, identifier := range resourceIdentifiers {
 		if !existingMap[identifier] {
-			newResources = append(newResources, models.RBACResourceIdentifier{
-				Identifier: identifier,
-			})
+			resource, err := newResourceIdentifier(identifier)
+			if err != nil {
+				return err
+			}
+			newResources = append(newResources, resource)
 		}
 	}
 
@@ -258,6 +442,23 @@ func (s *authzRBACService) AddRoleToPermission(roleIdentifier, permissionIdentif
 	return s.db.Model(&permission).Association("AcceptedRoles").Append(&role)
 }
 
+func (s *authzRBACService) RemoveRoleFromPermission(roleIdentifier, permissionIdentifier string) error {
+	var role models.RBACRole
+	var permission models.RBACPermission
+
+	// Verifica se o papel e a permissão existem
+	if err := s.db.Where("identifier = ?", roleIdentifier).First(&role).Error; err != nil {
+		return err
+	}
+
+	if err := s.db.Where("identifier = ?", permissionIdentifier).First(&permission).Error; err != nil {
+		return err
+	}
+
+	// Remove a permissão do papel
+	return s.db.Model(&permission).Association("AcceptedRoles").Delete(&role)
+}
+
 // RBACResourceType
 func (s *authzRBACService) CreateResourceType(resourceType *schemas.RBACResourceTypeCreate) (*schemas.RBACResourceTypeResponse, error) {
 	resourceTypeModel := schemas.RBACResourceTypeFromCreate(resourceType)
@@ -335,111 +536,174 @@ func (s *authzRBACService) DeleteResourceType(identifier string) error {
 }
 
 // Autorização
-func (s *authzRBACService) AuthorizeByResourceType(roleIdentifier, permissionIdentifier, resourceTypeIdentifier string) bool {
-	var role models.RBACRole
-	var permission models.RBACPermission
-	var resourceType models.RBACResourceType
+func (s *authzRBACService) AuthorizeByResourceType(roleIdentifier, permissionIdentifier, resourceTypeIdentifier string, attributes *schemas.RBACAuthorizationContext) schemas.RBACDecision {
+	algorithm := combiningAlgorithm()
 
-	// Verifica se o papel, a permissão e o tipo de recurso existem
+	var role models.RBACRole
 	if err := s.db.Where("identifier = ?", roleIdentifier).First(&role).Error; err != nil {
-		return false
+		return denyDecision(algorithm, "role not found")
 	}
 
-	if err := s.db.Where("identifier = ?", permissionIdentifier).First(&permission).Error; err != nil {
-		return false
+	rules, err := resourceTypeRules(s.db, inheritedRoleIDs(s.db, []uint{role.ID}), permissionIdentifier, resourceTypeIdentifier)
+	if err != nil {
+		return denyDecision(algorithm, err.Error())
 	}
 
-	if err := s.db.Where("identifier = ?", resourceTypeIdentifier).First(&resourceType).Error; err != nil {
-		return false
-	}
+	activation := conditionActivation(nil, attributes, map[string]interface{}{"type": resourceTypeIdentifier})
+	return combineRules(applyConditions(rules, activation), algorithm)
+}
 
-	// Verifica se a permissão está associada ao tipo de recurso
-	if permission.ResourceTypeID == nil || *permission.ResourceTypeID != resourceType.ID {
-		return false
+// effectiveRoles returns the roles granted to the user directly or to any of its
+// effective groups, along with every role they inherit from
+func (s *authzRBACService) effectiveRoles(user *models.User) ([]models.RBACRole, error) {
+	roles := []models.RBACRole{}
+
+	direct := activeAssignments(s.db).Select("rbac_role_id").Where("user_id = ?", user.ID)
+	inherited := s.db.Table("rbac_role_groups").Select("rbac_role_id").
+		Where("group_id IN (?)", effectiveGroups(s.db, user.ID).Select("groups.id"))
+
+	granted := s.db.Model(&models.RBACRole{}).Select("id").Where("id IN (?) OR id IN (?)", direct, inherited)
+	// A restrição de um token vale para os papéis concedidos; a herança deles é mantida
+	if s.roles != nil {
+		granted = granted.Where("identifier IN ?", s.roles)
 	}
 
-	// Verifica se o papel tem a permissão
-	exists := s.db.Model(&role).Where("id = ?", permission.ID).Association("Permissions").Count() > 0
-	return exists
+	err := s.db.Where("id IN (?)", inheritedRoleIDs(s.db, granted)).Order("identifier").Find(&roles).Error
 
+	return roles, err
 }
 
-func (s *authzRBACService) AuthorizeUserByResourceType(userIdentifier, permissionIdentifier, resourceTypeIdentifier string) bool {
-	user := models.User{}
-	roles := []models.RBACRole{}
+// effectiveRoleIDs resolves the user and the IDs of its effective roles
+func (s *authzRBACService) effectiveRoleIDs(userIdentifier string) (*models.User, []uint, error) {
+	var user models.User
 
 	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
-		return false
+		return nil, nil, err
 	}
 
-	if err := s.db.
-		Joins("JOIN rbac_role_users ON rbac_role_users.rbac_role_id = rbac_roles.id").
-		Where("rbac_role_users.user_id = ?", user.ID).
-		Find(&roles).Error; err != nil {
-		return false
+	roles, err := s.effectiveRoles(&user)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	for _, role := range roles {
-		if s.AuthorizeUserByResourceType(role.Identifier, permissionIdentifier, resourceTypeIdentifier) {
-			return true
-		}
+	roleIDs := make([]uint, len(roles))
+	for i, role := range roles {
+		roleIDs[i] = role.ID
 	}
 
-	return false
+	return &user, roleIDs, nil
 }
 
-func (s *authzRBACService) AuthorizeByResource(roleIdentifier, permissionIdentifier, resourceIdentifier string) bool {
-	var role models.RBACRole
-	var permission models.RBACPermission
-	var resource models.RBACResourceIdentifier
+func (s *authzRBACService) WithRoles(roles []string) AuthzRBACService {
+	return &authzRBACService{
+		db:    s.db,
+		roles: roles,
+	}
+}
+
+func (s *authzRBACService) AuthorizeUserByResourceType(userIdentifier, permissionIdentifier, resourceTypeIdentifier string, attributes *schemas.RBACAuthorizationContext) schemas.RBACDecision {
+	algorithm := combiningAlgorithm()
+
+	user, roleIDs, err := s.effectiveRoleIDs(userIdentifier)
+	if err != nil {
+		return denyDecision(algorithm, "user not found")
+	}
+
+	// Os papéis efetivos já incluem os herdados
+	rules, err := resourceTypeRules(s.db, roleIDs, permissionIdentifier, resourceTypeIdentifier)
+	if err != nil {
+		return denyDecision(algorithm, err.Error())
+	}
 
-	// Verifica se o papel, a permissão e o recurso existem
+	activation := conditionActivation(user, attributes, map[string]interface{}{"type": resourceTypeIdentifier})
+	return combineRules(applyConditions(rules, activation), algorithm)
+}
+
+func (s *authzRBACService) AuthorizeByResource(roleIdentifier, permissionIdentifier, resourceIdentifier string, attributes *schemas.RBACAuthorizationContext) schemas.RBACDecision {
+	algorithm := combiningAlgorithm()
+
+	var role models.RBACRole
 	if err := s.db.Where("identifier = ?", roleIdentifier).First(&role).Error; err != nil {
-		return false
+		return denyDecision(algorithm, "role not found")
 	}
 
-	if err := s.db.Where("identifier = ?", permissionIdentifier).First(&permission).Error; err != nil {
-		return false
+	// Regras que cobrem o recurso, diretamente, por um ancestral ou por um padrão
+	rules, err := resourceRules(s.db, inheritedRoleIDs(s.db, []uint{role.ID}), permissionIdentifier, resourceIdentifier)
+	if err != nil {
+		return denyDecision(algorithm, err.Error())
 	}
 
-	if err := s.db.Where("identifier = ?", resourceIdentifier).First(&resource).Error; err != nil {
-		return false
+	activation := conditionActivation(nil, attributes, map[string]interface{}{"id": resourceIdentifier})
+	return combineRules(applyConditions(rules, activation), algorithm)
+}
+
+func (s *authzRBACService) AuthorizeUserByResource(userIdentifier, permissionIdentifier, resourceIdentifier string, attributes *schemas.RBACAuthorizationContext) schemas.RBACDecision {
+	algorithm := combiningAlgorithm()
+
+	user, roleIDs, err := s.effectiveRoleIDs(userIdentifier)
+	if err != nil {
+		return denyDecision(algorithm, "user not found")
 	}
 
-	// Verifica se a permissão está associada ao recurso
-	count := s.db.Model(&permission).Where("id = ?", resource.ID).Association("ResourceIdentifiers").Count()
-	if count == 0 {
-		return false
+	// O recurso é resolvido uma única vez, e não para cada papel do usuário
+	rules, err := resourceRules(s.db, roleIDs, permissionIdentifier, resourceIdentifier)
+	if err != nil {
+		return denyDecision(algorithm, err.Error())
 	}
 
-	// Verifica se o papel tem a permissão
-	count = s.db.Model(&role).Where("id = ?", permission.ID).Association("Permissions").Count()
-	return count > 0
+	activation := conditionActivation(user, attributes, map[string]interface{}{"id": resourceIdentifier})
+	return combineRules(applyConditions(rules, activation), algorithm)
 }
 
-func (s *authzRBACService) AuthorizeUserByResource(userIdentifier, permissionIdentifier, resourceIdentifier string) bool {
-	user := models.User{}
-	roles := []models.RBACRole{}
+func (s *authzRBACService) AuthorizeUserBatch(userIdentifier string, batch *schemas.RBACBatchAuthorization) (*schemas.RBACBatchAuthorizationResponse, error) {
+	if len(batch.Checks) > config.Config.Authz.BatchMaxChecks {
+		return nil, ErrBatchTooLarge
+	}
 
-	// Primeiro busca o usuário pelo identifier
-	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
-		return false
+	algorithm := combiningAlgorithm()
+
+	user, roleIDs, err := s.effectiveRoleIDs(userIdentifier)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.db.
-		Joins("JOIN rbac_role_users ON rbac_role_users.rbac_role_id = rbac_roles.id").
-		Where("rbac_role_users.user_id = ?", user.ID).
-		Find(&roles).Error; err != nil {
-		return false
+	actions := []string{}
+	seen := map[string]bool{}
+	for _, check := range batch.Checks {
+		if !seen[check.Permission] {
+			seen[check.Permission] = true
+			actions = append(actions, check.Permission)
+		}
 	}
 
-	for _, role := range roles {
-		if s.AuthorizeByResource(role.Identifier, permissionIdentifier, resourceIdentifier) {
-			return true
+	rows, err := batchRules(s.db, roleIDs, actions)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &schemas.RBACBatchAuthorizationResponse{
+		Subject:   user.Identifier,
+		Decisions: make([]schemas.RBACDecision, len(batch.Checks)),
+	}
+
+	for i, check := range batch.Checks {
+		if (check.Resource == "") == (check.ResourceType == "") {
+			response.Decisions[i] = denyDecision(algorithm, ErrCheckAmbiguous.Error())
+			continue
+		}
+
+		resource := map[string]interface{}{"id": check.Resource}
+		if check.ResourceType != "" {
+			resource = map[string]interface{}{"type": check.ResourceType}
 		}
+
+		attributes := &schemas.RBACAuthorizationContext{Resource: check.Attributes, Environment: batch.Environment}
+		activation := conditionActivation(user, attributes, resource)
+
+		response.Decisions[i] = combineRules(applyConditions(matchRules(rows, check), activation), algorithm)
 	}
 
-	return false
+	return response, nil
 }
 
 // Gerenciamento de Papéis e Permissões
@@ -456,7 +720,11 @@ func (s *authzRBACService) GrantRoleToUser(roleIdentifier, userIdentifier string
 		return err
 	}
 
-	return s.db.Model(&role).Association("Users").Append(&user)
+	// Atribuição permanente; se já havia uma com janela, ela passa a não expirar
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "rbac_role_id"}, {Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"not_before": nil, "expires_at": nil, "updated_at": time.Now()}),
+	}).Create(&models.RBACRoleAssignment{RoleID: role.ID, UserID: user.ID}).Error
 }
 
 func (s *authzRBACService) RevokeRoleFromUser(roleIdentifier, userIdentifier string) error {
@@ -473,81 +741,114 @@ func (s *authzRBACService) RevokeRoleFromUser(roleIdentifier, userIdentifier str
 	}
 
 	// Remove o papel do usuário
-	return s.db.Model(&role).Association("Users").Delete(&user)
+	return s.db.Where("rbac_role_id = ? AND user_id = ?", role.ID, user.ID).Delete(&models.RBACRoleAssignment{}).Error
 }
 
-func (s *authzRBACService) ListGrantedRoles(userIdentifier string) ([]string, error) {
+func (s *authzRBACService) GrantRoleToGroup(roleIdentifier, groupIdentifier string) error {
+	var role models.RBACRole
+	var group models.Group
+
+	// Verifica se o papel e o grupo existem
+	if err := s.db.Where("identifier = ?", roleIdentifier).First(&role).Error; err != nil {
+		return err
+	}
+
+	if err := s.db.Where("identifier = ?", groupIdentifier).First(&group).Error; err != nil {
+		return err
+	}
+
+	return s.db.Model(&role).Association("Groups").Append(&group)
+}
+
+func (s *authzRBACService) RevokeRoleFromGroup(roleIdentifier, groupIdentifier string) error {
+	var role models.RBACRole
+	var group models.Group
+
+	// Verifica se o papel e o grupo existem
+	if err := s.db.Where("identifier = ?", roleIdentifier).First(&role).Error; err != nil {
+		return err
+	}
+
+	if err := s.db.Where("identifier = ?", groupIdentifier).First(&group).Error; err != nil {
+		return err
+	}
+
+	// Remove o papel do grupo
+	return s.db.Model(&role).Association("Groups").Delete(&group)
+}
+
+func (s *authzRBACService) GetUserRoles(userIdentifier string) ([]schemas.RBACRoleResponse, error) {
 	var user models.User
 
-	// Verifica se o usuário existe
 	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
 		return nil, err
 	}
 
-	// Lista os papéis associados ao usuário
-	var roles []models.RBACRole
-	if err := s.db.Model(&user).Association("Roles").Find(&roles); err != nil {
+	roles, err := s.effectiveRoles(&user)
+	if err != nil {
 		return nil, err
 	}
 
-	roleIdentifiers := make([]string, len(roles))
-	for i, role := range roles {
-		roleIdentifiers[i] = role.Identifier
+	returnRoles := []schemas.RBACRoleResponse{}
+	for _, role := range roles {
+		returnRoles = append(returnRoles, *schemas.RBACRoleResponseFromModel(&role))
 	}
 
-	return roleIdentifiers, nil
+	return returnRoles, nil
 }
 
-func (s *authzRBACService) ListGrantedResources(userIdentifier, permissionIdentifier string) ([]string, error) {
+func (s *authzRBACService) GetUserPermissions(userIdentifier string) ([]schemas.RBACPermissionResponse, error) {
 	var user models.User
-	var permission models.RBACPermission
 
-	// Verifica se o usuário e a permissão existem
 	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
 		return nil, err
 	}
 
-	if err := s.db.Where("identifier = ?", permissionIdentifier).First(&permission).Error; err != nil {
+	roles, err := s.effectiveRoles(&user)
+	if err != nil {
 		return nil, err
 	}
 
-	// Lista os recursos associados à permissão
-	var resources []models.RBACResourceIdentifier
-	if err := s.db.Model(&permission).Association("ResourceIdentifiers").Find(&resources); err != nil {
+	roleIDs := make([]uint, len(roles))
+	for i, role := range roles {
+		roleIDs[i] = role.ID
+	}
+
+	var permissions []models.RBACPermission
+
+	if err := s.db.Preload("ResourceIdentifiers").
+		Where("id IN (?)", s.db.Table("rbac_role_permissions").Select("rbac_permission_id").Where("rbac_role_id IN ?", roleIDs)).
+		Order("identifier").
+		Find(&permissions).Error; err != nil {
 		return nil, err
 	}
 
-	resourceIdentifiers := make([]string, len(resources))
-	for i, resource := range resources {
-		resourceIdentifiers[i] = resource.Identifier
+	returnPermissions := []schemas.RBACPermissionResponse{}
+	for _, permission := range permissions {
+		returnPermissions = append(returnPermissions, *schemas.RBACPermissionResponseFromModel(&permission))
 	}
 
-	return resourceIdentifiers, nil
+	return returnPermissions, nil
 }
 
-func (s *authzRBACService) ListGrantedResourceTypes(userIdentifier, permissionIdentifier string) ([]string, error) {
+func (s *authzRBACService) ListGrantedRoles(userIdentifier string) ([]string, error) {
 	var user models.User
-	var permission models.RBACPermission
 
-	// Verifica se o usuário e a permissão existem
+	// Verifica se o usuário existe
 	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
 		return nil, err
 	}
 
-	if err := s.db.Where("identifier = ?", permissionIdentifier).First(&permission).Error; err != nil {
-		return nil, err
-	}
-
-	// Lista os tipos de recurso associados à permissão
-	var resourceTypes []models.RBACResourceType
-	if err := s.db.Model(&permission).Association("ResourceType").Find(&resourceTypes); err != nil {
+	// Lista os papéis efetivos: diretos, de grupos e herdados
+	roles, err := s.effectiveRoles(&user)
+	if err != nil {
 		return nil, err
 	}
 
-	resourceTypeIdentifiers := make([]string, len(resourceTypes))
-	for i, resourceType := range resourceTypes {
-		resourceTypeIdentifiers[i] = resourceType.Identifier
+	roleIdentifiers := make([]string, len(roles))
+	for i, role := range roles {
+		roleIdentifiers[i] = role.Identifier
 	}
 
-	return resourceTypeIdentifiers, nil
+	return roleIdentifiers, nil
 }
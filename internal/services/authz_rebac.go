@@ -0,0 +1,422 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"gorm.io/gorm"
+)
+
+const (
+	ReBACChangeWrite     = "write"
+	ReBACChangeDelete    = "delete"
+	ReBACChangeNamespace = "namespace"
+)
+
+// AuthzReBACService is the relationship-based authorization subsystem: namespaces
+// define the relations of each object type, tuples relate subjects to objects and the
+// queries evaluate the relations through their userset rewrites. Every write returns
+// a zookie, and reads given one are evaluated at a revision at least as fresh.
+type AuthzReBACService interface {
+	CreateNamespace(namespace *schemas.ReBACNamespaceCreate) (*schemas.ReBACNamespaceResponse, error)
+	GetNamespace(name string) (*schemas.ReBACNamespaceResponse, error)
+	GetNamespaces() ([]schemas.ReBACNamespaceResponse, error)
+	UpdateNamespace(name string, namespace *schemas.ReBACNamespaceUpdate) (*schemas.ReBACNamespaceResponse, error)
+	// DeleteNamespace also deletes the tuples of its objects
+	DeleteNamespace(name string) error
+
+	WriteTuples(write *schemas.ReBACTupleWrite) (*schemas.ReBACWriteResponse, error)
+	ReadTuples(filter *schemas.ReBACTupleFilter) (*schemas.ReBACTuplesResponse, error)
+
+	Check(request *schemas.ReBACCheckRequest) (*schemas.ReBACCheckResponse, error)
+	Expand(request *schemas.ReBACExpandRequest) (*schemas.ReBACExpandResponse, error)
+	ListObjects(request *schemas.ReBACListObjectsRequest) (*schemas.ReBACListObjectsResponse, error)
+	ListUsers(request *schemas.ReBACListUsersRequest) (*schemas.ReBACListUsersResponse, error)
+}
+
+type authzReBACService struct {
+	db *gorm.DB
+}
+
+func NewAuthzReBACService() AuthzReBACService {
+	return &authzReBACService{
+		db: config.GetDB(),
+	}
+}
+
+// recordChange appends to the change log and returns the new revision
+func recordChange(tx *gorm.DB, operation, tuple string) (uint, error) {
+	change := models.ReBACChange{Operation: operation, Tuple: tuple}
+	err := tx.Create(&change).Error
+	return change.ID, err
+}
+
+// Namespaces
+func (s *authzReBACService) CreateNamespace(namespace *schemas.ReBACNamespaceCreate) (*schemas.ReBACNamespaceResponse, error) {
+	if namespace.Name == "" || len(namespace.Relations) == 0 {
+		return nil, fmt.Errorf("%w: a namespace needs a name and relations", ErrInvalidRewrite)
+	}
+
+	if err := validateRelations(namespace.Relations); err != nil {
+		return nil, err
+	}
+
+	relations, err := json.Marshal(namespace.Relations)
+	if err != nil {
+		return nil, err
+	}
+
+	model := models.ReBACNamespace{Name: namespace.Name, Relations: string(relations)}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&model).Error; err != nil {
+			return err
+		}
+
+		_, err := recordChange(tx, ReBACChangeNamespace, model.Name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schemas.ReBACNamespaceResponseFromModel(&model), nil
+}
+
+func (s *authzReBACService) GetNamespace(name string) (*schemas.ReBACNamespaceResponse, error) {
+	var namespace models.ReBACNamespace
+
+	if err := s.db.Where("name = ?", name).First(&namespace).Error; err != nil {
+		return nil, err
+	}
+
+	return schemas.ReBACNamespaceResponseFromModel(&namespace), nil
+}
+
+func (s *authzReBACService) GetNamespaces() ([]schemas.ReBACNamespaceResponse, error) {
+	var namespaces []models.ReBACNamespace
+
+	if err := s.db.Order("name").Find(&namespaces).Error; err != nil {
+		return nil, err
+	}
+
+	returnNamespaces := []schemas.ReBACNamespaceResponse{}
+	for _, namespace := range namespaces {
+		returnNamespaces = append(returnNamespaces, *schemas.ReBACNamespaceResponseFromModel(&namespace))
+	}
+
+	return returnNamespaces, nil
+}
+
+func (s *authzReBACService) UpdateNamespace(name string, namespace *schemas.ReBACNamespaceUpdate) (*schemas.ReBACNamespaceResponse, error) {
+	var existing models.ReBACNamespace
+
+	if err := s.db.Where("name = ?", name).First(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	if len(namespace.Relations) == 0 {
+		return nil, fmt.Errorf("%w: a namespace needs relations", ErrInvalidRewrite)
+	}
+
+	if err := validateRelations(namespace.Relations); err != nil {
+		return nil, err
+	}
+
+	relations, err := json.Marshal(namespace.Relations)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&existing).Update("relations", string(relations)).Error; err != nil {
+			return err
+		}
+
+		_, err := recordChange(tx, ReBACChangeNamespace, existing.Name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schemas.ReBACNamespaceResponseFromModel(&existing), nil
+}
+
+func (s *authzReBACService) DeleteNamespace(name string) error {
+	var namespace models.ReBACNamespace
+
+	if err := s.db.Where("name = ?", name).First(&namespace).Error; err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("namespace = ?", namespace.Name).Delete(&models.ReBACTuple{}).Error; err != nil {
+			return err
+		}
+
+		// Exclusão definitiva, para o nome poder ser reutilizado
+		if err := tx.Unscoped().Delete(&namespace).Error; err != nil {
+			return err
+		}
+
+		_, err := recordChange(tx, ReBACChangeNamespace, namespace.Name)
+		return err
+	})
+}
+
+// Tuples
+func tupleModel(tuple schemas.ReBACTuple) (models.ReBACTuple, error) {
+	object, err := parseReBACObject(tuple.Object)
+	if err != nil {
+		return models.ReBACTuple{}, err
+	}
+
+	subject, err := parseReBACSubject(tuple.Subject)
+	if err != nil {
+		return models.ReBACTuple{}, err
+	}
+
+	if tuple.Relation == "" {
+		return models.ReBACTuple{}, ErrReBACUnknownRelation
+	}
+
+	return models.ReBACTuple{
+		Namespace:        object.Namespace,
+		ObjectID:         object.ID,
+		Relation:         tuple.Relation,
+		SubjectNamespace: subject.Namespace,
+		SubjectObjectID:  subject.ID,
+		SubjectRelation:  subject.Relation,
+	}, nil
+}
+
+func (s *authzReBACService) WriteTuples(write *schemas.ReBACTupleWrite) (*schemas.ReBACWriteResponse, error) {
+	var revision uint
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		evaluator := newReBACEvaluator(tx)
+
+		var err error
+		if revision, err = currentRevision(tx); err != nil {
+			return err
+		}
+
+		for _, tuple := range write.Deletes {
+			model, err := tupleModel(tuple)
+			if err != nil {
+				return err
+			}
+
+			if err := tx.Where(&model, "Namespace", "ObjectID", "Relation", "SubjectNamespace", "SubjectObjectID", "SubjectRelation").
+				Delete(&models.ReBACTuple{}).Error; err != nil {
+				return err
+			}
+
+			if revision, err = recordChange(tx, ReBACChangeDelete, tuple.String()); err != nil {
+				return err
+			}
+		}
+
+		for _, tuple := range write.Writes {
+			model, err := tupleModel(tuple)
+			if err != nil {
+				return err
+			}
+
+			// A relação precisa existir no namespace do objeto, e a do userset no namespace do sujeito
+			if _, err := evaluator.rewrite(model.Namespace, model.Relation); err != nil {
+				return err
+			}
+			if model.SubjectRelation != "" {
+				if _, err := evaluator.rewrite(model.SubjectNamespace, model.SubjectRelation); err != nil {
+					return err
+				}
+			}
+
+			// Escrever uma tupla existente não é erro
+			if err := tx.Where(&model, "Namespace", "ObjectID", "Relation", "SubjectNamespace", "SubjectObjectID", "SubjectRelation").
+				FirstOrCreate(&model).Error; err != nil {
+				return err
+			}
+
+			if revision, err = recordChange(tx, ReBACChangeWrite, tuple.String()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &schemas.ReBACWriteResponse{Zookie: encodeZookie(revision)}, nil
+}
+
+func (s *authzReBACService) ReadTuples(filter *schemas.ReBACTupleFilter) (*schemas.ReBACTuplesResponse, error) {
+	revision, err := readRevision(s.db, filter.Zookie)
+	if err != nil {
+		return nil, err
+	}
+
+	query := s.db.Order("id")
+
+	if filter.Namespace != "" {
+		query = query.Where("namespace = ?", filter.Namespace)
+	}
+
+	if filter.Object != "" {
+		object, err := parseReBACObject(filter.Object)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("namespace = ? AND object_id = ?", object.Namespace, object.ID)
+	}
+
+	if filter.Relation != "" {
+		query = query.Where("relation = ?", filter.Relation)
+	}
+
+	if filter.Subject != "" {
+		subject, err := parseReBACSubject(filter.Subject)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("subject_namespace = ? AND subject_object_id = ? AND subject_relation = ?",
+			subject.Namespace, subject.ID, subject.Relation)
+	}
+
+	var tuples []models.ReBACTuple
+	if err := query.Find(&tuples).Error; err != nil {
+		return nil, err
+	}
+
+	response := &schemas.ReBACTuplesResponse{Tuples: []schemas.ReBACTuple{}, Zookie: encodeZookie(revision)}
+	for i := range tuples {
+		response.Tuples = append(response.Tuples, schemas.ReBACTupleFromModel(&tuples[i]))
+	}
+
+	return response, nil
+}
+
+// Queries
+func (s *authzReBACService) Check(request *schemas.ReBACCheckRequest) (*schemas.ReBACCheckResponse, error) {
+	revision, err := readRevision(s.db, request.Zookie)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := parseReBACObject(request.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := parseReBACSubject(request.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := newReBACEvaluator(s.db).check(object, request.Relation, subject, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schemas.ReBACCheckResponse{Allowed: allowed, Zookie: encodeZookie(revision)}, nil
+}
+
+func (s *authzReBACService) Expand(request *schemas.ReBACExpandRequest) (*schemas.ReBACExpandResponse, error) {
+	revision, err := readRevision(s.db, request.Zookie)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := parseReBACObject(request.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := newReBACEvaluator(s.db).expand(object, request.Relation, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schemas.ReBACExpandResponse{Tree: tree, Zookie: encodeZookie(revision)}, nil
+}
+
+// ListObjects checks the subject against every object of the namespace that has a
+// tuple. Rewrites are always evaluated from the object's own tuples, so an object
+// without any can't have the relation.
+func (s *authzReBACService) ListObjects(request *schemas.ReBACListObjectsRequest) (*schemas.ReBACListObjectsResponse, error) {
+	revision, err := readRevision(s.db, request.Zookie)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := parseReBACSubject(request.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	evaluator := newReBACEvaluator(s.db)
+	if _, err := evaluator.rewrite(request.Namespace, request.Relation); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	if err := s.db.Model(&models.ReBACTuple{}).
+		Where("namespace = ?", request.Namespace).
+		Distinct("object_id").
+		Order("object_id").
+		Pluck("object_id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	objects := []string{}
+	for _, id := range ids {
+		object := rebacObject{Namespace: request.Namespace, ID: id}
+
+		allowed, err := evaluator.check(object, request.Relation, subject, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if allowed {
+			objects = append(objects, object.String())
+		}
+	}
+
+	return &schemas.ReBACListObjectsResponse{Objects: objects, Zookie: encodeZookie(revision)}, nil
+}
+
+func (s *authzReBACService) ListUsers(request *schemas.ReBACListUsersRequest) (*schemas.ReBACListUsersResponse, error) {
+	revision, err := readRevision(s.db, request.Zookie)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := parseReBACObject(request.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := newReBACEvaluator(s.db).members(object, request.Relation, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	subjects := []string{}
+	for _, member := range sortedMembers(members) {
+		if request.SubjectNamespace != "" {
+			if subject, err := parseReBACObject(member); err != nil || subject.Namespace != request.SubjectNamespace {
+				continue
+			}
+		}
+		subjects = append(subjects, member)
+	}
+
+	return &schemas.ReBACListUsersResponse{Subjects: subjects, Zookie: encodeZookie(revision)}, nil
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/utils"
+)
+
+var ErrPasswordBreached = errors.New("password appears in a known data breach")
+
+// BreachChecker screens passwords against a locally stored list of compromised passwords
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+var (
+	breachChecker     BreachChecker
+	breachCheckerErr  error
+	breachCheckerOnce sync.Once
+)
+
+// NewBreachChecker returns the checker configured in password.breach. The filter
+// is loaded once and shared, since it can take hundreds of megabytes. A filter or
+// corpus that can't be loaded is an error rather than an empty list, so password
+// changes are refused instead of skipping the check.
+func NewBreachChecker() (BreachChecker, error) {
+	breachCheckerOnce.Do(func() {
+		cfg := config.Config.Password.Breach
+
+		switch {
+		case cfg.FilterPath != "":
+			breachChecker, breachCheckerErr = newBloomBreachChecker(cfg.FilterPath)
+		case cfg.CorpusPath != "":
+			breachChecker, breachCheckerErr = newCorpusBreachChecker(cfg.CorpusPath, cfg.MinCount)
+		default:
+			breachChecker = noopBreachChecker{}
+		}
+
+		if breachCheckerErr != nil {
+			breachCheckerErr = fmt.Errorf("loading breached password list: %w", breachCheckerErr)
+		}
+	})
+
+	return breachChecker, breachCheckerErr
+}
+
+// checkPasswordBreach applies password.breach.policy: "reject" returns
+// ErrPasswordBreached, "flag" only reports the match so it can be recorded.
+func checkPasswordBreach(password string) (flagged bool, err error) {
+	policy := config.Config.Password.Breach.Policy
+	if policy == "off" {
+		return false, nil
+	}
+
+	checker, err := NewBreachChecker()
+	if err != nil {
+		return false, err
+	}
+
+	breached, err := checker.IsBreached(password)
+	if err != nil {
+		return false, err
+	}
+
+	if !breached {
+		return false, nil
+	}
+
+	if policy == "flag" {
+		return true, nil
+	}
+
+	return false, ErrPasswordBreached
+}
+
+type noopBreachChecker struct{}
+
+func (noopBreachChecker) IsBreached(password string) (bool, error) {
+	return false, nil
+}
+
+// bloomBreachChecker uses a filter built by cmd/breachfilter
+type bloomBreachChecker struct {
+	filter *utils.BloomFilter
+}
+
+func newBloomBreachChecker(path string) (*bloomBreachChecker, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	filter, err := utils.ReadBloomFilter(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bloomBreachChecker{filter: filter}, nil
+}
+
+func (c *bloomBreachChecker) IsBreached(password string) (bool, error) {
+	return c.filter.Test(sha1.Sum([]byte(password))), nil
+}
+
+// corpusBreachChecker reads a directory of SHA-1 range files, one per 5 character
+// hash prefix (as produced by the usual k-anonymity downloaders), each holding
+// "SUFFIX:COUNT" lines. Only the file matching the password's prefix is read.
+type corpusBreachChecker struct {
+	dir      string
+	minCount int
+}
+
+func newCorpusBreachChecker(dir string, minCount int) (corpusBreachChecker, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return corpusBreachChecker{}, err
+	}
+
+	if !info.IsDir() {
+		return corpusBreachChecker{}, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	return corpusBreachChecker{dir: dir, minCount: minCount}, nil
+}
+
+func (c corpusBreachChecker) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix := digest[:5]
+
+	file, err := os.Open(filepath.Join(c.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(c.dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineDigest, count, ok := utils.ParseSHA1CountLine(scanner.Text(), prefix)
+		if ok && lineDigest == sum {
+			return count >= c.minCount, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/utils"
+)
+
+// useTestBreachConfig applies the breach configuration and drops the shared checker,
+// so the next check loads it again
+func useTestBreachConfig(t *testing.T, breach config.BreachConfig) {
+	t.Helper()
+
+	previous := config.Config.Password.Breach
+	config.Config.Password.Breach = breach
+	breachCheckerOnce = sync.Once{}
+
+	t.Cleanup(func() {
+		config.Config.Password.Breach = previous
+		breachCheckerOnce = sync.Once{}
+	})
+}
+
+func writeTestBloomFilter(t *testing.T, passwords ...string) string {
+	t.Helper()
+
+	filter := utils.NewBloomFilter(uint64(len(passwords)), 0.0001)
+	for _, password := range passwords {
+		filter.Add(sha1.Sum([]byte(password)))
+	}
+
+	path := filepath.Join(t.TempDir(), "breached.bloom")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("creating filter: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := filter.WriteTo(file); err != nil {
+		t.Fatalf("writing filter: %v", err)
+	}
+	return path
+}
+
+// writeTestCorpus writes a range file per password, with the given breach counts
+func writeTestCorpus(t *testing.T, counts map[string]int) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for password, count := range counts {
+		digest := fmt.Sprintf("%X", sha1.Sum([]byte(password)))
+		line := fmt.Sprintf("%s:%d\n", digest[5:], count)
+		if err := os.WriteFile(filepath.Join(dir, digest[:5]+".txt"), []byte(line), 0o644); err != nil {
+			t.Fatalf("writing corpus: %v", err)
+		}
+	}
+	return dir
+}
+
+func TestCheckPasswordBreach(t *testing.T) {
+	filter := writeTestBloomFilter(t, "hunter2", "password1")
+
+	tests := []struct {
+		policy      string
+		password    string
+		wantFlagged bool
+		wantErr     error
+	}{
+		{"off", "hunter2", false, nil},
+		{"flag", "hunter2", true, nil},
+		{"flag", "correct horse battery staple", false, nil},
+		{"reject", "password1", false, ErrPasswordBreached},
+		{"reject", "correct horse battery staple", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.password, func(t *testing.T) {
+			useTestBreachConfig(t, config.BreachConfig{Policy: tt.policy, FilterPath: filter})
+
+			flagged, err := checkPasswordBreach(tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("checkPasswordBreach = %v, want %v", err, tt.wantErr)
+			}
+			if flagged != tt.wantFlagged {
+				t.Errorf("flagged = %v, want %v", flagged, tt.wantFlagged)
+			}
+		})
+	}
+}
+
+func TestCheckPasswordBreachCorpus(t *testing.T) {
+	corpus := writeTestCorpus(t, map[string]int{"hunter2": 100, "rarely": 2})
+	useTestBreachConfig(t, config.BreachConfig{Policy: "reject", CorpusPath: corpus, MinCount: 10})
+
+	if _, err := checkPasswordBreach("hunter2"); !errors.Is(err, ErrPasswordBreached) {
+		t.Errorf("checkPasswordBreach(hunter2) = %v, want ErrPasswordBreached", err)
+	}
+
+	for _, password := range []string{"rarely", "correct horse battery staple"} {
+		if _, err := checkPasswordBreach(password); err != nil {
+			t.Errorf("checkPasswordBreach(%s) = %v", password, err)
+		}
+	}
+}
+
+// Uma lista que não carrega recusa a senha em vez de pular a verificação
+func TestCheckPasswordBreachFailsClosed(t *testing.T) {
+	garbage := filepath.Join(t.TempDir(), "garbage.bloom")
+	os.WriteFile(garbage, []byte("not a filter"), 0o644)
+
+	configs := map[string]config.BreachConfig{
+		"missing filter": {FilterPath: filepath.Join(t.TempDir(), "missing.bloom")},
+		"invalid filter": {FilterPath: garbage},
+		"missing corpus": {CorpusPath: filepath.Join(t.TempDir(), "missing")},
+		"corpus is file": {CorpusPath: garbage},
+	}
+
+	for name, breach := range configs {
+		for _, policy := range []string{"flag", "reject"} {
+			breach.Policy = policy
+			useTestBreachConfig(t, breach)
+
+			_, err := checkPasswordBreach("correct horse battery staple")
+			if err == nil || !strings.Contains(err.Error(), "loading breached password list") {
+				t.Errorf("%s with policy %s = %v, want a loading error", name, policy, err)
+			}
+		}
+	}
+
+	useTestBreachConfig(t, config.BreachConfig{Policy: "off", FilterPath: garbage})
+	if _, err := checkPasswordBreach("hunter2"); err != nil {
+		t.Errorf("policy off = %v, want the list ignored", err)
+	}
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/duvrdx/whoami/internal/models"
+	"gorm.io/gorm"
+)
+
+// Arestas do teste: 1 → 2 → 4, 1 → 3 → 4 (dois caminhos até 4), 4 → 5 e 6 → 7, com 7 removido
+var testClosureEdges = [][2]uint{{1, 2}, {1, 3}, {2, 4}, {3, 4}, {4, 5}, {6, 7}}
+
+var testClosureWant = [][2]uint{
+	{1, 2}, {1, 3}, {1, 4}, {1, 5},
+	{2, 4}, {2, 5},
+	{3, 4}, {3, 5},
+	{4, 5},
+}
+
+func sortedPairs(pairs [][2]uint) [][2]uint {
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	return pairs
+}
+
+func TestRebuildClosure(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(db *gorm.DB)
+		rebuild func(tx *gorm.DB) error
+		read    func(db *gorm.DB) [][2]uint
+	}{
+		{
+			"groups",
+			func(db *gorm.DB) {
+				for id := uint(1); id <= 7; id++ {
+					db.Create(&models.Group{Model: gorm.Model{ID: id}, Identifier: string(rune('a' + id))})
+				}
+				for _, edge := range testClosureEdges {
+					db.Exec("INSERT INTO group_subgroups (group_id, subgroup_id) VALUES (?, ?)", edge[0], edge[1])
+				}
+				db.Delete(&models.Group{}, 7)
+			},
+			rebuildGroupClosure,
+			func(db *gorm.DB) [][2]uint {
+				var rows []models.GroupClosure
+				db.Find(&rows)
+
+				pairs := [][2]uint{}
+				for _, row := range rows {
+					pairs = append(pairs, [2]uint{row.AncestorID, row.DescendantID})
+				}
+				return pairs
+			},
+		},
+		{
+			"roles",
+			func(db *gorm.DB) {
+				for id := uint(1); id <= 7; id++ {
+					db.Create(&models.RBACRole{Model: gorm.Model{ID: id}, Identifier: string(rune('a' + id))})
+				}
+				for _, edge := range testClosureEdges {
+					db.Exec("INSERT INTO rbac_role_parents (role_id, parent_id) VALUES (?, ?)", edge[0], edge[1])
+				}
+				db.Delete(&models.RBACRole{}, 7)
+			},
+			rebuildRoleClosure,
+			func(db *gorm.DB) [][2]uint {
+				var rows []models.RBACRoleClosure
+				db.Find(&rows)
+
+				pairs := [][2]uint{}
+				for _, row := range rows {
+					pairs = append(pairs, [2]uint{row.RoleID, row.AncestorID})
+				}
+				return pairs
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			tt.setup(db)
+
+			// A segunda reconstrução substitui a primeira em vez de duplicar as linhas
+			for i := 0; i < 2; i++ {
+				if err := db.Transaction(tt.rebuild); err != nil {
+					t.Fatalf("rebuild: %v", err)
+				}
+			}
+
+			if got := sortedPairs(tt.read(db)); !reflect.DeepEqual(got, testClosureWant) {
+				t.Errorf("closure = %v, want %v", got, testClosureWant)
+			}
+		})
+	}
+}
@@ -0,0 +1,623 @@
+package services
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownProvider        = errors.New("unknown identity provider")
+	ErrInvalidFederationState = errors.New("invalid or expired federation state")
+	ErrFederatedUserNotFound  = errors.New("no user is linked to this external identity")
+)
+
+type FederationService interface {
+	// StartLogin returns the provider URL the browser must be redirected to
+	StartLogin(providerName string, clientID uint) (string, error)
+	// CompleteLogin handles the provider callback and returns the local user and the whoami client that started the login
+	CompleteLogin(providerName, state, code string) (*models.User, uint, error)
+
+	LinkIdentity(userIdentifier string, identity *schemas.ExternalIdentityCreate) (*schemas.ExternalIdentityResponse, error)
+	ListIdentities(userIdentifier string) ([]schemas.ExternalIdentityResponse, error)
+	UnlinkIdentity(userIdentifier string, identityID uint) error
+}
+
+type federationService struct {
+	db         *gorm.DB
+	httpClient *http.Client
+}
+
+func NewFederationService() FederationService {
+	return &federationService{
+		db:         config.GetDB(),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// providerEndpoints holds the discovered (or configured) endpoints of a provider
+type providerEndpoints struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	fetchedAt time.Time
+	keys      map[string]crypto.PublicKey
+}
+
+// Descoberta e chaves são compartilhadas entre instâncias do serviço
+var (
+	providerCache   = map[string]*providerEndpoints{}
+	providerCacheMu sync.Mutex
+)
+
+const providerCacheTTL = time.Hour
+
+func findProvider(name string) (*config.OIDCProviderConfig, error) {
+	for i, provider := range config.Config.Federation.Providers {
+		if provider.Name == name {
+			return &config.Config.Federation.Providers[i], nil
+		}
+	}
+	return nil, ErrUnknownProvider
+}
+
+func (s *federationService) getJSON(endpoint string, header http.Header, target interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", endpoint, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// endpoints resolves the provider endpoints through OIDC discovery, letting
+// explicitly configured URLs take precedence
+func (s *federationService) endpoints(provider *config.OIDCProviderConfig) (*providerEndpoints, error) {
+	providerCacheMu.Lock()
+	cached, ok := providerCache[provider.Name]
+	providerCacheMu.Unlock()
+
+	if ok && time.Since(cached.fetchedAt) < providerCacheTTL {
+		return cached, nil
+	}
+
+	endpoints := &providerEndpoints{}
+
+	if provider.Type != "oauth2" {
+		discovery := strings.TrimSuffix(provider.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := s.getJSON(discovery, nil, endpoints); err != nil {
+			return nil, err
+		}
+
+		if endpoints.Issuer != provider.Issuer {
+			return nil, fmt.Errorf("discovered issuer %q does not match configured issuer", endpoints.Issuer)
+		}
+	}
+
+	if provider.AuthorizationURL != "" {
+		endpoints.AuthorizationEndpoint = provider.AuthorizationURL
+	}
+	if provider.TokenURL != "" {
+		endpoints.TokenEndpoint = provider.TokenURL
+	}
+	if provider.UserInfoURL != "" {
+		endpoints.UserInfoEndpoint = provider.UserInfoURL
+	}
+
+	if endpoints.AuthorizationEndpoint == "" || endpoints.TokenEndpoint == "" {
+		return nil, fmt.Errorf("provider %s has no authorization or token endpoint", provider.Name)
+	}
+
+	endpoints.fetchedAt = time.Now()
+
+	providerCacheMu.Lock()
+	providerCache[provider.Name] = endpoints
+	providerCacheMu.Unlock()
+
+	return endpoints, nil
+}
+
+// signingKey returns the provider key with the given id, refreshing the JWKS
+// once when the key is unknown (the provider may have rotated its keys)
+func (s *federationService) signingKey(endpoints *providerEndpoints, kid string) (crypto.PublicKey, error) {
+	providerCacheMu.Lock()
+	key, ok := endpoints.keys[kid]
+	providerCacheMu.Unlock()
+
+	if ok {
+		return key, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoints.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := utils.ParseJWKS(body)
+	if err != nil {
+		return nil, err
+	}
+
+	providerCacheMu.Lock()
+	endpoints.keys = keys
+	providerCacheMu.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		// Provedores com uma única chave às vezes omitem o kid
+		if kid == "" && len(keys) == 1 {
+			for _, only := range keys {
+				return only, nil
+			}
+		}
+		return nil, errors.New("unknown signing key")
+	}
+
+	return key, nil
+}
+
+func (s *federationService) StartLogin(providerName string, clientID uint) (string, error) {
+	provider, err := findProvider(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	endpoints, err := s.endpoints(provider)
+	if err != nil {
+		return "", err
+	}
+
+	state := models.FederationState{
+		State:        utils.GenerateSecureString(32),
+		Nonce:        utils.GenerateSecureString(32),
+		CodeVerifier: utils.GenerateSecureString(64),
+		Provider:     provider.Name,
+		ClientID:     clientID,
+		ExpiresAt:    time.Now().Add(time.Duration(config.Config.Federation.StateExpiration) * time.Second),
+	}
+
+	if err := s.db.Create(&state).Error; err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(state.CodeVerifier))
+
+	scopes := provider.Scopes
+	if len(scopes) == 0 && provider.Type != "oauth2" {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	authURL, err := url.Parse(endpoints.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientID)
+	query.Set("redirect_uri", provider.RedirectURL)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state.State)
+	query.Set("nonce", state.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+type upstreamTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	Error       string `json:"error"`
+}
+
+func (s *federationService) exchangeCode(provider *config.OIDCProviderConfig, endpoints *providerEndpoints, code, verifier string) (*upstreamTokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.RedirectURL)
+	form.Set("client_id", provider.ClientID)
+	form.Set("client_secret", provider.ClientSecret)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequest(http.MethodPost, endpoints.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tokens upstreamTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" || tokens.AccessToken == "" {
+		return nil, fmt.Errorf("token exchange failed: %s", tokens.Error)
+	}
+
+	return &tokens, nil
+}
+
+func (s *federationService) verifyIDToken(provider *config.OIDCProviderConfig, endpoints *providerEndpoints, rawToken, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.signingKey(endpoints, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(endpoints.Issuer),
+		jwt.WithAudience(provider.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	return claims, nil
+}
+
+func (s *federationService) CompleteLogin(providerName, stateValue, code string) (*models.User, uint, error) {
+	provider, err := findProvider(providerName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var state models.FederationState
+	if err := s.db.Where("state = ? AND provider = ?", stateValue, provider.Name).First(&state).Error; err != nil {
+		return nil, 0, ErrInvalidFederationState
+	}
+
+	// O state só pode ser usado uma vez
+	if err := s.db.Unscoped().Delete(&state).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if time.Now().After(state.ExpiresAt) {
+		return nil, 0, ErrInvalidFederationState
+	}
+
+	endpoints, err := s.endpoints(provider)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tokens, err := s.exchangeCode(provider, endpoints, code, state.CodeVerifier)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	claims := map[string]interface{}{}
+
+	if provider.Type != "oauth2" {
+		if tokens.IDToken == "" {
+			return nil, 0, errors.New("provider did not return an id_token")
+		}
+
+		idClaims, err := s.verifyIDToken(provider, endpoints, tokens.IDToken, state.Nonce)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for key, value := range idClaims {
+			claims[key] = value
+		}
+	}
+
+	if endpoints.UserInfoEndpoint != "" {
+		var userInfo map[string]interface{}
+		header := http.Header{"Authorization": {"Bearer " + tokens.AccessToken}}
+
+		if err := s.getJSON(endpoints.UserInfoEndpoint, header, &userInfo); err != nil {
+			return nil, 0, err
+		}
+
+		// O sub do userinfo precisa bater com o do id_token
+		if sub, ok := claims["sub"]; ok && userInfo["sub"] != nil && fmt.Sprint(userInfo["sub"]) != fmt.Sprint(sub) {
+			return nil, 0, errors.New("userinfo subject mismatch")
+		}
+
+		for key, value := range userInfo {
+			if _, exists := claims[key]; !exists {
+				claims[key] = value
+			}
+		}
+	}
+
+	user, err := s.resolveUser(provider, claims)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return user, state.ClientID, nil
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	value, ok := claims[name]
+	if !ok || value == nil {
+		return ""
+	}
+
+	// Alguns provedores (GitHub) usam ids numéricos
+	if number, ok := value.(float64); ok {
+		return fmt.Sprintf("%.0f", number)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// emailVerified reports whether the email_verified claim is true. Some providers
+// send it as a string.
+func emailVerified(claims map[string]interface{}) bool {
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		return verified
+	case string:
+		return verified == "true"
+	}
+	return false
+}
+
+// federatedIdentity is what an upstream login, OIDC or SAML, states about the user
+type federatedIdentity struct {
+	Provider   string
+	Subject    string
+	Identifier string
+	Claims     map[string]interface{}
+	// Metadata is merged into the user metadata on every login
+	Metadata     map[string]interface{}
+	Source       string
+	Provision    bool
+	LinkExisting bool
+}
+
+// linkFederatedUser finds the local user of an external identity, linking an
+// existing account or provisioning a new one when the provider allows it
+func linkFederatedUser(db *gorm.DB, external *federatedIdentity) (*models.User, error) {
+	if external.Subject == "" {
+		return nil, errors.New("external identity has no subject")
+	}
+
+	claimsJSON, err := json.Marshal(external.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	var identity models.ExternalIdentity
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Preload("User").Where("provider = ? AND subject = ?", external.Provider, external.Subject).First(&identity).Error
+
+		if err == nil {
+			user = identity.User
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			if external.Identifier == "" {
+				return ErrFederatedUserNotFound
+			}
+
+			err := tx.Where("identifier = ?", external.Identifier).First(&user).Error
+
+			// Administradores só entram por identidades vinculadas explicitamente, para que
+			// um provedor não possa assumir a conta afirmando o identificador dela
+			switch {
+			case err == nil && external.LinkExisting && !user.IsAdmin:
+			case errors.Is(err, gorm.ErrRecordNotFound) && external.Provision:
+				user = models.User{
+					Identifier: external.Identifier,
+					IsActive:   true,
+					Metadata:   "{}",
+					Source:     external.Source,
+				}
+				if err := tx.Create(&user).Error; err != nil {
+					return err
+				}
+			case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+				return err
+			default:
+				return ErrFederatedUserNotFound
+			}
+
+			identity = models.ExternalIdentity{
+				Provider: external.Provider,
+				Subject:  external.Subject,
+				UserID:   user.ID,
+			}
+		} else {
+			return err
+		}
+
+		identity.Claims = string(claimsJSON)
+		if err := tx.Save(&identity).Error; err != nil {
+			return err
+		}
+
+		if len(external.Metadata) == 0 {
+			return nil
+		}
+
+		metadata := map[string]interface{}{}
+		json.Unmarshal([]byte(user.Metadata), &metadata)
+
+		for key, value := range external.Metadata {
+			metadata[key] = value
+		}
+
+		metadataJSON, err := json.Marshal(metadata)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&user).Update("metadata", string(metadataJSON)).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// resolveUser finds the local user for the external identity, linking or
+// provisioning it according to the provider configuration
+func (s *federationService) resolveUser(provider *config.OIDCProviderConfig, claims map[string]interface{}) (*models.User, error) {
+	subjectClaim := provider.SubjectClaim
+	if subjectClaim == "" {
+		subjectClaim = "sub"
+	}
+
+	identifierClaim := provider.IdentifierClaim
+	if identifierClaim == "" {
+		identifierClaim = "email"
+	}
+
+	metadata := map[string]interface{}{}
+	for key, claim := range provider.MetadataClaims {
+		if value, ok := claims[claim]; ok {
+			metadata[key] = value
+		}
+	}
+
+	linkExisting := provider.LinkExisting
+
+	// Só vincula por e-mail quando o provedor afirma que ele foi verificado; a ausência
+	// da claim não prova nada
+	if identifierClaim == "email" && !emailVerified(claims) {
+		linkExisting = false
+	}
+
+	return linkFederatedUser(s.db, &federatedIdentity{
+		Provider:     provider.Name,
+		Subject:      claimString(claims, subjectClaim),
+		Identifier:   claimString(claims, identifierClaim),
+		Claims:       claims,
+		Metadata:     metadata,
+		Source:       "oidc:" + provider.Name,
+		Provision:    provider.Provision,
+		LinkExisting: linkExisting,
+	})
+}
+
+func (s *federationService) LinkIdentity(userIdentifier string, identity *schemas.ExternalIdentityCreate) (*schemas.ExternalIdentityResponse, error) {
+	var user models.User
+
+	if strings.HasPrefix(identity.Provider, samlProviderPrefix) {
+		var idp models.SAMLIdentityProvider
+		if err := s.db.Where("name = ?", strings.TrimPrefix(identity.Provider, samlProviderPrefix)).First(&idp).Error; err != nil {
+			return nil, ErrUnknownProvider
+		}
+	} else if _, err := findProvider(identity.Provider); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	identityModel := models.ExternalIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		UserID:   user.ID,
+		Claims:   "{}",
+	}
+
+	if err := s.db.Create(&identityModel).Error; err != nil {
+		return nil, err
+	}
+
+	return schemas.ExternalIdentityResponseFromModel(&identityModel), nil
+}
+
+func (s *federationService) ListIdentities(userIdentifier string) ([]schemas.ExternalIdentityResponse, error) {
+	var user models.User
+	var identities []models.ExternalIdentity
+
+	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Where("user_id = ?", user.ID).Find(&identities).Error; err != nil {
+		return nil, err
+	}
+
+	returnIdentities := []schemas.ExternalIdentityResponse{}
+	for _, identity := range identities {
+		returnIdentities = append(returnIdentities, *schemas.ExternalIdentityResponseFromModel(&identity))
+	}
+
+	return returnIdentities, nil
+}
+
+func (s *federationService) UnlinkIdentity(userIdentifier string, identityID uint) error {
+	var user models.User
+	var identity models.ExternalIdentity
+
+	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
+		return err
+	}
+
+	if err := s.db.Where("id = ? AND user_id = ?", identityID, user.ID).First(&identity).Error; err != nil {
+		return err
+	}
+
+	// Remove de fato para liberar o par provedor/subject para um novo vínculo
+	return s.db.Unscoped().Delete(&identity).Error
+}
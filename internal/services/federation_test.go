@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/duvrdx/whoami/internal/models"
+)
+
+func TestLinkFederatedUser(t *testing.T) {
+	db := newTestDB(t)
+
+	db.Create(&models.User{Identifier: "alice", Metadata: "{}", IsActive: true})
+	db.Create(&models.User{Identifier: "root", Metadata: "{}", IsActive: true, IsAdmin: true})
+
+	var root models.User
+	db.Where("identifier = ?", "root").First(&root)
+	db.Create(&models.ExternalIdentity{Provider: "saml:partner", Subject: "root-prelinked", UserID: root.ID, Claims: "{}"})
+
+	tests := []struct {
+		name     string
+		external federatedIdentity
+		want     string
+		wantErr  error
+	}{
+		{"links an existing user", federatedIdentity{
+			Provider: "saml:partner", Subject: "s-alice", Identifier: "alice", LinkExisting: true,
+		}, "alice", nil},
+		{"refuses to link without LinkExisting", federatedIdentity{
+			Provider: "saml:other", Subject: "s-alice", Identifier: "alice",
+		}, "", ErrFederatedUserNotFound},
+		{"refuses to link an administrator", federatedIdentity{
+			Provider: "saml:partner", Subject: "s-root", Identifier: "root", LinkExisting: true, Provision: true,
+		}, "", ErrFederatedUserNotFound},
+		{"accepts an administrator linked beforehand", federatedIdentity{
+			Provider: "saml:partner", Subject: "root-prelinked", Identifier: "someone-else",
+		}, "root", nil},
+		{"provisions an unknown user", federatedIdentity{
+			Provider: "saml:partner", Subject: "s-bob", Identifier: "bob", Provision: true, Source: "saml:partner",
+		}, "bob", nil},
+		{"refuses an unknown user without provisioning", federatedIdentity{
+			Provider: "saml:partner", Subject: "s-carol", Identifier: "carol",
+		}, "", ErrFederatedUserNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := linkFederatedUser(db, &tt.external)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("linkFederatedUser = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && user.Identifier != tt.want {
+				t.Errorf("linked to %s, want %s", user.Identifier, tt.want)
+			}
+		})
+	}
+
+	var count int64
+	db.Model(&models.ExternalIdentity{}).Where("subject = ?", "s-root").Count(&count)
+	if count != 0 {
+		t.Errorf("an identity was linked to the administrator")
+	}
+}
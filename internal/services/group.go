@@ -0,0 +1,90 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/duvrdx/whoami/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrGroupCycle = errors.New("group nesting would create a cycle")
+
+// rebuildClosure recomputes a closure table from a graph without cycles. edges
+// selects from_id and to_id pairs; model is the closure table, filled with a row
+// for every pair joined by a path, in fromColumn and toColumn. Graph changes are
+// rare, so the table is rebuilt as a whole instead of patched.
+func rebuildClosure(tx *gorm.DB, edges *gorm.DB, model interface{}, fromColumn, toColumn string) error {
+	var pairs []struct {
+		FromID uint
+		ToID   uint
+	}
+
+	if err := edges.Scan(&pairs).Error; err != nil {
+		return err
+	}
+
+	next := map[uint][]uint{}
+	for _, pair := range pairs {
+		next[pair.FromID] = append(next[pair.FromID], pair.ToID)
+	}
+
+	var closures []map[string]interface{}
+	for from := range next {
+		// Busca em profundidade; sem ciclos, mas um nó pode ser alcançado por vários caminhos
+		seen := map[uint]bool{}
+		stack := append([]uint{}, next[from]...)
+
+		for len(stack) > 0 {
+			to := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if seen[to] {
+				continue
+			}
+			seen[to] = true
+
+			closures = append(closures, map[string]interface{}{fromColumn: from, toColumn: to})
+			stack = append(stack, next[to]...)
+		}
+	}
+
+	if err := tx.Where("1 = 1").Delete(model).Error; err != nil {
+		return err
+	}
+
+	if len(closures) == 0 {
+		return nil
+	}
+
+	return tx.Model(model).CreateInBatches(closures, 500).Error
+}
+
+// rebuildGroupClosure recomputes the group closure from the nesting of live groups
+func rebuildGroupClosure(tx *gorm.DB) error {
+	edges := tx.Table("group_subgroups").
+		Select("group_subgroups.group_id AS from_id, group_subgroups.subgroup_id AS to_id").
+		Joins("JOIN groups parents ON parents.id = group_subgroups.group_id AND parents.deleted_at IS NULL").
+		Joins("JOIN groups children ON children.id = group_subgroups.subgroup_id AND children.deleted_at IS NULL")
+
+	return rebuildClosure(tx, edges, &models.GroupClosure{}, "ancestor_id", "descendant_id")
+}
+
+// effectiveGroups returns a query for the active groups of the user, joined
+// directly or inherited through nested groups
+func effectiveGroups(db *gorm.DB, userID uint) *gorm.DB {
+	direct := db.Table("group_users").Select("group_id").Where("user_id = ?", userID)
+	inherited := db.Model(&models.GroupClosure{}).Select("ancestor_id").Where("descendant_id IN (?)", direct)
+
+	return db.Model(&models.Group{}).
+		Where("groups.is_active = ?", true).
+		Where("groups.id IN (?) OR groups.id IN (?)", direct, inherited)
+}
+
+// effectiveGroupIdentifiers returns the identifiers of the user's effective groups
+func effectiveGroupIdentifiers(db *gorm.DB, userID uint) ([]string, error) {
+	var groups []string
+
+	err := effectiveGroups(db, userID).Order("groups.identifier").Pluck("groups.identifier", &groups).Error
+
+	return groups, err
+}
@@ -0,0 +1,370 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvalidInvitation  = errors.New("invitation is invalid, expired or already used")
+	ErrInvitationClosed   = errors.New("invitation was already accepted or revoked")
+)
+
+type InvitationService interface {
+	// CreateInvitation creates the pending user with its groups and roles and sends the invite
+	CreateInvitation(invitation *schemas.InvitationCreate, invitedByID uint) (*schemas.InvitationResponse, error)
+	GetInvitation(id uint) (*schemas.InvitationResponse, error)
+	GetInvitations(status string) ([]schemas.InvitationResponse, error)
+	// ResendInvitation replaces the token, restarts the expiry and sends the invite again
+	ResendInvitation(id uint) (*schemas.InvitationResponse, error)
+	// RevokeInvitation closes the invitation and undoes the groups and roles it granted.
+	// The pending user is removed too, unless it was granted something else meanwhile.
+	RevokeInvitation(id uint) error
+	AcceptInvitation(accept *schemas.InvitationAccept) (*schemas.UserResponse, error)
+}
+
+type invitationService struct {
+	db       *gorm.DB
+	notifier Notifier
+}
+
+func NewInvitationService(notifier Notifier) InvitationService {
+	return &invitationService{
+		db:       config.GetDB(),
+		notifier: notifier,
+	}
+}
+
+func invitationStatus(invitation *models.Invitation) string {
+	switch {
+	case invitation.AcceptedAt != nil:
+		return InvitationAccepted
+	case invitation.RevokedAt != nil:
+		return InvitationRevoked
+	case time.Now().After(invitation.ExpiresAt):
+		return InvitationExpired
+	}
+	return InvitationPending
+}
+
+func invitationResponse(invitation *models.Invitation) *schemas.InvitationResponse {
+	return schemas.InvitationResponseFromModel(invitation, invitationStatus(invitation))
+}
+
+func (s *invitationService) findInvitation(id uint) (*models.Invitation, error) {
+	var invitation models.Invitation
+
+	if err := s.db.Preload("InvitedBy").First(&invitation, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+
+	return &invitation, nil
+}
+
+// send issues a new token for the invitation and notifies the invitee
+func (s *invitationService) send(tx *gorm.DB, invitation *models.Invitation, user *models.User) error {
+	cfg := config.Config.Invitation
+	token := utils.GenerateSecureString(43)
+
+	invitation.TokenHash = utils.HashToken(token)
+	invitation.ExpiresAt = time.Now().Add(time.Duration(cfg.Expiration) * time.Second)
+	invitation.SentCount++
+
+	if err := tx.Save(invitation).Error; err != nil {
+		return err
+	}
+
+	notification := Notification{
+		Kind:      "invitation",
+		Recipient: user.Identifier,
+		Address:   notificationAddress(user.Identifier, user.Metadata),
+		Subject:   "You have been invited",
+		Data: map[string]string{
+			"token":      token,
+			"expires_at": invitation.ExpiresAt.Format(time.RFC3339),
+		},
+	}
+
+	if cfg.AcceptURL != "" {
+		link, err := magicLinkURL(cfg.AcceptURL, token)
+		if err != nil {
+			return err
+		}
+
+		notification.Body = fmt.Sprintf("Use this link to set your password: %s", link)
+		notification.Data["link"] = link
+	} else {
+		notification.Body = fmt.Sprintf("Use this invitation code to set your password: %s", token)
+	}
+
+	return s.notifier.Notify(notification)
+}
+
+func (s *invitationService) CreateInvitation(invitation *schemas.InvitationCreate, invitedByID uint) (*schemas.InvitationResponse, error) {
+	if invitation.Identifier == "" {
+		return nil, errors.New("identifier cannot be empty")
+	}
+
+	userModel := models.User{
+		Identifier: invitation.Identifier,
+		Metadata:   "{}",
+	}
+
+	if invitation.Metadata != nil {
+		userModel.Metadata = *invitation.Metadata
+	}
+
+	invitationModel := models.Invitation{
+		Identifier:  invitation.Identifier,
+		Groups:      strings.Join(invitation.Groups, ","),
+		Roles:       strings.Join(invitation.Roles, ","),
+		InvitedByID: &invitedByID,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&userModel).Error; err != nil {
+			return err
+		}
+
+		// O default da coluna ignora o false na criação, então a inativação é explícita
+		if err := tx.Model(&userModel).Update("is_active", false).Error; err != nil {
+			return err
+		}
+
+		if len(invitation.Groups) > 0 {
+			var groups []*models.Group
+			if err := tx.Where("identifier IN ?", invitation.Groups).Find(&groups).Error; err != nil {
+				return err
+			}
+
+			if len(groups) != len(invitation.Groups) {
+				return errors.New("groups reference unknown groups")
+			}
+
+			if err := tx.Model(&userModel).Association("Groups").Append(groups); err != nil {
+				return err
+			}
+		}
+
+		if len(invitation.Roles) > 0 {
+			var roles []models.RBACRole
+			if err := tx.Where("identifier IN ?", invitation.Roles).Find(&roles).Error; err != nil {
+				return err
+			}
+
+			if len(roles) != len(invitation.Roles) {
+				return errors.New("roles reference unknown RBAC roles")
+			}
+
+			for _, role := range roles {
+				assignment := models.RBACRoleAssignment{RoleID: role.ID, UserID: userModel.ID, GrantorID: invitationModel.InvitedByID, Reason: "invitation"}
+				if err := tx.Create(&assignment).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		invitationModel.UserID = userModel.ID
+
+		// O envio faz parte da transação: se falhar, o convite pode ser refeito do zero
+		return s.send(tx, &invitationModel, &userModel)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetInvitation(invitationModel.ID)
+}
+
+func (s *invitationService) GetInvitation(id uint) (*schemas.InvitationResponse, error) {
+	invitation, err := s.findInvitation(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return invitationResponse(invitation), nil
+}
+
+func (s *invitationService) GetInvitations(status string) ([]schemas.InvitationResponse, error) {
+	query := s.db.Preload("InvitedBy").Order("id DESC")
+	now := time.Now()
+
+	switch status {
+	case "":
+	case InvitationAccepted:
+		query = query.Where("accepted_at IS NOT NULL")
+	case InvitationRevoked:
+		query = query.Where("revoked_at IS NOT NULL")
+	case InvitationExpired:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= ?", now)
+	case InvitationPending:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now)
+	default:
+		return nil, fmt.Errorf("unknown invitation status %s", status)
+	}
+
+	var invitations []models.Invitation
+
+	if err := query.Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+
+	returnInvitations := []schemas.InvitationResponse{}
+	for _, invitation := range invitations {
+		returnInvitations = append(returnInvitations, *invitationResponse(&invitation))
+	}
+
+	return returnInvitations, nil
+}
+
+func (s *invitationService) ResendInvitation(id uint) (*schemas.InvitationResponse, error) {
+	invitation, err := s.findInvitation(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convites expirados podem ser reenviados; aceitos e revogados, não
+	if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return nil, ErrInvitationClosed
+	}
+
+	var user models.User
+	if err := s.db.First(&user, invitation.UserID).Error; err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		return s.send(tx, invitation, &user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return invitationResponse(invitation), nil
+}
+
+func (s *invitationService) RevokeInvitation(id uint) error {
+	invitation, err := s.findInvitation(id)
+	if err != nil {
+		return err
+	}
+
+	if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return ErrInvitationClosed
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(invitation).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		user := models.User{Model: gorm.Model{ID: invitation.UserID}}
+
+		// Só o que o convite concedeu é desfeito
+		var groups []*models.Group
+		if err := tx.Where("identifier IN ?", strings.Split(invitation.Groups, ",")).Find(&groups).Error; err != nil {
+			return err
+		}
+
+		if len(groups) > 0 {
+			if err := tx.Model(&user).Association("Groups").Delete(groups); err != nil {
+				return err
+			}
+		}
+
+		roles := tx.Model(&models.RBACRole{}).Select("id").Where("identifier IN ?", strings.Split(invitation.Roles, ","))
+		if err := tx.Where("user_id = ? AND rbac_role_id IN (?)", invitation.UserID, roles).
+			Delete(&models.RBACRoleAssignment{}).Error; err != nil {
+			return err
+		}
+
+		// Sem nada mais concedido, o usuário pendente, que nunca entrou, é removido para
+		// liberar o identificador; do contrário ele segue inativo
+		var remaining int64
+		if err := tx.Model(&models.RBACRoleAssignment{}).Where("user_id = ?", invitation.UserID).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining > 0 || tx.Model(&user).Association("Groups").Count() > 0 {
+			return nil
+		}
+
+		return tx.Unscoped().Delete(&user).Error
+	})
+}
+
+func (s *invitationService) AcceptInvitation(accept *schemas.InvitationAccept) (*schemas.UserResponse, error) {
+	var invitation models.Invitation
+
+	if err := s.db.Where("token_hash = ?", utils.HashToken(accept.Token)).First(&invitation).Error; err != nil {
+		return nil, ErrInvalidInvitation
+	}
+
+	if invitationStatus(&invitation) != InvitationPending {
+		return nil, ErrInvalidInvitation
+	}
+
+	if accept.Password == "" {
+		return nil, errors.New("password cannot be empty")
+	}
+
+	flagged, err := checkPasswordBreach(accept.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := utils.HashPassword(accept.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// A condição no UPDATE garante o uso único mesmo com requisições simultâneas
+		result := tx.Model(&models.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.ID).
+			Update("accepted_at", time.Now())
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrInvalidInvitation
+		}
+
+		if err := tx.First(&user, invitation.UserID).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"password":          hashedPassword,
+			"password_breached": flagged,
+			"is_active":         true,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return schemas.UserResponseFromModel(&user), nil
+}
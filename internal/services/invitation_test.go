@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/utils"
+	"gorm.io/gorm"
+)
+
+// newTestInvitations creates the groups eng and ops and the roles viewer and editor
+func newTestInvitations(t *testing.T) (*invitationService, *recordingNotifier, *gorm.DB) {
+	t.Helper()
+
+	db := newTestDB(t)
+	config.Config.Invitation = config.InvitationConfig{Expiration: 3600}
+	config.Config.Password = config.PasswordConfig{
+		Algorithm: "argon2id",
+		Breach:    config.BreachConfig{Policy: "off"},
+		Argon2:    config.Argon2Config{Memory: 64, Time: 1, Threads: 1, KeyLength: 16, SaltLength: 8},
+	}
+
+	db.Create(&models.User{Identifier: "admin", Metadata: "{}", IsActive: true})
+	db.Create(&models.Group{Identifier: "eng"})
+	db.Create(&models.Group{Identifier: "ops"})
+	db.Create(&models.RBACRole{Identifier: "viewer"})
+	db.Create(&models.RBACRole{Identifier: "editor"})
+
+	notifier := &recordingNotifier{}
+	return &invitationService{db: db, notifier: notifier}, notifier, db
+}
+
+func inviteTestUser(t *testing.T, service *invitationService, identifier string) *schemas.InvitationResponse {
+	t.Helper()
+
+	invitation, err := service.CreateInvitation(&schemas.InvitationCreate{
+		Identifier: identifier, Groups: []string{"eng"}, Roles: []string{"viewer"},
+	}, 1)
+	if err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+	return invitation
+}
+
+// testGrants lists the groups and roles the user holds
+func testGrants(t *testing.T, db *gorm.DB, userID uint) (groups, roles []string) {
+	t.Helper()
+
+	db.Table("groups").Joins("JOIN group_users ON group_users.group_id = groups.id").
+		Where("group_users.user_id = ?", userID).Order("identifier").Pluck("identifier", &groups)
+	db.Model(&models.RBACRole{}).Joins("JOIN rbac_role_users ON rbac_role_users.rbac_role_id = rbac_roles.id").
+		Where("rbac_role_users.user_id = ?", userID).Order("identifier").Pluck("identifier", &roles)
+	return groups, roles
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	service, notifier, db := newTestInvitations(t)
+
+	invitation := inviteTestUser(t, service, "alice")
+	token := notifier.last(t, "token")
+
+	alice := findTestUser(t, db, "alice")
+	if alice.IsActive {
+		t.Fatal("the invited user is active before accepting")
+	}
+	if groups, roles := testGrants(t, db, alice.ID); len(groups) != 1 || len(roles) != 1 {
+		t.Fatalf("invited user has groups %v and roles %v", groups, roles)
+	}
+
+	if _, err := service.AcceptInvitation(&schemas.InvitationAccept{Token: "wrong", Password: "s3cret-pass"}); !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("AcceptInvitation with a wrong token = %v, want ErrInvalidInvitation", err)
+	}
+
+	if _, err := service.AcceptInvitation(&schemas.InvitationAccept{Token: token, Password: "s3cret-pass"}); err != nil {
+		t.Fatalf("AcceptInvitation: %v", err)
+	}
+
+	alice = findTestUser(t, db, "alice")
+	if ok, _ := utils.VerifyPassword("s3cret-pass", alice.Password); !ok || !alice.IsActive {
+		t.Errorf("accepted user is active = %v, with the password set = %v", alice.IsActive, ok)
+	}
+
+	if _, err := service.AcceptInvitation(&schemas.InvitationAccept{Token: token, Password: "other-pass"}); !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("AcceptInvitation twice = %v, want ErrInvalidInvitation", err)
+	}
+	if err := service.RevokeInvitation(invitation.ID); !errors.Is(err, ErrInvitationClosed) {
+		t.Errorf("RevokeInvitation after it was accepted = %v, want ErrInvitationClosed", err)
+	}
+
+	if response, _ := service.GetInvitation(invitation.ID); response.Status != InvitationAccepted {
+		t.Errorf("status = %s, want %s", response.Status, InvitationAccepted)
+	}
+}
+
+func TestAcceptExpiredInvitation(t *testing.T) {
+	service, notifier, db := newTestInvitations(t)
+
+	invitation := inviteTestUser(t, service, "alice")
+	token := notifier.last(t, "token")
+	db.Model(&models.Invitation{}).Where("id = ?", invitation.ID).Update("expires_at", time.Now().Add(-time.Second))
+
+	if _, err := service.AcceptInvitation(&schemas.InvitationAccept{Token: token, Password: "s3cret-pass"}); !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("AcceptInvitation after it expired = %v, want ErrInvalidInvitation", err)
+	}
+
+	// Reenviado, o convite volta a valer com um novo token
+	if _, err := service.ResendInvitation(invitation.ID); err != nil {
+		t.Fatalf("ResendInvitation: %v", err)
+	}
+	if _, err := service.AcceptInvitation(&schemas.InvitationAccept{Token: token, Password: "s3cret-pass"}); !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("AcceptInvitation with the replaced token = %v, want ErrInvalidInvitation", err)
+	}
+	if _, err := service.AcceptInvitation(&schemas.InvitationAccept{Token: notifier.last(t, "token"), Password: "s3cret-pass"}); err != nil {
+		t.Errorf("AcceptInvitation after it was resent = %v", err)
+	}
+}
+
+func TestRevokeInvitation(t *testing.T) {
+	service, notifier, db := newTestInvitations(t)
+
+	invitation := inviteTestUser(t, service, "alice")
+	token := notifier.last(t, "token")
+
+	if err := service.RevokeInvitation(invitation.ID); err != nil {
+		t.Fatalf("RevokeInvitation: %v", err)
+	}
+
+	if err := db.Unscoped().Where("identifier = ?", "alice").First(&models.User{}).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("the pending user was kept: %v", err)
+	}
+
+	if _, err := service.AcceptInvitation(&schemas.InvitationAccept{Token: token, Password: "s3cret-pass"}); !errors.Is(err, ErrInvalidInvitation) {
+		t.Errorf("AcceptInvitation after it was revoked = %v, want ErrInvalidInvitation", err)
+	}
+	if err := service.RevokeInvitation(invitation.ID); !errors.Is(err, ErrInvitationClosed) {
+		t.Errorf("RevokeInvitation twice = %v, want ErrInvitationClosed", err)
+	}
+
+	// O identificador fica livre para um novo convite
+	inviteTestUser(t, service, "alice")
+}
+
+func TestRevokeInvitationKeepsOtherGrants(t *testing.T) {
+	service, _, db := newTestInvitations(t)
+
+	invitation := inviteTestUser(t, service, "alice")
+	alice := findTestUser(t, db, "alice")
+
+	var ops models.Group
+	var editor models.RBACRole
+	db.Where("identifier = ?", "ops").First(&ops)
+	db.Where("identifier = ?", "editor").First(&editor)
+	db.Model(&alice).Association("Groups").Append(&ops)
+	db.Create(&models.RBACRoleAssignment{RoleID: editor.ID, UserID: alice.ID})
+
+	if err := service.RevokeInvitation(invitation.ID); err != nil {
+		t.Fatalf("RevokeInvitation: %v", err)
+	}
+
+	alice = findTestUser(t, db, "alice")
+	if alice.IsActive {
+		t.Error("the kept user was activated")
+	}
+
+	groups, roles := testGrants(t, db, alice.ID)
+	if len(groups) != 1 || groups[0] != "ops" || len(roles) != 1 || roles[0] != "editor" {
+		t.Errorf("user kept groups %v and roles %v, want [ops] and [editor]", groups, roles)
+	}
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/ldap"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"gorm.io/gorm"
+)
+
+const SourceLDAP = "ldap"
+
+// ldapDeactivatedKey marks, in the user metadata, users deactivated by the sync
+// because they vanished from the directory
+const ldapDeactivatedKey = "ldap_deactivated"
+
+var ErrIdentifierConflict = errors.New("identifier already belongs to a user from another source")
+
+// IdentityBackend authenticates users against an external directory on behalf
+// of CompareUserPassword. Users it manages are marked with its Source.
+type IdentityBackend interface {
+	Source() string
+	Authenticate(identifier, password string) (*models.User, error)
+}
+
+type LDAPService interface {
+	IdentityBackend
+	// Sync mirrors directory users and groups into whoami
+	Sync() (*schemas.DirectorySyncResult, error)
+}
+
+type ldapService struct {
+	db *gorm.DB
+}
+
+func NewLDAPService() LDAPService {
+	return &ldapService{
+		db: config.GetDB(),
+	}
+}
+
+func (s *ldapService) Source() string {
+	return SourceLDAP
+}
+
+// connect opens a connection bound with the service account, when one is configured
+func (s *ldapService) connect() (*ldap.Conn, error) {
+	cfg := config.Config.LDAP
+
+	conn, err := ldap.Dial(cfg.URL, time.Duration(cfg.Timeout)*time.Second, cfg.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (s *ldapService) userAttributes() []string {
+	cfg := config.Config.LDAP
+
+	attributes := []string{cfg.IdentifierAttribute}
+	for _, attribute := range cfg.MetadataAttributes {
+		attributes = append(attributes, attribute)
+	}
+
+	return attributes
+}
+
+func (s *ldapService) Authenticate(identifier, password string) (*models.User, error) {
+	cfg := config.Config.LDAP
+
+	conn, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entries, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     cfg.UserBase,
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     fmt.Sprintf(cfg.UserFilter, ldap.EscapeFilter(identifier)),
+		Attributes: s.userAttributes(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) != 1 {
+		return nil, ldap.ErrInvalidCredentials
+	}
+
+	// Autentica fazendo bind com o DN do próprio usuário
+	if err := conn.Bind(entries[0].DN, password); err != nil {
+		return nil, err
+	}
+
+	user, _, err := s.upsertUser(s.db, entries[0])
+	return user, err
+}
+
+// upsertUser creates or refreshes the local copy of a directory user
+func (s *ldapService) upsertUser(tx *gorm.DB, entry *ldap.Entry) (*models.User, bool, error) {
+	cfg := config.Config.LDAP
+	var user models.User
+
+	identifier := entry.Get(cfg.IdentifierAttribute)
+	if identifier == "" {
+		return nil, false, fmt.Errorf("entry %s has no %s attribute", entry.DN, cfg.IdentifierAttribute)
+	}
+
+	err := tx.Where("identifier = ?", identifier).First(&user).Error
+	created := errors.Is(err, gorm.ErrRecordNotFound)
+
+	if err != nil && !created {
+		return nil, false, err
+	}
+
+	if !created && user.Source != SourceLDAP {
+		return nil, false, ErrIdentifierConflict
+	}
+
+	metadata := map[string]interface{}{}
+	json.Unmarshal([]byte(user.Metadata), &metadata)
+
+	for key, attribute := range cfg.MetadataAttributes {
+		if value := entry.Get(attribute); value != "" {
+			metadata[key] = value
+		}
+	}
+	metadata["ldap_dn"] = entry.DN
+
+	// Só reativa quem a própria sincronização desativou; a desativação local prevalece
+	if created || metadata[ldapDeactivatedKey] == true {
+		user.IsActive = true
+	}
+	delete(metadata, ldapDeactivatedKey)
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, false, err
+	}
+
+	user.Identifier = identifier
+	user.Metadata = string(metadataJSON)
+	user.Source = SourceLDAP
+
+	if err := tx.Save(&user).Error; err != nil {
+		return nil, false, err
+	}
+
+	return &user, created, nil
+}
+
+func (s *ldapService) Sync() (*schemas.DirectorySyncResult, error) {
+	cfg := config.Config.LDAP
+	result := &schemas.DirectorySyncResult{}
+
+	conn, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	userEntries, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     cfg.UserBase,
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     cfg.UserSyncFilter,
+		Attributes: s.userAttributes(),
+		PageSize:   cfg.PageSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groupEntries []*ldap.Entry
+	if cfg.GroupBase != "" {
+		groupEntries, err = conn.Search(&ldap.SearchRequest{
+			BaseDN:     cfg.GroupBase,
+			Scope:      ldap.ScopeWholeSubtree,
+			Filter:     cfg.GroupFilter,
+			Attributes: []string{cfg.GroupIdentifier, cfg.GroupDescription, cfg.GroupMember},
+			PageSize:   cfg.PageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		usersByDN := map[string]*models.User{}
+		usersByIdentifier := map[string]*models.User{}
+
+		for _, entry := range userEntries {
+			user, created, err := s.upsertUser(tx, entry)
+			if errors.Is(err, ErrIdentifierConflict) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			if created {
+				result.UsersCreated++
+			} else {
+				result.UsersUpdated++
+			}
+
+			usersByDN[strings.ToLower(entry.DN)] = user
+			usersByIdentifier[user.Identifier] = user
+		}
+
+		// Uma busca vazia quase sempre indica erro de configuração, então não desativa ninguém
+		if len(userEntries) > 0 {
+			var ldapUsers []models.User
+			if err := tx.Where("source = ? AND is_active = ?", SourceLDAP, true).Find(&ldapUsers).Error; err != nil {
+				return err
+			}
+
+			for _, user := range ldapUsers {
+				if _, ok := usersByIdentifier[user.Identifier]; ok {
+					continue
+				}
+
+				metadata := map[string]interface{}{}
+				json.Unmarshal([]byte(user.Metadata), &metadata)
+				metadata[ldapDeactivatedKey] = true
+
+				metadataJSON, err := json.Marshal(metadata)
+				if err != nil {
+					return err
+				}
+
+				if err := tx.Model(&user).Updates(map[string]interface{}{
+					"is_active": false,
+					"metadata":  string(metadataJSON),
+				}).Error; err != nil {
+					return err
+				}
+				result.UsersDeactivated++
+			}
+		}
+
+		if cfg.GroupBase == "" {
+			return nil
+		}
+
+		seenGroups := map[string]bool{}
+
+		for _, entry := range groupEntries {
+			identifier := entry.Get(cfg.GroupIdentifier)
+			if identifier == "" {
+				continue
+			}
+
+			var group models.Group
+			err := tx.Where("identifier = ?", identifier).First(&group).Error
+			created := errors.Is(err, gorm.ErrRecordNotFound)
+
+			if err != nil && !created {
+				return err
+			}
+
+			if !created && group.Source != SourceLDAP {
+				continue
+			}
+
+			group.Identifier = identifier
+			group.Description = entry.Get(cfg.GroupDescription)
+			group.IsActive = true
+			group.Source = SourceLDAP
+			if group.Metadata == "" {
+				group.Metadata = "{}"
+			}
+
+			if err := tx.Save(&group).Error; err != nil {
+				return err
+			}
+
+			// Membros podem vir como DN (groupOfNames) ou como identificador (posixGroup)
+			members := []*models.User{}
+			for _, member := range entry.GetAll(cfg.GroupMember) {
+				if user, ok := usersByDN[strings.ToLower(member)]; ok {
+					members = append(members, user)
+				} else if user, ok := usersByIdentifier[member]; ok {
+					members = append(members, user)
+				}
+			}
+
+			if err := tx.Model(&group).Association("Users").Replace(members); err != nil {
+				return err
+			}
+
+			if created {
+				result.GroupsCreated++
+			} else {
+				result.GroupsUpdated++
+			}
+			seenGroups[identifier] = true
+		}
+
+		if len(groupEntries) == 0 {
+			return nil
+		}
+
+		var ldapGroups []models.Group
+		if err := tx.Where("source = ? AND is_active = ?", SourceLDAP, true).Find(&ldapGroups).Error; err != nil {
+			return err
+		}
+
+		for _, group := range ldapGroups {
+			if seenGroups[group.Identifier] {
+				continue
+			}
+
+			if err := tx.Model(&group).Update("is_active", false).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Model(&group).Association("Users").Clear(); err != nil {
+				return err
+			}
+			result.GroupsDeactivated++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
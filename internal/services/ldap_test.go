@@ -0,0 +1,208 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/ldap"
+	"github.com/duvrdx/whoami/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	testPeopleBase = "ou=people,dc=example,dc=com"
+	testGroupBase  = "ou=groups,dc=example,dc=com"
+)
+
+func testPerson(uid string) *ldap.Entry {
+	return &ldap.Entry{
+		DN: "uid=" + uid + "," + testPeopleBase,
+		Attributes: map[string][]string{
+			"objectClass": {"inetOrgPerson"},
+			"uid":         {uid},
+			"mail":        {uid + "@example.com"},
+		},
+	}
+}
+
+// newTestLDAP starts a directory with alice and bob, alice in the eng group, and
+// points the LDAP configuration at it
+func newTestLDAP(t *testing.T) (*ldap.TestServer, *ldapService, *gorm.DB) {
+	t.Helper()
+
+	db := newTestDB(t)
+
+	server, err := ldap.NewTestServer()
+	if err != nil {
+		t.Fatalf("NewTestServer: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	server.AddEntry(&ldap.Entry{DN: "cn=whoami,dc=example,dc=com"}, "servicepass")
+	server.AddEntry(testPerson("alice"), "alicepass")
+	server.AddEntry(testPerson("bob"), "bobpass")
+	server.AddEntry(&ldap.Entry{
+		DN: "cn=eng," + testGroupBase,
+		Attributes: map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"cn":          {"eng"},
+			"description": {"Engineering"},
+			"member":      {"uid=alice," + testPeopleBase},
+		},
+	}, "")
+
+	config.Config.LDAP = config.LDAPConfig{
+		Enabled:             true,
+		URL:                 server.URL,
+		BindDN:              "cn=whoami,dc=example,dc=com",
+		BindPassword:        "servicepass",
+		Timeout:             5,
+		PageSize:            1,
+		UserBase:            testPeopleBase,
+		UserFilter:          "(&(objectClass=inetOrgPerson)(uid=%s))",
+		UserSyncFilter:      "(objectClass=inetOrgPerson)",
+		IdentifierAttribute: "uid",
+		MetadataAttributes:  map[string]string{"email": "mail"},
+		GroupBase:           testGroupBase,
+		GroupFilter:         "(objectClass=groupOfNames)",
+		GroupIdentifier:     "cn",
+		GroupDescription:    "description",
+		GroupMember:         "member",
+	}
+
+	return server, &ldapService{db: db}, db
+}
+
+func findTestUser(t *testing.T, db *gorm.DB, identifier string) models.User {
+	t.Helper()
+
+	var user models.User
+	if err := db.Where("identifier = ?", identifier).First(&user).Error; err != nil {
+		t.Fatalf("finding %s: %v", identifier, err)
+	}
+	return user
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	_, service, db := newTestLDAP(t)
+
+	tests := []struct {
+		name       string
+		identifier string
+		password   string
+		wantErr    error
+	}{
+		{"valid password", "alice", "alicepass", nil},
+		{"wrong password", "alice", "bobpass", ldap.ErrInvalidCredentials},
+		{"empty password", "alice", "", ldap.ErrInvalidCredentials},
+		{"unknown user", "zed", "zedpass", ldap.ErrInvalidCredentials},
+		{"filter injection", "*", "alicepass", ldap.ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := service.Authenticate(tt.identifier, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && (user.Identifier != tt.identifier || user.Source != SourceLDAP || !user.IsActive) {
+				t.Errorf("Authenticate returned %+v", user)
+			}
+		})
+	}
+
+	var count int64
+	db.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Errorf("%d users were created, want 1", count)
+	}
+}
+
+func TestLDAPAuthenticateConflict(t *testing.T) {
+	_, service, db := newTestLDAP(t)
+
+	db.Create(&models.User{Identifier: "alice", Metadata: "{}", Source: "local"})
+
+	if _, err := service.Authenticate("alice", "alicepass"); !errors.Is(err, ErrIdentifierConflict) {
+		t.Errorf("Authenticate = %v, want ErrIdentifierConflict", err)
+	}
+}
+
+func TestLDAPSync(t *testing.T) {
+	server, service, db := newTestLDAP(t)
+
+	result, err := service.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if result.UsersCreated != 2 || result.GroupsCreated != 1 || result.UsersDeactivated != 0 {
+		t.Errorf("first sync = %+v", result)
+	}
+
+	var group models.Group
+	if err := db.Preload("Users").Where("identifier = ?", "eng").First(&group).Error; err != nil {
+		t.Fatalf("finding group: %v", err)
+	}
+	if group.Description != "Engineering" || len(group.Users) != 1 || group.Users[0].Identifier != "alice" {
+		t.Errorf("group eng = %+v", group)
+	}
+
+	// Bob sai do diretório e é desativado
+	server.RemoveEntry("uid=bob," + testPeopleBase)
+
+	if result, err = service.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if result.UsersDeactivated != 1 {
+		t.Errorf("UsersDeactivated = %d, want 1", result.UsersDeactivated)
+	}
+	if findTestUser(t, db, "bob").IsActive {
+		t.Errorf("bob is still active after vanishing from the directory")
+	}
+
+	// Alice é desativada localmente, o que nem o login nem a sincronização desfazem
+	db.Model(&models.User{}).Where("identifier = ?", "alice").Update("is_active", false)
+
+	if _, err := service.Authenticate("alice", "alicepass"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if _, err := service.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if findTestUser(t, db, "alice").IsActive {
+		t.Errorf("alice was reactivated after a local deactivation")
+	}
+
+	// Bob volta ao diretório e é reativado, já que foi a sincronização que o desativou
+	server.AddEntry(testPerson("bob"), "bobpass")
+
+	if _, err := service.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if !findTestUser(t, db, "bob").IsActive {
+		t.Errorf("bob was not reactivated after returning to the directory")
+	}
+}
+
+func TestLDAPSyncEmptySearch(t *testing.T) {
+	server, service, db := newTestLDAP(t)
+
+	if _, err := service.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	// Uma busca vazia não desativa ninguém
+	server.RemoveEntry("uid=alice," + testPeopleBase)
+	server.RemoveEntry("uid=bob," + testPeopleBase)
+
+	result, err := service.Sync()
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if result.UsersDeactivated != 0 || !findTestUser(t, db, "alice").IsActive {
+		t.Errorf("an empty search deactivated users: %+v", result)
+	}
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	MFAFactorTOTP = "totp"
+	// MFAChallengeMethod marks the login challenges waiting for a second factor
+	MFAChallengeMethod = "mfa"
+)
+
+var (
+	ErrMFARequired       = errors.New("a second factor code is required")
+	ErrInvalidMFACode    = errors.New("invalid second factor code")
+	ErrFactorConfirmed   = errors.New("factor is already confirmed")
+	ErrFactorNotFound    = errors.New("factor not found")
+	ErrFactorNeedsCode   = errors.New("a code from a confirmed factor is required to remove it")
+	ErrMFANotForServices = errors.New("service accounts cannot enroll second factors")
+)
+
+type MFAService interface {
+	GetFactors(userIdentifier string) ([]schemas.MFAFactorResponse, error)
+	// EnrollTOTP creates an unconfirmed TOTP factor and returns its secret and otpauth URI
+	EnrollTOTP(userIdentifier string, factor *schemas.MFAFactorCreate) (*schemas.MFAFactorResponse, error)
+	ConfirmFactor(userIdentifier string, id uint, code string) (*schemas.MFAFactorResponse, error)
+	// DeleteFactor removes a factor. Removing a confirmed factor takes a valid code,
+	// unless force is set for an administrator resetting a lost device.
+	DeleteFactor(userIdentifier string, id uint, code string, force bool) error
+
+	// Required reports whether the user has a confirmed factor
+	Required(userID uint) (bool, error)
+	// Verify checks a code against the user's confirmed factors
+	Verify(userID uint, code string) error
+
+	// StartChallenge issues a single-use token for a login whose first factor was
+	// verified by the given method, to be exchanged for tokens along with a code
+	StartChallenge(userID, clientID uint, method string) (string, error)
+	// CompleteChallenge verifies the code for the challenge token and consumes it
+	CompleteChallenge(clientID uint, token, code string) (*models.LoginChallenge, error)
+}
+
+type mfaService struct {
+	db *gorm.DB
+}
+
+func NewMFAService() MFAService {
+	return &mfaService{
+		db: config.GetDB(),
+	}
+}
+
+func (s *mfaService) findUser(identifier string) (*models.User, error) {
+	var user models.User
+
+	if err := s.db.Where("identifier = ?", identifier).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *mfaService) findFactor(userID, id uint) (*models.MFAFactor, error) {
+	var factor models.MFAFactor
+
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&factor).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFactorNotFound
+		}
+		return nil, err
+	}
+
+	return &factor, nil
+}
+
+func (s *mfaService) GetFactors(userIdentifier string) ([]schemas.MFAFactorResponse, error) {
+	user, err := s.findUser(userIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var factors []models.MFAFactor
+
+	if err := s.db.Where("user_id = ?", user.ID).Order("id").Find(&factors).Error; err != nil {
+		return nil, err
+	}
+
+	returnFactors := []schemas.MFAFactorResponse{}
+	for _, factor := range factors {
+		returnFactors = append(returnFactors, *schemas.MFAFactorResponseFromModel(&factor))
+	}
+
+	return returnFactors, nil
+}
+
+func (s *mfaService) EnrollTOTP(userIdentifier string, factor *schemas.MFAFactorCreate) (*schemas.MFAFactorResponse, error) {
+	user, err := s.findUser(userIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Type == UserTypeServiceAccount {
+		return nil, ErrMFANotForServices
+	}
+
+	name := factor.Name
+	if name == "" {
+		name = "Authenticator"
+	}
+
+	factorModel := models.MFAFactor{
+		UserID: user.ID,
+		Type:   MFAFactorTOTP,
+		Name:   name,
+		Secret: utils.GenerateTOTPSecret(),
+	}
+
+	if err := s.db.Create(&factorModel).Error; err != nil {
+		return nil, err
+	}
+
+	response := schemas.MFAFactorResponseFromModel(&factorModel)
+	response.Secret = factorModel.Secret
+	response.URI = utils.TOTPURI(config.Config.MFA.Issuer, user.Identifier, factorModel.Secret)
+
+	return response, nil
+}
+
+// accept checks the code against the factor and records the step so the code cannot be replayed
+func (s *mfaService) accept(factor *models.MFAFactor, code string) bool {
+	step, ok := utils.VerifyTOTP(factor.Secret, code, time.Now(), config.Config.MFA.Skew)
+	if !ok || step <= factor.LastUsedStep {
+		return false
+	}
+
+	// A condição no UPDATE evita que duas requisições simultâneas aceitem o mesmo código
+	result := s.db.Model(&models.MFAFactor{}).
+		Where("id = ? AND last_used_step < ?", factor.ID, step).
+		Update("last_used_step", step)
+
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+
+	factor.LastUsedStep = step
+	return true
+}
+
+func (s *mfaService) ConfirmFactor(userIdentifier string, id uint, code string) (*schemas.MFAFactorResponse, error) {
+	user, err := s.findUser(userIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	factor, err := s.findFactor(user.ID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if factor.ConfirmedAt != nil {
+		return nil, ErrFactorConfirmed
+	}
+
+	if !s.accept(factor, code) {
+		return nil, ErrInvalidMFACode
+	}
+
+	now := time.Now()
+	factor.ConfirmedAt = &now
+
+	if err := s.db.Model(factor).Update("confirmed_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	return schemas.MFAFactorResponseFromModel(factor), nil
+}
+
+func (s *mfaService) DeleteFactor(userIdentifier string, id uint, code string, force bool) error {
+	user, err := s.findUser(userIdentifier)
+	if err != nil {
+		return err
+	}
+
+	factor, err := s.findFactor(user.ID, id)
+	if err != nil {
+		return err
+	}
+
+	// Um token de acesso roubado não deve bastar para desativar o segundo fator
+	if factor.ConfirmedAt != nil && !force {
+		if code == "" {
+			return ErrFactorNeedsCode
+		}
+
+		if err := s.Verify(user.ID, code); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Unscoped().Delete(factor).Error
+}
+
+func (s *mfaService) Required(userID uint) (bool, error) {
+	var count int64
+
+	err := s.db.Model(&models.MFAFactor{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL", userID).
+		Count(&count).Error
+
+	return count > 0, err
+}
+
+func (s *mfaService) Verify(userID uint, code string) error {
+	if code == "" {
+		return ErrMFARequired
+	}
+
+	var factors []models.MFAFactor
+
+	if err := s.db.Where("user_id = ? AND confirmed_at IS NOT NULL", userID).Find(&factors).Error; err != nil {
+		return err
+	}
+
+	for i := range factors {
+		if s.accept(&factors[i], code) {
+			return nil
+		}
+	}
+
+	return ErrInvalidMFACode
+}
+
+func (s *mfaService) StartChallenge(userID, clientID uint, method string) (string, error) {
+	token := utils.GenerateSecureString(43)
+
+	challenge := models.LoginChallenge{
+		Method:      MFAChallengeMethod,
+		FirstFactor: method,
+		SecretHash:  utils.HashToken(token),
+		UserID:      userID,
+		ClientID:    clientID,
+		ExpiresAt:   time.Now().Add(time.Duration(config.Config.MFA.ChallengeExpiration) * time.Second),
+	}
+
+	if err := s.db.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (s *mfaService) CompleteChallenge(clientID uint, token, code string) (*models.LoginChallenge, error) {
+	var challenge models.LoginChallenge
+
+	if err := s.db.Preload("User").
+		Where("secret_hash = ? AND method = ? AND consumed_at IS NULL", utils.HashToken(token), MFAChallengeMethod).
+		First(&challenge).Error; err != nil {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	if challenge.ClientID != clientID || time.Now().After(challenge.ExpiresAt) {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	// Como nos códigos de uso único, a tentativa é contada antes da verificação
+	result := s.db.Model(&models.LoginChallenge{}).
+		Where("id = ? AND attempts < ?", challenge.ID, config.Config.MFA.MaxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	if err := s.Verify(challenge.UserID, code); err != nil {
+		return nil, err
+	}
+
+	if err := consumeChallenge(s.db, &challenge); err != nil {
+		return nil, err
+	}
+
+	return &challenge, nil
+}
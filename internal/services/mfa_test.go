@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/utils"
+	"gorm.io/gorm"
+)
+
+// newTestMFA enrolls and confirms a TOTP factor for alice and returns its secret
+// along with the step its confirmation code used
+func newTestMFA(t *testing.T) (*mfaService, *gorm.DB, models.User, string, int64) {
+	t.Helper()
+
+	db := newTestDB(t)
+	config.Config.MFA = config.MFAConfig{Issuer: "whoami", Skew: 1, ChallengeExpiration: 300, MaxAttempts: 3}
+	db.Create(&models.User{Identifier: "alice", Metadata: "{}", IsActive: true})
+
+	service := &mfaService{db: db}
+	factor, err := service.EnrollTOTP("alice", &schemas.MFAFactorCreate{})
+	if err != nil {
+		t.Fatalf("EnrollTOTP: %v", err)
+	}
+
+	step := utils.TOTPStep(time.Now())
+	code, _ := utils.TOTPCode(factor.Secret, step)
+	if _, err := service.ConfirmFactor("alice", factor.ID, code); err != nil {
+		t.Fatalf("ConfirmFactor: %v", err)
+	}
+
+	return service, db, findTestUser(t, db, "alice"), factor.Secret, step
+}
+
+func TestMFAVerify(t *testing.T) {
+	service, _, alice, secret, step := newTestMFA(t)
+	code := func(step int64) string {
+		code, _ := utils.TOTPCode(secret, step)
+		return code
+	}
+
+	if required, err := service.Required(alice.ID); err != nil || !required {
+		t.Fatalf("Required = %v, %v", required, err)
+	}
+
+	if err := service.Verify(alice.ID, ""); !errors.Is(err, ErrMFARequired) {
+		t.Errorf("Verify without a code = %v, want ErrMFARequired", err)
+	}
+
+	// O código da confirmação e os de intervalos anteriores já não valem
+	for _, replayed := range []int64{step, step - 1} {
+		if err := service.Verify(alice.ID, code(replayed)); !errors.Is(err, ErrInvalidMFACode) {
+			t.Errorf("Verify with the code of step %d = %v, want ErrInvalidMFACode", replayed-step, err)
+		}
+	}
+
+	if err := service.Verify(alice.ID, code(step+3)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Verify outside the window = %v, want ErrInvalidMFACode", err)
+	}
+
+	if err := service.Verify(alice.ID, code(step+1)); err != nil {
+		t.Fatalf("Verify within the window = %v", err)
+	}
+	if err := service.Verify(alice.ID, code(step+1)); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Verify replaying a code = %v, want ErrInvalidMFACode", err)
+	}
+}
+
+func TestMFAUnconfirmedFactor(t *testing.T) {
+	db := newTestDB(t)
+	config.Config.MFA = config.MFAConfig{Skew: 1}
+	db.Create(&models.User{Identifier: "alice", Metadata: "{}", IsActive: true})
+
+	service := &mfaService{db: db}
+	factor, err := service.EnrollTOTP("alice", &schemas.MFAFactorCreate{})
+	if err != nil {
+		t.Fatalf("EnrollTOTP: %v", err)
+	}
+
+	alice := findTestUser(t, db, "alice")
+	if required, _ := service.Required(alice.ID); required {
+		t.Error("an unconfirmed factor made the second factor required")
+	}
+
+	code, _ := utils.TOTPCode(factor.Secret, utils.TOTPStep(time.Now()))
+	if err := service.Verify(alice.ID, code); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("Verify with an unconfirmed factor = %v, want ErrInvalidMFACode", err)
+	}
+}
+
+func TestMFAChallenge(t *testing.T) {
+	service, db, alice, secret, step := newTestMFA(t)
+	code := func(step int64) string {
+		code, _ := utils.TOTPCode(secret, step)
+		return code
+	}
+
+	token, err := service.StartChallenge(alice.ID, 1, LoginMethodOTP)
+	if err != nil {
+		t.Fatalf("StartChallenge: %v", err)
+	}
+
+	if _, err := service.CompleteChallenge(2, token, code(step+1)); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("CompleteChallenge from another client = %v, want ErrInvalidLoginChallenge", err)
+	}
+
+	challenge, err := service.CompleteChallenge(1, token, code(step+1))
+	if err != nil {
+		t.Fatalf("CompleteChallenge: %v", err)
+	}
+	if challenge.UserID != alice.ID || challenge.FirstFactor != LoginMethodOTP {
+		t.Errorf("challenge = user %d, first factor %s", challenge.UserID, challenge.FirstFactor)
+	}
+
+	if _, err := service.CompleteChallenge(1, token, code(step)); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("CompleteChallenge twice = %v, want ErrInvalidLoginChallenge", err)
+	}
+
+	// Esgotadas as tentativas, nem o código certo serve
+	token, _ = service.StartChallenge(alice.ID, 1, LoginMethodOTP)
+	for i := 0; i < config.Config.MFA.MaxAttempts; i++ {
+		if _, err := service.CompleteChallenge(1, token, "000000"); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("CompleteChallenge with a wrong code = %v, want ErrInvalidMFACode", err)
+		}
+	}
+	if _, err := service.CompleteChallenge(1, token, code(step+2)); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("CompleteChallenge after the attempts = %v, want ErrInvalidLoginChallenge", err)
+	}
+
+	token, _ = service.StartChallenge(alice.ID, 1, LoginMethodOTP)
+	db.Model(&models.LoginChallenge{}).Where("consumed_at IS NULL").Update("expires_at", time.Now().Add(-time.Second))
+	if _, err := service.CompleteChallenge(1, token, code(step+2)); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("CompleteChallenge after it expired = %v, want ErrInvalidLoginChallenge", err)
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+)
+
+// Notification is a message to be delivered to a user out of band (email, SMS, chat...)
+type Notification struct {
+	Kind      string            `json:"kind"`
+	Recipient string            `json:"recipient"`
+	Address   string            `json:"address"`
+	Subject   string            `json:"subject"`
+	Body      string            `json:"body"`
+	Data      map[string]string `json:"data,omitempty"`
+}
+
+// Notifier delivers notifications. New delivery channels only need to implement
+// this interface and be registered in NewNotifier.
+type Notifier interface {
+	Notify(notification Notification) error
+}
+
+// NewNotifier returns the notifier configured in notifier.kind
+func NewNotifier() Notifier {
+	switch config.Config.Notifier.Kind {
+	case "webhook":
+		return &webhookNotifier{
+			url:    config.Config.Notifier.WebhookURL,
+			client: &http.Client{Timeout: 10 * time.Second},
+		}
+	default:
+		return logNotifier{}
+	}
+}
+
+// logNotifier writes notifications to the server log, useful in development
+type logNotifier struct{}
+
+func (logNotifier) Notify(notification Notification) error {
+	log.Printf("[notifier] %s to %s (%s): %s\n%s", notification.Kind, notification.Recipient, notification.Address, notification.Subject, notification.Body)
+	return nil
+}
+
+// webhookNotifier posts notifications as JSON to an external delivery service
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notifier webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// notificationAddress picks the delivery address for a user: the "email" (or
+// "phone") entry of its metadata when present, otherwise its identifier
+func notificationAddress(identifier, metadata string) string {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(metadata), &data); err == nil {
+		for _, key := range []string{"email", "phone"} {
+			if value, ok := data[key].(string); ok && value != "" {
+				return value
+			}
+		}
+	}
+
+	return identifier
+}
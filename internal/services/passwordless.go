@@ -0,0 +1,217 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	LoginMethodPassword   = "password"
+	LoginMethodMagicLink  = "magic_link"
+	LoginMethodOTP        = "otp"
+	LoginMethodFederation = "federation"
+)
+
+var (
+	ErrLoginMethodNotAllowed = errors.New("login method not allowed for this client")
+	ErrTooManyLoginRequests  = errors.New("too many login requests, try again later")
+	ErrInvalidLoginChallenge = errors.New("invalid or expired login code")
+)
+
+type PasswordlessService interface {
+	// StartLogin issues a magic link or one-time code and delivers it to the user
+	StartLogin(clientID uint, userIdentifier, method string) error
+	// RedeemMagicLink consumes a magic link token and returns the user it was issued to
+	RedeemMagicLink(clientID uint, token string) (*models.User, error)
+	// RedeemOTP consumes a one-time code issued to the user and returns the user
+	RedeemOTP(clientID uint, userIdentifier, code string) (*models.User, error)
+}
+
+type passwordlessService struct {
+	db       *gorm.DB
+	notifier Notifier
+}
+
+func NewPasswordlessService(notifier Notifier) PasswordlessService {
+	return &passwordlessService{
+		db:       config.GetDB(),
+		notifier: notifier,
+	}
+}
+
+func (s *passwordlessService) StartLogin(clientID uint, userIdentifier, method string) error {
+	cfg := config.Config.Passwordless
+	var user models.User
+
+	if method != LoginMethodMagicLink && method != LoginMethodOTP {
+		return ErrLoginMethodNotAllowed
+	}
+
+	if method == LoginMethodMagicLink && cfg.LinkURL == "" {
+		return errors.New("magic links are not configured")
+	}
+
+	// Limita os pedidos por identificador, existindo ou não o usuário, para que a
+	// resposta não revele quais contas existem
+	var recent int64
+	windowStart := time.Now().Add(-time.Duration(cfg.RateWindow) * time.Second)
+	if err := s.db.Model(&models.LoginRequest{}).
+		Where("identifier = ? AND created_at > ?", userIdentifier, windowStart).
+		Count(&recent).Error; err != nil {
+		return err
+	}
+
+	if int(recent) >= cfg.RateLimit {
+		return ErrTooManyLoginRequests
+	}
+
+	if err := s.db.Create(&models.LoginRequest{Identifier: userIdentifier, ClientID: clientID}).Error; err != nil {
+		return err
+	}
+
+	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
+		return err
+	}
+
+	var secret string
+	if method == LoginMethodMagicLink {
+		secret = utils.GenerateSecureString(43)
+	} else {
+		secret = utils.GenerateNumericCode(6)
+	}
+
+	challenge := models.LoginChallenge{
+		Method:     method,
+		SecretHash: utils.HashToken(secret),
+		UserID:     user.ID,
+		ClientID:   clientID,
+		ExpiresAt:  time.Now().Add(time.Duration(cfg.Expiration) * time.Second),
+	}
+
+	if err := s.db.Create(&challenge).Error; err != nil {
+		return err
+	}
+
+	notification := Notification{
+		Kind:      method,
+		Recipient: user.Identifier,
+		Address:   notificationAddress(user.Identifier, user.Metadata),
+		Data:      map[string]string{"expires_at": challenge.ExpiresAt.Format(time.RFC3339)},
+	}
+
+	if method == LoginMethodMagicLink {
+		link, err := magicLinkURL(cfg.LinkURL, secret)
+		if err != nil {
+			return err
+		}
+
+		notification.Subject = "Your sign-in link"
+		notification.Body = fmt.Sprintf("Use this link to sign in: %s", link)
+		notification.Data["link"] = link
+	} else {
+		notification.Subject = "Your sign-in code"
+		notification.Body = fmt.Sprintf("Your sign-in code is %s", secret)
+		notification.Data["code"] = secret
+	}
+
+	return s.notifier.Notify(notification)
+}
+
+func magicLinkURL(base, token string) (string, error) {
+	link, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return link.String(), nil
+}
+
+func (s *passwordlessService) RedeemMagicLink(clientID uint, token string) (*models.User, error) {
+	var challenge models.LoginChallenge
+
+	if err := s.db.Preload("User").
+		Where("secret_hash = ? AND method = ? AND consumed_at IS NULL", utils.HashToken(token), LoginMethodMagicLink).
+		First(&challenge).Error; err != nil {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	if challenge.ClientID != clientID || time.Now().After(challenge.ExpiresAt) {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	if err := consumeChallenge(s.db, &challenge); err != nil {
+		return nil, err
+	}
+
+	return &challenge.User, nil
+}
+
+func (s *passwordlessService) RedeemOTP(clientID uint, userIdentifier, code string) (*models.User, error) {
+	var user models.User
+	var challenge models.LoginChallenge
+
+	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	// Apenas o código mais recente do usuário é válido
+	if err := s.db.
+		Where("user_id = ? AND client_id = ? AND method = ? AND consumed_at IS NULL AND expires_at > ?",
+			user.ID, clientID, LoginMethodOTP, time.Now()).
+		Order("created_at DESC").
+		First(&challenge).Error; err != nil {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	// A tentativa é contada antes da comparação, e a condição no próprio update impede
+	// que palpites concorrentes passem todos pelo limite
+	result := s.db.Model(&models.LoginChallenge{}).
+		Where("id = ? AND attempts < ?", challenge.ID, config.Config.Passwordless.MaxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	if subtle.ConstantTimeCompare([]byte(challenge.SecretHash), []byte(utils.HashToken(code))) != 1 {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	if err := consumeChallenge(s.db, &challenge); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// consumeChallenge marks the challenge as used. The conditional update guarantees
+// that concurrent redemptions of the same code cannot both succeed.
+func consumeChallenge(db *gorm.DB, challenge *models.LoginChallenge) error {
+	result := db.Model(&models.LoginChallenge{}).
+		Where("id = ? AND consumed_at IS NULL", challenge.ID).
+		Update("consumed_at", time.Now())
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected != 1 {
+		return ErrInvalidLoginChallenge
+	}
+
+	return nil
+}
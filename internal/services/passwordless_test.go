@@ -0,0 +1,166 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"gorm.io/gorm"
+)
+
+// recordingNotifier keeps the notifications instead of delivering them
+type recordingNotifier struct {
+	sent []Notification
+}
+
+func (n *recordingNotifier) Notify(notification Notification) error {
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+func (n *recordingNotifier) last(t *testing.T, key string) string {
+	t.Helper()
+
+	if len(n.sent) == 0 {
+		t.Fatal("nothing was sent")
+	}
+	return n.sent[len(n.sent)-1].Data[key]
+}
+
+func magicLinkToken(t *testing.T, notifier *recordingNotifier) string {
+	t.Helper()
+
+	link, err := url.Parse(notifier.last(t, "link"))
+	if err != nil {
+		t.Fatalf("parsing link: %v", err)
+	}
+	return link.Query().Get("token")
+}
+
+func newTestPasswordless(t *testing.T) (*passwordlessService, *recordingNotifier, *gorm.DB) {
+	t.Helper()
+
+	db := newTestDB(t)
+	config.Config.Passwordless = config.PasswordlessConfig{
+		LinkURL: "https://app.example.com/login", Expiration: 600, MaxAttempts: 3, RateLimit: 3, RateWindow: 3600,
+	}
+	db.Create(&models.User{Identifier: "alice", Metadata: "{}", IsActive: true})
+
+	notifier := &recordingNotifier{}
+	return &passwordlessService{db: db, notifier: notifier}, notifier, db
+}
+
+func TestPasswordlessMagicLink(t *testing.T) {
+	service, notifier, db := newTestPasswordless(t)
+
+	if err := service.StartLogin(1, "alice", LoginMethodMagicLink); err != nil {
+		t.Fatalf("StartLogin: %v", err)
+	}
+	token := magicLinkToken(t, notifier)
+
+	if _, err := service.RedeemMagicLink(2, token); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("RedeemMagicLink from another client = %v, want ErrInvalidLoginChallenge", err)
+	}
+
+	user, err := service.RedeemMagicLink(1, token)
+	if err != nil {
+		t.Fatalf("RedeemMagicLink: %v", err)
+	}
+	if user.Identifier != "alice" {
+		t.Errorf("user = %s, want alice", user.Identifier)
+	}
+
+	if _, err := service.RedeemMagicLink(1, token); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("RedeemMagicLink twice = %v, want ErrInvalidLoginChallenge", err)
+	}
+
+	service.StartLogin(1, "alice", LoginMethodMagicLink)
+	token = magicLinkToken(t, notifier)
+	db.Model(&models.LoginChallenge{}).Where("consumed_at IS NULL").Update("expires_at", time.Now().Add(-time.Second))
+
+	if _, err := service.RedeemMagicLink(1, token); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("RedeemMagicLink after it expired = %v, want ErrInvalidLoginChallenge", err)
+	}
+}
+
+func TestPasswordlessOTP(t *testing.T) {
+	service, notifier, db := newTestPasswordless(t)
+
+	service.StartLogin(1, "alice", LoginMethodOTP)
+	stale := notifier.last(t, "code")
+	service.StartLogin(1, "alice", LoginMethodOTP)
+	code := notifier.last(t, "code")
+
+	// Só o código mais recente vale
+	if stale != code {
+		if _, err := service.RedeemOTP(1, "alice", stale); !errors.Is(err, ErrInvalidLoginChallenge) {
+			t.Errorf("RedeemOTP with a replaced code = %v, want ErrInvalidLoginChallenge", err)
+		}
+	}
+
+	if _, err := service.RedeemOTP(1, "bob", code); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("RedeemOTP for another user = %v, want ErrInvalidLoginChallenge", err)
+	}
+
+	if _, err := service.RedeemOTP(1, "alice", code); err != nil {
+		t.Fatalf("RedeemOTP: %v", err)
+	}
+	if _, err := service.RedeemOTP(1, "alice", code); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("RedeemOTP twice = %v, want ErrInvalidLoginChallenge", err)
+	}
+
+	service.StartLogin(1, "alice", LoginMethodOTP)
+	code = notifier.last(t, "code")
+	db.Model(&models.LoginChallenge{}).Where("consumed_at IS NULL").Update("expires_at", time.Now().Add(-time.Second))
+
+	if _, err := service.RedeemOTP(1, "alice", code); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("RedeemOTP after it expired = %v, want ErrInvalidLoginChallenge", err)
+	}
+}
+
+func TestPasswordlessOTPAttempts(t *testing.T) {
+	service, notifier, _ := newTestPasswordless(t)
+
+	service.StartLogin(1, "alice", LoginMethodOTP)
+	code := notifier.last(t, "code")
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	for i := 0; i < config.Config.Passwordless.MaxAttempts; i++ {
+		if _, err := service.RedeemOTP(1, "alice", wrong); !errors.Is(err, ErrInvalidLoginChallenge) {
+			t.Fatalf("RedeemOTP with a wrong code = %v", err)
+		}
+	}
+
+	if _, err := service.RedeemOTP(1, "alice", code); !errors.Is(err, ErrInvalidLoginChallenge) {
+		t.Errorf("RedeemOTP after the attempts = %v, want ErrInvalidLoginChallenge", err)
+	}
+}
+
+// O limite vale igualmente para contas que não existem, para não revelá-las
+func TestPasswordlessRateLimit(t *testing.T) {
+	service, notifier, _ := newTestPasswordless(t)
+
+	for _, identifier := range []string{"alice", "ghost"} {
+		for i := 0; i < config.Config.Passwordless.RateLimit; i++ {
+			err := service.StartLogin(1, identifier, LoginMethodOTP)
+			if identifier == "ghost" && !errors.Is(err, gorm.ErrRecordNotFound) || identifier == "alice" && err != nil {
+				t.Fatalf("StartLogin(%s) = %v", identifier, err)
+			}
+		}
+
+		if err := service.StartLogin(1, identifier, LoginMethodOTP); !errors.Is(err, ErrTooManyLoginRequests) {
+			t.Errorf("StartLogin(%s) over the limit = %v, want ErrTooManyLoginRequests", identifier, err)
+		}
+	}
+
+	if len(notifier.sent) != config.Config.Passwordless.RateLimit {
+		t.Errorf("%d messages sent, want %d", len(notifier.sent), config.Config.Passwordless.RateLimit)
+	}
+}
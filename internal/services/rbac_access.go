@@ -0,0 +1,221 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+)
+
+const (
+	grantedResourcesDefaultLimit = 100
+	grantedResourcesMaxLimit     = 1000
+)
+
+func (s *authzRBACService) ListGrantedResources(userIdentifier string, filter *schemas.RBACGrantedResourceFilter) (*schemas.RBACGrantedResources, error) {
+	algorithm := combiningAlgorithm()
+
+	user, roleIDs, err := s.effectiveRoleIDs(userIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := batchRules(s.db, roleIDs, []string{filter.Permission})
+	if err != nil {
+		return nil, err
+	}
+
+	// Candidatos: os recursos e padrões em que alguma permissão é concedida
+	kinds := map[string]string{}
+	for _, row := range rows {
+		if row.Rule.Resource != "" && row.Rule.Effect != EffectDeny {
+			kinds[row.Rule.Resource] = row.ResourceKind
+		}
+	}
+
+	identifiers := make([]string, 0, len(kinds))
+	for identifier := range kinds {
+		if identifier > filter.After {
+			identifiers = append(identifiers, identifier)
+		}
+	}
+	sort.Strings(identifiers)
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = grantedResourcesDefaultLimit
+	} else if limit > grantedResourcesMaxLimit {
+		limit = grantedResourcesMaxLimit
+	}
+
+	response := &schemas.RBACGrantedResources{
+		Subject:    user.Identifier,
+		Permission: filter.Permission,
+		Resources:  []schemas.RBACGrantedResource{},
+	}
+
+	for _, identifier := range identifiers {
+		if len(response.Resources) == limit {
+			response.Next = response.Resources[limit-1].Identifier
+			break
+		}
+
+		check := schemas.RBACAuthorizationCheck{Permission: filter.Permission, Resource: identifier}
+		if allowed, conditional := staticDecision(matchRules(rows, check), algorithm); allowed {
+			response.Resources = append(response.Resources, schemas.RBACGrantedResource{
+				Identifier:  identifier,
+				Kind:        kinds[identifier],
+				Conditional: conditional,
+			})
+		}
+	}
+
+	return response, nil
+}
+
+func (s *authzRBACService) ListGrantedResourceTypes(userIdentifier, permissionIdentifier string) ([]schemas.RBACGrantedResource, error) {
+	algorithm := combiningAlgorithm()
+
+	_, roleIDs, err := s.effectiveRoleIDs(userIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := batchRules(s.db, roleIDs, []string{permissionIdentifier})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	resourceTypes := []string{}
+	for _, row := range rows {
+		if row.ResourceType != "" && row.Rule.Effect != EffectDeny && !seen[row.ResourceType] {
+			seen[row.ResourceType] = true
+			resourceTypes = append(resourceTypes, row.ResourceType)
+		}
+	}
+	sort.Strings(resourceTypes)
+
+	granted := []schemas.RBACGrantedResource{}
+	for _, resourceType := range resourceTypes {
+		check := schemas.RBACAuthorizationCheck{Permission: permissionIdentifier, ResourceType: resourceType}
+		if allowed, conditional := staticDecision(matchRules(rows, check), algorithm); allowed {
+			granted = append(granted, schemas.RBACGrantedResource{Identifier: resourceType, Conditional: conditional})
+		}
+	}
+
+	return granted, nil
+}
+
+func (s *authzRBACService) GetResourceAccess(resourceIdentifier, permissionIdentifier string) (*schemas.RBACResourceAccess, error) {
+	response := &schemas.RBACResourceAccess{
+		Resource:   resourceIdentifier,
+		Permission: permissionIdentifier,
+		Users:      []schemas.RBACAccessHolder{},
+		Groups:     []schemas.RBACAccessHolder{},
+	}
+
+	// Regras de todos os papéis que cobrem o recurso
+	rules, err := resourceRules(s.db, s.db.Model(&models.RBACRole{}).Select("id"), permissionIdentifier, resourceIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	granting := []string{}
+	for _, rule := range rules {
+		if rule.Effect != EffectDeny {
+			granting = append(granting, rule.Role)
+		}
+	}
+
+	if len(granting) == 0 {
+		return response, nil
+	}
+
+	// Papéis que concedem a permissão e os que herdam deles
+	grantingIDs := s.db.Model(&models.RBACRole{}).Select("id").Where("identifier IN ?", granting)
+	holderIDs := s.db.Model(&models.RBACRole{}).Select("id").
+		Where("id IN (?) OR id IN (?)", grantingIDs, s.db.Model(&models.RBACRoleClosure{}).Select("role_id").Where("ancestor_id IN (?)", grantingIDs))
+
+	var groups []models.Group
+	if err := s.db.Where("is_active = ?", true).
+		Where("id IN (?)", s.db.Table("rbac_role_groups").Select("group_id").Where("rbac_role_id IN (?)", holderIDs)).
+		Order("identifier").
+		Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	for _, group := range groups {
+		direct := s.db.Table("rbac_role_groups").Select("rbac_role_id").Where("group_id = ?", group.ID)
+
+		holder, err := s.accessHolder(group.Identifier, inheritedRoleIDs(s.db, direct), resourceIdentifier, permissionIdentifier)
+		if err != nil {
+			return nil, err
+		}
+		if holder != nil {
+			response.Groups = append(response.Groups, *holder)
+		}
+	}
+
+	// Membros dos grupos que detêm o papel, inclusive dos subgrupos, e quem o detém diretamente
+	holderGroups := s.db.Table("rbac_role_groups").Select("group_id").Where("rbac_role_id IN (?)", holderIDs)
+	subgroups := s.db.Model(&models.GroupClosure{}).Select("descendant_id").Where("ancestor_id IN (?)", holderGroups)
+
+	var users []models.User
+	if err := s.db.Where("id IN (?) OR id IN (?)",
+		activeAssignments(s.db).Select("user_id").Where("rbac_role_id IN (?)", holderIDs),
+		s.db.Table("group_users").Select("user_id").Where("group_id IN (?) OR group_id IN (?)", holderGroups, subgroups)).
+		Order("identifier").
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		roles, err := s.effectiveRoles(&user)
+		if err != nil {
+			return nil, err
+		}
+
+		roleIDs := make([]uint, len(roles))
+		for i, role := range roles {
+			roleIDs[i] = role.ID
+		}
+
+		holder, err := s.accessHolder(user.Identifier, roleIDs, resourceIdentifier, permissionIdentifier)
+		if err != nil {
+			return nil, err
+		}
+		if holder != nil {
+			response.Users = append(response.Users, *holder)
+		}
+	}
+
+	return response, nil
+}
+
+// accessHolder decides whether the roles hold the permission on the resource, returning
+// the roles granting it, or nil when a deny rule or the lack of a grant keeps it from them
+func (s *authzRBACService) accessHolder(identifier string, roleIDs interface{}, resourceIdentifier, permissionIdentifier string) (*schemas.RBACAccessHolder, error) {
+	rules, err := resourceRules(s.db, roleIDs, permissionIdentifier, resourceIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, conditional := staticDecision(rules, combiningAlgorithm())
+	if !allowed {
+		return nil, nil
+	}
+
+	holder := &schemas.RBACAccessHolder{Identifier: identifier, Roles: []string{}, Conditional: conditional}
+
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		if rule.Effect != EffectDeny && !seen[rule.Role] {
+			seen[rule.Role] = true
+			holder.Roles = append(holder.Roles, rule.Role)
+		}
+	}
+	sort.Strings(holder.Roles)
+
+	return holder, nil
+}
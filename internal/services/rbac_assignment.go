@@ -0,0 +1,171 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidAssignmentWindow = errors.New("expires_at must be in the future and after not_before")
+
+// activeAssignments returns a query for the role assignments within their window now
+func activeAssignments(db *gorm.DB) *gorm.DB {
+	now := time.Now()
+
+	return db.Model(&models.RBACRoleAssignment{}).
+		Where("not_before IS NULL OR not_before <= ?", now).
+		Where("expires_at IS NULL OR expires_at > ?", now)
+}
+
+func (s *authzRBACService) AssignRole(assignment *schemas.RBACRoleAssignmentCreate, grantorIdentifier string) (*schemas.RBACRoleAssignmentResponse, error) {
+	if assignment.ExpiresAt != nil {
+		if !assignment.ExpiresAt.After(time.Now()) ||
+			assignment.NotBefore != nil && !assignment.ExpiresAt.After(*assignment.NotBefore) {
+			return nil, ErrInvalidAssignmentWindow
+		}
+	}
+
+	// As janelas são comparadas com a hora local do servidor, como os demais prazos
+	for _, at := range []*time.Time{assignment.NotBefore, assignment.ExpiresAt} {
+		if at != nil {
+			*at = at.Local()
+		}
+	}
+
+	var role models.RBACRole
+	var user models.User
+
+	// Verifica se o papel e o usuário existem
+	if err := s.db.Where("identifier = ?", assignment.Role).First(&role).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Where("identifier = ?", assignment.User).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	model := models.RBACRoleAssignment{
+		RoleID:    role.ID,
+		UserID:    user.ID,
+		NotBefore: assignment.NotBefore,
+		ExpiresAt: assignment.ExpiresAt,
+		Reason:    assignment.Reason,
+	}
+
+	if grantorIdentifier != "" {
+		var grantor models.User
+		if err := s.db.Where("identifier = ?", grantorIdentifier).First(&grantor).Error; err != nil {
+			return nil, err
+		}
+		model.GrantorID = &grantor.ID
+	}
+
+	// Atribuir de novo um papel substitui a janela, o motivo e quem o concedeu
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "rbac_role_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"not_before", "expires_at", "reason", "grantor_id", "updated_at"}),
+	}).Create(&model).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Preload("Role").Preload("User").Preload("Grantor").
+		Where("rbac_role_id = ? AND user_id = ?", role.ID, user.ID).
+		First(&model).Error; err != nil {
+		return nil, err
+	}
+
+	return schemas.RBACRoleAssignmentResponseFromModel(&model), nil
+}
+
+func (s *authzRBACService) GetAssignments(filter *schemas.RBACRoleAssignmentFilter) ([]schemas.RBACRoleAssignmentResponse, error) {
+	query := s.db.Preload("Role").Preload("User").Preload("Grantor").Order("created_at")
+
+	if filter.Role != "" {
+		query = query.Where("rbac_role_id IN (?)", s.db.Model(&models.RBACRole{}).Select("id").Where("identifier = ?", filter.Role))
+	}
+
+	if filter.User != "" {
+		query = query.Where("user_id IN (?)", s.db.Model(&models.User{}).Select("id").Where("identifier = ?", filter.User))
+	}
+
+	return s.findAssignments(query)
+}
+
+func (s *authzRBACService) GetExpiringAssignments(within time.Duration) ([]schemas.RBACRoleAssignmentResponse, error) {
+	now := time.Now()
+
+	query := s.db.Preload("Role").Preload("User").Preload("Grantor").
+		Where("expires_at > ? AND expires_at <= ?", now, now.Add(within)).
+		Order("expires_at")
+
+	return s.findAssignments(query)
+}
+
+func (s *authzRBACService) findAssignments(query *gorm.DB) ([]schemas.RBACRoleAssignmentResponse, error) {
+	var assignments []models.RBACRoleAssignment
+
+	if err := query.Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+
+	returnAssignments := []schemas.RBACRoleAssignmentResponse{}
+	for _, assignment := range assignments {
+		returnAssignments = append(returnAssignments, *schemas.RBACRoleAssignmentResponseFromModel(&assignment))
+	}
+
+	return returnAssignments, nil
+}
+
+func (s *authzRBACService) ExpireAssignments() (int, error) {
+	var assignments []models.RBACRoleAssignment
+	now := time.Now()
+
+	if err := s.db.Preload("Role").Where("expires_at <= ?", now).Find(&assignments).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		audit := &auditService{db: tx}
+
+		for _, assignment := range assignments {
+			// Uma atribuição renovada desde a busca não é removida
+			result := tx.Where("rbac_role_id = ? AND user_id = ? AND expires_at <= ?", assignment.RoleID, assignment.UserID, now).
+				Delete(&models.RBACRoleAssignment{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+
+			// O evento fica atribuído a quem concedeu o papel
+			entry := &schemas.AuditLogCreate{
+				Action: AuditRoleAssignmentExpired,
+				UserID: assignment.UserID,
+				Reason: fmt.Sprintf("role %s expired at %s", assignment.Role.Identifier, assignment.ExpiresAt.Format(time.RFC3339)),
+			}
+			if assignment.GrantorID != nil {
+				entry.ActorID = *assignment.GrantorID
+			}
+
+			if err := audit.Record(entry); err != nil {
+				return err
+			}
+
+			expired++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return expired, nil
+}
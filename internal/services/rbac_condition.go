@@ -0,0 +1,173 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+var ErrInvalidCondition = errors.New("invalid permission condition")
+
+// conditionCostLimit bounds the work of a single condition, so a permission can't
+// stall authorization requests
+const conditionCostLimit = 100000
+
+// Programas compilados por expressão, reaproveitados entre requisições
+var conditionPrograms sync.Map
+
+// conditionEnv declares what conditions can refer to: the user (id, identifier and
+// metadata), the resource attributes sent with the request and the environment
+// (time and ip, plus any attribute sent with the request)
+var conditionEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("user", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("resource", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("env", cel.MapType(cel.StringType, cel.DynType)),
+		// env.ip.inCIDR("10.0.0.0/8")
+		cel.Function("inCIDR",
+			cel.MemberOverload("string_in_cidr_string", []*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(inCIDR),
+			),
+		),
+	)
+})
+
+func inCIDR(ip, cidr ref.Val) ref.Val {
+	_, network, err := net.ParseCIDR(cidr.Value().(string))
+	if err != nil {
+		return types.NewErr("invalid CIDR %q", cidr.Value())
+	}
+
+	parsed := net.ParseIP(ip.Value().(string))
+	return types.Bool(parsed != nil && network.Contains(parsed))
+}
+
+// compileCondition compiles the expression once and caches the program
+func compileCondition(expression string) (cel.Program, error) {
+	if program, ok := conditionPrograms.Load(expression); ok {
+		return program.(cel.Program), nil
+	}
+
+	env, err := conditionEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCondition, issues.Err())
+	}
+
+	// Atributos de metadata e do recurso são dinâmicos, então só o resultado da avaliação é conferido
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("%w: must evaluate to a bool, not %s", ErrInvalidCondition, ast.OutputType())
+	}
+
+	program, err := env.Program(ast, cel.CostLimit(conditionCostLimit))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCondition, err)
+	}
+
+	conditionPrograms.Store(expression, program)
+	return program, nil
+}
+
+// validateCondition rejects conditions that don't compile, before the permission is written
+func validateCondition(expression string) error {
+	if expression == "" {
+		return nil
+	}
+
+	_, err := compileCondition(expression)
+	return err
+}
+
+func evaluateCondition(expression string, activation map[string]interface{}) (bool, error) {
+	program, err := compileCondition(expression)
+	if err != nil {
+		return false, err
+	}
+
+	out, _, err := program.Eval(activation)
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: evaluated to %v", ErrInvalidCondition, out.Type())
+	}
+
+	return result, nil
+}
+
+// conditionActivation builds the variables conditions are evaluated against. The
+// resource identifier or type and the current time are set by the server and
+// override attributes of the same name sent with the request.
+func conditionActivation(user *models.User, attributes *schemas.RBACAuthorizationContext, resource map[string]interface{}) map[string]interface{} {
+	userVars := map[string]interface{}{}
+	if user != nil {
+		metadata := map[string]interface{}{}
+		json.Unmarshal([]byte(user.Metadata), &metadata)
+
+		userVars["id"] = int64(user.ID)
+		userVars["identifier"] = user.Identifier
+		userVars["metadata"] = metadata
+	}
+
+	resourceVars := map[string]interface{}{}
+	envVars := map[string]interface{}{}
+	if attributes != nil {
+		for key, value := range attributes.Resource {
+			resourceVars[key] = value
+		}
+		for key, value := range attributes.Environment {
+			envVars[key] = value
+		}
+	}
+
+	for key, value := range resource {
+		resourceVars[key] = value
+	}
+	envVars["time"] = time.Now()
+
+	return map[string]interface{}{
+		"user":     userVars,
+		"resource": resourceVars,
+		"env":      envVars,
+	}
+}
+
+// applyConditions drops the rules whose condition doesn't hold. A condition that
+// can't be evaluated, e.g. for lack of an attribute, keeps a deny rule and drops an
+// allow rule, so missing context never widens access.
+func applyConditions(rules []rbacRule, activation map[string]interface{}) []rbacRule {
+	applicable := []rbacRule{}
+
+	for _, rule := range rules {
+		if rule.Condition == "" {
+			applicable = append(applicable, rule)
+			continue
+		}
+
+		holds, err := evaluateCondition(rule.Condition, activation)
+		if err != nil {
+			holds = rule.Effect == EffectDeny
+		}
+
+		if holds {
+			applicable = append(applicable, rule)
+		}
+	}
+
+	return applicable
+}
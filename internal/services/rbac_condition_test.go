@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+)
+
+func TestValidateCondition(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"user.identifier == 'alice'",
+		"resource.owner == user.id && env.ip.inCIDR('10.0.0.0/8')",
+		"user.metadata.department",
+	} {
+		if err := validateCondition(expression); err != nil {
+			t.Errorf("validateCondition(%q) = %v", expression, err)
+		}
+	}
+
+	for _, expression := range []string{
+		"user.identifier ==",
+		"request.hour < 6",
+		"user.id + 1",
+		"'alice'",
+		"env.ip.inCIDR(8)",
+	} {
+		if err := validateCondition(expression); !errors.Is(err, ErrInvalidCondition) {
+			t.Errorf("validateCondition(%q) = %v, want ErrInvalidCondition", expression, err)
+		}
+	}
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	user := &models.User{Identifier: "alice", Metadata: `{"department": "eng", "level": 3}`}
+	user.ID = 7
+	activation := conditionActivation(user,
+		&schemas.RBACAuthorizationContext{
+			Resource:    map[string]interface{}{"owner": int64(7), "type": "forged"},
+			Environment: map[string]interface{}{"ip": "10.1.2.3"},
+		},
+		map[string]interface{}{"type": "doc"},
+	)
+
+	tests := []struct {
+		expression string
+		want       bool
+		wantErr    bool
+	}{
+		{"user.identifier == 'alice'", true, false},
+		{"user.metadata.department == 'eng' && user.metadata.level >= 3.0", true, false},
+		{"resource.owner == user.id", true, false},
+		{"resource.type == 'doc'", true, false},
+		{"env.ip.inCIDR('10.0.0.0/8')", true, false},
+		{"env.ip.inCIDR('192.168.0.0/16')", false, false},
+		{"env.time > timestamp('2000-01-01T00:00:00Z')", true, false},
+		{"resource.project == 'x'", false, true},
+		{"env.ip.inCIDR('not a cidr')", false, true},
+		{"user.metadata.department", false, true},
+		{"[0,1,2,3,4,5,6,7,8,9].all(a, [0,1,2,3,4,5,6,7,8,9].all(b, [0,1,2,3,4,5,6,7,8,9].all(c, [0,1,2,3,4,5,6,7,8,9].all(d, [0,1,2,3,4,5,6,7,8,9].all(e, true)))))", false, true},
+	}
+
+	for _, tt := range tests {
+		got, err := evaluateCondition(tt.expression, activation)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("evaluateCondition(%q) error = %v, want error %v", tt.expression, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("evaluateCondition(%q) = %v, want %v", tt.expression, got, tt.want)
+		}
+	}
+
+	if _, err := evaluateCondition("user.id ==", activation); !errors.Is(err, ErrInvalidCondition) {
+		t.Errorf("evaluateCondition with a syntax error = %v, want ErrInvalidCondition", err)
+	}
+}
+
+func TestApplyConditions(t *testing.T) {
+	activation := conditionActivation(&models.User{Identifier: "alice", Metadata: "{}"}, nil, nil)
+
+	rules := []rbacRule{
+		{Role: "plain", Effect: EffectAllow},
+		{Role: "holds", Effect: EffectAllow, Condition: "user.identifier == 'alice'"},
+		{Role: "fails", Effect: EffectAllow, Condition: "user.identifier == 'bob'"},
+		{Role: "allow without context", Effect: EffectAllow, Condition: "resource.owner == user.id"},
+		{Role: "deny without context", Effect: EffectDeny, Condition: "env.ip.inCIDR('10.0.0.0/8')"},
+		{Role: "deny that fails", Effect: EffectDeny, Condition: "user.identifier == 'bob'"},
+	}
+
+	var roles []string
+	for _, rule := range applyConditions(rules, activation) {
+		roles = append(roles, rule.Role)
+	}
+
+	if want := []string{"plain", "holds", "deny without context"}; !reflect.DeepEqual(roles, want) {
+		t.Errorf("applicable rules = %s, want %s", strings.Join(roles, ", "), strings.Join(want, ", "))
+	}
+}
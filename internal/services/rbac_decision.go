@@ -0,0 +1,228 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Combining algorithms, selected by authz.combining_algorithm, decide the outcome
+// when several permissions with different effects apply to the same request
+const (
+	CombineDenyOverrides   = "deny-overrides"
+	CombineAllowOverrides  = "allow-overrides"
+	CombineFirstApplicable = "first-applicable"
+)
+
+var (
+	ErrInvalidEffect  = errors.New("effect must be allow or deny")
+	ErrBatchTooLarge  = errors.New("too many checks in a single batch")
+	ErrCheckAmbiguous = errors.New("a check needs either a resource or a resource_type")
+)
+
+// rbacRule is a permission that applies to an authorization request, along with
+// the role it is granted through and the resource or resource type it matched
+type rbacRule struct {
+	Permission string
+	Effect     string
+	Priority   int
+	Condition  string
+	Role       string
+	Resource   string
+}
+
+func validateEffect(effect string) error {
+	if effect != "" && effect != EffectAllow && effect != EffectDeny {
+		return ErrInvalidEffect
+	}
+	return nil
+}
+
+func combiningAlgorithm() string {
+	switch algorithm := config.Config.Authz.CombiningAlgorithm; algorithm {
+	case CombineAllowOverrides, CombineFirstApplicable:
+		return algorithm
+	default:
+		return CombineDenyOverrides
+	}
+}
+
+// ruleQuery selects the permissions named or acting as the actions, a single one or a
+// list, that are granted to the roles, in the order first-applicable evaluates them
+func ruleQuery(db *gorm.DB, roleIDs interface{}, actions interface{}) *gorm.DB {
+	return db.Table("rbac_permissions p").
+		Joins("JOIN rbac_role_permissions rp ON rp.rbac_permission_id = p.id").
+		Joins("JOIN rbac_roles r ON r.id = rp.rbac_role_id AND r.deleted_at IS NULL").
+		Where("p.deleted_at IS NULL AND rp.rbac_role_id IN (?)", roleIDs).
+		Where("p.identifier IN (?) OR p.action IN (?)", actions, actions).
+		Order("p.priority, p.id, r.identifier")
+}
+
+// resourceRules returns the rules granted to the roles that cover the resource,
+// directly, through an ancestor or through a pattern
+func resourceRules(db *gorm.DB, roleIDs interface{}, action, resource string) ([]rbacRule, error) {
+	ids, err := matchingResourceIDs(db, resource)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	var rules []rbacRule
+	err = ruleQuery(db, roleIDs, action).
+		Select("p.identifier AS permission, p.effect, p.priority, p.condition, r.identifier AS role, ri.identifier AS resource").
+		Joins("JOIN rbac_permission_resource_identifiers pri ON pri.rbac_permission_id = p.id").
+		Joins("JOIN rbac_resource_identifiers ri ON ri.id = pri.rbac_resource_identifier_id").
+		Where("ri.id IN ?", ids).
+		Scan(&rules).Error
+
+	return rules, err
+}
+
+// resourceTypeRules returns the rules granted to the roles that apply to the resource type
+func resourceTypeRules(db *gorm.DB, roleIDs interface{}, action, resourceType string) ([]rbacRule, error) {
+	var rules []rbacRule
+	err := ruleQuery(db, roleIDs, action).
+		Select("p.identifier AS permission, p.effect, p.priority, p.condition, r.identifier AS role, rt.identifier AS resource").
+		Joins("JOIN rbac_resource_types rt ON rt.id = p.resource_type_id AND rt.deleted_at IS NULL").
+		Where("rt.identifier = ?", resourceType).
+		Scan(&rules).Error
+
+	return rules, err
+}
+
+// rbacRuleRow is a rule as loaded for a batch: every resource and the resource type of
+// the permission, to be matched in memory against each check
+type rbacRuleRow struct {
+	Rule         rbacRule `gorm:"embedded"`
+	Action       string
+	ResourceKind string
+	ResourceType string
+}
+
+// batchRules loads in a single query the rules granted to the roles for any of the actions
+func batchRules(db *gorm.DB, roleIDs []uint, actions []string) ([]rbacRuleRow, error) {
+	var rows []rbacRuleRow
+	err := ruleQuery(db, roleIDs, actions).
+		Select("p.identifier AS permission, p.action, p.effect, p.priority, p.condition, r.identifier AS role, " +
+			"ri.identifier AS resource, ri.kind AS resource_kind, rt.identifier AS resource_type").
+		Joins("LEFT JOIN rbac_permission_resource_identifiers pri ON pri.rbac_permission_id = p.id").
+		Joins("LEFT JOIN rbac_resource_identifiers ri ON ri.id = pri.rbac_resource_identifier_id AND ri.deleted_at IS NULL").
+		Joins("LEFT JOIN rbac_resource_types rt ON rt.id = p.resource_type_id AND rt.deleted_at IS NULL").
+		Scan(&rows).Error
+
+	return rows, err
+}
+
+// matchRules selects, among the loaded rows, the rules that apply to the check,
+// matching resources in memory instead of going to the database for each one
+func matchRules(rows []rbacRuleRow, check schemas.RBACAuthorizationCheck) []rbacRule {
+	lineage := utils.ResourceLineage(check.Resource)
+
+	rules := []rbacRule{}
+	for _, row := range rows {
+		if row.Rule.Permission != check.Permission && row.Action != check.Permission {
+			continue
+		}
+
+		switch {
+		case check.ResourceType != "" && row.ResourceType == check.ResourceType:
+			rule := row.Rule
+			rule.Resource = row.ResourceType
+			rules = append(rules, rule)
+		case check.Resource != "" && resourceCovers(row.Rule.Resource, row.ResourceKind, lineage):
+			rules = append(rules, row.Rule)
+		}
+	}
+
+	return rules
+}
+
+// combineRules applies the combining algorithm to the applicable rules. Requests
+// no rule applies to are denied.
+func combineRules(rules []rbacRule, algorithm string) schemas.RBACDecision {
+	if len(rules) == 0 {
+		return denyDecision(algorithm, "no permission applies")
+	}
+
+	first := func(effect string) *rbacRule {
+		for i := range rules {
+			// Permissões anteriores à coluna effect são concessões
+			if (rules[i].Effect == EffectDeny) == (effect == EffectDeny) {
+				return &rules[i]
+			}
+		}
+		return nil
+	}
+
+	var rule *rbacRule
+	switch algorithm {
+	case CombineFirstApplicable:
+		rule = &rules[0]
+	case CombineAllowOverrides:
+		if rule = first(EffectAllow); rule == nil {
+			rule = first(EffectDeny)
+		}
+	default:
+		if rule = first(EffectDeny); rule == nil {
+			rule = first(EffectAllow)
+		}
+	}
+
+	effect := EffectAllow
+	if rule.Effect == EffectDeny {
+		effect = EffectDeny
+	}
+
+	return schemas.RBACDecision{
+		Allowed:   effect == EffectAllow,
+		Algorithm: algorithm,
+		Rule:      rule.Permission,
+		Effect:    effect,
+		Role:      rule.Role,
+		Resource:  rule.Resource,
+		Reason:    fmt.Sprintf("%s by permission %s granted to role %s", decisionVerb(effect), rule.Permission, rule.Role),
+	}
+}
+
+// staticDecision decides a request without its attributes. Assuming the conditional
+// allow rules don't hold and the conditional deny rules do, an allowed request is
+// allowed whatever the attributes; otherwise, assuming the opposite tells whether
+// some attributes could allow it.
+func staticDecision(rules []rbacRule, algorithm string) (allowed, conditional bool) {
+	pessimistic, optimistic := []rbacRule{}, []rbacRule{}
+
+	for _, rule := range rules {
+		if rule.Condition == "" || rule.Effect == EffectDeny {
+			pessimistic = append(pessimistic, rule)
+		}
+		if rule.Condition == "" || rule.Effect != EffectDeny {
+			optimistic = append(optimistic, rule)
+		}
+	}
+
+	if combineRules(pessimistic, algorithm).Allowed {
+		return true, false
+	}
+
+	allowed = combineRules(optimistic, algorithm).Allowed
+	return allowed, allowed
+}
+
+func denyDecision(algorithm, reason string) schemas.RBACDecision {
+	return schemas.RBACDecision{Algorithm: algorithm, Reason: reason}
+}
+
+func decisionVerb(effect string) string {
+	if effect == EffectDeny {
+		return "denied"
+	}
+	return "allowed"
+}
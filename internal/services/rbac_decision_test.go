@@ -0,0 +1,88 @@
+package services
+
+import "testing"
+
+func TestCombineRules(t *testing.T) {
+	readAllow := rbacRule{Permission: "doc:read", Effect: EffectAllow, Role: "reader", Resource: "project:*"}
+	readLegacy := rbacRule{Permission: "doc:read", Effect: "", Role: "legacy", Resource: "project:42"}
+	readDeny := rbacRule{Permission: "doc:read-block", Effect: EffectDeny, Role: "blocked", Resource: "project:42"}
+	editAllow := rbacRule{Permission: "doc:edit", Effect: EffectAllow, Role: "editor", Resource: "project:42"}
+
+	tests := []struct {
+		name      string
+		rules     []rbacRule
+		algorithm string
+		allowed   bool
+		rule      string
+		role      string
+	}{
+		{"no rules", nil, CombineDenyOverrides, false, "", ""},
+		{"no rules, allow-overrides", nil, CombineAllowOverrides, false, "", ""},
+		{"single allow", []rbacRule{readAllow}, CombineDenyOverrides, true, "doc:read", "reader"},
+		{"empty effect is an allow", []rbacRule{readLegacy}, CombineDenyOverrides, true, "doc:read", "legacy"},
+		{"single deny", []rbacRule{readDeny}, CombineAllowOverrides, false, "doc:read-block", "blocked"},
+
+		{"deny-overrides with deny last", []rbacRule{readAllow, editAllow, readDeny}, CombineDenyOverrides, false, "doc:read-block", "blocked"},
+		{"deny-overrides with deny first", []rbacRule{readDeny, readAllow}, CombineDenyOverrides, false, "doc:read-block", "blocked"},
+		{"unknown algorithm is deny-overrides", []rbacRule{readAllow, readDeny}, "whatever", false, "doc:read-block", "blocked"},
+
+		{"allow-overrides with deny first", []rbacRule{readDeny, readAllow}, CombineAllowOverrides, true, "doc:read", "reader"},
+		{"allow-overrides picks the first allow", []rbacRule{readDeny, editAllow, readAllow}, CombineAllowOverrides, true, "doc:edit", "editor"},
+
+		{"first-applicable allow", []rbacRule{readAllow, readDeny}, CombineFirstApplicable, true, "doc:read", "reader"},
+		{"first-applicable deny", []rbacRule{readDeny, readAllow}, CombineFirstApplicable, false, "doc:read-block", "blocked"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := combineRules(tt.rules, tt.algorithm)
+
+			if decision.Allowed != tt.allowed || decision.Rule != tt.rule || decision.Role != tt.role {
+				t.Errorf("combineRules = %+v, want allowed %v by %s through %s", decision, tt.allowed, tt.rule, tt.role)
+			}
+
+			if decision.Algorithm != tt.algorithm {
+				t.Errorf("Algorithm = %s, want %s", decision.Algorithm, tt.algorithm)
+			}
+
+			wantEffect := EffectDeny
+			if tt.allowed {
+				wantEffect = EffectAllow
+			}
+			if tt.rule != "" && decision.Effect != wantEffect {
+				t.Errorf("Effect = %s, want %s", decision.Effect, wantEffect)
+			}
+		})
+	}
+}
+
+func TestStaticDecision(t *testing.T) {
+	allow := rbacRule{Permission: "doc:read", Effect: EffectAllow, Role: "reader"}
+	conditionalAllow := rbacRule{Permission: "doc:read", Effect: EffectAllow, Role: "owner", Condition: "resource.owner == subject.id"}
+	deny := rbacRule{Permission: "doc:read", Effect: EffectDeny, Role: "blocked"}
+	conditionalDeny := rbacRule{Permission: "doc:read", Effect: EffectDeny, Role: "night", Condition: "request.hour < 6"}
+
+	tests := []struct {
+		name        string
+		rules       []rbacRule
+		algorithm   string
+		allowed     bool
+		conditional bool
+	}{
+		{"unconditional allow", []rbacRule{allow}, CombineDenyOverrides, true, false},
+		{"only a conditional allow", []rbacRule{conditionalAllow}, CombineDenyOverrides, true, true},
+		{"allow under a conditional deny", []rbacRule{allow, conditionalDeny}, CombineDenyOverrides, true, true},
+		{"allow-overrides ignores the conditional deny", []rbacRule{allow, conditionalDeny}, CombineAllowOverrides, true, false},
+		{"unconditional deny", []rbacRule{conditionalAllow, deny}, CombineDenyOverrides, false, false},
+		{"nothing applies", nil, CombineDenyOverrides, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, conditional := staticDecision(tt.rules, tt.algorithm)
+			if allowed != tt.allowed || conditional != tt.conditional {
+				t.Errorf("staticDecision = %v, %v, want %v, %v", allowed, conditional, tt.allowed, tt.conditional)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/utils"
+	"gorm.io/gorm"
+)
+
+// Operations of a policy change in a simulation
+const (
+	PolicyChangeGrantRole        = "grant_role"
+	PolicyChangeRevokeRole       = "revoke_role"
+	PolicyChangeGrantGroupRole   = "grant_group_role"
+	PolicyChangeRevokeGroupRole  = "revoke_group_role"
+	PolicyChangeGrantPermission  = "grant_permission"
+	PolicyChangeRevokePermission = "revoke_permission"
+	PolicyChangeAddParentRole    = "add_parent_role"
+	PolicyChangeRemoveParent     = "remove_parent_role"
+	PolicyChangeCreatePermission = "create_permission"
+	PolicyChangeUpdatePermission = "update_permission"
+	PolicyChangeDeletePermission = "delete_permission"
+)
+
+var ErrUnknownPolicyChange = errors.New("unknown policy change operation")
+
+// errSimulationRollback undoes the changes of a simulation once it is evaluated
+var errSimulationRollback = errors.New("simulation rolled back")
+
+// roleSources tells how the user holds each of its effective roles
+func (s *authzRBACService) roleSources(user *models.User, roles []models.RBACRole) ([]schemas.RBACTraceRole, error) {
+	var direct, grouped []uint
+
+	if err := activeAssignments(s.db).Where("user_id = ?", user.ID).Pluck("rbac_role_id", &direct).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Table("rbac_role_groups").
+		Where("group_id IN (?)", effectiveGroups(s.db, user.ID).Select("groups.id")).
+		Pluck("rbac_role_id", &grouped).Error; err != nil {
+		return nil, err
+	}
+
+	via := map[uint]string{}
+	for _, id := range grouped {
+		via[id] = "group"
+	}
+	for _, id := range direct {
+		via[id] = "user"
+	}
+
+	sources := make([]schemas.RBACTraceRole, len(roles))
+	for i, role := range roles {
+		sources[i] = schemas.RBACTraceRole{Identifier: role.Identifier, Via: via[role.ID]}
+		if sources[i].Via == "" {
+			sources[i].Via = "inherited"
+		}
+	}
+
+	return sources, nil
+}
+
+func (s *authzRBACService) Explain(userIdentifier string, request *schemas.RBACExplainRequest) (*schemas.RBACDecisionTrace, error) {
+	if (request.Resource == "") == (request.ResourceType == "") {
+		return nil, ErrCheckAmbiguous
+	}
+
+	var user models.User
+	if err := s.db.Where("identifier = ?", userIdentifier).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	roles, err := s.effectiveRoles(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	trace := &schemas.RBACDecisionTrace{
+		Subject:      user.Identifier,
+		Permission:   request.Permission,
+		Resource:     request.Resource,
+		ResourceType: request.ResourceType,
+		Permissions:  []schemas.RBACTracePermission{},
+	}
+
+	if trace.Roles, err = s.roleSources(&user, roles); err != nil {
+		return nil, err
+	}
+
+	effective := map[uint]bool{}
+	for _, role := range roles {
+		effective[role.ID] = true
+	}
+
+	// Todas as permissões da ação, concedidas ou não, na ordem em que são avaliadas
+	var permissions []models.RBACPermission
+	if err := s.db.Preload("ResourceIdentifiers").Preload("ResourceType").Preload("AcceptedRoles").
+		Where("identifier = ? OR action = ?", request.Permission, request.Permission).
+		Order("priority, id").
+		Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	resource := map[string]interface{}{"id": request.Resource}
+	if request.ResourceType != "" {
+		resource = map[string]interface{}{"type": request.ResourceType}
+	}
+	activation := conditionActivation(&user,
+		&schemas.RBACAuthorizationContext{Resource: request.Attributes, Environment: request.Environment}, resource)
+	lineage := utils.ResourceLineage(request.Resource)
+
+	rules := []rbacRule{}
+	for _, permission := range permissions {
+		entry := schemas.RBACTracePermission{
+			Identifier:     permission.Identifier,
+			Action:         permission.Action,
+			Effect:         EffectAllow,
+			Priority:       permission.Priority,
+			GrantedThrough: []string{},
+			Condition:      permission.Condition,
+		}
+		if permission.Effect == EffectDeny {
+			entry.Effect = EffectDeny
+		}
+
+		sort.Slice(permission.AcceptedRoles, func(i, j int) bool {
+			return permission.AcceptedRoles[i].Identifier < permission.AcceptedRoles[j].Identifier
+		})
+		for _, role := range permission.AcceptedRoles {
+			if effective[role.ID] {
+				entry.GrantedThrough = append(entry.GrantedThrough, role.Identifier)
+			}
+		}
+
+		if request.ResourceType != "" {
+			if permission.ResourceType != nil && permission.ResourceType.Identifier == request.ResourceType {
+				entry.Linked, entry.Match = true, request.ResourceType
+			}
+		} else {
+			for _, identifier := range permission.ResourceIdentifiers {
+				if resourceCovers(identifier.Identifier, identifier.Kind, lineage) {
+					entry.Linked, entry.Match = true, identifier.Identifier
+					break
+				}
+			}
+		}
+
+		holds := true
+		if permission.Condition != "" {
+			result, err := evaluateCondition(permission.Condition, activation)
+			if err != nil {
+				entry.ConditionError = err.Error()
+				holds = entry.Effect == EffectDeny
+			} else {
+				entry.ConditionResult = &result
+				holds = result
+			}
+		}
+
+		entry.Applies = len(entry.GrantedThrough) > 0 && entry.Linked && holds
+		if entry.Applies {
+			for _, role := range entry.GrantedThrough {
+				rules = append(rules, rbacRule{
+					Permission: permission.Identifier,
+					Effect:     entry.Effect,
+					Priority:   permission.Priority,
+					Condition:  permission.Condition,
+					Role:       role,
+					Resource:   entry.Match,
+				})
+			}
+		}
+
+		trace.Permissions = append(trace.Permissions, entry)
+	}
+
+	// As condições já foram avaliadas acima
+	trace.Decision = combineRules(rules, combiningAlgorithm())
+
+	return trace, nil
+}
+
+// Simulate explains the check before and after the changes, applied in a transaction
+// that is always rolled back
+func (s *authzRBACService) Simulate(userIdentifier string, request *schemas.RBACSimulationRequest) (*schemas.RBACSimulationResponse, error) {
+	before, err := s.Explain(userIdentifier, &request.RBACExplainRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	var after *schemas.RBACDecisionTrace
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		simulation := &authzRBACService{db: tx, roles: s.roles}
+
+		for i, change := range request.Changes {
+			if err := simulation.applyChange(&change); err != nil {
+				return fmt.Errorf("change %d (%s): %w", i, change.Operation, err)
+			}
+		}
+
+		var err error
+		if after, err = simulation.Explain(userIdentifier, &request.RBACExplainRequest); err != nil {
+			return err
+		}
+
+		return errSimulationRollback
+	})
+	if !errors.Is(err, errSimulationRollback) {
+		return nil, err
+	}
+
+	return &schemas.RBACSimulationResponse{
+		Before:  *before,
+		After:   *after,
+		Changed: before.Decision.Allowed != after.Decision.Allowed,
+	}, nil
+}
+
+func (s *authzRBACService) applyChange(change *schemas.RBACPolicyChange) error {
+	switch change.Operation {
+	case PolicyChangeGrantRole:
+		return s.GrantRoleToUser(change.Role, change.User)
+	case PolicyChangeRevokeRole:
+		return s.RevokeRoleFromUser(change.Role, change.User)
+	case PolicyChangeGrantGroupRole:
+		return s.GrantRoleToGroup(change.Role, change.Group)
+	case PolicyChangeRevokeGroupRole:
+		return s.RevokeRoleFromGroup(change.Role, change.Group)
+	case PolicyChangeGrantPermission:
+		return s.AddRoleToPermission(change.Role, change.Permission)
+	case PolicyChangeRevokePermission:
+		return s.RemoveRoleFromPermission(change.Role, change.Permission)
+	case PolicyChangeAddParentRole:
+		return s.AddParentRole(change.Role, change.Parent)
+	case PolicyChangeRemoveParent:
+		return s.RemoveParentRole(change.Role, change.Parent)
+	case PolicyChangeCreatePermission:
+		if change.Create == nil {
+			return ErrUnknownPolicyChange
+		}
+		_, err := s.CreatePermission(change.Create)
+		return err
+	case PolicyChangeUpdatePermission:
+		if change.Update == nil {
+			return ErrUnknownPolicyChange
+		}
+		_, err := s.UpdatePermission(change.Permission, change.Update)
+		return err
+	case PolicyChangeDeletePermission:
+		return s.DeletePermission(change.Permission)
+	}
+
+	return ErrUnknownPolicyChange
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/duvrdx/whoami/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrRoleCycle = errors.New("role inheritance would create a cycle")
+
+// rebuildRoleClosure recomputes the role closure from the parents of live roles
+func rebuildRoleClosure(tx *gorm.DB) error {
+	edges := tx.Table("rbac_role_parents").
+		Select("rbac_role_parents.role_id AS from_id, rbac_role_parents.parent_id AS to_id").
+		Joins("JOIN rbac_roles roles ON roles.id = rbac_role_parents.role_id AND roles.deleted_at IS NULL").
+		Joins("JOIN rbac_roles parents ON parents.id = rbac_role_parents.parent_id AND parents.deleted_at IS NULL")
+
+	return rebuildClosure(tx, edges, &models.RBACRoleClosure{}, "role_id", "ancestor_id")
+}
+
+// inheritedRoleIDs returns a query for the roles in roleIDs and every role they inherit from
+func inheritedRoleIDs(db *gorm.DB, roleIDs interface{}) *gorm.DB {
+	ancestors := db.Model(&models.RBACRoleClosure{}).Select("ancestor_id").Where("role_id IN (?)", roleIDs)
+
+	return db.Model(&models.RBACRole{}).Select("rbac_roles.id").
+		Where("rbac_roles.id IN (?) OR rbac_roles.id IN (?)", roleIDs, ancestors)
+}
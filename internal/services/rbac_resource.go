@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	ResourceKindExact = "exact"
+	ResourceKindGlob  = "glob"
+)
+
+var ErrInvalidResourcePattern = errors.New("** must be a whole segment of a resource pattern")
+
+// newResourceIdentifier classifies the identifier as a literal resource or a glob
+func newResourceIdentifier(identifier string) (models.RBACResourceIdentifier, error) {
+	resource := models.RBACResourceIdentifier{Identifier: identifier, Kind: ResourceKindExact}
+
+	if !utils.IsResourcePattern(identifier) {
+		return resource, nil
+	}
+
+	for _, segment := range strings.Split(identifier, utils.ResourceSeparator) {
+		if strings.Contains(segment, "**") && segment != "**" {
+			return resource, ErrInvalidResourcePattern
+		}
+	}
+
+	resource.Kind = ResourceKindGlob
+	resource.Prefix = utils.ResourcePatternPrefix(identifier)
+
+	return resource, nil
+}
+
+// validateResourceIdentifiers rejects malformed patterns before anything is written
+func validateResourceIdentifiers(identifiers []string) error {
+	for _, identifier := range identifiers {
+		if _, err := newResourceIdentifier(identifier); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchingResourceIDs returns the resource identifiers whose grants cover the
+// resource: the resource itself, its ancestors and the globs matching any of them.
+// Literals are found by the identifier index and globs by the prefix index, so
+// only the few globs sharing a prefix with the resource are matched in memory.
+func matchingResourceIDs(db *gorm.DB, resource string) ([]uint, error) {
+	lineage := utils.ResourceLineage(resource)
+
+	var ids []uint
+	if err := db.Model(&models.RBACResourceIdentifier{}).
+		Where("kind = ? AND identifier IN ?", ResourceKindExact, lineage).
+		Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	var globs []models.RBACResourceIdentifier
+	if err := db.Select("id", "identifier").
+		Where("kind = ? AND prefix IN ?", ResourceKindGlob, utils.ResourcePatternPrefixes(resource)).
+		Find(&globs).Error; err != nil {
+		return nil, err
+	}
+
+	for _, glob := range globs {
+		for _, ancestor := range lineage {
+			if utils.MatchResourcePattern(glob.Identifier, ancestor) {
+				ids = append(ids, glob.ID)
+				break
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// resourceCovers reports in memory whether a resource identifier of the given kind
+// covers the resource whose lineage is given, as matchingResourceIDs would find it
+func resourceCovers(identifier, kind string, lineage []string) bool {
+	if identifier == "" {
+		return false
+	}
+
+	for _, ancestor := range lineage {
+		if kind == ResourceKindGlob && utils.MatchResourcePattern(identifier, ancestor) ||
+			kind != ResourceKindGlob && identifier == ancestor {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,564 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrReBACNamespaceNotFound = errors.New("namespace not found")
+	ErrReBACUnknownRelation   = errors.New("relation not defined in namespace")
+	ErrInvalidReBACObject     = errors.New("objects must be namespace:id and subjects namespace:id or namespace:id#relation")
+	ErrInvalidRewrite         = errors.New("invalid userset rewrite")
+	ErrInvalidZookie          = errors.New("invalid zookie")
+	ErrReBACDepthExceeded     = errors.New("maximum depth exceeded while evaluating relations")
+)
+
+type rebacObject struct {
+	Namespace string
+	ID        string
+}
+
+func (object rebacObject) String() string {
+	return object.Namespace + ":" + object.ID
+}
+
+// rebacSubject is a user, an object, or with a relation the userset of an object
+type rebacSubject struct {
+	rebacObject
+	Relation string
+}
+
+func (subject rebacSubject) String() string {
+	if subject.Relation == "" {
+		return subject.rebacObject.String()
+	}
+	return subject.rebacObject.String() + "#" + subject.Relation
+}
+
+func parseReBACObject(value string) (rebacObject, error) {
+	namespace, id, ok := strings.Cut(value, ":")
+	if !ok || namespace == "" || id == "" || strings.ContainsAny(value, "#@") {
+		return rebacObject{}, ErrInvalidReBACObject
+	}
+	return rebacObject{Namespace: namespace, ID: id}, nil
+}
+
+func parseReBACSubject(value string) (rebacSubject, error) {
+	value, relation, hasRelation := strings.Cut(value, "#")
+	if hasRelation && relation == "" {
+		return rebacSubject{}, ErrInvalidReBACObject
+	}
+
+	object, err := parseReBACObject(value)
+	return rebacSubject{rebacObject: object, Relation: relation}, err
+}
+
+// validateRelations checks that every rewrite sets exactly one operation and only
+// refers to relations of the namespace. Relations reached through tuple_to_userset
+// belong to the namespace the tuples point to, so they are resolved at evaluation.
+func validateRelations(relations map[string]*schemas.ReBACUsersetRewrite) error {
+	var validate func(rewrite *schemas.ReBACUsersetRewrite) error
+	validate = func(rewrite *schemas.ReBACUsersetRewrite) error {
+		if rewrite == nil {
+			return nil
+		}
+
+		set := 0
+		for _, present := range []bool{rewrite.This != nil, rewrite.ComputedUserset != "", rewrite.TupleToUserset != nil,
+			rewrite.Union != nil, rewrite.Intersection != nil, rewrite.Exclusion != nil} {
+			if present {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("%w: exactly one operation must be set", ErrInvalidRewrite)
+		}
+
+		switch {
+		case rewrite.ComputedUserset != "":
+			if _, ok := relations[rewrite.ComputedUserset]; !ok {
+				return fmt.Errorf("%w: %s", ErrReBACUnknownRelation, rewrite.ComputedUserset)
+			}
+		case rewrite.TupleToUserset != nil:
+			if _, ok := relations[rewrite.TupleToUserset.Tupleset]; !ok {
+				return fmt.Errorf("%w: %s", ErrReBACUnknownRelation, rewrite.TupleToUserset.Tupleset)
+			}
+			if rewrite.TupleToUserset.ComputedUserset == "" {
+				return fmt.Errorf("%w: tuple_to_userset needs a computed_userset", ErrInvalidRewrite)
+			}
+		case rewrite.Exclusion != nil:
+			if err := validate(&rewrite.Exclusion.Base); err != nil {
+				return err
+			}
+			return validate(&rewrite.Exclusion.Subtract)
+		}
+
+		for _, child := range append(rewrite.Union, rewrite.Intersection...) {
+			if err := validate(&child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for name, rewrite := range relations {
+		if name == "" || strings.ContainsAny(name, ":#@") {
+			return fmt.Errorf("%w: invalid relation name %q", ErrInvalidRewrite, name)
+		}
+		if err := validate(rewrite); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Zookies are opaque to clients and encode the revision of the tuple store
+func encodeZookie(revision uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("rev:" + strconv.FormatUint(uint64(revision), 10)))
+}
+
+func decodeZookie(zookie string) (uint, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(zookie)
+	if err != nil || !strings.HasPrefix(string(decoded), "rev:") {
+		return 0, ErrInvalidZookie
+	}
+
+	revision, err := strconv.ParseUint(strings.TrimPrefix(string(decoded), "rev:"), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidZookie
+	}
+	return uint(revision), nil
+}
+
+func currentRevision(db *gorm.DB) (uint, error) {
+	var revision uint
+	err := db.Model(&models.ReBACChange{}).Select("COALESCE(MAX(id), 0)").Scan(&revision).Error
+	return revision, err
+}
+
+// readRevision returns the revision reads are evaluated at. There is a single tuple
+// store, so the latest revision is always at least as fresh as the zookie; a zookie
+// ahead of it was not issued by this store.
+func readRevision(db *gorm.DB, zookie string) (uint, error) {
+	revision, err := currentRevision(db)
+	if err != nil || zookie == "" {
+		return revision, err
+	}
+
+	requested, err := decodeZookie(zookie)
+	if err != nil {
+		return 0, err
+	}
+
+	if requested > revision {
+		return 0, ErrInvalidZookie
+	}
+	return revision, nil
+}
+
+// rebacEvaluator answers a single query. It caches the namespaces it loads and tracks
+// the object#relation pairs being evaluated, so cyclic usersets end instead of looping.
+// A cut cycle evaluates to no access, which is only safe outside of an exclusion's
+// subtrahend: there, the exclusion denies whenever its subtrahend cut a cycle.
+type rebacEvaluator struct {
+	db         *gorm.DB
+	namespaces map[string]map[string]*schemas.ReBACUsersetRewrite
+	visiting   map[string]bool
+	cycles     int // Ciclos interrompidos até aqui
+}
+
+func newReBACEvaluator(db *gorm.DB) *rebacEvaluator {
+	return &rebacEvaluator{
+		db:         db,
+		namespaces: map[string]map[string]*schemas.ReBACUsersetRewrite{},
+		visiting:   map[string]bool{},
+	}
+}
+
+func (e *rebacEvaluator) relations(namespace string) (map[string]*schemas.ReBACUsersetRewrite, error) {
+	if relations, ok := e.namespaces[namespace]; ok {
+		return relations, nil
+	}
+
+	var model models.ReBACNamespace
+	if err := e.db.Where("name = ?", namespace).First(&model).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrReBACNamespaceNotFound, namespace)
+		}
+		return nil, err
+	}
+
+	relations := map[string]*schemas.ReBACUsersetRewrite{}
+	if err := json.Unmarshal([]byte(model.Relations), &relations); err != nil {
+		return nil, err
+	}
+
+	e.namespaces[namespace] = relations
+	return relations, nil
+}
+
+func (e *rebacEvaluator) rewrite(namespace, relation string) (*schemas.ReBACUsersetRewrite, error) {
+	relations, err := e.relations(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	rewrite, ok := relations[relation]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s#%s", ErrReBACUnknownRelation, namespace, relation)
+	}
+	return rewrite, nil
+}
+
+func (e *rebacEvaluator) tuples(object rebacObject, relation string) ([]models.ReBACTuple, error) {
+	var tuples []models.ReBACTuple
+	err := e.db.Where("namespace = ? AND object_id = ? AND relation = ?", object.Namespace, object.ID, relation).
+		Order("id").
+		Find(&tuples).Error
+	return tuples, err
+}
+
+// enter marks object#relation as being evaluated, reporting false when it already is
+func (e *rebacEvaluator) enter(object rebacObject, relation string, depth int) (bool, error) {
+	if depth > config.Config.ReBAC.MaxDepth {
+		return false, ErrReBACDepthExceeded
+	}
+
+	key := object.String() + "#" + relation
+	if e.visiting[key] {
+		e.cycles++
+		return false, nil
+	}
+
+	e.visiting[key] = true
+	return true, nil
+}
+
+func (e *rebacEvaluator) leave(object rebacObject, relation string) {
+	delete(e.visiting, object.String()+"#"+relation)
+}
+
+// check reports whether the subject has the relation with the object
+func (e *rebacEvaluator) check(object rebacObject, relation string, subject rebacSubject, depth int) (bool, error) {
+	// Um userset sempre contém a si mesmo
+	if subject.rebacObject == object && subject.Relation == relation {
+		return true, nil
+	}
+
+	rewrite, err := e.rewrite(object.Namespace, relation)
+	if err != nil {
+		return false, err
+	}
+
+	if ok, err := e.enter(object, relation, depth); !ok {
+		return false, err
+	}
+	defer e.leave(object, relation)
+
+	return e.checkRewrite(object, relation, rewrite, subject, depth)
+}
+
+func (e *rebacEvaluator) checkRewrite(object rebacObject, relation string, rewrite *schemas.ReBACUsersetRewrite, subject rebacSubject, depth int) (bool, error) {
+	switch {
+	case rewrite == nil || rewrite.This != nil:
+		tuples, err := e.tuples(object, relation)
+		if err != nil {
+			return false, err
+		}
+
+		// Sujeitos diretos primeiro, para só descer pelos usersets quando necessário
+		for _, tuple := range tuples {
+			if tuple.SubjectNamespace == subject.Namespace && tuple.SubjectObjectID == subject.ID && tuple.SubjectRelation == subject.Relation {
+				return true, nil
+			}
+		}
+
+		for _, tuple := range tuples {
+			if tuple.SubjectRelation == "" {
+				continue
+			}
+
+			target := rebacObject{Namespace: tuple.SubjectNamespace, ID: tuple.SubjectObjectID}
+			if ok, err := e.check(target, tuple.SubjectRelation, subject, depth+1); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+
+	case rewrite.ComputedUserset != "":
+		return e.check(object, rewrite.ComputedUserset, subject, depth+1)
+
+	case rewrite.TupleToUserset != nil:
+		tuples, err := e.tuples(object, rewrite.TupleToUserset.Tupleset)
+		if err != nil {
+			return false, err
+		}
+
+		for _, tuple := range tuples {
+			target := rebacObject{Namespace: tuple.SubjectNamespace, ID: tuple.SubjectObjectID}
+			if ok, err := e.check(target, rewrite.TupleToUserset.ComputedUserset, subject, depth+1); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+
+	case rewrite.Union != nil:
+		for _, child := range rewrite.Union {
+			if ok, err := e.checkRewrite(object, relation, &child, subject, depth+1); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+
+	case rewrite.Intersection != nil:
+		for _, child := range rewrite.Intersection {
+			if ok, err := e.checkRewrite(object, relation, &child, subject, depth+1); !ok || err != nil {
+				return false, err
+			}
+		}
+		return len(rewrite.Intersection) > 0, nil
+
+	default:
+		ok, err := e.checkRewrite(object, relation, &rewrite.Exclusion.Base, subject, depth+1)
+		if !ok || err != nil {
+			return false, err
+		}
+
+		cycles := e.cycles
+		excluded, err := e.checkRewrite(object, relation, &rewrite.Exclusion.Subtract, subject, depth+1)
+		if err != nil {
+			return false, err
+		}
+
+		// Sem ciclos, um subtraendo falso é de fato falso; com eles, pode ter sido só interrompido
+		return !excluded && e.cycles == cycles, nil
+	}
+}
+
+// expand returns the userset tree of object#relation
+func (e *rebacEvaluator) expand(object rebacObject, relation string, depth int) (schemas.ReBACUsersetTree, error) {
+	node := schemas.ReBACUsersetTree{Operation: "leaf", Object: object.String(), Relation: relation}
+
+	rewrite, err := e.rewrite(object.Namespace, relation)
+	if err != nil {
+		return node, err
+	}
+
+	if ok, err := e.enter(object, relation, depth); !ok {
+		return node, err
+	}
+	defer e.leave(object, relation)
+
+	tree, err := e.expandRewrite(object, relation, rewrite, depth)
+	if err != nil {
+		return node, err
+	}
+
+	// Uma reescrita que aponta para outra relação é envolvida, para o nó dizer de qual relação veio
+	if tree.Object != "" && (tree.Object != node.Object || tree.Relation != relation) {
+		return schemas.ReBACUsersetTree{Operation: "union", Object: node.Object, Relation: relation, Children: []schemas.ReBACUsersetTree{tree}}, nil
+	}
+
+	tree.Object, tree.Relation = node.Object, relation
+	return tree, nil
+}
+
+func (e *rebacEvaluator) expandRewrite(object rebacObject, relation string, rewrite *schemas.ReBACUsersetRewrite, depth int) (schemas.ReBACUsersetTree, error) {
+	switch {
+	case rewrite == nil || rewrite.This != nil:
+		tuples, err := e.tuples(object, relation)
+		if err != nil {
+			return schemas.ReBACUsersetTree{}, err
+		}
+
+		subjects := make([]string, len(tuples))
+		for i := range tuples {
+			subjects[i] = schemas.ReBACTupleFromModel(&tuples[i]).Subject
+		}
+		return schemas.ReBACUsersetTree{Operation: "leaf", Object: object.String(), Relation: relation, Subjects: subjects}, nil
+
+	case rewrite.ComputedUserset != "":
+		return e.expand(object, rewrite.ComputedUserset, depth+1)
+
+	case rewrite.TupleToUserset != nil:
+		tuples, err := e.tuples(object, rewrite.TupleToUserset.Tupleset)
+		if err != nil {
+			return schemas.ReBACUsersetTree{}, err
+		}
+
+		node := schemas.ReBACUsersetTree{Operation: "union"}
+		for _, tuple := range tuples {
+			target := rebacObject{Namespace: tuple.SubjectNamespace, ID: tuple.SubjectObjectID}
+			child, err := e.expand(target, rewrite.TupleToUserset.ComputedUserset, depth+1)
+			if err != nil {
+				return node, err
+			}
+			node.Children = append(node.Children, child)
+		}
+		return node, nil
+
+	case rewrite.Union != nil || rewrite.Intersection != nil:
+		node := schemas.ReBACUsersetTree{Operation: "union"}
+		children := rewrite.Union
+		if rewrite.Intersection != nil {
+			node.Operation, children = "intersection", rewrite.Intersection
+		}
+
+		for _, child := range children {
+			tree, err := e.expandRewrite(object, relation, &child, depth+1)
+			if err != nil {
+				return node, err
+			}
+			node.Children = append(node.Children, tree)
+		}
+		return node, nil
+
+	default:
+		base, err := e.expandRewrite(object, relation, &rewrite.Exclusion.Base, depth+1)
+		if err != nil {
+			return base, err
+		}
+
+		subtract, err := e.expandRewrite(object, relation, &rewrite.Exclusion.Subtract, depth+1)
+		return schemas.ReBACUsersetTree{Operation: "exclusion", Children: []schemas.ReBACUsersetTree{base, subtract}}, err
+	}
+}
+
+// members returns the subjects of object#relation, with the usersets resolved down
+// to subjects that have no relation of their own, e.g. users
+func (e *rebacEvaluator) members(object rebacObject, relation string, depth int) (map[string]bool, error) {
+	rewrite, err := e.rewrite(object.Namespace, relation)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, err := e.enter(object, relation, depth); !ok {
+		return map[string]bool{}, err
+	}
+	defer e.leave(object, relation)
+
+	return e.membersRewrite(object, relation, rewrite, depth)
+}
+
+func (e *rebacEvaluator) membersRewrite(object rebacObject, relation string, rewrite *schemas.ReBACUsersetRewrite, depth int) (map[string]bool, error) {
+	members := map[string]bool{}
+
+	switch {
+	case rewrite == nil || rewrite.This != nil:
+		tuples, err := e.tuples(object, relation)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tuple := range tuples {
+			target := rebacObject{Namespace: tuple.SubjectNamespace, ID: tuple.SubjectObjectID}
+			if tuple.SubjectRelation == "" {
+				members[target.String()] = true
+				continue
+			}
+
+			nested, err := e.members(target, tuple.SubjectRelation, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			for member := range nested {
+				members[member] = true
+			}
+		}
+
+	case rewrite.ComputedUserset != "":
+		return e.members(object, rewrite.ComputedUserset, depth+1)
+
+	case rewrite.TupleToUserset != nil:
+		tuples, err := e.tuples(object, rewrite.TupleToUserset.Tupleset)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tuple := range tuples {
+			target := rebacObject{Namespace: tuple.SubjectNamespace, ID: tuple.SubjectObjectID}
+			nested, err := e.members(target, rewrite.TupleToUserset.ComputedUserset, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			for member := range nested {
+				members[member] = true
+			}
+		}
+
+	case rewrite.Union != nil:
+		for _, child := range rewrite.Union {
+			nested, err := e.membersRewrite(object, relation, &child, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			for member := range nested {
+				members[member] = true
+			}
+		}
+
+	case rewrite.Intersection != nil:
+		for i, child := range rewrite.Intersection {
+			nested, err := e.membersRewrite(object, relation, &child, depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			if i == 0 {
+				members = nested
+				continue
+			}
+			for member := range members {
+				if !nested[member] {
+					delete(members, member)
+				}
+			}
+		}
+
+	default:
+		base, err := e.membersRewrite(object, relation, &rewrite.Exclusion.Base, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		cycles := e.cycles
+		subtract, err := e.membersRewrite(object, relation, &rewrite.Exclusion.Subtract, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		// O subtraendo pode ter ficado incompleto, então ninguém passa pela exclusão
+		if e.cycles != cycles {
+			return members, nil
+		}
+
+		for member := range base {
+			if !subtract[member] {
+				members[member] = true
+			}
+		}
+	}
+
+	return members, nil
+}
+
+func sortedMembers(members map[string]bool) []string {
+	list := make([]string, 0, len(members))
+	for member := range members {
+		list = append(list, member)
+	}
+	sort.Strings(list)
+	return list
+}
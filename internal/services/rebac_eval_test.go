@@ -0,0 +1,219 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/schemas"
+)
+
+func rebacComputed(relation string) schemas.ReBACUsersetRewrite {
+	return schemas.ReBACUsersetRewrite{ComputedUserset: relation}
+}
+
+var rebacThis = schemas.ReBACUsersetRewrite{This: &struct{}{}}
+
+// newTestReBAC creates groups with members and documents in folders:
+//
+//	viewer       = this ∪ editor ∪ parent→viewer
+//	editor       = this ∪ owner
+//	reader       = viewer − banned
+//	audit_viewer = viewer ∩ auditor
+func newTestReBAC(t *testing.T) *authzReBACService {
+	t.Helper()
+
+	newTestDB(t)
+	config.Config.ReBAC.MaxDepth = 25
+	service := &authzReBACService{db: config.GetDB()}
+
+	namespaces := []schemas.ReBACNamespaceCreate{
+		{Name: "group", Relations: map[string]*schemas.ReBACUsersetRewrite{"member": nil}},
+		{Name: "folder", Relations: map[string]*schemas.ReBACUsersetRewrite{"viewer": nil}},
+		{Name: "doc", Relations: map[string]*schemas.ReBACUsersetRewrite{
+			"parent":  nil,
+			"owner":   nil,
+			"banned":  nil,
+			"auditor": nil,
+			"editor":  {Union: []schemas.ReBACUsersetRewrite{rebacThis, rebacComputed("owner")}},
+			"viewer": {Union: []schemas.ReBACUsersetRewrite{rebacThis, rebacComputed("editor"),
+				{TupleToUserset: &schemas.ReBACTupleToUserset{Tupleset: "parent", ComputedUserset: "viewer"}}}},
+			"reader":       {Exclusion: &schemas.ReBACExclusion{Base: rebacComputed("viewer"), Subtract: rebacComputed("banned")}},
+			"audit_viewer": {Intersection: []schemas.ReBACUsersetRewrite{rebacComputed("viewer"), rebacComputed("auditor")}},
+		}},
+	}
+	for i := range namespaces {
+		if _, err := service.CreateNamespace(&namespaces[i]); err != nil {
+			t.Fatalf("CreateNamespace %s: %v", namespaces[i].Name, err)
+		}
+	}
+
+	return service
+}
+
+// writeTestTuples writes tuples given as object#relation@subject
+func writeTestTuples(t *testing.T, service *authzReBACService, tuples ...string) string {
+	t.Helper()
+
+	write := &schemas.ReBACTupleWrite{}
+	for _, tuple := range tuples {
+		object, rest, _ := strings.Cut(tuple, "#")
+		relation, subject, _ := strings.Cut(rest, "@")
+		write.Writes = append(write.Writes, schemas.ReBACTuple{Object: object, Relation: relation, Subject: subject})
+	}
+
+	response, err := service.WriteTuples(write)
+	if err != nil {
+		t.Fatalf("WriteTuples: %v", err)
+	}
+	return response.Zookie
+}
+
+func TestReBACCheck(t *testing.T) {
+	service := newTestReBAC(t)
+	writeTestTuples(t, service,
+		"group:eng#member@user:alice",
+		"group:eng#member@group:leads#member",
+		"group:leads#member@user:bob",
+		"folder:f#viewer@group:eng#member",
+		"doc:1#parent@folder:f",
+		"doc:1#owner@user:carol",
+		"doc:1#viewer@user:dave",
+		"doc:1#banned@user:bob",
+		"doc:1#auditor@user:alice",
+		"doc:1#auditor@user:erin",
+	)
+
+	tests := []struct {
+		relation string
+		subject  string
+		want     bool
+	}{
+		{"owner", "user:carol", true},
+		{"editor", "user:carol", true},
+		{"editor", "user:dave", false},
+		{"viewer", "user:dave", true},
+		{"viewer", "user:carol", true},
+		{"viewer", "user:alice", true},
+		{"viewer", "user:bob", true},
+		{"viewer", "user:erin", false},
+		{"viewer", "group:eng#member", true},
+		{"reader", "user:alice", true},
+		{"reader", "user:bob", false},
+		{"reader", "user:erin", false},
+		{"audit_viewer", "user:alice", true},
+		{"audit_viewer", "user:erin", false},
+		{"audit_viewer", "user:dave", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.relation+" "+tt.subject, func(t *testing.T) {
+			response, err := service.Check(&schemas.ReBACCheckRequest{Object: "doc:1", Relation: tt.relation, Subject: tt.subject})
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			if response.Allowed != tt.want {
+				t.Errorf("Allowed = %v, want %v", response.Allowed, tt.want)
+			}
+		})
+	}
+
+	users, err := service.ListUsers(&schemas.ReBACListUsersRequest{Object: "doc:1", Relation: "reader", SubjectNamespace: "user"})
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if want := []string{"user:alice", "user:carol", "user:dave"}; !reflect.DeepEqual(users.Subjects, want) {
+		t.Errorf("readers = %v, want %v", users.Subjects, want)
+	}
+}
+
+func TestReBACCycles(t *testing.T) {
+	service := newTestReBAC(t)
+	writeTestTuples(t, service,
+		"group:a#member@group:b#member",
+		"group:b#member@group:a#member",
+		"group:b#member@user:alice",
+		"doc:1#viewer@user:alice",
+		"doc:1#viewer@user:bob",
+		"doc:1#banned@group:a#member",
+	)
+
+	for _, tt := range []struct {
+		object, relation, subject string
+		want                      bool
+	}{
+		{"group:a", "member", "user:alice", true},
+		{"group:a", "member", "user:bob", false},
+		{"doc:1", "reader", "user:alice", false},
+		// bob não está no grupo, mas o subtraendo cortou um ciclo e não dá para afirmar
+		{"doc:1", "reader", "user:bob", false},
+	} {
+		response, err := service.Check(&schemas.ReBACCheckRequest{Object: tt.object, Relation: tt.relation, Subject: tt.subject})
+		if err != nil {
+			t.Fatalf("Check %s#%s@%s: %v", tt.object, tt.relation, tt.subject, err)
+		}
+		if response.Allowed != tt.want {
+			t.Errorf("Check %s#%s@%s = %v, want %v", tt.object, tt.relation, tt.subject, response.Allowed, tt.want)
+		}
+	}
+
+	users, err := service.ListUsers(&schemas.ReBACListUsersRequest{Object: "doc:1", Relation: "reader"})
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if len(users.Subjects) != 0 {
+		t.Errorf("readers = %v, want none", users.Subjects)
+	}
+}
+
+func TestReBACDepth(t *testing.T) {
+	service := newTestReBAC(t)
+	writeTestTuples(t, service,
+		"group:1#member@group:2#member",
+		"group:2#member@group:3#member",
+		"group:3#member@group:4#member",
+		"group:4#member@user:alice",
+	)
+
+	config.Config.ReBAC.MaxDepth = 2
+
+	_, err := service.Check(&schemas.ReBACCheckRequest{Object: "group:1", Relation: "member", Subject: "user:alice"})
+	if !errors.Is(err, ErrReBACDepthExceeded) {
+		t.Errorf("Check = %v, want ErrReBACDepthExceeded", err)
+	}
+}
+
+func TestReBACZookies(t *testing.T) {
+	service := newTestReBAC(t)
+	zookie := writeTestTuples(t, service, "doc:1#viewer@user:alice")
+
+	written, err := decodeZookie(zookie)
+	if err != nil {
+		t.Fatalf("decodeZookie: %v", err)
+	}
+
+	response, err := service.Check(&schemas.ReBACCheckRequest{Object: "doc:1", Relation: "viewer", Subject: "user:alice", Zookie: zookie})
+	if err != nil || !response.Allowed {
+		t.Fatalf("Check at the write's zookie = %+v, %v", response, err)
+	}
+
+	// Escritas posteriores avançam a revisão, e zookies antigos continuam aceitos
+	writeTestTuples(t, service, "doc:1#viewer@user:bob")
+
+	response, err = service.Check(&schemas.ReBACCheckRequest{Object: "doc:1", Relation: "viewer", Subject: "user:bob", Zookie: zookie})
+	if err != nil || !response.Allowed {
+		t.Fatalf("Check at a stale zookie = %+v, %v", response, err)
+	}
+
+	if revision, _ := decodeZookie(response.Zookie); revision <= written {
+		t.Errorf("read at revision %d, want after %d", revision, written)
+	}
+
+	for _, zookie := range []string{encodeZookie(written + 100), "garbage", "cmV2OngK"} {
+		if _, err := service.Check(&schemas.ReBACCheckRequest{Object: "doc:1", Relation: "viewer", Subject: "user:bob", Zookie: zookie}); !errors.Is(err, ErrInvalidZookie) {
+			t.Errorf("Check with zookie %q = %v, want ErrInvalidZookie", zookie, err)
+		}
+	}
+}
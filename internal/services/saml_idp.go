@@ -0,0 +1,926 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/saml"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownServiceProvider   = errors.New("unknown or inactive SAML service provider")
+	ErrInvalidSAMLRequest       = errors.New("invalid SAML request")
+	ErrNameIDFormatNotSupported = errors.New("NameID format not supported for this user")
+	ErrNoSAMLSession            = errors.New("no active SAML session")
+)
+
+const (
+	configSAMLKey         = "saml_idp_key"
+	configSAMLCertificate = "saml_idp_certificate"
+)
+
+var supportedNameIDFormats = []string{
+	saml.NameIDFormatUnspecified,
+	saml.NameIDFormatEmailAddress,
+	saml.NameIDFormatPersistent,
+	saml.NameIDFormatTransient,
+}
+
+// Atributos enviados quando o SP não configura um mapeamento próprio
+var defaultSAMLAttributes = map[string]string{
+	"uid":    "identifier",
+	"email":  "metadata.email",
+	"groups": "groups",
+	"roles":  "roles",
+}
+
+// SAMLMessage is a protocol message as received through one of the bindings
+type SAMLMessage struct {
+	Binding    string
+	Value      string
+	RelayState string
+	// RawQuery is the undecoded query string, needed to verify HTTP-Redirect signatures
+	RawQuery string
+}
+
+// SSORequest is a validated AuthnRequest waiting for the user to be authenticated
+type SSORequest struct {
+	ServiceProvider *models.SAMLServiceProvider
+	Request         *saml.AuthnRequest
+	RelayState      string
+}
+
+// SAMLBindingResult tells where the browser must take a protocol message:
+// either a redirect or an auto-submitting page
+type SAMLBindingResult struct {
+	RedirectURL string
+	Form        []byte
+}
+
+type SAMLIdPService interface {
+	Metadata() ([]byte, error)
+
+	CreateServiceProvider(sp *schemas.SAMLServiceProviderCreate) (*schemas.SAMLServiceProviderResponse, error)
+	GetServiceProvider(id uint) (*schemas.SAMLServiceProviderResponse, error)
+	GetServiceProviders() ([]schemas.SAMLServiceProviderResponse, error)
+	UpdateServiceProvider(id uint, sp *schemas.SAMLServiceProviderUpdate) (*schemas.SAMLServiceProviderResponse, error)
+	DeleteServiceProvider(id uint) error
+
+	// ParseAuthnRequest validates an AuthnRequest against the registered service providers
+	ParseAuthnRequest(message *SAMLMessage) (*SSORequest, error)
+	// IssueResponse returns the page posting the signed assertion for the session user to the service provider
+	IssueResponse(request *SSORequest, sessionToken string) ([]byte, error)
+	// FailResponse returns the page posting an error status to the service provider
+	FailResponse(request *SSORequest, status, subStatus string) ([]byte, error)
+
+	// StartSession opens a browser session for the user and returns the cookie value
+	StartSession(userID uint) (string, error)
+	// SessionUser returns the user of an active browser session
+	SessionUser(sessionToken string) (*models.User, error)
+	EndSession(sessionToken string) error
+	// Logout handles a LogoutRequest from a service provider, ending the browser
+	// sessions it refers to. Other service providers the user signed in to are
+	// not notified; they find the session gone on their next request.
+	Logout(message *SAMLMessage) (*SAMLBindingResult, error)
+}
+
+type samlIdPService struct {
+	db *gorm.DB
+}
+
+func NewSAMLIdPService() SAMLIdPService {
+	return &samlIdPService{
+		db: config.GetDB(),
+	}
+}
+
+// A chave de assinatura é gerada uma única vez e compartilhada entre instâncias do serviço
+var (
+	samlKeyMu   sync.Mutex
+	samlKey     *rsa.PrivateKey
+	samlKeyCert *x509.Certificate
+)
+
+func samlEntityID() string {
+	if config.Config.SAML.EntityID != "" {
+		return config.Config.SAML.EntityID
+	}
+	return config.Config.SAML.BaseURL + "/saml/metadata"
+}
+
+func samlEndpoint(path string) string {
+	return config.Config.SAML.BaseURL + path
+}
+
+// samlSigningKey loads the key pair whoami signs SAML messages with, as
+// identity provider and as service provider, generating and storing a key
+// with a self-signed certificate on first use
+func samlSigningKey(db *gorm.DB) (*rsa.PrivateKey, *x509.Certificate, error) {
+	samlKeyMu.Lock()
+	defer samlKeyMu.Unlock()
+
+	if samlKey != nil {
+		return samlKey, samlKeyCert, nil
+	}
+
+	var keyConfig, certConfig models.Config
+	keyErr := db.Where("key = ?", configSAMLKey).First(&keyConfig).Error
+	certErr := db.Where("key = ?", configSAMLCertificate).First(&certConfig).Error
+
+	if keyErr == nil && certErr == nil {
+		keyBlock, _ := pem.Decode([]byte(keyConfig.Value))
+		certBlock, _ := pem.Decode([]byte(certConfig.Value))
+		if keyBlock == nil || certBlock == nil {
+			return nil, nil, errors.New("stored SAML signing key is corrupted")
+		}
+
+		parsedKey, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		key, ok := parsedKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, errors.New("stored SAML signing key is not an RSA key")
+		}
+
+		cert, err := x509.ParseCertificate(certBlock.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		samlKey, samlKeyCert = key, cert
+		return key, cert, nil
+	}
+
+	if !errors.Is(keyErr, gorm.ErrRecordNotFound) && keyErr != nil {
+		return nil, nil, keyErr
+	}
+	if !errors.Is(certErr, gorm.ErrRecordNotFound) && certErr != nil {
+		return nil, nil, certErr
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "whoami SAML"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Remove restos de uma geração incompleta antes de gravar o novo par
+		if err := tx.Unscoped().Where("key IN ?", []string{configSAMLKey, configSAMLCertificate}).Delete(&models.Config{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(&models.Config{Key: configSAMLKey, Value: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.Config{Key: configSAMLCertificate, Value: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	samlKey, samlKeyCert = key, cert
+	return key, cert, nil
+}
+
+func (s *samlIdPService) Metadata() ([]byte, error) {
+	_, cert, err := samlSigningKey(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &saml.IdPMetadata{
+		EntityID:      samlEntityID(),
+		Certificate:   cert,
+		SSOURL:        samlEndpoint("/saml/sso"),
+		SLOURL:        samlEndpoint("/saml/slo"),
+		NameIDFormats: supportedNameIDFormats,
+	}
+
+	return append([]byte(xml.Header), metadata.Element().Bytes()...), nil
+}
+
+// applyServiceProviderMetadata fills the fields not given explicitly from the SP metadata XML
+func applyServiceProviderMetadata(sp *schemas.SAMLServiceProviderCreate) error {
+	metadata, err := saml.ParseMetadata([]byte(sp.Metadata))
+	if err != nil {
+		return err
+	}
+
+	descriptor := metadata.SPSSODescriptor
+	if descriptor == nil {
+		return errors.New("metadata has no SPSSODescriptor")
+	}
+
+	if sp.EntityID == "" {
+		sp.EntityID = metadata.EntityID
+	}
+
+	if sp.ACSURL == "" {
+		if endpoint := saml.FindEndpoint(descriptor.AssertionConsumerServices, saml.BindingHTTPPost); endpoint != nil {
+			sp.ACSURL = endpoint.Location
+		}
+	}
+
+	if sp.SLOURL == "" {
+		if endpoint := saml.FindEndpoint(descriptor.SingleLogoutServices, saml.BindingHTTPRedirect, saml.BindingHTTPPost); endpoint != nil {
+			sp.SLOURL = endpoint.Location
+			if endpoint.ResponseLocation != "" {
+				sp.SLOURL = endpoint.ResponseLocation
+			}
+			sp.SLOBinding = endpoint.Binding
+		}
+	}
+
+	if sp.NameIDFormat == "" && len(descriptor.NameIDFormats) > 0 {
+		sp.NameIDFormat = descriptor.NameIDFormats[0]
+	}
+
+	if sp.Certificate == "" {
+		certs, err := descriptor.SigningCertificates()
+		if err != nil {
+			return err
+		}
+		if len(certs) > 0 {
+			sp.Certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certs[0].Raw}))
+		}
+	}
+
+	if sp.WantRequestsSigned == nil {
+		sp.WantRequestsSigned = &descriptor.AuthnRequestsSigned
+	}
+
+	return nil
+}
+
+func validateServiceProvider(sp *models.SAMLServiceProvider) error {
+	if sp.EntityID == "" || sp.ACSURL == "" {
+		return errors.New("entity_id and acs_url are required")
+	}
+
+	if sp.NameIDFormat == "" {
+		sp.NameIDFormat = saml.NameIDFormatUnspecified
+	}
+
+	supported := false
+	for _, format := range supportedNameIDFormats {
+		supported = supported || format == sp.NameIDFormat
+	}
+	if !supported {
+		return fmt.Errorf("unsupported name_id_format %q", sp.NameIDFormat)
+	}
+
+	if sp.SLOURL != "" && sp.SLOBinding == "" {
+		sp.SLOBinding = saml.BindingHTTPRedirect
+	}
+	if sp.SLOBinding != "" && sp.SLOBinding != saml.BindingHTTPRedirect && sp.SLOBinding != saml.BindingHTTPPost {
+		return fmt.Errorf("unsupported slo_binding %q", sp.SLOBinding)
+	}
+
+	if sp.Certificate != "" {
+		if _, err := saml.ParseCertificate(sp.Certificate); err != nil {
+			return err
+		}
+	} else if sp.WantRequestsSigned {
+		return errors.New("a certificate is required to verify signed requests")
+	}
+
+	attributes := map[string]string{}
+	if err := json.Unmarshal([]byte(sp.Attributes), &attributes); err != nil {
+		return errors.New("attributes must be a JSON object")
+	}
+
+	for name, source := range attributes {
+		switch {
+		case source == "id", source == "identifier", source == "groups", source == "roles":
+		case strings.HasPrefix(source, "metadata.") && len(source) > len("metadata."):
+		default:
+			return fmt.Errorf("unknown source %q for attribute %s", source, name)
+		}
+	}
+
+	return nil
+}
+
+func (s *samlIdPService) CreateServiceProvider(sp *schemas.SAMLServiceProviderCreate) (*schemas.SAMLServiceProviderResponse, error) {
+	if sp.Metadata != "" {
+		if err := applyServiceProviderMetadata(sp); err != nil {
+			return nil, err
+		}
+	}
+
+	spModel := schemas.SAMLServiceProviderFromCreate(sp)
+
+	if err := validateServiceProvider(spModel); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(spModel).Error; err != nil {
+		return nil, err
+	}
+
+	return schemas.SAMLServiceProviderResponseFromModel(spModel), nil
+}
+
+func (s *samlIdPService) GetServiceProvider(id uint) (*schemas.SAMLServiceProviderResponse, error) {
+	var sp models.SAMLServiceProvider
+
+	if err := s.db.First(&sp, id).Error; err != nil {
+		return nil, err
+	}
+
+	return schemas.SAMLServiceProviderResponseFromModel(&sp), nil
+}
+
+func (s *samlIdPService) GetServiceProviders() ([]schemas.SAMLServiceProviderResponse, error) {
+	var sps []models.SAMLServiceProvider
+
+	if err := s.db.Find(&sps).Error; err != nil {
+		return nil, err
+	}
+
+	var returnSPs []schemas.SAMLServiceProviderResponse
+
+	for _, sp := range sps {
+		returnSPs = append(returnSPs, *schemas.SAMLServiceProviderResponseFromModel(&sp))
+	}
+
+	return returnSPs, nil
+}
+
+func (s *samlIdPService) UpdateServiceProvider(id uint, sp *schemas.SAMLServiceProviderUpdate) (*schemas.SAMLServiceProviderResponse, error) {
+	var existing models.SAMLServiceProvider
+
+	if err := s.db.First(&existing, id).Error; err != nil {
+		return nil, err
+	}
+
+	if sp.Name != nil {
+		existing.Name = *sp.Name
+	}
+	if sp.ACSURL != nil {
+		existing.ACSURL = *sp.ACSURL
+	}
+	if sp.SLOURL != nil {
+		existing.SLOURL = *sp.SLOURL
+	}
+	if sp.SLOBinding != nil {
+		existing.SLOBinding = *sp.SLOBinding
+	}
+	if sp.NameIDFormat != nil {
+		existing.NameIDFormat = *sp.NameIDFormat
+	}
+	if sp.Certificate != nil {
+		existing.Certificate = *sp.Certificate
+	}
+	if sp.WantRequestsSigned != nil {
+		existing.WantRequestsSigned = *sp.WantRequestsSigned
+	}
+	if sp.SignResponse != nil {
+		existing.SignResponse = *sp.SignResponse
+	}
+	if sp.Attributes != nil {
+		attributes, _ := json.Marshal(*sp.Attributes)
+		existing.Attributes = string(attributes)
+	}
+	if sp.IsActive != nil {
+		existing.IsActive = *sp.IsActive
+	}
+
+	if err := validateServiceProvider(&existing); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	return schemas.SAMLServiceProviderResponseFromModel(&existing), nil
+}
+
+func (s *samlIdPService) DeleteServiceProvider(id uint) error {
+	var sp models.SAMLServiceProvider
+
+	if err := s.db.First(&sp, id).Error; err != nil {
+		return err
+	}
+
+	return s.db.Delete(&sp).Error
+}
+
+func (s *samlIdPService) activeServiceProvider(entityID string) (*models.SAMLServiceProvider, error) {
+	var sp models.SAMLServiceProvider
+
+	if err := s.db.Where("entity_id = ? AND is_active = ?", entityID, true).First(&sp).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownServiceProvider
+		}
+		return nil, err
+	}
+
+	return &sp, nil
+}
+
+func decodeSAMLMessage(message *SAMLMessage) (*saml.Element, error) {
+	var el *saml.Element
+	var err error
+
+	switch message.Binding {
+	case saml.BindingHTTPRedirect:
+		el, err = saml.DecodeRedirect(message.Value)
+	case saml.BindingHTTPPost:
+		el, err = saml.DecodePost(message.Value)
+	default:
+		return nil, ErrInvalidSAMLRequest
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLRequest, err)
+	}
+
+	return el, nil
+}
+
+// verifyMessage checks the signature of a message sent by the service
+// provider. It reports whether the message was signed; a signature that is
+// present but does not verify is always an error.
+func (s *samlIdPService) verifyMessage(sp *models.SAMLServiceProvider, message *SAMLMessage, el *saml.Element) (bool, error) {
+	if sp.Certificate == "" {
+		if sp.WantRequestsSigned {
+			return false, fmt.Errorf("%w: %v", ErrInvalidSAMLRequest, saml.ErrMissingSignature)
+		}
+		return false, nil
+	}
+
+	cert, err := saml.ParseCertificate(sp.Certificate)
+	if err != nil {
+		return false, err
+	}
+
+	if message.Binding == saml.BindingHTTPRedirect {
+		err = saml.VerifyQuery(message.RawQuery, "SAMLRequest", []*x509.Certificate{cert})
+	} else {
+		err = saml.Verify(el, []*x509.Certificate{cert})
+	}
+
+	if errors.Is(err, saml.ErrMissingSignature) && !sp.WantRequestsSigned {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidSAMLRequest, err)
+	}
+
+	return true, nil
+}
+
+func (s *samlIdPService) ParseAuthnRequest(message *SAMLMessage) (*SSORequest, error) {
+	el, err := decodeSAMLMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := saml.ParseAuthnRequest(el)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLRequest, err)
+	}
+
+	sp, err := s.activeServiceProvider(request.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.verifyMessage(sp, message, el); err != nil {
+		return nil, err
+	}
+
+	// A resposta só pode ir para o ACS cadastrado, nunca para um endereço vindo da requisição
+	if request.AssertionConsumerServiceURL != "" && request.AssertionConsumerServiceURL != sp.ACSURL {
+		return nil, fmt.Errorf("%w: unregistered assertion consumer service %s", ErrInvalidSAMLRequest, request.AssertionConsumerServiceURL)
+	}
+
+	if request.ProtocolBinding != "" && request.ProtocolBinding != saml.BindingHTTPPost {
+		return nil, fmt.Errorf("%w: unsupported protocol binding %s", ErrInvalidSAMLRequest, request.ProtocolBinding)
+	}
+
+	if request.Destination != "" && request.Destination != samlEndpoint("/saml/sso") {
+		return nil, fmt.Errorf("%w: wrong destination %s", ErrInvalidSAMLRequest, request.Destination)
+	}
+
+	return &SSORequest{ServiceProvider: sp, Request: request, RelayState: message.RelayState}, nil
+}
+
+// nameID computes the subject identifier sent to the service provider
+func (s *samlIdPService) nameID(sp *models.SAMLServiceProvider, user *models.User, format string) (string, error) {
+	switch format {
+	case saml.NameIDFormatUnspecified:
+		return user.Identifier, nil
+	case saml.NameIDFormatEmailAddress:
+		if email := metadataValues(user.Metadata, "email"); len(email) > 0 {
+			return email[0], nil
+		}
+		if strings.Contains(user.Identifier, "@") {
+			return user.Identifier, nil
+		}
+		return "", ErrNameIDFormatNotSupported
+	case saml.NameIDFormatPersistent:
+		// Opaco e estável por SP, sem permitir correlacionar o usuário entre SPs
+		return utils.HashToken(fmt.Sprintf("saml:%s:%d", sp.EntityID, user.ID)), nil
+	case saml.NameIDFormatTransient:
+		return saml.NewID(), nil
+	}
+
+	return "", ErrNameIDFormatNotSupported
+}
+
+// metadataValues reads a metadata key as a list of strings
+func metadataValues(metadata, key string) []string {
+	data := map[string]interface{}{}
+	json.Unmarshal([]byte(metadata), &data)
+
+	switch value := data[key].(type) {
+	case nil:
+		return nil
+	case string:
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	case []interface{}:
+		values := []string{}
+		for _, item := range value {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(value)}
+	}
+}
+
+func (s *samlIdPService) userGroups(user *models.User) ([]string, error) {
+	return effectiveGroupIdentifiers(s.db, user.ID)
+}
+
+func (s *samlIdPService) userRoles(user *models.User) ([]string, error) {
+	var roles []string
+
+	err := s.db.Model(&models.RBACRole{}).
+		Where("id IN (?)", activeAssignments(s.db).Select("rbac_role_id").Where("user_id = ?", user.ID)).
+		Order("rbac_roles.identifier").
+		Pluck("rbac_roles.identifier", &roles).Error
+
+	return roles, err
+}
+
+// attributes builds the attribute statement from the service provider mapping
+func (s *samlIdPService) attributes(sp *models.SAMLServiceProvider, user *models.User) ([]saml.Attribute, error) {
+	mapping := map[string]string{}
+	json.Unmarshal([]byte(sp.Attributes), &mapping)
+
+	if len(mapping) == 0 {
+		mapping = defaultSAMLAttributes
+	}
+
+	names := make([]string, 0, len(mapping))
+	for name := range mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var attributes []saml.Attribute
+
+	for _, name := range names {
+		source := mapping[name]
+		var values []string
+		var err error
+
+		switch source {
+		case "id":
+			values = []string{strconv.FormatUint(uint64(user.ID), 10)}
+		case "identifier":
+			values = []string{user.Identifier}
+		case "groups":
+			values, err = s.userGroups(user)
+		case "roles":
+			values, err = s.userRoles(user)
+		default:
+			values = metadataValues(user.Metadata, strings.TrimPrefix(source, "metadata."))
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(values) > 0 {
+			attributes = append(attributes, saml.Attribute{Name: name, Values: values})
+		}
+	}
+
+	return attributes, nil
+}
+
+func (s *samlIdPService) activeSession(sessionToken string) (*models.SAMLBrowserSession, error) {
+	var session models.SAMLBrowserSession
+
+	if sessionToken == "" {
+		return nil, ErrNoSAMLSession
+	}
+
+	err := s.db.Preload("User").
+		Where("token_hash = ? AND ended_at IS NULL AND expires_at > ?", utils.HashToken(sessionToken), time.Now()).
+		First(&session).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoSAMLSession
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !session.User.IsActive {
+		return nil, ErrNoSAMLSession
+	}
+
+	return &session, nil
+}
+
+func (s *samlIdPService) StartSession(userID uint) (string, error) {
+	token := utils.GenerateSecureString(43)
+
+	session := models.SAMLBrowserSession{
+		TokenHash: utils.HashToken(token),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(time.Duration(config.Config.SAML.SessionLifetime) * time.Second),
+	}
+
+	if err := s.db.Create(&session).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (s *samlIdPService) SessionUser(sessionToken string) (*models.User, error) {
+	session, err := s.activeSession(sessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session.User, nil
+}
+
+func (s *samlIdPService) EndSession(sessionToken string) error {
+	return s.db.Model(&models.SAMLBrowserSession{}).
+		Where("token_hash = ? AND ended_at IS NULL", utils.HashToken(sessionToken)).
+		Update("ended_at", time.Now()).Error
+}
+
+func (s *samlIdPService) IssueResponse(request *SSORequest, sessionToken string) ([]byte, error) {
+	sp := request.ServiceProvider
+
+	session, err := s.activeSession(sessionToken)
+	if err != nil {
+		return nil, err
+	}
+
+	format := request.Request.NameIDFormat
+	if format == "" || format == saml.NameIDFormatUnspecified {
+		format = sp.NameIDFormat
+	}
+
+	nameID, err := s.nameID(sp, &session.User, format)
+	if errors.Is(err, ErrNameIDFormatNotSupported) {
+		return s.FailResponse(request, saml.StatusRequester, saml.StatusInvalidNameIDPolicy)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	attributes, err := s.attributes(sp, &session.User)
+	if err != nil {
+		return nil, err
+	}
+
+	key, cert, err := samlSigningKey(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sessionIndex := saml.NewID()
+
+	assertion := (&saml.Assertion{
+		ID:           saml.NewID(),
+		Issuer:       samlEntityID(),
+		Audience:     sp.EntityID,
+		Recipient:    sp.ACSURL,
+		InResponseTo: request.Request.ID,
+		NameID:       nameID,
+		NameIDFormat: format,
+		SessionIndex: sessionIndex,
+		IssueInstant: now,
+		NotBefore:    now.Add(-saml.ClockSkew),
+		NotOnOrAfter: now.Add(time.Duration(config.Config.SAML.AssertionLifetime) * time.Second),
+		AuthnInstant: session.CreatedAt,
+		Attributes:   attributes,
+	}).Element()
+
+	if err := saml.Sign(assertion, key, cert); err != nil {
+		return nil, err
+	}
+
+	response := (&saml.Response{
+		ID:           saml.NewID(),
+		InResponseTo: request.Request.ID,
+		Destination:  sp.ACSURL,
+		Issuer:       samlEntityID(),
+		IssueInstant: now,
+		StatusCode:   saml.StatusSuccess,
+		Assertion:    assertion,
+	}).Element()
+
+	if sp.SignResponse {
+		if err := saml.Sign(response, key, cert); err != nil {
+			return nil, err
+		}
+	}
+
+	samlSession := models.SAMLSession{
+		SessionIndex:      sessionIndex,
+		BrowserSessionID:  session.ID,
+		ServiceProviderID: sp.ID,
+		UserID:            session.UserID,
+		NameID:            nameID,
+		NameIDFormat:      format,
+	}
+
+	if err := s.db.Create(&samlSession).Error; err != nil {
+		return nil, err
+	}
+
+	return saml.PostForm(sp.ACSURL, "SAMLResponse", response, request.RelayState)
+}
+
+func (s *samlIdPService) FailResponse(request *SSORequest, status, subStatus string) ([]byte, error) {
+	sp := request.ServiceProvider
+
+	response := (&saml.Response{
+		ID:            saml.NewID(),
+		InResponseTo:  request.Request.ID,
+		Destination:   sp.ACSURL,
+		Issuer:        samlEntityID(),
+		IssueInstant:  time.Now(),
+		StatusCode:    status,
+		SubStatusCode: subStatus,
+	}).Element()
+
+	if sp.SignResponse {
+		key, cert, err := samlSigningKey(s.db)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := saml.Sign(response, key, cert); err != nil {
+			return nil, err
+		}
+	}
+
+	return saml.PostForm(sp.ACSURL, "SAMLResponse", response, request.RelayState)
+}
+
+func (s *samlIdPService) Logout(message *SAMLMessage) (*SAMLBindingResult, error) {
+	el, err := decodeSAMLMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := saml.ParseLogoutRequest(el)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLRequest, err)
+	}
+
+	sp, err := s.activeServiceProvider(request.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if sp.SLOURL == "" {
+		return nil, errors.New("service provider has no single logout endpoint")
+	}
+
+	signed, err := s.verifyMessage(sp, message, el)
+	if err != nil {
+		return nil, err
+	}
+
+	if !request.NotOnOrAfter.IsZero() && time.Now().After(request.NotOnOrAfter.Add(saml.ClockSkew)) {
+		return nil, fmt.Errorf("%w: logout request expired", ErrInvalidSAMLRequest)
+	}
+
+	// Sem assinatura, só o SessionIndex (aleatório) prova que o pedido veio de quem recebeu a asserção
+	var browserSessionIDs []uint
+	if signed || len(request.SessionIndexes) > 0 {
+		query := s.db.Model(&models.SAMLSession{}).Where("service_provider_id = ? AND name_id = ?", sp.ID, request.NameID)
+		if len(request.SessionIndexes) > 0 {
+			query = query.Where("session_index IN ?", request.SessionIndexes)
+		}
+
+		if err := query.Pluck("browser_session_id", &browserSessionIDs).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if len(browserSessionIDs) > 0 {
+		err := s.db.Model(&models.SAMLBrowserSession{}).
+			Where("id IN ? AND ended_at IS NULL", browserSessionIDs).
+			Update("ended_at", time.Now()).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key, cert, err := samlSigningKey(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	response := (&saml.LogoutResponse{
+		ID:           saml.NewID(),
+		InResponseTo: request.ID,
+		Destination:  sp.SLOURL,
+		Issuer:       samlEntityID(),
+		IssueInstant: time.Now(),
+		StatusCode:   saml.StatusSuccess,
+	}).Element()
+
+	if sp.SLOBinding == saml.BindingHTTPPost {
+		if err := saml.Sign(response, key, cert); err != nil {
+			return nil, err
+		}
+
+		form, err := saml.PostForm(sp.SLOURL, "SAMLResponse", response, message.RelayState)
+		if err != nil {
+			return nil, err
+		}
+
+		return &SAMLBindingResult{Form: form}, nil
+	}
+
+	redirectURL, err := saml.RedirectURL(sp.SLOURL, "SAMLResponse", response, message.RelayState, func(query string) (string, error) {
+		return saml.SignQuery(query, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &SAMLBindingResult{RedirectURL: redirectURL}, nil
+}
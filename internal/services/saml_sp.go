@@ -0,0 +1,545 @@
+package services
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/saml"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"gorm.io/gorm"
+)
+
+// Usuários, grupos e identidades externas vindos de IdPs SAML usam "saml:<nome>" como Source e Provider
+const samlProviderPrefix = "saml:"
+
+var ErrInvalidSAMLResponse = errors.New("invalid SAML response")
+
+type SAMLSPService interface {
+	Metadata() ([]byte, error)
+
+	CreateIdentityProvider(idp *schemas.SAMLIdentityProviderCreate) (*schemas.SAMLIdentityProviderResponse, error)
+	GetIdentityProvider(name string) (*schemas.SAMLIdentityProviderResponse, error)
+	GetIdentityProviders() ([]schemas.SAMLIdentityProviderResponse, error)
+	UpdateIdentityProvider(name string, idp *schemas.SAMLIdentityProviderUpdate) (*schemas.SAMLIdentityProviderResponse, error)
+	DeleteIdentityProvider(name string) error
+
+	// StartLogin sends the browser to the identity provider with a new AuthnRequest
+	StartLogin(providerName string, clientID uint) (*SAMLBindingResult, error)
+	// ConsumeResponse validates a Response posted to the assertion consumer
+	// service and returns the local user and the whoami client that started the login
+	ConsumeResponse(samlResponse string) (*models.User, uint, error)
+}
+
+type samlSPService struct {
+	db *gorm.DB
+}
+
+func NewSAMLSPService() SAMLSPService {
+	return &samlSPService{
+		db: config.GetDB(),
+	}
+}
+
+func samlSPEntityID() string {
+	if config.Config.SAML.SPEntityID != "" {
+		return config.Config.SAML.SPEntityID
+	}
+	return config.Config.SAML.BaseURL + "/saml/sp/metadata"
+}
+
+func (s *samlSPService) Metadata() ([]byte, error) {
+	_, cert, err := samlSigningKey(s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var signing int64
+	if err := s.db.Model(&models.SAMLIdentityProvider{}).Where("sign_requests = ?", true).Count(&signing).Error; err != nil {
+		return nil, err
+	}
+
+	metadata := &saml.SPMetadata{
+		EntityID:            samlSPEntityID(),
+		Certificate:         cert,
+		ACSURL:              samlEndpoint("/saml/acs"),
+		AuthnRequestsSigned: signing > 0,
+	}
+
+	return append([]byte(xml.Header), metadata.Element().Bytes()...), nil
+}
+
+// applyIdentityProviderMetadata fills the fields not given explicitly from the IdP metadata XML
+func applyIdentityProviderMetadata(idp *schemas.SAMLIdentityProviderCreate) error {
+	metadata, err := saml.ParseMetadata([]byte(idp.Metadata))
+	if err != nil {
+		return err
+	}
+
+	descriptor := metadata.IDPSSODescriptor
+	if descriptor == nil {
+		return errors.New("metadata has no IDPSSODescriptor")
+	}
+
+	if idp.EntityID == "" {
+		idp.EntityID = metadata.EntityID
+	}
+
+	if idp.SSOURL == "" {
+		if endpoint := saml.FindEndpoint(descriptor.SingleSignOnServices, saml.BindingHTTPRedirect, saml.BindingHTTPPost); endpoint != nil {
+			idp.SSOURL = endpoint.Location
+			idp.SSOBinding = endpoint.Binding
+		}
+	}
+
+	if idp.NameIDFormat == "" && len(descriptor.NameIDFormats) > 0 {
+		idp.NameIDFormat = descriptor.NameIDFormats[0]
+	}
+
+	if idp.Certificates == "" {
+		certs, err := descriptor.SigningCertificates()
+		if err != nil {
+			return err
+		}
+		for _, cert := range certs {
+			idp.Certificates += string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+		}
+	}
+
+	if idp.SignRequests == nil {
+		idp.SignRequests = &descriptor.WantAuthnRequestsSigned
+	}
+
+	return nil
+}
+
+func validateIdentityProvider(idp *models.SAMLIdentityProvider) error {
+	if idp.Name == "" || idp.EntityID == "" || idp.SSOURL == "" {
+		return errors.New("name, entity_id and sso_url are required")
+	}
+
+	if idp.SSOBinding == "" {
+		idp.SSOBinding = saml.BindingHTTPRedirect
+	}
+	if idp.SSOBinding != saml.BindingHTTPRedirect && idp.SSOBinding != saml.BindingHTTPPost {
+		return fmt.Errorf("unsupported sso_binding %q", idp.SSOBinding)
+	}
+
+	// Sem certificado não há como validar as asserções
+	if idp.Certificates == "" {
+		return errors.New("at least one certificate is required")
+	}
+	if _, err := saml.ParseCertificates(idp.Certificates); err != nil {
+		return err
+	}
+
+	if idp.NameIDFormat == saml.NameIDFormatTransient && idp.IdentifierAttribute == "" {
+		return errors.New("transient NameIDs require an identifier_attribute")
+	}
+
+	metadataAttributes := map[string]string{}
+	if err := json.Unmarshal([]byte(idp.MetadataAttributes), &metadataAttributes); err != nil {
+		return errors.New("metadata_attributes must be a JSON object")
+	}
+
+	return nil
+}
+
+func (s *samlSPService) CreateIdentityProvider(idp *schemas.SAMLIdentityProviderCreate) (*schemas.SAMLIdentityProviderResponse, error) {
+	if idp.Metadata != "" {
+		if err := applyIdentityProviderMetadata(idp); err != nil {
+			return nil, err
+		}
+	}
+
+	idpModel := schemas.SAMLIdentityProviderFromCreate(idp)
+
+	if err := validateIdentityProvider(idpModel); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(idpModel).Error; err != nil {
+		return nil, err
+	}
+
+	return schemas.SAMLIdentityProviderResponseFromModel(idpModel), nil
+}
+
+func (s *samlSPService) GetIdentityProvider(name string) (*schemas.SAMLIdentityProviderResponse, error) {
+	var idp models.SAMLIdentityProvider
+
+	if err := s.db.Where("name = ?", name).First(&idp).Error; err != nil {
+		return nil, err
+	}
+
+	return schemas.SAMLIdentityProviderResponseFromModel(&idp), nil
+}
+
+func (s *samlSPService) GetIdentityProviders() ([]schemas.SAMLIdentityProviderResponse, error) {
+	var idps []models.SAMLIdentityProvider
+
+	if err := s.db.Find(&idps).Error; err != nil {
+		return nil, err
+	}
+
+	var returnIdPs []schemas.SAMLIdentityProviderResponse
+
+	for _, idp := range idps {
+		returnIdPs = append(returnIdPs, *schemas.SAMLIdentityProviderResponseFromModel(&idp))
+	}
+
+	return returnIdPs, nil
+}
+
+func (s *samlSPService) UpdateIdentityProvider(name string, idp *schemas.SAMLIdentityProviderUpdate) (*schemas.SAMLIdentityProviderResponse, error) {
+	var existing models.SAMLIdentityProvider
+
+	if err := s.db.Where("name = ?", name).First(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	if idp.SSOURL != nil {
+		existing.SSOURL = *idp.SSOURL
+	}
+	if idp.SSOBinding != nil {
+		existing.SSOBinding = *idp.SSOBinding
+	}
+	if idp.Certificates != nil {
+		existing.Certificates = *idp.Certificates
+	}
+	if idp.SignRequests != nil {
+		existing.SignRequests = *idp.SignRequests
+	}
+	if idp.NameIDFormat != nil {
+		existing.NameIDFormat = *idp.NameIDFormat
+	}
+	if idp.IdentifierAttribute != nil {
+		existing.IdentifierAttribute = *idp.IdentifierAttribute
+	}
+	if idp.GroupsAttribute != nil {
+		existing.GroupsAttribute = *idp.GroupsAttribute
+	}
+	if idp.MetadataAttributes != nil {
+		metadataAttributes, _ := json.Marshal(*idp.MetadataAttributes)
+		existing.MetadataAttributes = string(metadataAttributes)
+	}
+	if idp.Provision != nil {
+		existing.Provision = *idp.Provision
+	}
+	if idp.LinkExisting != nil {
+		existing.LinkExisting = *idp.LinkExisting
+	}
+	if idp.IsActive != nil {
+		existing.IsActive = *idp.IsActive
+	}
+
+	if err := validateIdentityProvider(&existing); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	return schemas.SAMLIdentityProviderResponseFromModel(&existing), nil
+}
+
+func (s *samlSPService) DeleteIdentityProvider(name string) error {
+	var idp models.SAMLIdentityProvider
+
+	if err := s.db.Where("name = ?", name).First(&idp).Error; err != nil {
+		return err
+	}
+
+	return s.db.Delete(&idp).Error
+}
+
+func (s *samlSPService) activeIdentityProvider(query string, value string) (*models.SAMLIdentityProvider, error) {
+	var idp models.SAMLIdentityProvider
+
+	if err := s.db.Where(query+" = ? AND is_active = ?", value, true).First(&idp).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownProvider
+		}
+		return nil, err
+	}
+
+	return &idp, nil
+}
+
+func (s *samlSPService) StartLogin(providerName string, clientID uint) (*SAMLBindingResult, error) {
+	idp, err := s.activeIdentityProvider("name", providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &saml.AuthnRequest{
+		ID:                          saml.NewID(),
+		Issuer:                      samlSPEntityID(),
+		Destination:                 idp.SSOURL,
+		AssertionConsumerServiceURL: samlEndpoint("/saml/acs"),
+		ProtocolBinding:             saml.BindingHTTPPost,
+		NameIDFormat:                idp.NameIDFormat,
+		IssueInstant:                time.Now(),
+	}
+
+	pending := models.SAMLAuthnRequest{
+		RequestID: request.ID,
+		Provider:  idp.Name,
+		ClientID:  clientID,
+		ExpiresAt: time.Now().Add(time.Duration(config.Config.Federation.StateExpiration) * time.Second),
+	}
+
+	if err := s.db.Create(&pending).Error; err != nil {
+		return nil, err
+	}
+
+	el := request.Element()
+
+	if idp.SSOBinding == saml.BindingHTTPPost {
+		if idp.SignRequests {
+			key, cert, err := samlSigningKey(s.db)
+			if err != nil {
+				return nil, err
+			}
+			if err := saml.Sign(el, key, cert); err != nil {
+				return nil, err
+			}
+		}
+
+		form, err := saml.PostForm(idp.SSOURL, "SAMLRequest", el, "")
+		if err != nil {
+			return nil, err
+		}
+		return &SAMLBindingResult{Form: form}, nil
+	}
+
+	var sign func(string) (string, error)
+	if idp.SignRequests {
+		key, _, err := samlSigningKey(s.db)
+		if err != nil {
+			return nil, err
+		}
+		sign = func(query string) (string, error) {
+			return saml.SignQuery(query, key)
+		}
+	}
+
+	redirectURL, err := saml.RedirectURL(idp.SSOURL, "SAMLRequest", el, "", sign)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SAMLBindingResult{RedirectURL: redirectURL}, nil
+}
+
+func (s *samlSPService) ConsumeResponse(samlResponse string) (*models.User, uint, error) {
+	el, err := saml.DecodePost(samlResponse)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidSAMLResponse, err)
+	}
+
+	issuer, inResponseTo := saml.PeekResponse(el)
+
+	idp, err := s.activeIdentityProvider("entity_id", issuer)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Respostas não solicitadas (IdP-initiated) não são aceitas
+	var pending models.SAMLAuthnRequest
+	if err := s.db.Where("request_id = ? AND provider = ?", inResponseTo, idp.Name).First(&pending).Error; err != nil {
+		return nil, 0, fmt.Errorf("%w: no pending request matches the response", ErrInvalidSAMLResponse)
+	}
+
+	// A requisição só pode ser respondida uma vez
+	if err := s.db.Unscoped().Delete(&pending).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if time.Now().After(pending.ExpiresAt) {
+		return nil, 0, fmt.Errorf("%w: the login request has expired", ErrInvalidSAMLResponse)
+	}
+
+	certs, err := saml.ParseCertificates(idp.Certificates)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	assertion, err := saml.ValidateResponse(el, &saml.ResponseValidation{
+		Certificates: certs,
+		IdPEntityID:  idp.EntityID,
+		SPEntityID:   samlSPEntityID(),
+		ACSURL:       samlEndpoint("/saml/acs"),
+		RequestID:    pending.RequestID,
+		Now:          time.Now(),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidSAMLResponse, err)
+	}
+
+	if err := s.consumeAssertion(idp, assertion); err != nil {
+		return nil, 0, err
+	}
+
+	user, err := s.resolveUser(idp, assertion)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return user, pending.ClientID, nil
+}
+
+// consumeAssertion records the assertion ID so the same assertion cannot be replayed while it is valid
+func (s *samlSPService) consumeAssertion(idp *models.SAMLIdentityProvider, assertion *saml.AssertionInfo) error {
+	if err := s.db.Unscoped().Where("expires_at < ?", time.Now().Add(-saml.ClockSkew)).Delete(&models.SAMLConsumedAssertion{}).Error; err != nil {
+		return err
+	}
+
+	var count int64
+	if err := s.db.Unscoped().Model(&models.SAMLConsumedAssertion{}).Where("assertion_id = ?", assertion.ID).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return fmt.Errorf("%w: assertion already used", ErrInvalidSAMLResponse)
+	}
+
+	return s.db.Create(&models.SAMLConsumedAssertion{
+		AssertionID: assertion.ID,
+		Provider:    idp.Name,
+		ExpiresAt:   assertion.NotOnOrAfter.Add(saml.ClockSkew),
+	}).Error
+}
+
+// attributeValue returns a single value as a string and several as a list
+func attributeValue(values []string) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+// resolveUser maps the assertion onto a local user and its groups
+func (s *samlSPService) resolveUser(idp *models.SAMLIdentityProvider, assertion *saml.AssertionInfo) (*models.User, error) {
+	claims := map[string]interface{}{
+		"name_id":        assertion.NameID,
+		"name_id_format": assertion.NameIDFormat,
+	}
+	for name, values := range assertion.Attributes {
+		claims[name] = attributeValue(values)
+	}
+
+	identifier := assertion.NameID
+	if idp.IdentifierAttribute != "" {
+		identifier = ""
+		if values := assertion.Attributes[idp.IdentifierAttribute]; len(values) > 0 {
+			identifier = values[0]
+		}
+	}
+
+	// NameIDs transientes mudam a cada login, então o vínculo usa o identificador
+	subject := assertion.NameID
+	if assertion.NameIDFormat == saml.NameIDFormatTransient {
+		subject = identifier
+	}
+
+	metadataAttributes := map[string]string{}
+	json.Unmarshal([]byte(idp.MetadataAttributes), &metadataAttributes)
+
+	metadata := map[string]interface{}{}
+	for key, attribute := range metadataAttributes {
+		if values, ok := assertion.Attributes[attribute]; ok && len(values) > 0 {
+			metadata[key] = attributeValue(values)
+		}
+	}
+
+	source := samlProviderPrefix + idp.Name
+
+	user, err := linkFederatedUser(s.db, &federatedIdentity{
+		Provider:     source,
+		Subject:      subject,
+		Identifier:   identifier,
+		Claims:       claims,
+		Metadata:     metadata,
+		Source:       source,
+		Provision:    idp.Provision,
+		LinkExisting: idp.LinkExisting,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if idp.GroupsAttribute != "" {
+		if err := s.syncGroups(user, source, assertion.Attributes[idp.GroupsAttribute]); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// syncGroups mirrors the groups asserted by the identity provider. Only groups
+// created from this provider are touched, so an assertion can never grant
+// membership in a local group.
+func (s *samlSPService) syncGroups(user *models.User, source string, identifiers []string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		asserted := map[string]bool{}
+
+		for _, identifier := range identifiers {
+			if identifier == "" {
+				continue
+			}
+
+			var group models.Group
+			err := tx.Where("identifier = ?", identifier).First(&group).Error
+
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				group = models.Group{
+					Identifier: identifier,
+					Metadata:   "{}",
+					IsActive:   true,
+					Source:     source,
+				}
+				if err := tx.Create(&group).Error; err != nil {
+					return err
+				}
+			} else if err != nil {
+				return err
+			}
+
+			if group.Source != source {
+				continue
+			}
+
+			if err := tx.Model(&group).Association("Users").Append(user); err != nil {
+				return err
+			}
+			asserted[identifier] = true
+		}
+
+		var current []models.Group
+		err := tx.Joins("JOIN group_users ON group_users.group_id = groups.id").
+			Where("group_users.user_id = ? AND groups.source = ?", user.ID, source).
+			Find(&current).Error
+		if err != nil {
+			return err
+		}
+
+		for _, group := range current {
+			if asserted[group.Identifier] {
+				continue
+			}
+			if err := tx.Model(&group).Association("Users").Delete(user); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
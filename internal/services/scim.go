@@ -0,0 +1,934 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/scim"
+	"github.com/duvrdx/whoami/internal/utils"
+	"gorm.io/gorm"
+)
+
+const SourceSCIM = "scim"
+
+var ErrInvalidSCIMToken = errors.New("invalid SCIM token")
+
+// Referências a recursos criados no mesmo bulk request
+var bulkIDReference = regexp.MustCompile(`bulkId:([A-Za-z0-9_.~-]+)`)
+
+type SCIMService interface {
+	CreateToken(token *schemas.SCIMTokenCreate) (*schemas.SCIMTokenResponse, error)
+	GetTokens() ([]schemas.SCIMTokenResponse, error)
+	DeleteToken(id uint) error
+	// Authenticate checks the bearer token presented by a provisioning client
+	Authenticate(token string) error
+
+	// Errors returned by the operations below are *scim.Error for anything the client did wrong.
+	// version is the If-Match header; a mismatch fails with 412.
+	ListUsers(query *scim.Query) (*scim.ListResponse, error)
+	GetUser(id string) (scim.Resource, error)
+	CreateUser(resource scim.Resource) (scim.Resource, error)
+	ReplaceUser(id string, resource scim.Resource, version string) (scim.Resource, error)
+	PatchUser(id string, patch *scim.PatchRequest, version string) (scim.Resource, error)
+	DeleteUser(id string, version string) error
+
+	ListGroups(query *scim.Query) (*scim.ListResponse, error)
+	GetGroup(id string) (scim.Resource, error)
+	CreateGroup(resource scim.Resource) (scim.Resource, error)
+	ReplaceGroup(id string, resource scim.Resource, version string) (scim.Resource, error)
+	PatchGroup(id string, patch *scim.PatchRequest, version string) (scim.Resource, error)
+	DeleteGroup(id string, version string) error
+
+	Bulk(request *scim.BulkRequest) (*scim.BulkResponse, error)
+}
+
+type scimService struct {
+	db *gorm.DB
+}
+
+func NewSCIMService() SCIMService {
+	return &scimService{
+		db: config.GetDB(),
+	}
+}
+
+func (s *scimService) CreateToken(token *schemas.SCIMTokenCreate) (*schemas.SCIMTokenResponse, error) {
+	if token.Name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	secret := "scim_" + utils.GenerateSecureString(40)
+
+	tokenModel := models.SCIMToken{
+		Name:      token.Name,
+		TokenHash: utils.HashToken(secret),
+	}
+
+	if err := s.db.Create(&tokenModel).Error; err != nil {
+		return nil, err
+	}
+
+	response := schemas.SCIMTokenResponseFromModel(&tokenModel)
+	response.Token = secret
+
+	return response, nil
+}
+
+func (s *scimService) GetTokens() ([]schemas.SCIMTokenResponse, error) {
+	var tokens []models.SCIMToken
+
+	if err := s.db.Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+
+	returnTokens := []schemas.SCIMTokenResponse{}
+	for _, token := range tokens {
+		returnTokens = append(returnTokens, *schemas.SCIMTokenResponseFromModel(&token))
+	}
+
+	return returnTokens, nil
+}
+
+func (s *scimService) DeleteToken(id uint) error {
+	var token models.SCIMToken
+
+	if err := s.db.First(&token, id).Error; err != nil {
+		return err
+	}
+
+	return s.db.Unscoped().Delete(&token).Error
+}
+
+func (s *scimService) Authenticate(token string) error {
+	if token == "" {
+		return ErrInvalidSCIMToken
+	}
+
+	var scimToken models.SCIMToken
+	if err := s.db.Where("token_hash = ?", utils.HashToken(token)).First(&scimToken).Error; err != nil {
+		return ErrInvalidSCIMToken
+	}
+
+	return s.db.Model(&scimToken).UpdateColumn("last_used_at", time.Now()).Error
+}
+
+func scimLocation(endpoint string, id uint) string {
+	return config.Config.SCIM.BaseURL + endpoint + "/" + strconv.FormatUint(uint64(id), 10)
+}
+
+func scimNotFound(resourceType, id string) error {
+	return scim.NewError(404, "", "%s %s not found", resourceType, id)
+}
+
+// checkVersion compares the If-Match header with the current resource version
+func checkVersion(version string, lastModified time.Time) error {
+	if version == "" {
+		return nil
+	}
+
+	current := scim.ETag(lastModified)
+	for _, candidate := range strings.Split(version, ",") {
+		if candidate = strings.TrimSpace(candidate); candidate == "*" || candidate == current {
+			return nil
+		}
+	}
+
+	return scim.NewError(412, scim.ErrorInvalidVersion, "resource version does not match")
+}
+
+// scimAttributes reads the SCIM attributes kept in the "scim" key of a metadata object
+func scimAttributes(metadata string) map[string]interface{} {
+	values := map[string]interface{}{}
+	json.Unmarshal([]byte(metadata), &values)
+
+	stored, _ := values["scim"].(map[string]interface{})
+	if stored == nil {
+		stored = map[string]interface{}{}
+	}
+
+	return stored
+}
+
+// storeSCIMAttributes saves the SCIM attributes in the metadata, mirroring the
+// primary email and phone to the keys the notifier and the SAML IdP read
+func storeSCIMAttributes(metadata string, stored map[string]interface{}) string {
+	values := map[string]interface{}{}
+	json.Unmarshal([]byte(metadata), &values)
+
+	values["scim"] = stored
+
+	mirrors := map[string]string{"emails": "email", "phoneNumbers": "phone"}
+	for attribute, key := range mirrors {
+		if value := primaryValue(stored[attribute]); value != "" {
+			values[key] = value
+		}
+	}
+
+	metadataJSON, _ := json.Marshal(values)
+	return string(metadataJSON)
+}
+
+// clearSCIMAttributes drops the stored SCIM attributes, since PUT and PATCH
+// rebuild them from the full resource
+func clearSCIMAttributes(metadata string) string {
+	values := map[string]interface{}{}
+	json.Unmarshal([]byte(metadata), &values)
+
+	delete(values, "scim")
+
+	metadataJSON, _ := json.Marshal(values)
+	return string(metadataJSON)
+}
+
+// primaryValue returns the value marked primary in a multi-valued attribute, or the first one
+func primaryValue(attribute interface{}) string {
+	list, _ := attribute.([]interface{})
+
+	first := ""
+	for _, element := range list {
+		object, _ := element.(map[string]interface{})
+		value, _ := object["value"].(string)
+		if object["primary"] == true {
+			return value
+		}
+		if first == "" {
+			first = value
+		}
+	}
+
+	return first
+}
+
+func (s *scimService) findUser(id string) (*models.User, error) {
+	numericID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, scimNotFound("User", id)
+	}
+
+	var user models.User
+	if err := s.db.Preload("Groups").First(&user, numericID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, scimNotFound("User", id)
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *scimService) userResource(user *models.User) (scim.Resource, error) {
+	resource := scim.Resource{}
+	for key, value := range scimAttributes(user.Metadata) {
+		resource[key] = value
+	}
+
+	resourceSchemas := []string{scim.SchemaUser}
+	if _, ok := resource[scim.SchemaEnterpriseUser]; ok {
+		resourceSchemas = append(resourceSchemas, scim.SchemaEnterpriseUser)
+	}
+
+	resource["schemas"] = resourceSchemas
+	resource["id"] = strconv.FormatUint(uint64(user.ID), 10)
+	resource["userName"] = user.Identifier
+	resource["active"] = user.IsActive
+	resource["meta"] = scim.Meta("User", scimLocation("/Users", user.ID), user.CreatedAt, user.UpdatedAt)
+
+	groups := []map[string]interface{}{}
+	for _, group := range user.Groups {
+		groups = append(groups, map[string]interface{}{
+			"value":   strconv.FormatUint(uint64(group.ID), 10),
+			"display": group.Identifier,
+			"$ref":    scimLocation("/Groups", group.ID),
+			"type":    "direct",
+		})
+	}
+	if len(groups) > 0 {
+		resource["groups"] = groups
+	}
+
+	return scim.Normalize(resource)
+}
+
+func (s *scimService) identifierTaken(model interface{}, identifier string, id uint) (bool, error) {
+	var count int64
+
+	err := s.db.Unscoped().Model(model).Where("identifier = ? AND id <> ?", identifier, id).Count(&count).Error
+
+	return count > 0, err
+}
+
+// saveUser applies a client representation to the user and saves it
+func (s *scimService) saveUser(user *models.User, resource scim.Resource) (scim.Resource, error) {
+	canonical, err := scim.UserResourceType.Canonicalize(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	userName, _ := canonical["userName"].(string)
+	if userName == "" {
+		return nil, scim.NewError(400, scim.ErrorInvalidValue, "userName is required")
+	}
+
+	taken, err := s.identifierTaken(&models.User{}, userName, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, scim.NewError(409, scim.ErrorUniqueness, "userName %s is already in use", userName)
+	}
+
+	if password, ok := canonical["password"].(string); ok {
+		flagged, err := checkPasswordBreach(password)
+		if errors.Is(err, ErrPasswordBreached) {
+			return nil, scim.NewError(400, scim.ErrorInvalidValue, err.Error())
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		hashed, err := utils.HashPassword(password)
+		if err != nil {
+			return nil, err
+		}
+
+		user.Password = hashed
+		user.PasswordBreached = flagged
+	}
+
+	if active, ok := canonical["active"].(bool); ok {
+		user.IsActive = active
+	}
+
+	user.Identifier = userName
+
+	for _, key := range []string{"userName", "password", "active"} {
+		delete(canonical, key)
+	}
+	user.Metadata = storeSCIMAttributes(user.Metadata, canonical)
+
+	// Na criação o gorm troca o false pelo default da coluna, inclusive na struct
+	active := user.IsActive
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Save também gravaria os grupos carregados, que aqui são somente leitura
+		if err := tx.Omit("Groups").Save(user).Error; err != nil {
+			return err
+		}
+
+		if active {
+			return nil
+		}
+
+		if err := tx.Model(user).Update("is_active", false).Error; err != nil {
+			return err
+		}
+
+		// O desprovisionamento encerra as sessões e os tokens em uso
+		return revokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.findUser(strconv.FormatUint(uint64(user.ID), 10))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.userResource(saved)
+}
+
+// userNameFilter returns the value of a plain `userName eq "..."` filter, the
+// lookup provisioning clients do before every push, so it can run in the database
+func userNameFilter(filter scim.Expression) (string, bool) {
+	expression, ok := filter.(scim.AttributeExpression)
+	if !ok || expression.Operator != "eq" || expression.Path.Sub != "" || !strings.EqualFold(expression.Path.Name, "userName") {
+		return "", false
+	}
+
+	if expression.Path.URI != "" && !strings.EqualFold(expression.Path.URI, scim.SchemaUser) {
+		return "", false
+	}
+
+	value, ok := expression.Value.(string)
+	return value, ok
+}
+
+func (s *scimService) ListUsers(query *scim.Query) (*scim.ListResponse, error) {
+	var users []models.User
+
+	db := s.db.Preload("Groups").Order("id")
+	if userName, ok := userNameFilter(query.Filter); ok {
+		db = db.Where("LOWER(identifier) = LOWER(?)", userName)
+	}
+
+	if err := db.Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	resources := []scim.Resource{}
+	for i := range users {
+		resource, err := s.userResource(&users[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if query.Filter == nil || scim.UserResourceType.Match(resource, query.Filter) {
+			resources = append(resources, resource)
+		}
+	}
+
+	response := query.Page(resources)
+	for i, resource := range response.Resources {
+		response.Resources[i] = scim.UserResourceType.Project(resource, query.Attributes, query.ExcludedAttributes)
+	}
+
+	return response, nil
+}
+
+func (s *scimService) GetUser(id string) (scim.Resource, error) {
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.userResource(user)
+}
+
+func (s *scimService) CreateUser(resource scim.Resource) (scim.Resource, error) {
+	user := models.User{
+		IsActive: true,
+		Metadata: "{}",
+		Source:   SourceSCIM,
+	}
+
+	return s.saveUser(&user, resource)
+}
+
+func (s *scimService) ReplaceUser(id string, resource scim.Resource, version string) (scim.Resource, error) {
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkVersion(version, user.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	user.Metadata = clearSCIMAttributes(user.Metadata)
+
+	return s.saveUser(user, resource)
+}
+
+func (s *scimService) PatchUser(id string, patch *scim.PatchRequest, version string) (scim.Resource, error) {
+	user, err := s.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkVersion(version, user.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	resource, err := s.userResource(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := scim.UserResourceType.ApplyPatch(resource, patch); err != nil {
+		return nil, err
+	}
+
+	user.Metadata = clearSCIMAttributes(user.Metadata)
+
+	return s.saveUser(user, resource)
+}
+
+func (s *scimService) DeleteUser(id string, version string) error {
+	user, err := s.findUser(id)
+	if err != nil {
+		return err
+	}
+
+	if err := checkVersion(version, user.UpdatedAt); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := revokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.PersonalAccessToken{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(user).Error
+	})
+}
+
+func (s *scimService) findGroup(id string) (*models.Group, error) {
+	numericID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, scimNotFound("Group", id)
+	}
+
+	var group models.Group
+	if err := s.db.Preload("Users").First(&group, numericID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, scimNotFound("Group", id)
+		}
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+func (s *scimService) groupResource(group *models.Group) (scim.Resource, error) {
+	resource := scim.Resource{}
+	for key, value := range scimAttributes(group.Metadata) {
+		resource[key] = value
+	}
+
+	resource["schemas"] = []string{scim.SchemaGroup}
+	resource["id"] = strconv.FormatUint(uint64(group.ID), 10)
+	resource["displayName"] = group.Identifier
+	resource["meta"] = scim.Meta("Group", scimLocation("/Groups", group.ID), group.CreatedAt, group.UpdatedAt)
+
+	members := []map[string]interface{}{}
+	for _, user := range group.Users {
+		members = append(members, map[string]interface{}{
+			"value":   strconv.FormatUint(uint64(user.ID), 10),
+			"display": user.Identifier,
+			"$ref":    scimLocation("/Users", user.ID),
+			"type":    "User",
+		})
+	}
+	if len(members) > 0 {
+		resource["members"] = members
+	}
+
+	return scim.Normalize(resource)
+}
+
+// groupMembers resolves the members attribute to users
+func (s *scimService) groupMembers(members interface{}) ([]*models.User, error) {
+	list, _ := members.([]interface{})
+
+	ids := map[uint64]bool{}
+	for _, element := range list {
+		member, _ := element.(map[string]interface{})
+
+		if memberType, _ := member["type"].(string); memberType != "" && !strings.EqualFold(memberType, "User") {
+			return nil, scim.NewError(400, scim.ErrorInvalidValue, "only users can be group members")
+		}
+
+		value, _ := member["value"].(string)
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, scim.NewError(400, scim.ErrorInvalidValue, "invalid member %q", value)
+		}
+		ids[id] = true
+	}
+
+	users := []*models.User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	var idList []uint64
+	for id := range ids {
+		idList = append(idList, id)
+	}
+
+	if err := s.db.Where("id IN ?", idList).Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	if len(users) != len(ids) {
+		return nil, scim.NewError(400, scim.ErrorInvalidValue, "members reference unknown users")
+	}
+
+	return users, nil
+}
+
+// saveGroup applies a client representation to the group and saves it along with its members
+func (s *scimService) saveGroup(group *models.Group, resource scim.Resource) (scim.Resource, error) {
+	canonical, err := scim.GroupResourceType.Canonicalize(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName, _ := canonical["displayName"].(string)
+	if displayName == "" {
+		return nil, scim.NewError(400, scim.ErrorInvalidValue, "displayName is required")
+	}
+
+	taken, err := s.identifierTaken(&models.Group{}, displayName, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, scim.NewError(409, scim.ErrorUniqueness, "displayName %s is already in use", displayName)
+	}
+
+	members, err := s.groupMembers(canonical["members"])
+	if err != nil {
+		return nil, err
+	}
+
+	group.Identifier = displayName
+
+	delete(canonical, "displayName")
+	delete(canonical, "members")
+	group.Metadata = storeSCIMAttributes(group.Metadata, canonical)
+
+	// Usuários que entram ou saem do grupo mudam de versão, pois o atributo groups deles muda
+	changed := map[uint]bool{}
+	for _, user := range group.Users {
+		changed[user.ID] = true
+	}
+	for _, user := range members {
+		if changed[user.ID] {
+			delete(changed, user.ID)
+		} else {
+			changed[user.ID] = true
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Users").Save(group).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(group).Association("Users").Replace(members); err != nil {
+			return err
+		}
+
+		if len(changed) == 0 {
+			return nil
+		}
+
+		var changedIDs []uint
+		for id := range changed {
+			changedIDs = append(changedIDs, id)
+		}
+
+		return tx.Model(&models.User{}).Where("id IN ?", changedIDs).UpdateColumn("updated_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.findGroup(strconv.FormatUint(uint64(group.ID), 10))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.groupResource(saved)
+}
+
+func (s *scimService) ListGroups(query *scim.Query) (*scim.ListResponse, error) {
+	var groups []models.Group
+
+	if err := s.db.Preload("Users").Order("id").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	resources := []scim.Resource{}
+	for i := range groups {
+		resource, err := s.groupResource(&groups[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if query.Filter == nil || scim.GroupResourceType.Match(resource, query.Filter) {
+			resources = append(resources, resource)
+		}
+	}
+
+	response := query.Page(resources)
+	for i, resource := range response.Resources {
+		response.Resources[i] = scim.GroupResourceType.Project(resource, query.Attributes, query.ExcludedAttributes)
+	}
+
+	return response, nil
+}
+
+func (s *scimService) GetGroup(id string) (scim.Resource, error) {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.groupResource(group)
+}
+
+func (s *scimService) CreateGroup(resource scim.Resource) (scim.Resource, error) {
+	group := models.Group{
+		IsActive: true,
+		Metadata: "{}",
+		Source:   SourceSCIM,
+	}
+
+	return s.saveGroup(&group, resource)
+}
+
+func (s *scimService) ReplaceGroup(id string, resource scim.Resource, version string) (scim.Resource, error) {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkVersion(version, group.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	group.Metadata = clearSCIMAttributes(group.Metadata)
+
+	return s.saveGroup(group, resource)
+}
+
+func (s *scimService) PatchGroup(id string, patch *scim.PatchRequest, version string) (scim.Resource, error) {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkVersion(version, group.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	resource, err := s.groupResource(group)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := scim.GroupResourceType.ApplyPatch(resource, patch); err != nil {
+		return nil, err
+	}
+
+	group.Metadata = clearSCIMAttributes(group.Metadata)
+
+	return s.saveGroup(group, resource)
+}
+
+func (s *scimService) DeleteGroup(id string, version string) error {
+	group, err := s.findGroup(id)
+	if err != nil {
+		return err
+	}
+
+	if err := checkVersion(version, group.UpdatedAt); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(group).Association("Users").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Delete(group).Error; err != nil {
+			return err
+		}
+		return rebuildGroupClosure(tx)
+	})
+}
+
+// AsSCIMError converts any error into the SCIM error sent to the client
+func AsSCIMError(err error) *scim.Error {
+	var scimErr *scim.Error
+	if errors.As(err, &scimErr) {
+		return scimErr
+	}
+	return scim.NewError(500, "", err.Error())
+}
+
+// resolveBulkIDs replaces bulkId references with the ids of resources created
+// earlier in the request. It reports false while a reference is still unknown.
+func resolveBulkIDs(text string, created map[string]string) (string, bool) {
+	resolved := true
+
+	text = bulkIDReference.ReplaceAllStringFunc(text, func(reference string) string {
+		id, ok := created[strings.TrimPrefix(reference, "bulkId:")]
+		if !ok {
+			resolved = false
+			return reference
+		}
+		return id
+	})
+
+	return text, resolved
+}
+
+func (s *scimService) Bulk(request *scim.BulkRequest) (*scim.BulkResponse, error) {
+	found := false
+	for _, schema := range request.Schemas {
+		found = found || schema == scim.MessageBulkRequest
+	}
+	if !found {
+		return nil, scim.NewError(400, scim.ErrorInvalidSyntax, "bulk requests must use the %s schema", scim.MessageBulkRequest)
+	}
+
+	if len(request.Operations) > config.Config.SCIM.BulkMaxOperations {
+		return nil, scim.NewError(413, "", "bulk requests are limited to %d operations", config.Config.SCIM.BulkMaxOperations)
+	}
+
+	response := &scim.BulkResponse{
+		Schemas:    []string{scim.MessageBulkResponse},
+		Operations: []scim.BulkOperationResult{},
+	}
+
+	created := map[string]string{}
+	failures := 0
+
+	pending := make([]int, len(request.Operations))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	// Operações que dependem de um bulkId ainda não criado ficam para a próxima passada
+	for len(pending) > 0 {
+		var deferred []int
+
+		for _, i := range pending {
+			if request.FailOnErrors > 0 && failures >= request.FailOnErrors {
+				return response, nil
+			}
+
+			operation := request.Operations[i]
+
+			path, pathResolved := resolveBulkIDs(operation.Path, created)
+			data, dataResolved := resolveBulkIDs(string(operation.Data), created)
+			if !pathResolved || !dataResolved {
+				deferred = append(deferred, i)
+				continue
+			}
+
+			result, id := s.bulkOperation(operation, path, []byte(data))
+			if status, _ := strconv.Atoi(result.Status); status >= 400 {
+				failures++
+			}
+			if operation.BulkID != "" && id != "" {
+				created[operation.BulkID] = id
+			}
+
+			response.Operations = append(response.Operations, result)
+		}
+
+		if len(deferred) == len(pending) {
+			// Referências circulares ou para bulkIds inexistentes
+			for _, i := range deferred {
+				response.Operations = append(response.Operations, scim.BulkOperationResult{
+					Method:   request.Operations[i].Method,
+					BulkID:   request.Operations[i].BulkID,
+					Status:   "409",
+					Response: scim.NewError(409, scim.ErrorInvalidValue, "unresolved bulkId reference"),
+				})
+			}
+			break
+		}
+
+		pending = deferred
+	}
+
+	return response, nil
+}
+
+// bulkOperation runs one operation of a bulk request and returns its result and the resource id
+func (s *scimService) bulkOperation(operation scim.BulkOperation, path string, data []byte) (scim.BulkOperationResult, string) {
+	result := scim.BulkOperationResult{Method: operation.Method, BulkID: operation.BulkID}
+
+	fail := func(err error) (scim.BulkOperationResult, string) {
+		scimErr := AsSCIMError(err)
+		result.Status = strconv.Itoa(scimErr.Status)
+		result.Response = scimErr
+		return result, ""
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	method := strings.ToUpper(operation.Method)
+
+	if len(parts) > 2 || (parts[0] != "Users" && parts[0] != "Groups") {
+		return fail(scim.NewError(400, scim.ErrorInvalidPath, "invalid path %q", path))
+	}
+	if (method == "POST") != (len(parts) == 1) {
+		return fail(scim.NewError(400, scim.ErrorInvalidPath, "invalid path %q for %s", path, method))
+	}
+
+	users := parts[0] == "Users"
+	id := ""
+	if len(parts) == 2 {
+		id = parts[1]
+	}
+
+	var resource scim.Resource
+	var err error
+
+	switch method {
+	case "POST", "PUT":
+		var body scim.Resource
+		if err := json.Unmarshal(data, &body); err != nil {
+			return fail(scim.NewError(400, scim.ErrorInvalidSyntax, "invalid data: %v", err))
+		}
+
+		switch {
+		case method == "POST" && users:
+			resource, err = s.CreateUser(body)
+		case method == "POST":
+			resource, err = s.CreateGroup(body)
+		case users:
+			resource, err = s.ReplaceUser(id, body, operation.Version)
+		default:
+			resource, err = s.ReplaceGroup(id, body, operation.Version)
+		}
+	case "PATCH":
+		var patch scim.PatchRequest
+		if err := json.Unmarshal(data, &patch); err != nil {
+			return fail(scim.NewError(400, scim.ErrorInvalidSyntax, "invalid data: %v", err))
+		}
+
+		if users {
+			resource, err = s.PatchUser(id, &patch, operation.Version)
+		} else {
+			resource, err = s.PatchGroup(id, &patch, operation.Version)
+		}
+	case "DELETE":
+		if users {
+			err = s.DeleteUser(id, operation.Version)
+		} else {
+			err = s.DeleteGroup(id, operation.Version)
+		}
+		if err != nil {
+			return fail(err)
+		}
+
+		result.Status = "204"
+		return result, id
+	default:
+		return fail(scim.NewError(400, scim.ErrorInvalidSyntax, "unsupported method %q", operation.Method))
+	}
+
+	if err != nil {
+		return fail(err)
+	}
+
+	result.Status = "200"
+	if method == "POST" {
+		result.Status = "201"
+	}
+
+	if meta, ok := resource["meta"].(map[string]interface{}); ok {
+		result.Location, _ = meta["location"].(string)
+		result.Version, _ = meta["version"].(string)
+	}
+
+	id, _ = resource["id"].(string)
+	return result, id
+}
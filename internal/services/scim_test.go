@@ -0,0 +1,83 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/scim"
+	"gorm.io/gorm"
+)
+
+// newTestSCIMUser provisions a user over SCIM and gives it a session, a token and an API key
+func newTestSCIMUser(t *testing.T, db *gorm.DB, service *scimService, userName string) string {
+	t.Helper()
+
+	resource, err := service.CreateUser(scim.Resource{"userName": userName})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	id, _ := resource["id"].(string)
+
+	user := findTestUser(t, db, userName)
+	db.Create(&models.Session{SID: "sid-" + userName, UserID: user.ID})
+	db.Create(&models.Token{AccessToken: "access-" + userName, RefreshToken: "refresh-" + userName, UserID: user.ID})
+	db.Create(&models.PersonalAccessToken{Name: "ci", TokenHash: "hash-" + userName, UserID: user.ID})
+
+	return id
+}
+
+func countTestRows(db *gorm.DB, model interface{}, userID uint) int64 {
+	var count int64
+	db.Model(model).Where("user_id = ?", userID).Count(&count)
+	return count
+}
+
+func TestSCIMDeprovisioning(t *testing.T) {
+	db := newTestDB(t)
+	service := &scimService{db: db}
+
+	t.Run("created inactive", func(t *testing.T) {
+		if _, err := service.CreateUser(scim.Resource{"userName": "dormant", "active": false}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if findTestUser(t, db, "dormant").IsActive {
+			t.Errorf("user created with active false is active")
+		}
+	})
+
+	t.Run("deactivation revokes sessions and tokens", func(t *testing.T) {
+		id := newTestSCIMUser(t, db, service, "alice")
+
+		patch := &scim.PatchRequest{
+			Schemas:    []string{scim.MessagePatchOp},
+			Operations: []scim.PatchOperation{{Op: "replace", Path: "active", Value: false}},
+		}
+		if _, err := service.PatchUser(id, patch, ""); err != nil {
+			t.Fatalf("PatchUser: %v", err)
+		}
+
+		user := findTestUser(t, db, "alice")
+		if user.IsActive {
+			t.Errorf("alice is still active")
+		}
+		if countTestRows(db, &models.Token{}, user.ID) != 0 || countTestRows(db, &models.Session{}, user.ID) != 0 {
+			t.Errorf("sessions or tokens survived the deactivation")
+		}
+	})
+
+	t.Run("delete revokes sessions, tokens and API keys", func(t *testing.T) {
+		id := newTestSCIMUser(t, db, service, "bob")
+		userID, _ := strconv.ParseUint(id, 10, 64)
+
+		if err := service.DeleteUser(id, ""); err != nil {
+			t.Fatalf("DeleteUser: %v", err)
+		}
+
+		for _, model := range []interface{}{&models.Token{}, &models.Session{}, &models.PersonalAccessToken{}} {
+			if count := countTestRows(db, model, uint(userID)); count != 0 {
+				t.Errorf("%d %T rows survived the deletion", count, model)
+			}
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens a fresh sqlite database with every model migrated and makes it the
+// global connection for the duration of the test. The configuration is restored too,
+// so tests can change it freely.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "whoami.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("opening test database: %v", err)
+	}
+
+	if err := db.AutoMigrate(models.User{}, models.Client{}, models.Group{}, models.GroupClosure{}, models.Token{}, models.Session{},
+		models.PersonalAccessToken{}, models.MFAFactor{}, models.Invitation{}, models.LoginChallenge{}, models.ExternalIdentity{},
+		models.FederationState{}, models.LoginRequest{},
+		models.SAMLServiceProvider{}, models.SAMLBrowserSession{}, models.SAMLSession{},
+		models.SAMLIdentityProvider{}, models.SAMLAuthnRequest{}, models.SAMLConsumedAssertion{},
+		models.SCIMToken{}, models.AuditLog{},
+		models.RBACRole{}, models.RBACRoleAssignment{}, models.RBACRoleClosure{}, models.RBACPermission{}, models.RBACResourceType{},
+		models.RBACResourceIdentifier{}, models.RBACApprovalPolicy{}, models.RBACAccessRequest{}, models.RBACAccessRequestEvent{},
+		models.ReBACNamespace{}, models.ReBACTuple{}, models.ReBACChange{},
+		models.Config{}); err != nil {
+		t.Fatalf("migrating test database: %v", err)
+	}
+
+	previousDB, previousConfig := config.DB, config.Config
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB, config.Config = previousDB, previousConfig
+	})
+
+	return db
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"github.com/duvrdx/whoami/internal/models"
+	"github.com/duvrdx/whoami/internal/schemas"
+	"github.com/duvrdx/whoami/internal/utils"
+	"gorm.io/gorm"
+)
+
+// AuthMethodSAML records logins through a partner SAML identity provider; the
+// other methods reuse the login method names
+const AuthMethodSAML = "saml"
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Último last_seen gravado por sid, para não escrever no banco a cada requisição
+var (
+	sessionTouches   sync.Map
+	sessionSweepMu   sync.Mutex
+	sessionLastSweep time.Time
+)
+
+type SessionService interface {
+	CreateSession(session *schemas.SessionCreate) (*schemas.SessionResponse, error)
+	GetSession(id uint) (*schemas.SessionResponse, error)
+	// GetSessions lists the live sessions of the user, flagging the one with currentSID
+	GetSessions(userIdentifier string, currentSID string) ([]schemas.SessionResponse, error)
+	RevokeSession(userIdentifier string, id uint) error
+	// RevokeOtherSessions revokes every session of the user except currentSID
+	RevokeOtherSessions(userIdentifier string, currentSID string) error
+	// Touch records activity on the session, writing at most once per touch interval
+	Touch(sid string)
+}
+
+type sessionService struct {
+	db *gorm.DB
+}
+
+func NewSessionService() SessionService {
+	return &sessionService{
+		db: config.GetDB(),
+	}
+}
+
+func (s *sessionService) findUser(identifier string) (*models.User, error) {
+	var user models.User
+
+	if err := s.db.Where("identifier = ?", identifier).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// liveSessions restricts the query to sessions that still hold an unexpired token
+func (s *sessionService) liveSessions(userID uint) *gorm.DB {
+	return s.db.Model(&models.Session{}).
+		Where("user_id = ?", userID).
+		Where("EXISTS (SELECT 1 FROM tokens WHERE tokens.session_id = sessions.id AND tokens.deleted_at IS NULL AND tokens.expires_in > ?)", time.Now().Unix())
+}
+
+func (s *sessionService) CreateSession(session *schemas.SessionCreate) (*schemas.SessionResponse, error) {
+	now := time.Now()
+
+	sessionModel := models.Session{
+		SID:        utils.GenerateSecureString(32),
+		UserID:     session.UserID,
+		ClientID:   session.ClientID,
+		IP:         session.IP,
+		UserAgent:  session.UserAgent,
+		Device:     utils.DeviceName(session.UserAgent),
+		Methods:    strings.Join(session.Methods, ","),
+		LastSeenAt: now,
+	}
+
+	if err := s.db.Create(&sessionModel).Error; err != nil {
+		return nil, err
+	}
+
+	return schemas.SessionResponseFromModel(&sessionModel), nil
+}
+
+func (s *sessionService) GetSession(id uint) (*schemas.SessionResponse, error) {
+	var session models.Session
+
+	if err := s.db.Preload("Client").First(&session, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	return schemas.SessionResponseFromModel(&session), nil
+}
+
+func (s *sessionService) GetSessions(userIdentifier string, currentSID string) ([]schemas.SessionResponse, error) {
+	user, err := s.findUser(userIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []models.Session
+
+	if err := s.liveSessions(user.ID).Preload("Client").Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	returnSessions := []schemas.SessionResponse{}
+	for _, session := range sessions {
+		response := schemas.SessionResponseFromModel(&session)
+		response.Current = currentSID != "" && session.SID == currentSID
+		returnSessions = append(returnSessions, *response)
+	}
+
+	return returnSessions, nil
+}
+
+// revoke deletes the sessions and the tokens issued within them
+func (s *sessionService) revoke(sessions []models.Session) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	ids := []uint{}
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id IN ?", ids).Delete(&models.Token{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&models.Session{}, ids).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		sessionTouches.Delete(session.SID)
+	}
+
+	return nil
+}
+
+// revokeUserSessions deletes every session and token of the user, so a deactivated
+// or deleted account loses access at once instead of when its tokens expire
+func revokeUserSessions(tx *gorm.DB, userID uint) error {
+	var sids []string
+	if err := tx.Model(&models.Session{}).Where("user_id = ?", userID).Pluck("sid", &sids).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.Token{}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&models.Session{}).Error; err != nil {
+		return err
+	}
+
+	for _, sid := range sids {
+		sessionTouches.Delete(sid)
+	}
+
+	return nil
+}
+
+func (s *sessionService) RevokeSession(userIdentifier string, id uint) error {
+	user, err := s.findUser(userIdentifier)
+	if err != nil {
+		return err
+	}
+
+	// Filtrar pelo usuário impede revogar sessões de outras contas
+	var session models.Session
+
+	if err := s.db.Where("id = ? AND user_id = ?", id, user.ID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+
+	return s.revoke([]models.Session{session})
+}
+
+func (s *sessionService) RevokeOtherSessions(userIdentifier string, currentSID string) error {
+	user, err := s.findUser(userIdentifier)
+	if err != nil {
+		return err
+	}
+
+	var sessions []models.Session
+
+	if err := s.db.Where("user_id = ? AND sid <> ?", user.ID, currentSID).Find(&sessions).Error; err != nil {
+		return err
+	}
+
+	return s.revoke(sessions)
+}
+
+func (s *sessionService) Touch(sid string) {
+	now := time.Now()
+	interval := time.Duration(config.Config.Session.TouchInterval) * time.Second
+
+	if last, ok := sessionTouches.Load(sid); ok && now.Sub(last.(time.Time)) < interval {
+		return
+	}
+
+	sessionTouches.Store(sid, now)
+	sweepSessionTouches(now)
+
+	if err := s.db.Model(&models.Session{}).Where("sid = ?", sid).UpdateColumn("last_seen_at", now).Error; err != nil {
+		sessionTouches.Delete(sid)
+	}
+}
+
+// sweepSessionTouches drops entries of sessions idle for longer than a token
+// lives, so the cache does not grow with every login
+func sweepSessionTouches(now time.Time) {
+	lifetime := time.Duration(config.Config.Token.Expiration) * time.Second
+
+	sessionSweepMu.Lock()
+	if now.Sub(sessionLastSweep) < lifetime {
+		sessionSweepMu.Unlock()
+		return
+	}
+	sessionLastSweep = now
+	sessionSweepMu.Unlock()
+
+	sessionTouches.Range(func(key, value interface{}) bool {
+		if now.Sub(value.(time.Time)) > lifetime {
+			sessionTouches.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidBloomFilter = errors.New("invalid bloom filter file")
+
+var bloomFilterMagic = [8]byte{'W', 'H', 'O', 'B', 'L', 'O', 'O', 'M'}
+
+// BloomFilter is a compact membership filter over SHA-1 digests.
+// Since the inputs are already uniformly distributed, the bit positions
+// are derived from the digest itself using double hashing.
+type BloomFilter struct {
+	m    uint64
+	k    uint32
+	bits []uint64
+}
+
+// NewBloomFilter sizes a filter for n items with the given false positive rate
+func NewBloomFilter(n uint64, falsePositiveRate float64) *BloomFilter {
+	if n == 0 {
+		n = 1
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k == 0 {
+		k = 1
+	}
+
+	return &BloomFilter{
+		m:    m,
+		k:    k,
+		bits: make([]uint64, (m+63)/64),
+	}
+}
+
+func (f *BloomFilter) positions(digest [20]byte, fn func(uint64)) {
+	h1 := binary.LittleEndian.Uint64(digest[0:8])
+	h2 := binary.LittleEndian.Uint64(digest[8:16]) | 1
+
+	for i := uint64(0); i < uint64(f.k); i++ {
+		fn((h1 + i*h2) % f.m)
+	}
+}
+
+func (f *BloomFilter) Add(digest [20]byte) {
+	f.positions(digest, func(pos uint64) {
+		f.bits[pos/64] |= 1 << (pos % 64)
+	})
+}
+
+func (f *BloomFilter) Test(digest [20]byte) bool {
+	found := true
+	f.positions(digest, func(pos uint64) {
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			found = false
+		}
+	})
+	return found
+}
+
+// WriteTo serializes the filter as magic, m, k and the bit array, all little endian
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+
+	header := make([]byte, 20)
+	copy(header, bloomFilterMagic[:])
+	binary.LittleEndian.PutUint64(header[8:16], f.m)
+	binary.LittleEndian.PutUint32(header[16:20], f.k)
+
+	if _, err := bw.Write(header); err != nil {
+		return 0, err
+	}
+
+	word := make([]byte, 8)
+	for _, bits := range f.bits {
+		binary.LittleEndian.PutUint64(word, bits)
+		if _, err := bw.Write(word); err != nil {
+			return 0, err
+		}
+	}
+
+	return int64(len(header) + 8*len(f.bits)), bw.Flush()
+}
+
+// ReadBloomFilter loads a filter written by WriteTo
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, 20)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, ErrInvalidBloomFilter
+	}
+
+	if [8]byte(header[0:8]) != bloomFilterMagic {
+		return nil, ErrInvalidBloomFilter
+	}
+
+	f := &BloomFilter{
+		m: binary.LittleEndian.Uint64(header[8:16]),
+		k: binary.LittleEndian.Uint32(header[16:20]),
+	}
+
+	if f.m == 0 || f.k == 0 {
+		return nil, ErrInvalidBloomFilter
+	}
+
+	f.bits = make([]uint64, (f.m+63)/64)
+
+	word := make([]byte, 8)
+	for i := range f.bits {
+		if _, err := io.ReadFull(br, word); err != nil {
+			return nil, ErrInvalidBloomFilter
+		}
+		f.bits[i] = binary.LittleEndian.Uint64(word)
+	}
+
+	return f, nil
+}
+
+// ParseSHA1CountLine parses a "HASH:COUNT" line from a breached password list.
+// Lines from prefix range files only carry the hash suffix, so the file's prefix
+// is prepended before decoding.
+func ParseSHA1CountLine(line, prefix string) (digest [20]byte, count int, ok bool) {
+	hash, countStr, _ := strings.Cut(strings.TrimSpace(line), ":")
+
+	raw, err := hex.DecodeString(prefix + hash)
+	if err != nil || len(raw) != len(digest) {
+		return digest, 0, false
+	}
+	copy(digest[:], raw)
+
+	count = 1
+	if countStr != "" {
+		if count, err = strconv.Atoi(countStr); err != nil {
+			return digest, 0, false
+		}
+	}
+
+	return digest, count, true
+}
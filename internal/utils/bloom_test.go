@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	filter := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		filter.Add(sha1.Sum([]byte(fmt.Sprintf("breached-%d", i))))
+	}
+
+	var buf bytes.Buffer
+	if _, err := filter.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	loaded, err := ReadBloomFilter(&buf)
+	if err != nil {
+		t.Fatalf("ReadBloomFilter: %v", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if !loaded.Test(sha1.Sum([]byte(fmt.Sprintf("breached-%d", i)))) {
+			t.Fatalf("breached-%d is missing from the filter", i)
+		}
+	}
+
+	// Com 1% de falsos positivos, bem mais que 3% indicaria um filtro mal dimensionado
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if loaded.Test(sha1.Sum([]byte(fmt.Sprintf("clean-%d", i)))) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("%d false positives in 10000, want about 100", falsePositives)
+	}
+}
+
+func TestReadBloomFilterRejectsInvalidFiles(t *testing.T) {
+	var buf bytes.Buffer
+	NewBloomFilter(100, 0.01).WriteTo(&buf)
+	valid := buf.Bytes()
+
+	zero := append([]byte{}, valid...)
+	copy(zero[8:16], make([]byte, 8))
+
+	for name, data := range map[string][]byte{
+		"empty":        nil,
+		"wrong magic":  append([]byte("NOTBLOOM"), valid[8:]...),
+		"truncated":    valid[:len(valid)-1],
+		"no bits":      zero,
+		"header only":  valid[:20],
+		"short header": valid[:10],
+	} {
+		if _, err := ReadBloomFilter(bytes.NewReader(data)); !errors.Is(err, ErrInvalidBloomFilter) {
+			t.Errorf("ReadBloomFilter with %s = %v, want ErrInvalidBloomFilter", name, err)
+		}
+	}
+}
+
+func TestParseSHA1CountLine(t *testing.T) {
+	sum := sha1.Sum([]byte("password"))
+	full := fmt.Sprintf("%X", sum)
+
+	tests := []struct {
+		line, prefix string
+		count        int
+		ok           bool
+	}{
+		{full + ":42", "", 42, true},
+		{full, "", 1, true},
+		{full[5:] + ":7\r", full[:5], 7, true},
+		{full[5:] + ":many", full[:5], 0, false},
+		{full[6:] + ":7", full[:5], 0, false},
+		{"not hex:1", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		digest, count, ok := ParseSHA1CountLine(tt.line, tt.prefix)
+		if ok != tt.ok || count != tt.count || ok && digest != sum {
+			t.Errorf("ParseSHA1CountLine(%q, %q) = %x, %d, %v", tt.line, tt.prefix, digest, count, ok)
+		}
+	}
+}
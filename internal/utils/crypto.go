@@ -1,22 +1,28 @@
 package utils
 
 import (
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
 	"math/rand"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/duvrdx/whoami/internal/config"
 )
 
+// HashPassword hashes the password with the algorithm configured in password.algorithm
 func HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	_, hasher, err := defaultPasswordHasher()
 	if err != nil {
 		return "", err
 	}
-	return string(hashedBytes), nil
+	return hasher.Hash(password)
 }
 
 func CheckPassword(password, hashedPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-	return err == nil
+	ok, _ := VerifyPassword(password, hashedPassword)
+	return ok
 }
 
 func GenerateRandomString(length int) string {
@@ -29,3 +35,44 @@ func GenerateRandomString(length int) string {
 
 	return string(b)
 }
+
+// GenerateSecureString is like GenerateRandomString but uses crypto/rand,
+// for values that grant access on their own (login links, invites, API keys)
+func GenerateSecureString(length int) string {
+	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	b := make([]byte, length)
+	max := big.NewInt(int64(len(charset)))
+	for i := range b {
+		n, err := cryptorand.Int(cryptorand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = charset[n.Int64()]
+	}
+
+	return string(b)
+}
+
+// GenerateNumericCode returns a random code with the given number of digits
+func GenerateNumericCode(digits int) string {
+	b := make([]byte, digits)
+	max := big.NewInt(10)
+	for i := range b {
+		n, err := cryptorand.Int(cryptorand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b[i] = byte('0' + n.Int64())
+	}
+
+	return string(b)
+}
+
+// HashToken returns a keyed hash of a secret so it can be stored and looked up
+// without keeping the secret itself
+func HashToken(token string) string {
+	mac := hmac.New(sha256.New, config.Config.Token.Secret)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"log"
+	"time"
+)
+
+// RunPeriodically runs fn right away and then every interval in a background
+// goroutine, logging failures instead of stopping
+func RunPeriodically(name string, interval time.Duration, fn func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := fn(); err != nil {
+				log.Printf("%s failed: %v", name, err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,367 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/duvrdx/whoami/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrUnknownPasswordHasher = errors.New("unknown password hashing algorithm")
+	ErrInvalidPasswordHash   = errors.New("invalid password hash format")
+)
+
+// PasswordHasher hashes and verifies passwords stored in PHC string format
+// (or the native modular crypt format, in bcrypt's case).
+type PasswordHasher interface {
+	// Matches reports whether the encoded hash was produced by this hasher.
+	Matches(encoded string) bool
+	// Validate checks that the encoded hash is well formed without verifying a password.
+	Validate(encoded string) error
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether the encoded hash uses outdated parameters.
+	NeedsRehash(encoded string) bool
+}
+
+// Limites dos parâmetros aceitos em hashes importados ou armazenados. Cada login
+// refaz o hash com eles, então um hash com custo absurdo derrubaria o servidor.
+const (
+	argon2MaxMemory    = 256 * 1024 // KiB
+	argon2MaxTime      = 16
+	argon2MaxThreads   = 16
+	bcryptMaxCost      = 16
+	scryptMaxMemory    = 256 * 1024 * 1024 // Bytes, 128·r·N
+	scryptMaxP         = 16
+	maxPasswordHashLen = 128
+)
+
+var passwordHashers = map[string]PasswordHasher{}
+
+// RegisterPasswordHasher adds a hasher to the registry under the given algorithm name.
+func RegisterPasswordHasher(name string, hasher PasswordHasher) {
+	passwordHashers[name] = hasher
+}
+
+func init() {
+	RegisterPasswordHasher("argon2id", argon2idHasher{})
+	RegisterPasswordHasher("bcrypt", bcryptHasher{})
+	RegisterPasswordHasher("scrypt", scryptHasher{})
+}
+
+// defaultPasswordHasher returns the hasher configured in password.algorithm
+func defaultPasswordHasher() (string, PasswordHasher, error) {
+	name := config.Config.Password.Algorithm
+	if name == "" {
+		name = "argon2id"
+	}
+
+	hasher, ok := passwordHashers[name]
+	if !ok {
+		return "", nil, ErrUnknownPasswordHasher
+	}
+
+	return name, hasher, nil
+}
+
+// identifyPasswordHasher finds the hasher that produced the encoded hash
+func identifyPasswordHasher(encoded string) (string, PasswordHasher, bool) {
+	for name, hasher := range passwordHashers {
+		if hasher.Matches(encoded) {
+			return name, hasher, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// IsSupportedPasswordHash reports whether the encoded hash can be verified by a registered hasher.
+func IsSupportedPasswordHash(encoded string) bool {
+	_, hasher, ok := identifyPasswordHasher(encoded)
+	if !ok {
+		return false
+	}
+
+	// Garante que o hash está bem formado, e não apenas com o prefixo certo
+	return hasher.Validate(encoded) == nil
+}
+
+// VerifyPassword checks the password against the encoded hash and reports
+// whether the hash should be replaced by one using the current algorithm and parameters.
+func VerifyPassword(password, encoded string) (ok bool, needsRehash bool) {
+	name, hasher, found := identifyPasswordHasher(encoded)
+	if !found {
+		return false, false
+	}
+
+	ok, err := hasher.Verify(password, encoded)
+	if err != nil || !ok {
+		return false, false
+	}
+
+	defaultName, _, err := defaultPasswordHasher()
+	if err != nil {
+		return true, false
+	}
+
+	return true, name != defaultName || hasher.NeedsRehash(encoded)
+}
+
+func randomSalt(length int) ([]byte, error) {
+	salt := make([]byte, length)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// parsePHC splits "$id$v=19$m=..,t=..$salt$hash" style strings into their parts.
+// The version segment is optional.
+func parsePHC(encoded, id string) (params map[string]string, salt, hash []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) < 5 || parts[0] != "" || parts[1] != id {
+		return nil, nil, nil, ErrInvalidPasswordHash
+	}
+
+	fields := parts[2:]
+	params = make(map[string]string)
+
+	if strings.HasPrefix(fields[0], "v=") {
+		params["v"] = strings.TrimPrefix(fields[0], "v=")
+		fields = fields[1:]
+	}
+
+	if len(fields) != 3 {
+		return nil, nil, nil, ErrInvalidPasswordHash
+	}
+
+	for _, kv := range strings.Split(fields[0], ",") {
+		key, value, found := strings.Cut(kv, "=")
+		if !found {
+			return nil, nil, nil, ErrInvalidPasswordHash
+		}
+		params[key] = value
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(fields[1]); err != nil {
+		return nil, nil, nil, ErrInvalidPasswordHash
+	}
+
+	if hash, err = base64.RawStdEncoding.DecodeString(fields[2]); err != nil {
+		return nil, nil, nil, ErrInvalidPasswordHash
+	}
+
+	return params, salt, hash, nil
+}
+
+// argon2id
+type argon2idHasher struct{}
+
+func (argon2idHasher) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (argon2idHasher) Hash(password string) (string, error) {
+	cfg := config.Config.Password.Argon2
+
+	salt, err := randomSalt(int(cfg.SaltLength))
+	if err != nil {
+		return "", err
+	}
+
+	hash := argon2.IDKey([]byte(password), salt, cfg.Time, cfg.Memory, cfg.Threads, cfg.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, cfg.Memory, cfg.Time, cfg.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+func (argon2idHasher) params(encoded string) (memory, time uint32, threads uint8, salt, hash []byte, err error) {
+	params, salt, hash, err := parsePHC(encoded, "argon2id")
+	if err != nil {
+		return 0, 0, 0, nil, nil, err
+	}
+
+	if v, ok := params["v"]; ok && v != fmt.Sprint(argon2.Version) {
+		return 0, 0, 0, nil, nil, ErrInvalidPasswordHash
+	}
+
+	var p uint32
+	if _, err := fmt.Sscanf(params["m"]+" "+params["t"]+" "+params["p"], "%d %d %d", &memory, &time, &p); err != nil {
+		return 0, 0, 0, nil, nil, ErrInvalidPasswordHash
+	}
+
+	if memory == 0 || time == 0 || p == 0 || len(hash) == 0 {
+		return 0, 0, 0, nil, nil, ErrInvalidPasswordHash
+	}
+
+	if memory > argon2MaxMemory || time > argon2MaxTime || p > argon2MaxThreads || len(hash) > maxPasswordHashLen {
+		return 0, 0, 0, nil, nil, ErrInvalidPasswordHash
+	}
+
+	return memory, time, uint8(p), salt, hash, nil
+}
+
+func (h argon2idHasher) Validate(encoded string) error {
+	_, _, _, _, _, err := h.params(encoded)
+	return err
+}
+
+func (h argon2idHasher) Verify(password, encoded string) (bool, error) {
+	memory, time, threads, salt, hash, err := h.params(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(hash)))
+	return subtle.ConstantTimeCompare(hash, computed) == 1, nil
+}
+
+func (h argon2idHasher) NeedsRehash(encoded string) bool {
+	cfg := config.Config.Password.Argon2
+
+	memory, time, threads, salt, hash, err := h.params(encoded)
+	if err != nil {
+		return true
+	}
+
+	return memory != cfg.Memory || time != cfg.Time || threads != cfg.Threads ||
+		uint32(len(hash)) != cfg.KeyLength || uint32(len(salt)) < cfg.SaltLength
+}
+
+// bcrypt
+type bcryptHasher struct{}
+
+func (bcryptHasher) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (bcryptHasher) Hash(password string) (string, error) {
+	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), config.Config.Password.Bcrypt.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedBytes), nil
+}
+
+func (bcryptHasher) Validate(encoded string) error {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil || cost > bcryptMaxCost || len(encoded) != 60 {
+		return ErrInvalidPasswordHash
+	}
+	return nil
+}
+
+func (h bcryptHasher) Verify(password, encoded string) (bool, error) {
+	if err := h.Validate(encoded); err != nil {
+		return false, err
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (bcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return true
+	}
+
+	return cost != config.Config.Password.Bcrypt.Cost
+}
+
+// scrypt
+type scryptHasher struct{}
+
+func (scryptHasher) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$scrypt$")
+}
+
+func (scryptHasher) Hash(password string) (string, error) {
+	cfg := config.Config.Password.Scrypt
+
+	salt, err := randomSalt(cfg.SaltLength)
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := scrypt.Key([]byte(password), salt, 1<<cfg.LogN, cfg.R, cfg.P, cfg.KeyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		cfg.LogN, cfg.R, cfg.P,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+func (scryptHasher) params(encoded string) (logN uint8, r, p int, salt, hash []byte, err error) {
+	params, salt, hash, err := parsePHC(encoded, "scrypt")
+	if err != nil {
+		return 0, 0, 0, nil, nil, err
+	}
+
+	var ln int
+	if _, err := fmt.Sscanf(params["ln"]+" "+params["r"]+" "+params["p"], "%d %d %d", &ln, &r, &p); err != nil {
+		return 0, 0, 0, nil, nil, ErrInvalidPasswordHash
+	}
+
+	if ln <= 0 || ln > 31 || r <= 0 || p <= 0 || len(hash) == 0 {
+		return 0, 0, 0, nil, nil, ErrInvalidPasswordHash
+	}
+
+	// Comparado assim para que um r enorme não estoure a multiplicação
+	if uint64(r) > scryptMaxMemory/128>>uint(ln) || p > scryptMaxP || len(hash) > maxPasswordHashLen {
+		return 0, 0, 0, nil, nil, ErrInvalidPasswordHash
+	}
+
+	return uint8(ln), r, p, salt, hash, nil
+}
+
+func (h scryptHasher) Validate(encoded string) error {
+	_, _, _, _, _, err := h.params(encoded)
+	return err
+}
+
+func (h scryptHasher) Verify(password, encoded string) (bool, error) {
+	logN, r, p, salt, hash, err := h.params(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	computed, err := scrypt.Key([]byte(password), salt, 1<<logN, r, p, len(hash))
+	if err != nil {
+		return false, ErrInvalidPasswordHash
+	}
+
+	return subtle.ConstantTimeCompare(hash, computed) == 1, nil
+}
+
+func (h scryptHasher) NeedsRehash(encoded string) bool {
+	cfg := config.Config.Password.Scrypt
+
+	logN, r, p, salt, hash, err := h.params(encoded)
+	if err != nil {
+		return true
+	}
+
+	return logN != cfg.LogN || r != cfg.R || p != cfg.P ||
+		len(hash) != cfg.KeyLength || len(salt) < cfg.SaltLength
+}
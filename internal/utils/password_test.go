@@ -0,0 +1,224 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/duvrdx/whoami/internal/config"
+)
+
+// Gerado com hashlib.scrypt do Python: senha "correct horse", sal "saltsaltsaltsalt"
+const testScryptHash = "$scrypt$ln=4,r=8,p=1$c2FsdHNhbHRzYWx0c2FsdA$rkTI9fAgA7thDzzR8FHXhMiojYBreJBmYTkEzWypBCQ"
+
+// Vetor de teste do John the Ripper para a senha "U*U"
+const testBcryptHash = "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW"
+
+// setTestPasswordConfig uses cheap parameters, so hashing in tests stays fast
+func setTestPasswordConfig(t *testing.T, algorithm string) {
+	t.Helper()
+
+	previous := config.Config.Password
+	t.Cleanup(func() { config.Config.Password = previous })
+
+	config.Config.Password = config.PasswordConfig{
+		Algorithm: algorithm,
+		Argon2:    config.Argon2Config{Memory: 64, Time: 1, Threads: 1, KeyLength: 16, SaltLength: 8},
+		Bcrypt:    config.BcryptConfig{Cost: 4},
+		Scrypt:    config.ScryptConfig{LogN: 4, R: 8, P: 1, KeyLength: 32, SaltLength: 16},
+	}
+}
+
+func TestParsePHC(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		encoded string
+		params  map[string]string
+		salt    string
+		hash    string
+		wantErr bool
+	}{
+		{
+			name:    "with version",
+			id:      "argon2id",
+			encoded: "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA",
+			params:  map[string]string{"v": "19", "m": "64", "t": "1", "p": "1"},
+			salt:    "salt",
+			hash:    "hash",
+		},
+		{
+			name:    "without version",
+			id:      "scrypt",
+			encoded: "$scrypt$ln=4,r=8,p=1$c2FsdA$aGFzaA",
+			params:  map[string]string{"ln": "4", "r": "8", "p": "1"},
+			salt:    "salt",
+			hash:    "hash",
+		},
+		{name: "other algorithm", id: "argon2id", encoded: "$scrypt$ln=4$c2FsdA$aGFzaA", wantErr: true},
+		{name: "missing leading $", id: "argon2id", encoded: "argon2id$v=19$m=64$c2FsdA$aGFzaA", wantErr: true},
+		{name: "missing hash", id: "argon2id", encoded: "$argon2id$v=19$m=64$c2FsdA", wantErr: true},
+		{name: "extra field", id: "argon2id", encoded: "$argon2id$m=64$c2FsdA$aGFzaA$aGFzaA", wantErr: true},
+		{name: "parameter without value", id: "argon2id", encoded: "$argon2id$m=64,t$c2FsdA$aGFzaA", wantErr: true},
+		{name: "padded salt", id: "argon2id", encoded: "$argon2id$m=64$c2FsdA==$aGFzaA", wantErr: true},
+		{name: "invalid hash encoding", id: "argon2id", encoded: "$argon2id$m=64$c2FsdA$a*b", wantErr: true},
+		{name: "empty", id: "argon2id", encoded: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, salt, hash, err := parsePHC(tt.encoded, tt.id)
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidPasswordHash) {
+					t.Errorf("parsePHC = %v, want ErrInvalidPasswordHash", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("parsePHC: %v", err)
+			}
+			if !reflect.DeepEqual(params, tt.params) || string(salt) != tt.salt || string(hash) != tt.hash {
+				t.Errorf("parsePHC = %v %q %q", params, salt, hash)
+			}
+		})
+	}
+}
+
+func TestPasswordHashers(t *testing.T) {
+	for _, algorithm := range []string{"argon2id", "bcrypt", "scrypt"} {
+		t.Run(algorithm, func(t *testing.T) {
+			setTestPasswordConfig(t, algorithm)
+
+			encoded, err := HashPassword("correct horse")
+			if err != nil {
+				t.Fatalf("HashPassword: %v", err)
+			}
+
+			if !IsSupportedPasswordHash(encoded) {
+				t.Errorf("%s is not supported", encoded)
+			}
+
+			if ok, rehash := VerifyPassword("correct horse", encoded); !ok || rehash {
+				t.Errorf("VerifyPassword = %v, %v, want true, false", ok, rehash)
+			}
+
+			if ok, _ := VerifyPassword("wrong horse", encoded); ok {
+				t.Errorf("a wrong password was accepted")
+			}
+
+			other, _ := HashPassword("correct horse")
+			if other == encoded {
+				t.Errorf("two hashes share a salt")
+			}
+		})
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	setTestPasswordConfig(t, "argon2id")
+
+	tests := []struct {
+		name        string
+		password    string
+		encoded     string
+		ok          bool
+		needsRehash bool
+	}{
+		{"scrypt reference", "correct horse", testScryptHash, true, true},
+		{"scrypt reference, wrong password", "correct horsE", testScryptHash, false, false},
+		{"bcrypt reference", "U*U", testBcryptHash, true, true},
+		{"bcrypt reference, wrong password", "U*V", testBcryptHash, false, false},
+		{"argon2 with another version", "x", "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA", false, false},
+		{"argon2 without threads", "x", "$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA", false, false},
+		{"scrypt with huge cost", "x", "$scrypt$ln=32,r=8,p=1$c2FsdA$aGFzaA", false, false},
+		{"unknown algorithm", "x", "$pbkdf2$i=1000$c2FsdA$aGFzaA", false, false},
+		{"plain text", "x", "x", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash := VerifyPassword(tt.password, tt.encoded)
+			if ok != tt.ok || needsRehash != tt.needsRehash {
+				t.Errorf("VerifyPassword = %v, %v, want %v, %v", ok, needsRehash, tt.ok, tt.needsRehash)
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordRehashOnNewParameters(t *testing.T) {
+	setTestPasswordConfig(t, "argon2id")
+
+	encoded, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+
+	config.Config.Password.Argon2.Time = 2
+
+	if ok, rehash := VerifyPassword("correct horse", encoded); !ok || !rehash {
+		t.Errorf("VerifyPassword = %v, %v, want true, true", ok, rehash)
+	}
+}
+
+func TestIsSupportedPasswordHash(t *testing.T) {
+	tests := []struct {
+		encoded string
+		want    bool
+	}{
+		{testScryptHash, true},
+		{testBcryptHash, true},
+		{testBcryptHash[:59], false},
+		{"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA", true},
+		{"$argon2id$v=19$m=64,t=1$c2FsdA$aGFzaA", false},
+		{"$argon2id$garbage", false},
+		{"$scrypt$ln=4,r=0,p=1$c2FsdA$aGFzaA", false},
+		{"$2x$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", false},
+		{"5f4dcc3b5aa765d61d8327deb882cf99", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsSupportedPasswordHash(tt.encoded); got != tt.want {
+			t.Errorf("IsSupportedPasswordHash(%q) = %v, want %v", tt.encoded, got, tt.want)
+		}
+	}
+}
+
+// Hashes com custo acima dos limites são recusados antes de qualquer cálculo, tanto
+// na importação quanto no login
+func TestPasswordHashLimits(t *testing.T) {
+	setTestPasswordConfig(t, "argon2id")
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    bool
+	}{
+		{"argon2 at the memory limit", "$argon2id$v=19$m=262144,t=16,p=16$c2FsdA$aGFzaA", true},
+		{"argon2 with 4 GiB", "$argon2id$v=19$m=4194304,t=1,p=1$c2FsdA$aGFzaA", false},
+		{"argon2 with many passes", "$argon2id$v=19$m=64,t=1000,p=1$c2FsdA$aGFzaA", false},
+		{"argon2 with many threads", "$argon2id$v=19$m=64,t=1,p=255$c2FsdA$aGFzaA", false},
+		{"argon2 with a long hash", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$" + strings.Repeat("A", 200), false},
+		{"scrypt at the memory limit", "$scrypt$ln=18,r=8,p=16$c2FsdA$aGFzaA", true},
+		{"scrypt with ln=30", "$scrypt$ln=30,r=8,p=1$c2FsdA$aGFzaA", false},
+		{"scrypt with a huge block size", "$scrypt$ln=1,r=9223372036854775807,p=1$c2FsdA$aGFzaA", false},
+		{"scrypt with many lanes", "$scrypt$ln=4,r=8,p=1000$c2FsdA$aGFzaA", false},
+		{"bcrypt with cost 31", "$2a$31$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSupportedPasswordHash(tt.encoded); got != tt.want {
+				t.Errorf("IsSupportedPasswordHash = %v, want %v", got, tt.want)
+			}
+
+			if !tt.want {
+				if ok, _ := VerifyPassword("x", tt.encoded); ok {
+					t.Errorf("VerifyPassword accepted an oversized hash")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package utils
+
+import "strings"
+
+// ResourceSeparator splits resource identifiers into hierarchy segments, as in project:42:doc:7
+const ResourceSeparator = ":"
+
+// IsResourcePattern reports whether the identifier is a glob rather than a literal resource
+func IsResourcePattern(identifier string) bool {
+	return strings.ContainsAny(identifier, "*?")
+}
+
+// ResourcePatternPrefix returns the literal segments of the pattern before its
+// first wildcard, ending with the separator. Patterns are indexed by it.
+func ResourcePatternPrefix(pattern string) string {
+	segments := strings.Split(pattern, ResourceSeparator)
+
+	prefix := ""
+	for _, segment := range segments {
+		if IsResourcePattern(segment) {
+			break
+		}
+		prefix += segment + ResourceSeparator
+	}
+
+	return prefix
+}
+
+// ResourceLineage returns the resource and its ancestors, from the root:
+// project, project:42, project:42:doc, project:42:doc:7
+func ResourceLineage(resource string) []string {
+	segments := strings.Split(resource, ResourceSeparator)
+
+	lineage := make([]string, len(segments))
+	for i := range segments {
+		lineage[i] = strings.Join(segments[:i+1], ResourceSeparator)
+	}
+
+	return lineage
+}
+
+// ResourcePatternPrefixes returns every pattern prefix that may match the resource
+// or one of its ancestors. It includes the whole resource, since a trailing **
+// also matches zero segments: project:42:** matches project:42.
+func ResourcePatternPrefixes(resource string) []string {
+	segments := strings.Split(resource, ResourceSeparator)
+
+	prefixes := make([]string, len(segments)+1)
+	for i := range prefixes {
+		prefixes[i] = strings.Join(segments[:i], ResourceSeparator)
+		if i > 0 {
+			prefixes[i] += ResourceSeparator
+		}
+	}
+
+	return prefixes
+}
+
+// MatchResourcePattern matches a resource against a segment-aware glob. Within
+// a segment, * matches any characters and ? a single one; a ** segment matches
+// any number of whole segments.
+func MatchResourcePattern(pattern, resource string) bool {
+	return matchSegments(strings.Split(pattern, ResourceSeparator), strings.Split(resource, ResourceSeparator))
+}
+
+func matchSegments(pattern, resource []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Tenta consumir zero ou mais segmentos do recurso
+			for i := 0; i <= len(resource); i++ {
+				if matchSegments(pattern[1:], resource[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(resource) == 0 || !matchSegment(pattern[0], resource[0]) {
+			return false
+		}
+
+		pattern, resource = pattern[1:], resource[1:]
+	}
+
+	return len(resource) == 0
+}
+
+func matchSegment(pattern, segment string) bool {
+	// Backtracking sobre o último *, suficiente para padrões sem classes de caracteres
+	p, s := 0, 0
+	star, mark := -1, 0
+
+	for s < len(segment) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == segment[s]):
+			p++
+			s++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, s
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			s = mark
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+var resourcePatternTests = []struct {
+	pattern  string
+	resource string
+	want     bool
+}{
+	{"project:42", "project:42", true},
+	{"project:42", "project:43", false},
+	{"project:*", "project:42", true},
+	{"project:*", "project", false},
+	{"project:*", "project:42:doc", false},
+	{"project:4*", "project:42", true},
+	{"project:*2", "project:42", true},
+	{"project:*2", "project:423", false},
+	{"project:4?", "project:42", true},
+	{"project:4?", "project:4", false},
+	{"project:?", "project:42", false},
+	{"project:*", "project:", true},
+	{"project:a*b*c", "project:aXbYbZc", true},
+	{"project:a*b*c", "project:aXbYc1", false},
+	{"project:**", "project:42:doc:7", true},
+	{"project:**", "project", true},
+	{"project:**", "other:42", false},
+	{"**", "project:42", true},
+	{"**:doc:*", "project:42:doc:7", true},
+	{"**:doc:*", "doc:7", true},
+	{"**:doc:*", "project:42:doc", false},
+	{"project:**:doc:7", "project:doc:7", true},
+	{"project:**:doc:7", "project:1:2:3:doc:7", true},
+	{"project:**:doc:7", "project:1:2:3:doc:8", false},
+	{"project:*:**:7", "project:42:7", true},
+	{"project:*:**:7", "project:7", false},
+	{"Project:42", "project:42", false},
+}
+
+func TestMatchResourcePattern(t *testing.T) {
+	for _, tt := range resourcePatternTests {
+		t.Run(tt.pattern+" "+tt.resource, func(t *testing.T) {
+			if got := MatchResourcePattern(tt.pattern, tt.resource); got != tt.want {
+				t.Errorf("MatchResourcePattern(%q, %q) = %v, want %v", tt.pattern, tt.resource, got, tt.want)
+			}
+		})
+	}
+}
+
+// O índice por prefixo só funciona se todo padrão que casa com o recurso tiver
+// seu prefixo entre os consultados
+func TestResourcePatternPrefixesFindMatches(t *testing.T) {
+	for _, tt := range resourcePatternTests {
+		if !tt.want {
+			continue
+		}
+
+		prefix := ResourcePatternPrefix(tt.pattern)
+		if !containsPrefix(ResourcePatternPrefixes(tt.resource), prefix) {
+			t.Errorf("%q matches %q, but its prefix %q is not among %q",
+				tt.pattern, tt.resource, prefix, ResourcePatternPrefixes(tt.resource))
+		}
+	}
+}
+
+func containsPrefix(prefixes []string, prefix string) bool {
+	for _, p := range prefixes {
+		if p == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+func TestResourcePatternPrefix(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"project:42", "project:42:"},
+		{"project:*", "project:"},
+		{"project:4*:doc", "project:"},
+		{"project:42:**", "project:42:"},
+		{"**:doc", ""},
+		{"*", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ResourcePatternPrefix(tt.pattern); got != tt.want {
+			t.Errorf("ResourcePatternPrefix(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestResourceLineage(t *testing.T) {
+	tests := []struct {
+		resource string
+		lineage  []string
+		prefixes []string
+	}{
+		{
+			"project:42:doc",
+			[]string{"project", "project:42", "project:42:doc"},
+			[]string{"", "project:", "project:42:", "project:42:doc:"},
+		},
+		{"project", []string{"project"}, []string{"", "project:"}},
+	}
+
+	for _, tt := range tests {
+		if got := ResourceLineage(tt.resource); !reflect.DeepEqual(got, tt.lineage) {
+			t.Errorf("ResourceLineage(%q) = %q, want %q", tt.resource, got, tt.lineage)
+		}
+		if got := ResourcePatternPrefixes(tt.resource); !reflect.DeepEqual(got, tt.prefixes) {
+			t.Errorf("ResourcePatternPrefixes(%q) = %q, want %q", tt.resource, got, tt.prefixes)
+		}
+	}
+}
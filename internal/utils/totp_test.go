@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// Segredo ASCII "12345678901234567890" dos vetores de teste da RFC 6238
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := TOTPCode(rfcTOTPSecret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode: %v", err)
+		}
+		if code != tt.want {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, code, tt.want)
+		}
+	}
+
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("TOTPCode accepted an invalid secret")
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := TOTPStep(now)
+
+	for _, tt := range []struct {
+		offset int64
+		skew   int
+		want   bool
+	}{
+		{0, 0, true},
+		{-1, 0, false},
+		{-1, 1, true},
+		{1, 1, true},
+		{2, 1, false},
+		{-2, 1, false},
+		{-2, 2, true},
+	} {
+		code, _ := TOTPCode(rfcTOTPSecret, step+tt.offset)
+
+		matched, ok := VerifyTOTP(rfcTOTPSecret, code, now, tt.skew)
+		if ok != tt.want {
+			t.Errorf("VerifyTOTP with offset %d and skew %d = %v, want %v", tt.offset, tt.skew, ok, tt.want)
+		}
+		if ok && matched != step+tt.offset {
+			t.Errorf("VerifyTOTP matched step %d, want %d", matched, step+tt.offset)
+		}
+	}
+
+	for _, code := range []string{"", "00592", "0059240", "abcdef"} {
+		if _, ok := VerifyTOTP(rfcTOTPSecret, code, now, 1); ok {
+			t.Errorf("VerifyTOTP accepted %q", code)
+		}
+	}
+}